@@ -1,30 +1,99 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
 	"github.com/gin-gonic/gin"
-	"github.com/gosimple/slug"
+	"log"
 	"net/http"
 )
 
 func main() {
-	// Cria um roteador Gin
-	router := gin.Default()
+	storeKind := flag.String("store", "mem", "tipo da loja de receitas: mem, file ou sql")
+	dataDir := flag.String("data-dir", "data", "diretório usado pela loja quando -store=file ou -store=sql")
+	autoSuffix := flag.Bool("auto-suffix", false, "cria receitas com nome repetido com um sufixo (-2, -3, ...) em vez de responder 409")
+	trashTTL := flag.Duration("trash-ttl", service.DefaultTrashTTL, "por quanto tempo uma receita removida fica na lixeira antes de ser apagada de vez")
+	allergens := flag.String("allergens", "", "arquivo JSON que estende a taxonomia de alérgenos padrão")
+	substitutions := flag.String("substitutions", "", "arquivo JSON ou YAML que estende a base de substituições de ingredientes")
+	flag.Parse()
 
-	// Instancia o recipe handler e provisiona uma implementação da store de dados
-	store := recipes.NewMemStore()
-	recipesHandler := NewRecipeHandler(store)
+	// Provisiona uma implementação da store de dados e o serviço
+	store, err := service.OpenStore(*storeKind, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := service.New(store)
+	svc.AutoSuffix = *autoSuffix
+	svc.TrashTTL = *trashTTL
+	if *allergens != "" {
+		if svc.Taxonomy, err = recipes.LoadTaxonomy(*allergens); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Os alérgenos gravados podem ter vindo de outra taxonomia
+	if _, err := svc.DetectAllergens(); err != nil {
+		log.Fatal(err)
+	}
+	if *substitutions != "" {
+		if svc.Substitutions, err = recipes.LoadSubstitutions(*substitutions); err != nil {
+			log.Fatal(err)
+		}
+	}
+	go svc.RunPurge(context.Background())
+
+	// Inicia o servidor
+	newRouter(svc, gin.Logger(), gin.Recovery()).Run()
+}
+
+// newRouter - Cria um roteador Gin com os middlewares informados e registra as rotas
+func newRouter(svc *service.Service, middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware...)
+
+	// Respostas de erro no mesmo formato JSON dos outros servidores
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		abortWithProblem(c, recipes.NotFoundErr)
+	})
+	router.NoMethod(func(c *gin.Context) {
+		abortWithProblem(c, service.MethodNotAllowedErr)
+	})
+
+	// Instancia o recipe handler
+	recipesHandler := NewRecipeHandler(svc)
 
 	// Registra Rotas
 	router.GET("/", homePage)
 	router.GET("/receitas", recipesHandler.ListRecipes)
 	router.POST("/receitas", recipesHandler.CreateRecipe)
+	router.GET("/receitas/match", recipesHandler.MatchRecipes)
+	router.POST("/receitas/match", recipesHandler.MatchRecipes)
+	router.GET("/receitas/search", recipesHandler.SearchRecipes)
+	router.GET("/receitas/facets", recipesHandler.ListFacets)
+	router.GET("/receitas/trash", recipesHandler.ListTrash)
+	router.POST("/receitas/trash/:id/restore", recipesHandler.RestoreTrashed)
 	router.GET("/receitas/:id", recipesHandler.GetRecipe)
 	router.PUT("/receitas/:id", recipesHandler.UpdateRecipe)
+	router.PATCH("/receitas/:id", recipesHandler.PatchRecipe)
 	router.DELETE("/receitas/:id", recipesHandler.DeleteRecipe)
+	router.GET("/receitas/:id/revisions", recipesHandler.ListRevisions)
+	router.GET("/receitas/:id/revisions/:n", recipesHandler.GetRevision)
+	router.GET("/receitas/:id/revisions/:n/diff", recipesHandler.DiffRevisions)
+	router.POST("/receitas/:id/revisions/:n/restore", recipesHandler.RestoreRevision)
+	router.POST("/receitas/:id/rename", recipesHandler.RenameRecipe)
+	router.GET("/receitas/:id/substitutions", recipesHandler.SuggestSubstitutions)
+	router.POST("/shopping-lists", recipesHandler.CreateShoppingList)
+	router.GET("/planos", recipesHandler.ListPlans)
+	router.POST("/planos", recipesHandler.CreatePlan)
+	router.POST("/planos/generate", recipesHandler.GeneratePlan)
+	router.GET("/planos/:id", recipesHandler.GetPlan)
+	router.PUT("/planos/:id", recipesHandler.UpdatePlan)
+	router.DELETE("/planos/:id", recipesHandler.DeletePlan)
 
-	// Inicia o servidor
-	router.Run()
+	return router
 }
 
 func homePage(c *gin.Context) {
@@ -32,87 +101,467 @@ func homePage(c *gin.Context) {
 }
 
 type RecipesHandler struct {
-	store recipeStore
+	service *service.Service
 }
 
-func NewRecipeHandler(s recipeStore) *RecipesHandler {
+func NewRecipeHandler(svc *service.Service) *RecipesHandler {
 	return &RecipesHandler{
-		store: s,
+		service: svc,
 	}
 }
 
-type recipeStore interface {
-	Add(name string, recipe recipes.Recipe) error
-	Get(name string) (recipes.Recipe, error)
-	List() (map[string]recipes.Recipe, error)
-	Update(name string, recipe recipes.Recipe) error
-	Remove(name string) error
+// abortWithProblem - responde o erro como application/problem+json, igual aos
+// outros servidores
+func abortWithProblem(c *gin.Context, err error) {
+	problem := service.NewProblem(err, c.Request.URL.Path)
+	c.Header("Content-Type", service.ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
 }
 
-// Definindo a assinatura das funções handler
+// Definindo a assinatura das funções handler. Cada handler só converte a
+// requisição do gin para o serviço e o resultado de volta para JSON
 
 func (h RecipesHandler) CreateRecipe(c *gin.Context) {
 	// Pega o corpo da requisição e converte em recipes.Recipe
-	var recipe recipes.Recipe
-	if err := c.ShouldBindJSON(&recipe); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	recipe, err := service.DecodeRecipe(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
 		return
 	}
 
-	id := slug.Make(recipe.Name)
-
-	h.store.Add(id, recipe)
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	created, err := h.service.Create(recipe, opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	c.Header("Location", service.Location(created.ID))
+	c.Header("ETag", service.ETag(created))
+	c.JSON(http.StatusCreated, created)
 }
+
+// ListRecipes - Lista as receitas página a página, com o cabeçalho Link
+// apontando para as páginas seguinte e anterior
 func (h RecipesHandler) ListRecipes(c *gin.Context) {
-	r, err := h.store.List()
+	opts, err := service.ListOptionsFromQuery(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	page, err := h.service.ListPage(opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	if link := service.LinkHeader(c.Request.URL, page); link != "" {
+		c.Header("Link", link)
+	}
+
+	c.JSON(http.StatusOK, page.Recipes)
+}
+
+// ListFacets - Quantas receitas têm cada categoria, restrição alimentar,
+// tag e ingrediente, com os mesmos filtros da listagem
+func (h RecipesHandler) ListFacets(c *gin.Context) {
+	opts, err := service.ListOptionsFromQuery(c.Request.URL.Query())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithProblem(c, err)
+		return
 	}
 
-	c.JSON(200, r)
+	facets, err := h.service.Facets(opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, facets)
 }
+
 func (h RecipesHandler) GetRecipe(c *gin.Context) {
 	id := c.Param("id")
 
-	recipe, err := h.store.Get(id)
+	// ?servings=4&units=metric devolvem uma cópia ajustada da receita
+	opts, err := service.ViewOptionsFromQuery(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	recipe, err := h.service.View(id, opts)
+	if errors.Is(err, recipes.NotFoundErr) {
+		// O ID antigo de uma receita renomeada redireciona para o atual
+		if to, err := h.service.Alias(id); err == nil {
+			c.Redirect(http.StatusMovedPermanently, service.MovedLocation(to, c.Request.URL.RawQuery))
+			return
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		abortWithProblem(c, err)
+		return
 	}
 
-	c.JSON(200, recipe)
+	// Se o cliente já tem esta versão, não precisa recebê-la de novo
+	etag := service.ViewETag(recipe, opts)
+	c.Header("ETag", etag)
+	if !service.ParseCondition(c.Request.Header.Values("If-None-Match")).NoneMatch(etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, recipe)
 }
 func (h RecipesHandler) UpdateRecipe(c *gin.Context) {
-	var recipe recipes.Recipe
-	if err := c.ShouldBindJSON(&recipe); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	recipe, err := service.DecodeRecipe(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
 		return
 	}
 	id := c.Param("id")
 
-	err := h.store.Update(id, recipe)
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
 	if err != nil {
-		if err == recipes.NotFoundErr {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithProblem(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	updated, err := h.service.Update(id, recipe, opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", service.ETag(updated))
+	c.JSON(http.StatusOK, updated)
 }
+
+// PatchRecipe - Altera parte da receita com um merge patch
+// (application/merge-patch+json) ou JSON Patch (application/json-patch+json)
+func (h RecipesHandler) PatchRecipe(c *gin.Context) {
+	patch, err := service.DecodePatch(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	id := c.Param("id")
+
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	patched, err := h.service.Patch(id, patch, opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", service.ETag(patched))
+	c.JSON(http.StatusOK, patched)
+}
+
+// DeleteRecipe - Move a receita para a lixeira; com ?permanent=true, apaga
+// de vez
 func (h RecipesHandler) DeleteRecipe(c *gin.Context) {
 	id := c.Param("id")
 
-	err := h.store.Remove(id)
+	opts, err := service.DeleteOptionsFromRequest(c.Request.URL.Query(), c.Request.Header)
 	if err != nil {
-		if err == recipes.NotFoundErr {
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abortWithProblem(c, err)
+		return
+	}
+	if err := h.service.Delete(id, opts); err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ListRevisions - O histórico da receita, sem o conteúdo de cada revisão
+func (h RecipesHandler) ListRevisions(c *gin.Context) {
+	revisions, err := h.service.Revisions(c.Param("id"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetRevision - Uma revisão, com a receita completa como ela estava
+func (h RecipesHandler) GetRevision(c *gin.Context) {
+	number, err := service.ParseRevisionNumber(c.Param("n"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	revision, err := h.service.Revision(c.Param("id"), number)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffRevisions - O que mudou até a revisão, a partir da anterior ou de ?from=
+func (h RecipesHandler) DiffRevisions(c *gin.Context) {
+	to, err := service.ParseRevisionNumber(c.Param("n"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	from, err := service.DiffFromQuery(c.Request.URL.Query(), to)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	diff, err := h.service.DiffRevisions(c.Param("id"), from, to)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, diff)
+}
+
+// RestoreRevision - Volta a receita para uma revisão, gravando uma revisão nova
+func (h RecipesHandler) RestoreRevision(c *gin.Context) {
+	number, err := service.ParseRevisionNumber(c.Param("n"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	restored, err := h.service.Restore(c.Param("id"), number, opts)
+	if err != nil {
+		abortWithProblem(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "success"})
+	c.Header("ETag", service.ETag(restored))
+	c.JSON(http.StatusOK, restored)
+}
+
+// RenameRecipe - Troca o nome da receita e o ID junto; o ID antigo passa a
+// redirecionar para o novo
+func (h RecipesHandler) RenameRecipe(c *gin.Context) {
+	name, err := service.DecodeRename(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	renamed, err := h.service.Rename(c.Param("id"), name, opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("Location", service.Location(renamed.ID))
+	c.Header("ETag", service.ETag(renamed))
+	c.JSON(http.StatusOK, renamed)
+}
+
+// SuggestSubstitutions - A receita com os ingredientes de ?missing=
+// trocados pelos substitutos conhecidos, e a lista das trocas
+func (h RecipesHandler) SuggestSubstitutions(c *gin.Context) {
+	missing, err := service.MissingFromQuery(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	result, err := h.service.Substitute(c.Param("id"), missing)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// CreateShoppingList - A lista de compras das receitas do corpo, em JSON,
+// texto ou Markdown conforme ?format= ou o cabeçalho Accept
+func (h RecipesHandler) CreateShoppingList(c *gin.Context) {
+	format, err := service.ShoppingListFormatFrom(c.Request.URL.Query(), c.GetHeader("Accept"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	req, err := service.DecodeShoppingListRequest(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	list, err := h.service.ShoppingList(req)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	contentType, body, err := service.RenderShoppingList(list, format)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// ListPlans - Os planos de refeições, pela ordem dos IDs
+func (h RecipesHandler) ListPlans(c *gin.Context) {
+	plans, err := h.service.ListPlans()
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// CreatePlan - Grava um plano com as receitas de cada dia e refeição
+func (h RecipesHandler) CreatePlan(c *gin.Context) {
+	plan, err := service.DecodePlan(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	created, err := h.service.CreatePlan(plan)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("Location", service.PlanLocation(created.ID))
+	c.Header("ETag", service.PlanETag(created))
+	c.JSON(http.StatusCreated, created)
+}
+
+// GeneratePlan - Monta e grava um plano com as receitas que cumprem as
+// restrições do corpo
+func (h RecipesHandler) GeneratePlan(c *gin.Context) {
+	req, err := service.DecodeGeneratePlanRequest(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	created, err := h.service.GeneratePlan(req)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("Location", service.PlanLocation(created.ID))
+	c.Header("ETag", service.PlanETag(created))
+	c.JSON(http.StatusCreated, created)
+}
+
+// GetPlan - O plano, com avisos para as receitas removidas
+func (h RecipesHandler) GetPlan(c *gin.Context) {
+	plan, err := h.service.GetPlan(c.Param("id"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", service.PlanETag(plan))
+	c.JSON(http.StatusOK, plan)
+}
+
+func (h RecipesHandler) UpdatePlan(c *gin.Context) {
+	plan, err := service.DecodePlan(c.GetHeader("Content-Type"), c.Request.Body)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	updated, err := h.service.UpdatePlan(c.Param("id"), plan, opts)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", service.PlanETag(updated))
+	c.JSON(http.StatusOK, updated)
+}
+
+func (h RecipesHandler) DeletePlan(c *gin.Context) {
+	opts, err := service.WriteOptionsFromHeader(c.Request.Header)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	if err := h.service.DeletePlan(c.Param("id"), opts); err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// ListTrash - As receitas na lixeira, das removidas mais recentemente para
+// as mais antigas
+func (h RecipesHandler) ListTrash(c *gin.Context) {
+	trash, err := h.service.Trash()
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreTrashed - Devolve a receita da lixeira, como ela estava
+func (h RecipesHandler) RestoreTrashed(c *gin.Context) {
+	restored, err := h.service.Untrash(c.Param("id"))
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+	c.Header("ETag", service.ETag(restored))
+	c.JSON(http.StatusOK, restored)
+}
+
+// MatchRecipes - Ordena as receitas pelos ingredientes que o usuário tem,
+// recebidos via ?have=pão,queijo (GET) ou como recipes.Pantry em JSON (POST)
+func (h RecipesHandler) MatchRecipes(c *gin.Context) {
+	var req service.MatchRequest
+	var err error
+	if c.Request.Method == http.MethodPost {
+		req, err = service.DecodeMatchRequest(c.GetHeader("Content-Type"), c.Request.Body, c.Request.URL.Query())
+	} else {
+		req, err = service.MatchRequestFromQuery(c.Request.URL.Query())
+	}
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	matches, err := h.service.Match(req)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, matches)
+}
+
+// SearchRecipes - Busca textual nas receitas: GET /receitas/search?q=pao de queijo
+func (h RecipesHandler) SearchRecipes(c *gin.Context) {
+	req, err := service.SearchRequestFromQuery(c.Request.URL.Query())
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	results, err := h.service.Search(req)
+	if err != nil {
+		abortWithProblem(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
 }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/conformance"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestConformance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conformance.Run(t, func(svc *service.Service) http.Handler {
+		return newRouter(svc)
+	})
+}
@@ -1,170 +1,560 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
 	"github.com/gorilla/mux"
-	"github.com/gosimple/slug"
+	"log"
 	"net/http"
 )
 
 type MiddlewareFunc func(http.Handler) http.Handler
 
 func main() {
-	// Cria a Store e o Recipe Handler
-	store := recipes.NewMemStore()
-	// Cria o roteador
+	storeKind := flag.String("store", "mem", "tipo da loja de receitas: mem, file ou sql")
+	dataDir := flag.String("data-dir", "data", "diretório usado pela loja quando -store=file ou -store=sql")
+	autoSuffix := flag.Bool("auto-suffix", false, "cria receitas com nome repetido com um sufixo (-2, -3, ...) em vez de responder 409")
+	trashTTL := flag.Duration("trash-ttl", service.DefaultTrashTTL, "por quanto tempo uma receita removida fica na lixeira antes de ser apagada de vez")
+	allergens := flag.String("allergens", "", "arquivo JSON que estende a taxonomia de alérgenos padrão")
+	substitutions := flag.String("substitutions", "", "arquivo JSON ou YAML que estende a base de substituições de ingredientes")
+	flag.Parse()
+
+	// Cria a Store e o serviço
+	store, err := service.OpenStore(*storeKind, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := service.New(store)
+	svc.AutoSuffix = *autoSuffix
+	svc.TrashTTL = *trashTTL
+	if *allergens != "" {
+		if svc.Taxonomy, err = recipes.LoadTaxonomy(*allergens); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Os alérgenos gravados podem ter vindo de outra taxonomia
+	if _, err := svc.DetectAllergens(); err != nil {
+		log.Fatal(err)
+	}
+	if *substitutions != "" {
+		if svc.Substitutions, err = recipes.LoadSubstitutions(*substitutions); err != nil {
+			log.Fatal(err)
+		}
+	}
+	go svc.RunPurge(context.Background())
+
+	// Inicia o servidor
+	err = http.ListenAndServe(":8010", newRouter(svc))
+	if err != nil {
+		return
+	}
+}
+
+// newRouter - Cria o roteador e registra as rotas
+func newRouter(svc *service.Service) *mux.Router {
 	router := mux.NewRouter()
 	//router.HandleFunc("/", &home{})
 	//router.Use("/", loggingMiddleware)
 
-	s := router.PathPrefix("/receitas").Subrouter()
+	// Respostas de erro no mesmo formato JSON dos outros servidores
+	router.NotFoundHandler = http.HandlerFunc(service.NotFoundHandler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(service.MethodNotAllowedHandler)
 
 	// Registra as rotas
-	NewRecipesHandler(store, s)
+	NewRecipesHandler(svc, router)
 
-	// Inicia o servidor
-	err := http.ListenAndServe(":8010", router)
-	if err != nil {
-		return
-	}
+	return router
 }
 
-func NewRecipesHandler(s recipeStore, router *mux.Router) *RecipesHandler {
+func NewRecipesHandler(svc *service.Service, router *mux.Router) *RecipesHandler {
 	handler := &RecipesHandler{
-		store: s,
+		service: svc,
 	}
 
-	router.HandleFunc("/", handler.ListRecipes).Methods("GET")
-	router.HandleFunc("/", handler.CreateRecipe).Methods("POST")
-	router.HandleFunc("/{id}", handler.GetRecipe).Methods("GET")
-	router.HandleFunc("/{id}", handler.UpdateRecipe).Methods("PUT")
-	router.HandleFunc("/{id}", handler.DeleteRecipe).Methods("DELETE")
+	s := router.PathPrefix("/receitas").Subrouter()
+
+	// Atende /receitas e /receitas/, como nos outros servidores. Fica no
+	// roteador principal, registrada depois do subrouter, porque dentro do
+	// subrouter o caminho sem a barra final responderia 404 em vez de 405
+	router.HandleFunc("/receitas{slash:/?}", handler.ListRecipes).Methods("GET")
+	router.HandleFunc("/receitas{slash:/?}", handler.CreateRecipe).Methods("POST")
+
+	// As rotas de match, search, facets e trash precisam vir antes de
+	// /{id}, senão seriam tratadas como IDs
+	s.HandleFunc("/match", handler.MatchRecipes).Methods("GET", "POST")
+	s.HandleFunc("/search", handler.SearchRecipes).Methods("GET")
+	s.HandleFunc("/facets", handler.ListFacets).Methods("GET")
+	s.HandleFunc("/trash", handler.ListTrash).Methods("GET")
+	s.HandleFunc("/{id}", handler.GetRecipe).Methods("GET")
+	s.HandleFunc("/{id}", handler.UpdateRecipe).Methods("PUT")
+	s.HandleFunc("/{id}", handler.PatchRecipe).Methods("PATCH")
+	s.HandleFunc("/{id}", handler.DeleteRecipe).Methods("DELETE")
+
+	// As rotas do histórico também ficam no roteador principal: no subrouter,
+	// o prefixo /receitas que elas herdam desfaz o 405 de /{id} e um método
+	// errado em /receitas/{id} responderia 404
+	router.HandleFunc("/receitas/{id}/revisions", handler.ListRevisions).Methods("GET")
+	router.HandleFunc("/receitas/{id}/revisions/{n}", handler.GetRevision).Methods("GET")
+	router.HandleFunc("/receitas/{id}/revisions/{n}/diff", handler.DiffRevisions).Methods("GET")
+	router.HandleFunc("/receitas/{id}/revisions/{n}/restore", handler.RestoreRevision).Methods("POST")
+	router.HandleFunc("/receitas/{id}/rename", handler.RenameRecipe).Methods("POST")
+	router.HandleFunc("/receitas/{id}/substitutions", handler.SuggestSubstitutions).Methods("GET")
+	router.HandleFunc("/receitas/trash/{id}/restore", handler.RestoreTrashed).Methods("POST")
+	router.HandleFunc("/shopping-lists", handler.CreateShoppingList).Methods("POST")
+	router.HandleFunc("/planos{slash:/?}", handler.ListPlans).Methods("GET")
+	router.HandleFunc("/planos{slash:/?}", handler.CreatePlan).Methods("POST")
+	router.HandleFunc("/planos/generate", handler.GeneratePlan).Methods("POST")
+	router.HandleFunc("/planos/{id}", handler.GetPlan).Methods("GET")
+	router.HandleFunc("/planos/{id}", handler.UpdatePlan).Methods("PUT")
+	router.HandleFunc("/planos/{id}", handler.DeletePlan).Methods("DELETE")
 
 	return handler
 }
 
-func InternalServerErrorHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	_, err := w.Write([]byte("500 Internal Server Error"))
+type RecipesHandler struct {
+	service *service.Service
+}
+
+func (h RecipesHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	// objeto da receita que vai ser populado pelo JSON payload
+	recipe, err := service.DecodeRecipe(r.Header.Get("Content-Type"), r.Body)
 	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-}
 
-func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	_, err := w.Write([]byte("404 Not Found"))
+	opts, err := service.WriteOptionsFromHeader(r.Header)
 	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	created, err := h.service.Create(recipe, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-}
-
-type RecipesHandler struct {
-	store recipeStore
-}
 
-type recipeStore interface {
-	Add(name string, recipe recipes.Recipe) error
-	Get(name string) (recipes.Recipe, error)
-	List() (map[string]recipes.Recipe, error)
-	Update(name string, recipe recipes.Recipe) error
-	Remove(name string) error
+	w.Header().Set("Location", service.Location(created.ID))
+	w.Header().Set("ETag", service.ETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
 }
 
-func (h RecipesHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
-	// objeto da receita que vai ser populado pelo JSON payload
-	var recipe recipes.Recipe
+// ListRecipes - Lista as receitas página a página, com o cabeçalho Link
+// apontando para as páginas seguinte e anterior
+func (h RecipesHandler) ListRecipes(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.ListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+	page, err := h.service.ListPage(opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
+	if link := service.LinkHeader(r.URL, page); link != "" {
+		w.Header().Set("Link", link)
+	}
 
-	// Cria uma URL mais fácil de entender pra usar como ID
-	resourceID := slug.Make(recipe.Name)
+	service.WriteJSON(w, http.StatusOK, page.Recipes)
+}
 
-	if err := h.store.Add(resourceID, recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+// ListFacets - Quantas receitas têm cada categoria, restrição alimentar,
+// tag e ingrediente, com os mesmos filtros da listagem
+func (h RecipesHandler) ListFacets(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.ListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-}
-func (h RecipesHandler) ListRecipes(w http.ResponseWriter, r *http.Request) {
-	recipes, err := h.store.List()
 
-	jsonBytes, err := json.Marshal(recipes)
+	facets, err := h.service.Facets(opts)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
+	service.WriteJSON(w, http.StatusOK, facets)
 }
+
 func (h RecipesHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
 	// Quando o ID da receita (slug) é passado como parâmetro, use mux.Vars() com a requisição como parâmetro.
 	// Essa função retorna um mapa de parâmetros correspondentes com o padrão da URL definida no router (nesse caso
 	// id de /receitas/{id}).
 	id := mux.Vars(r)["id"]
 
-	recipe, err := h.store.Get(id)
+	// ?servings=4&units=metric devolvem uma cópia ajustada da receita
+	opts, err := service.ViewOptionsFromQuery(r.URL.Query())
 	if err != nil {
-		if err == recipes.NotFoundErr {
-			NotFoundHandler(w, r)
+		service.WriteError(w, r, err)
+		return
+	}
+
+	recipe, err := h.service.View(id, opts)
+	if errors.Is(err, recipes.NotFoundErr) {
+		// O ID antigo de uma receita renomeada redireciona para o atual
+		if to, err := h.service.Alias(id); err == nil {
+			http.Redirect(w, r, service.MovedLocation(to, r.URL.RawQuery), http.StatusMovedPermanently)
 			return
 		}
+	}
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
 
-		InternalServerErrorHandler(w, r)
+	// Se o cliente já tem esta versão, não precisa recebê-la de novo
+	etag := service.ViewETag(recipe, opts)
+	w.Header().Set("ETag", etag)
+	if !service.ParseCondition(r.Header.Values("If-None-Match")).NoneMatch(etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	service.WriteJSON(w, http.StatusOK, recipe)
+}
+func (h RecipesHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	jsonBytes, err := json.Marshal(recipe)
+	// Recebe objeto que vai ser populado pelo JSON
+	recipe, err := service.DecodeRecipe(r.Header.Get("Content-Type"), r.Body)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	updated, err := h.service.Update(id, recipe, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", service.ETag(updated))
+	service.WriteJSON(w, http.StatusOK, updated)
 }
-func (h RecipesHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+
+// PatchRecipe - Altera parte da receita com um merge patch
+// (application/merge-patch+json) ou JSON Patch (application/json-patch+json)
+func (h RecipesHandler) PatchRecipe(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	// Recebe objeto que vai ser populado pelo JSON
-	var recipe recipes.Recipe
-	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+	patch, err := service.DecodePatch(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	if err := h.store.Update(id, recipe); err != nil {
-		if err == recipes.NotFoundErr {
-			NotFoundHandler(w, r)
-			return
-		}
-		InternalServerErrorHandler(w, r)
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-	jsonBytes, err := json.Marshal(recipe)
+	patched, err := h.service.Patch(id, patch, opts)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
+	w.Header().Set("ETag", service.ETag(patched))
+	service.WriteJSON(w, http.StatusOK, patched)
 }
 
+// DeleteRecipe - Move a receita para a lixeira; com ?permanent=true, apaga
+// de vez
 func (h RecipesHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 
-	if err := h.store.Remove(id); err != nil {
-		InternalServerErrorHandler(w, r)
+	opts, err := service.DeleteOptionsFromRequest(r.URL.Query(), r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	if err := h.service.Delete(id, opts); err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListRevisions - O histórico da receita, sem o conteúdo de cada revisão
+func (h RecipesHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := h.service.Revisions(mux.Vars(r)["id"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, revisions)
+}
+
+// GetRevision - Uma revisão, com a receita completa como ela estava
+func (h RecipesHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	number, err := service.ParseRevisionNumber(mux.Vars(r)["n"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	revision, err := h.service.Revision(mux.Vars(r)["id"], number)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, revision)
+}
+
+// DiffRevisions - O que mudou até a revisão, a partir da anterior ou de ?from=
+func (h RecipesHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	to, err := service.ParseRevisionNumber(mux.Vars(r)["n"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	from, err := service.DiffFromQuery(r.URL.Query(), to)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	diff, err := h.service.DiffRevisions(mux.Vars(r)["id"], from, to)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, diff)
+}
+
+// RestoreRevision - Volta a receita para uma revisão, gravando uma revisão nova
+func (h RecipesHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	number, err := service.ParseRevisionNumber(mux.Vars(r)["n"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	restored, err := h.service.Restore(mux.Vars(r)["id"], number, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.ETag(restored))
+	service.WriteJSON(w, http.StatusOK, restored)
+}
+
+// RenameRecipe - Troca o nome da receita e o ID junto; o ID antigo passa a
+// redirecionar para o novo
+func (h RecipesHandler) RenameRecipe(w http.ResponseWriter, r *http.Request) {
+	name, err := service.DecodeRename(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	renamed, err := h.service.Rename(mux.Vars(r)["id"], name, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.Location(renamed.ID))
+	w.Header().Set("ETag", service.ETag(renamed))
+	service.WriteJSON(w, http.StatusOK, renamed)
+}
+
+// SuggestSubstitutions - A receita com os ingredientes de ?missing=
+// trocados pelos substitutos conhecidos, e a lista das trocas
+func (h RecipesHandler) SuggestSubstitutions(w http.ResponseWriter, r *http.Request) {
+	missing, err := service.MissingFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	result, err := h.service.Substitute(mux.Vars(r)["id"], missing)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, result)
+}
+
+// CreateShoppingList - A lista de compras das receitas do corpo, em JSON,
+// texto ou Markdown conforme ?format= ou o cabeçalho Accept
+func (h RecipesHandler) CreateShoppingList(w http.ResponseWriter, r *http.Request) {
+	format, err := service.ShoppingListFormatFrom(r.URL.Query(), r.Header.Get("Accept"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	req, err := service.DecodeShoppingListRequest(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	list, err := h.service.ShoppingList(req)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
+	contentType, body, err := service.RenderShoppingList(list, format)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteContent(w, http.StatusOK, contentType, body)
+}
 
+// ListPlans - Os planos de refeições, pela ordem dos IDs
+func (h RecipesHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.service.ListPlans()
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, plans)
+}
+
+// CreatePlan - Grava um plano com as receitas de cada dia e refeição
+func (h RecipesHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := service.DecodePlan(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	created, err := h.service.CreatePlan(plan)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.PlanLocation(created.ID))
+	w.Header().Set("ETag", service.PlanETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GeneratePlan - Monta e grava um plano com as receitas que cumprem as
+// restrições do corpo
+func (h RecipesHandler) GeneratePlan(w http.ResponseWriter, r *http.Request) {
+	req, err := service.DecodeGeneratePlanRequest(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	created, err := h.service.GeneratePlan(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.PlanLocation(created.ID))
+	w.Header().Set("ETag", service.PlanETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GetPlan - O plano, com avisos para as receitas removidas
+func (h RecipesHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.service.GetPlan(mux.Vars(r)["id"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.PlanETag(plan))
+	service.WriteJSON(w, http.StatusOK, plan)
+}
+
+func (h RecipesHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := service.DecodePlan(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	updated, err := h.service.UpdatePlan(mux.Vars(r)["id"], plan, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.PlanETag(updated))
+	service.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h RecipesHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	if err := h.service.DeletePlan(mux.Vars(r)["id"], opts); err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
+// ListTrash - As receitas na lixeira, das removidas mais recentemente para
+// as mais antigas
+func (h RecipesHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.service.Trash()
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, trash)
+}
+
+// RestoreTrashed - Devolve a receita da lixeira, como ela estava
+func (h RecipesHandler) RestoreTrashed(w http.ResponseWriter, r *http.Request) {
+	restored, err := h.service.Untrash(mux.Vars(r)["id"])
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.ETag(restored))
+	service.WriteJSON(w, http.StatusOK, restored)
+}
+
+// MatchRecipes - Ordena as receitas pelos ingredientes que o usuário tem,
+// recebidos via ?have=pão,queijo (GET) ou como recipes.Pantry em JSON (POST)
+func (h RecipesHandler) MatchRecipes(w http.ResponseWriter, r *http.Request) {
+	var req service.MatchRequest
+	var err error
+	if r.Method == http.MethodPost {
+		req, err = service.DecodeMatchRequest(r.Header.Get("Content-Type"), r.Body, r.URL.Query())
+	} else {
+		req, err = service.MatchRequestFromQuery(r.URL.Query())
+	}
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	matches, err := h.service.Match(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	service.WriteJSON(w, http.StatusOK, matches)
+}
+
 type homeHandler struct{}
 
 func (h *homeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -173,3 +563,20 @@ func (h *homeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// SearchRecipes - Busca textual nas receitas: GET /receitas/search?q=pao de queijo
+func (h RecipesHandler) SearchRecipes(w http.ResponseWriter, r *http.Request) {
+	req, err := service.SearchRequestFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	results, err := h.service.Search(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	service.WriteJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/conformance"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(svc *service.Service) http.Handler {
+		return newRouter(svc)
+	})
+}
@@ -1,47 +1,69 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	recipes "github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
-	"github.com/gosimple/slug"
+	"flag"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+	"log"
 	"net/http"
-	"regexp"
-)
-
-// As duas regexes diferenciam os dois possíveis URIs (/recipes vs. /recipes/<id>)
-var (
-	RecipeRe       = regexp.MustCompile(`^/receitas/*$`)
-	RecipeReWithID = regexp.MustCompile(`^/receitas/([a-z0-9]+(?:-[a-z0-9]+)+)$`)
 )
 
 func main() {
-	// Cria a Store e o Recipe Handler
-	store := recipes.NewMemStore()
-	recipesHandler := NewRecipesHandler(store)
+	storeKind := flag.String("store", "mem", "tipo da loja de receitas: mem, file ou sql")
+	dataDir := flag.String("data-dir", "data", "diretório usado pela loja quando -store=file ou -store=sql")
+	autoSuffix := flag.Bool("auto-suffix", false, "cria receitas com nome repetido com um sufixo (-2, -3, ...) em vez de responder 409")
+	trashTTL := flag.Duration("trash-ttl", service.DefaultTrashTTL, "por quanto tempo uma receita removida fica na lixeira antes de ser apagada de vez")
+	allergens := flag.String("allergens", "", "arquivo JSON que estende a taxonomia de alérgenos padrão")
+	substitutions := flag.String("substitutions", "", "arquivo JSON ou YAML que estende a base de substituições de ingredientes")
+	flag.Parse()
+
+	// Cria a Store e o serviço
+	store, err := service.OpenStore(*storeKind, *dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := service.New(store)
+	svc.AutoSuffix = *autoSuffix
+	svc.TrashTTL = *trashTTL
+	if *allergens != "" {
+		if svc.Taxonomy, err = recipes.LoadTaxonomy(*allergens); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// Os alérgenos gravados podem ter vindo de outra taxonomia
+	if _, err := svc.DetectAllergens(); err != nil {
+		log.Fatal(err)
+	}
+	if *substitutions != "" {
+		if svc.Substitutions, err = recipes.LoadSubstitutions(*substitutions); err != nil {
+			log.Fatal(err)
+		}
+	}
+	go svc.RunPurge(context.Background())
 
-	// Cria um multiplexador de requisições
-	// Recebe solicitações HTTP e as envia para os handlers correspondentes
-	mux := http.NewServeMux()
-	// Registra as rotas e os handlers
-	mux.Handle("/", &homeHandler{})
-	mux.Handle("/receitas", recipesHandler)
-	mux.Handle("/receitas/", recipesHandler)
 	// Executa o servidor
-	err := http.ListenAndServe(":8080", mux)
+	err = http.ListenAndServe(":8080", newMux(svc))
 	if err != nil {
 		return
 	}
 }
 
-func InternalServerErrorHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte("500 Internal Server Error"))
-}
+// newMux - Cria um multiplexador de requisições, que recebe solicitações HTTP
+// e as envia para os handlers correspondentes
+func newMux(svc *service.Service) *http.ServeMux {
+	recipesHandler := NewRecipesHandler(svc)
 
-func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("404 Not Found"))
+	// Registra as rotas e os handlers
+	mux := http.NewServeMux()
+	mux.Handle("/", &homeHandler{})
+	mux.Handle("/receitas", recipesHandler)
+	mux.Handle("/receitas/", recipesHandler)
+	mux.Handle("/shopping-lists", recipesHandler)
+	mux.Handle("/planos", recipesHandler)
+	mux.Handle("/planos/", recipesHandler)
+	return mux
 }
 
 type homeHandler struct{}
@@ -50,158 +72,510 @@ type homeHandler struct{}
 // ServeHTTP(w http.ResponseWriter, r *http.Request). Portanto, para criar um
 // handler, é necessário criar uma estrutura (struct) e implementar o método ServeHTTP
 func (h *homeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// O padrão "/" do ServeMux recebe qualquer caminho que não tenha outro handler
+	if r.URL.Path != "/" {
+		service.NotFoundHandler(w, r)
+		return
+	}
 	w.Write([]byte("Bem-vindo à página inicial!"))
 }
 
-type recipeStore interface {
-	Add(name string, recipe recipes.Recipe) error
-	Get(name string) (recipes.Recipe, error)
-	Update(name string, recipe recipes.Recipe) error
-	List() (map[string]recipes.Recipe, error)
-	Remove(name string) error
-}
-
-// RecipesHandler - implementa http.Handler e despacha requisições para a loja
+// RecipesHandler - implementa http.Handler e despacha requisições para o serviço
 type RecipesHandler struct {
-	store recipeStore
+	service *service.Service
+	router  *Router
 }
 
-func NewRecipesHandler(s recipeStore) *RecipesHandler {
-	return &RecipesHandler{
-		store: s,
+func NewRecipesHandler(svc *service.Service) *RecipesHandler {
+	h := &RecipesHandler{
+		service: svc,
+		router:  NewRouter(),
 	}
+
+	// Roteamento (Routing)
+	h.router.Handle(http.MethodGet, "/receitas", h.ListRecipes)
+	h.router.Handle(http.MethodPost, "/receitas", h.CreateRecipe)
+	h.router.Handle(http.MethodGet, "/receitas/match", h.MatchRecipes)
+	h.router.Handle(http.MethodPost, "/receitas/match", h.MatchRecipes)
+	h.router.Handle(http.MethodGet, "/receitas/search", h.SearchRecipes)
+	h.router.Handle(http.MethodGet, "/receitas/facets", h.ListFacets)
+	h.router.Handle(http.MethodGet, "/receitas/trash", h.ListTrash)
+	h.router.Handle(http.MethodPost, "/receitas/trash/{id}/restore", h.RestoreTrashed)
+	h.router.Handle(http.MethodGet, "/receitas/{id}", h.GetRecipe)
+	h.router.Handle(http.MethodPut, "/receitas/{id}", h.UpdateRecipe)
+	h.router.Handle(http.MethodPatch, "/receitas/{id}", h.PatchRecipe)
+	h.router.Handle(http.MethodDelete, "/receitas/{id}", h.DeleteRecipe)
+	h.router.Handle(http.MethodGet, "/receitas/{id}/revisions", h.ListRevisions)
+	h.router.Handle(http.MethodGet, "/receitas/{id}/revisions/{n}", h.GetRevision)
+	h.router.Handle(http.MethodGet, "/receitas/{id}/revisions/{n}/diff", h.DiffRevisions)
+	h.router.Handle(http.MethodPost, "/receitas/{id}/revisions/{n}/restore", h.RestoreRevision)
+	h.router.Handle(http.MethodPost, "/receitas/{id}/rename", h.RenameRecipe)
+	h.router.Handle(http.MethodGet, "/receitas/{id}/substitutions", h.SuggestSubstitutions)
+	h.router.Handle(http.MethodPost, "/shopping-lists", h.CreateShoppingList)
+	h.router.Handle(http.MethodGet, "/planos", h.ListPlans)
+	h.router.Handle(http.MethodPost, "/planos", h.CreatePlan)
+	h.router.Handle(http.MethodPost, "/planos/generate", h.GeneratePlan)
+	h.router.Handle(http.MethodGet, "/planos/{id}", h.GetPlan)
+	h.router.Handle(http.MethodPut, "/planos/{id}", h.UpdatePlan)
+	h.router.Handle(http.MethodDelete, "/planos/{id}", h.DeletePlan)
+
+	return h
 }
 
-// Roteamento (Routing)
 func (h *RecipesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch {
-	case r.Method == http.MethodPost && RecipeRe.MatchString(r.URL.Path):
-		h.CreateRecipe(w, r)
+	h.router.ServeHTTP(w, r)
+}
+
+// CreateRecipe - Lê os arquivos JSON transportados pelo corpo da requisição HTTP
+// e converte em uma instância de recipes.Recipe
+func (h *RecipesHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, err := service.DecodeRecipe(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
-	case r.Method == http.MethodGet && RecipeRe.MatchString(r.URL.Path):
-		h.ListRecipes(w, r)
+	}
+	created, err := h.service.Create(recipe, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
-	case r.Method == http.MethodGet && RecipeReWithID.MatchString(r.URL.Path):
-		h.GetRecipe(w, r)
+	}
+
+	// Responde 201 com o endereço e o conteúdo da receita criada
+	w.Header().Set("Location", service.Location(created.ID))
+	w.Header().Set("ETag", service.ETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
+}
+
+// ListRecipes - Lista as receitas página a página. A query string escolhe
+// a ordenação, os filtros e o tamanho da página; o cabeçalho Link aponta
+// para as páginas seguinte e anterior
+func (h *RecipesHandler) ListRecipes(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.ListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
-	case r.Method == http.MethodPut && RecipeReWithID.MatchString(r.URL.Path):
-		h.UpdateRecipe(w, r)
+	}
+
+	// Retorna uma página de receitas da loja
+	page, err := h.service.ListPage(opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
-	case r.Method == http.MethodDelete && RecipeReWithID.MatchString(r.URL.Path):
-		h.DeleteRecipe(w, r)
+	}
+	if link := service.LinkHeader(r.URL, page); link != "" {
+		w.Header().Set("Link", link)
+	}
+	// Converte a página em JSON e adiciona à resposta HTTP
+	service.WriteJSON(w, http.StatusOK, page.Recipes)
+}
+
+// ListFacets - Quantas receitas têm cada categoria, restrição alimentar,
+// tag e ingrediente, com os mesmos filtros da listagem
+func (h *RecipesHandler) ListFacets(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.ListOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
-	default:
+	}
+
+	facets, err := h.service.Facets(opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
+	service.WriteJSON(w, http.StatusOK, facets)
 }
 
-// CreateRecipe - Lê os arquivos JSON transportados pelo corpo da requisição HTTP
-// e converte em uma instância de recipes.Recipe
-func (h *RecipesHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
-	// Objeto de receita que vai ser populado pelos dados JSON
-	var recipe recipes.Recipe
-	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+func (h *RecipesHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
+	// ?servings=4&units=metric devolvem uma cópia ajustada da receita
+	opts, err := service.ViewOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	// Converte o nome da receita em uma string URL mais amigável
-	resourceID := slug.Make(recipe.Name)
-	if err := h.store.Add(resourceID, recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+	// Recebe o nome do recurso via URL com /receitas/slug-nome-receita
+	id := PathParam(r, "id")
+	recipe, err := h.service.View(id, opts)
+	if errors.Is(err, recipes.NotFoundErr) {
+		// O ID antigo de uma receita renomeada redireciona para o atual
+		if to, err := h.service.Alias(id); err == nil {
+			http.Redirect(w, r, service.MovedLocation(to, r.URL.RawQuery), http.StatusMovedPermanently)
+			return
+		}
+	}
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	// Define o status code para 200
-	w.WriteHeader(http.StatusOK)
+	// Se o cliente já tem esta versão, não precisa recebê-la de novo
+	etag := service.ViewETag(recipe, opts)
+	w.Header().Set("ETag", etag)
+	if !service.ParseCondition(r.Header.Values("If-None-Match")).NoneMatch(etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, recipe)
 }
 
-func (h *RecipesHandler) ListRecipes(w http.ResponseWriter, r *http.Request) {
-	// Retorna as receitas da loja
-	resources, err := h.store.List()
-	// Converte a lista retornada em JSON usando a função Marshal
-	jsonBytes, err := json.Marshal(resources)
+func (h *RecipesHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	recipe, err := service.DecodeRecipe(r.Header.Get("Content-Type"), r.Body)
 	if err != nil {
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	updated, err := h.service.Update(PathParam(r, "id"), recipe, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", service.ETag(updated))
+	service.WriteJSON(w, http.StatusOK, updated)
+}
+
+// PatchRecipe - Altera parte da receita. O Content-Type escolhe o formato:
+// application/merge-patch+json (RFC 7386) ou application/json-patch+json
+// (RFC 6902)
+func (h *RecipesHandler) PatchRecipe(w http.ResponseWriter, r *http.Request) {
+	patch, err := service.DecodePatch(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	patched, err := h.service.Patch(PathParam(r, "id"), patch, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", service.ETag(patched))
+	service.WriteJSON(w, http.StatusOK, patched)
+}
+
+// DeleteRecipe - Move a receita para a lixeira; com ?permanent=true, apaga
+// de vez
+func (h *RecipesHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.DeleteOptionsFromRequest(r.URL.Query(), r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	if err := h.service.Delete(PathParam(r, "id"), opts); err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-	// Adiciona os dados em JSON para a resposta HTTP usando a função Write
 	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
 }
 
-func (h *RecipesHandler) GetRecipe(w http.ResponseWriter, r *http.Request) {
-	// Recebe o nome do recurso via URl com /recipes/slug-nome-receita
-	matches := RecipeReWithID.FindStringSubmatch(r.URL.Path)
+// ListRevisions - O histórico da receita, da revisão mais antiga para a
+// mais nova, sem o conteúdo de cada uma
+func (h *RecipesHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := h.service.Revisions(PathParam(r, "id"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, revisions)
+}
 
-	// Espera que as correspondências sejam length >= 2 (full str + 1 grupo)
-	if len(matches) < 2 {
-		InternalServerErrorHandler(w, r)
+// GetRevision - Uma revisão, com a receita completa como ela estava
+func (h *RecipesHandler) GetRevision(w http.ResponseWriter, r *http.Request) {
+	number, err := service.ParseRevisionNumber(PathParam(r, "n"))
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	// A primeira correspondência ou match ao chamar FindStringSubmatch
-	// é sempre a string correspondente completa e, em seguida, todos os
-	// subgrupos. Olhando para a regex RecipeReWithID, o primeiro grupo
-	// correspondente é o ID do recurso. Só precisamos chamar a função
-	// Get da loja com esse ID
-	recipe, err := h.store.Get(matches[1])
+	revision, err := h.service.Revision(PathParam(r, "id"), number)
 	if err != nil {
-		// caso especial de erro NotFound
-		if errors.Is(err, recipes.NotFoundErr) {
-			NotFoundHandler(w, r)
-			return
-		}
-		// Qualquer outro erro
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
 		return
 	}
-	// Converte a struct em dados JSON
-	jsonBytes, err := json.Marshal(recipe)
+	service.WriteJSON(w, http.StatusOK, revision)
+}
+
+// DiffRevisions - O que mudou até a revisão {n}, a partir da anterior ou
+// da revisão pedida em ?from=
+func (h *RecipesHandler) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	to, err := service.ParseRevisionNumber(PathParam(r, "n"))
 	if err != nil {
-		InternalServerErrorHandler(w, r)
+		service.WriteError(w, r, err)
+		return
+	}
+	from, err := service.DiffFromQuery(r.URL.Query(), to)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	// Adiciona os dados em JSON para a resposta HTTP usando a função Write
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
+	diff, err := h.service.DiffRevisions(PathParam(r, "id"), from, to)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, diff)
 }
 
-func (h *RecipesHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
-	matches := RecipeReWithID.FindStringSubmatch(r.URL.Path)
-	if len(matches) < 2 {
-		InternalServerErrorHandler(w, r)
+// RestoreRevision - Volta a receita para a revisão {n}, gravando uma
+// revisão nova
+func (h *RecipesHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	number, err := service.ParseRevisionNumber(PathParam(r, "n"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	var recipe recipes.Recipe
-	if err := json.NewDecoder(r.Body).Decode(&recipe); err != nil {
-		InternalServerErrorHandler(w, r)
+	restored, err := h.service.Restore(PathParam(r, "id"), number, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	if err := h.store.Update(matches[1], recipe); err != nil {
-		if errors.Is(recipes.NotFoundErr, err) {
-			NotFoundHandler(w, r)
-			return
-		}
-		InternalServerErrorHandler(w, r)
+	w.Header().Set("ETag", service.ETag(restored))
+	service.WriteJSON(w, http.StatusOK, restored)
+}
+
+// RenameRecipe - Troca o nome da receita e o ID junto; o ID antigo passa a
+// redirecionar para o novo
+func (h *RecipesHandler) RenameRecipe(w http.ResponseWriter, r *http.Request) {
+	name, err := service.DecodeRename(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	renamed, err := h.service.Rename(PathParam(r, "id"), name, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.Location(renamed.ID))
+	w.Header().Set("ETag", service.ETag(renamed))
+	service.WriteJSON(w, http.StatusOK, renamed)
 }
 
-func (h *RecipesHandler) DeleteRecipe(w http.ResponseWriter, r *http.Request) {
-	matches := RecipeReWithID.FindStringSubmatch(r.URL.Path)
-	if len(matches) < 2 {
-		InternalServerErrorHandler(w, r)
+// SuggestSubstitutions - A receita com os ingredientes de ?missing=
+// trocados pelos substitutos conhecidos, e a lista das trocas
+func (h *RecipesHandler) SuggestSubstitutions(w http.ResponseWriter, r *http.Request) {
+	missing, err := service.MissingFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
-	if err := h.store.Remove(matches[1]); err != nil {
-		InternalServerErrorHandler(w, r)
+	result, err := h.service.Substitute(PathParam(r, "id"), missing)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, result)
+}
+
+// CreateShoppingList - A lista de compras das receitas do corpo, em JSON,
+// texto ou Markdown conforme ?format= ou o cabeçalho Accept
+func (h *RecipesHandler) CreateShoppingList(w http.ResponseWriter, r *http.Request) {
+	format, err := service.ShoppingListFormatFrom(r.URL.Query(), r.Header.Get("Accept"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	req, err := service.DecodeShoppingListRequest(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	list, err := h.service.ShoppingList(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	contentType, body, err := service.RenderShoppingList(list, format)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteContent(w, http.StatusOK, contentType, body)
+}
+
+// ListPlans - Os planos de refeições, pela ordem dos IDs
+func (h *RecipesHandler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.service.ListPlans()
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, plans)
+}
+
+// CreatePlan - Grava um plano com as receitas de cada dia e refeição
+func (h *RecipesHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := service.DecodePlan(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	created, err := h.service.CreatePlan(plan)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.PlanLocation(created.ID))
+	w.Header().Set("ETag", service.PlanETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GeneratePlan - Monta e grava um plano com as receitas que cumprem as
+// restrições do corpo
+func (h *RecipesHandler) GeneratePlan(w http.ResponseWriter, r *http.Request) {
+	req, err := service.DecodeGeneratePlanRequest(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	created, err := h.service.GeneratePlan(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", service.PlanLocation(created.ID))
+	w.Header().Set("ETag", service.PlanETag(created))
+	service.WriteJSON(w, http.StatusCreated, created)
+}
+
+// GetPlan - O plano, com avisos para as receitas removidas
+func (h *RecipesHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := h.service.GetPlan(PathParam(r, "id"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.PlanETag(plan))
+	service.WriteJSON(w, http.StatusOK, plan)
+}
+
+func (h *RecipesHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	plan, err := service.DecodePlan(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	updated, err := h.service.UpdatePlan(PathParam(r, "id"), plan, opts)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.PlanETag(updated))
+	service.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *RecipesHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	opts, err := service.WriteOptionsFromHeader(r.Header)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	if err := h.service.DeletePlan(PathParam(r, "id"), opts); err != nil {
+		service.WriteError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// ListTrash - As receitas na lixeira, das removidas mais recentemente para
+// as mais antigas
+func (h *RecipesHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	trash, err := h.service.Trash()
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	service.WriteJSON(w, http.StatusOK, trash)
+}
+
+// RestoreTrashed - Devolve a receita da lixeira, como ela estava
+func (h *RecipesHandler) RestoreTrashed(w http.ResponseWriter, r *http.Request) {
+	restored, err := h.service.Untrash(PathParam(r, "id"))
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", service.ETag(restored))
+	service.WriteJSON(w, http.StatusOK, restored)
+}
+
+// MatchRecipes - Ordena as receitas pelos ingredientes que o usuário tem.
+// GET /receitas/match?have=pão,queijo recebe a despensa pela query string e
+// POST /receitas/match recebe um recipes.Pantry em JSON
+func (h *RecipesHandler) MatchRecipes(w http.ResponseWriter, r *http.Request) {
+	var req service.MatchRequest
+	var err error
+	if r.Method == http.MethodPost {
+		req, err = service.DecodeMatchRequest(r.Header.Get("Content-Type"), r.Body, r.URL.Query())
+	} else {
+		req, err = service.MatchRequestFromQuery(r.URL.Query())
+	}
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	matches, err := h.service.Match(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	service.WriteJSON(w, http.StatusOK, matches)
+}
+
+// SearchRecipes - Busca textual nas receitas: GET /receitas/search?q=pao de queijo
+func (h *RecipesHandler) SearchRecipes(w http.ResponseWriter, r *http.Request) {
+	req, err := service.SearchRequestFromQuery(r.URL.Query())
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	results, err := h.service.Search(req)
+	if err != nil {
+		service.WriteError(w, r, err)
+		return
+	}
+
+	service.WriteJSON(w, http.StatusOK, results)
+}
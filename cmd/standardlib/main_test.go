@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/conformance"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -24,7 +28,7 @@ func TestRecipesHandlerCRUD_Integration(t *testing.T) {
 
 	//	Cria uma MemStore e um Recipe Handler
 	store := recipes.NewMemStore()
-	recipesHandler := NewRecipesHandler(store)
+	recipesHandler := NewRecipesHandler(service.New(store))
 
 	//	Testa os dados
 	queijoEPresunto := readTestData(t, "receita_queijo_e_presunto.json")
@@ -40,13 +44,14 @@ func TestRecipesHandlerCRUD_Integration(t *testing.T) {
 
 	result := w.Result()
 	defer result.Body.Close()
-	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, 201, result.StatusCode)
+	assert.Equal(t, "/receitas/torrada-de-presunto-e-queijo", result.Header.Get("Location"))
 
 	saved, _ := store.List()
 	assert.Len(t, saved, 1)
 
 	// GET - Encontra o registro criado no CREATE
-	req = httptest.NewRequest(http.MethodGet, "/receitas/torrada-de-queijo-e-presunto", queijoEPresuntoReader)
+	req = httptest.NewRequest(http.MethodGet, "/receitas/torrada-de-presunto-e-queijo", queijoEPresuntoReader)
 	w = httptest.NewRecorder()
 	recipesHandler.ServeHTTP(w, req)
 
@@ -59,10 +64,14 @@ func TestRecipesHandlerCRUD_Integration(t *testing.T) {
 		t.Errorf("Erro inesperado: %v", err)
 	}
 
-	assert.JSONEq(t, string(queijoEPresunto), string(data))
+	var got recipes.Recipe
+	assert.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, "torrada-de-presunto-e-queijo", got.ID)
+	assert.Equal(t, "Torrada de presunto e queijo", got.Name)
+	assert.Len(t, got.Ingredients, 3)
 
 	// UPDATE - adiciona manteiga à receita
-	req = httptest.NewRequest(http.MethodPut, "/receitas/torrada-de-queijo-e-presunto", queijoPresuntoComManteigaReader)
+	req = httptest.NewRequest(http.MethodPut, "/receitas/torrada-de-presunto-e-queijo", queijoPresuntoComManteigaReader)
 	w = httptest.NewRecorder()
 	recipesHandler.ServeHTTP(w, req)
 
@@ -70,13 +79,13 @@ func TestRecipesHandlerCRUD_Integration(t *testing.T) {
 	defer result.Body.Close()
 	assert.Equal(t, 200, result.StatusCode)
 
-	updatePresuntoEQueijo, err := store.Get("torrada-de-queijo-e-presunto")
+	updatePresuntoEQueijo, err := store.Get("torrada-de-presunto-e-queijo")
 	assert.NoError(t, err)
 
 	assert.Contains(t, updatePresuntoEQueijo.Ingredients, recipes.Ingredient{Name: "manteiga"})
 
 	//DELETE - remove a receita da torrada
-	req = httptest.NewRequest(http.MethodDelete, "/receitas/torrada-de-queijo-e-presunto", nil)
+	req = httptest.NewRequest(http.MethodDelete, "/receitas/torrada-de-presunto-e-queijo", nil)
 	w = httptest.NewRecorder()
 	recipesHandler.ServeHTTP(w, req)
 
@@ -88,3 +97,48 @@ func TestRecipesHandlerCRUD_Integration(t *testing.T) {
 	assert.Len(t, saved, 0)
 
 }
+
+func TestRecipesHandlerMatch_Integration(t *testing.T) {
+	store := recipes.NewMemStore()
+	recipesHandler := NewRecipesHandler(service.New(store))
+
+	for _, name := range []string{"receita_queijo_e_presunto.json", "receita_queijo_presunto_com_manteiga.json"} {
+		req := httptest.NewRequest(http.MethodPost, "/receitas", bytes.NewReader(readTestData(t, name)))
+		w := httptest.NewRecorder()
+		recipesHandler.ServeHTTP(w, req)
+		assert.Equal(t, 201, w.Code)
+	}
+
+	// GET - despensa pela query string
+	req := httptest.NewRequest(http.MethodGet, "/receitas/match?have=pao,queijo,presunto", nil)
+	w := httptest.NewRecorder()
+	recipesHandler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	var matches recipes.Matches
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &matches))
+	if assert.Len(t, matches.Exact, 1) {
+		assert.Equal(t, "torrada-de-presunto-e-queijo", matches.Exact[0].ID)
+	}
+	if assert.Len(t, matches.NearMisses, 1) {
+		assert.Equal(t, []string{"manteiga"}, matches.NearMisses[0].Missing)
+	}
+
+	// POST - despensa em JSON
+	req = httptest.NewRequest(http.MethodPost, "/receitas/match", strings.NewReader(`{"ingredients":[{"name":"pão"},{"name":"queijo"}],"max_missing":0}`))
+	w = httptest.NewRecorder()
+	recipesHandler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+
+	matches = recipes.Matches{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &matches))
+	assert.Len(t, matches.Exact, 0)
+	assert.Len(t, matches.NearMisses, 0)
+	assert.Len(t, matches.Partial, 2)
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(svc *service.Service) http.Handler {
+		return newMux(svc)
+	})
+}
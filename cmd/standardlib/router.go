@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+)
+
+// Router - tabela de rotas com parâmetros de caminho, feita só com a
+// biblioteca padrão. Os padrões são divididos em segmentos; um segmento
+// "{nome}" aceita qualquer valor não vazio e fica disponível em PathParam.
+//
+// Quando mais de uma rota aceita o caminho, vale a mais específica: no
+// primeiro segmento em que elas diferem, o literal ("/receitas/match")
+// ganha do parâmetro ("/receitas/{id}"), qualquer que seja a ordem de
+// registro. Quando o caminho existe, mas não com o método pedido, a
+// resposta é 405 com o cabeçalho Allow. HEAD é atendido pelo handler de
+// GET (sem corpo) e OPTIONS responde apenas com o Allow
+type Router struct {
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+
+	routes []*route
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.HandlerFunc
+	methods  []string // na ordem de registro, para o cabeçalho Allow
+}
+
+func NewRouter() *Router {
+	return &Router{
+		NotFound:         http.HandlerFunc(service.NotFoundHandler),
+		MethodNotAllowed: http.HandlerFunc(service.MethodNotAllowedHandler),
+	}
+}
+
+// Handle - registra o handler para o método e o padrão informados
+func (rt *Router) Handle(method, pattern string, handler http.HandlerFunc) {
+	segments := splitPath(pattern)
+	for _, r := range rt.routes {
+		if equalSegments(r.segments, segments) {
+			r.add(method, handler)
+			return
+		}
+	}
+
+	r := &route{segments: segments, handlers: make(map[string]http.HandlerFunc)}
+	r.add(method, handler)
+	rt.routes = append(rt.routes, r)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := splitPath(r.URL.Path)
+
+	var best *route
+	var params map[string]string
+	for _, candidate := range rt.routes {
+		p, ok := candidate.match(segments)
+		if ok && (best == nil || candidate.moreSpecific(best)) {
+			best, params = candidate, p
+		}
+	}
+
+	switch {
+	case best == nil:
+		rt.NotFound.ServeHTTP(w, r)
+	case best.handler(r.Method) != nil:
+		if r.Method == http.MethodHead && best.handlers[http.MethodHead] == nil {
+			w = headResponseWriter{w}
+		}
+		best.handler(r.Method)(w, r.WithContext(context.WithValue(r.Context(), paramsKey{}, params)))
+	case r.Method == http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(best.allow(), ", "))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", strings.Join(best.allow(), ", "))
+		rt.MethodNotAllowed.ServeHTTP(w, r)
+	}
+}
+
+type paramsKey struct{}
+
+// PathParam - valor do parâmetro {name} da rota que atendeu a requisição
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func (r *route) add(method string, handler http.HandlerFunc) {
+	if _, ok := r.handlers[method]; !ok {
+		r.methods = append(r.methods, method)
+	}
+	r.handlers[method] = handler
+}
+
+// handler - o handler do método, ou o de GET quando o método é HEAD.
+// OPTIONS sem handler próprio é respondido pelo Router
+func (r *route) handler(method string) http.HandlerFunc {
+	if handler, ok := r.handlers[method]; ok {
+		return handler
+	}
+	if method == http.MethodHead {
+		return r.handlers[http.MethodGet]
+	}
+	return nil
+}
+
+// allow - métodos aceitos pela rota, incluindo os automáticos
+func (r *route) allow() []string {
+	methods := append([]string(nil), r.methods...)
+	if _, ok := r.handlers[http.MethodGet]; ok {
+		methods = appendMethods(methods, http.MethodHead)
+	}
+	return appendMethods(methods, http.MethodOptions)
+}
+
+func (r *route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if name, ok := paramName(segment); ok {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+			continue
+		}
+		if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// moreSpecific - r ganha de other no primeiro segmento em que um é literal
+// e o outro é parâmetro. As duas rotas precisam aceitar o mesmo caminho
+func (r *route) moreSpecific(other *route) bool {
+	for i, segment := range r.segments {
+		_, param := paramName(segment)
+		_, otherParam := paramName(other.segments[i])
+		if param != otherParam {
+			return otherParam
+		}
+	}
+	return false
+}
+
+// splitPath - "/receitas/" e "/receitas" são o mesmo caminho, como nas
+// regexes que o roteador substituiu
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func paramName(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func equalSegments(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func appendMethods(methods []string, more ...string) []string {
+	for _, method := range more {
+		found := false
+		for _, m := range methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// headResponseWriter - descarta o corpo escrito pelo handler de GET ao
+// responder um HEAD, mantendo status e cabeçalhos
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
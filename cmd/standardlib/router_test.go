@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	store := recipes.NewMemStore()
+	store.Add("lasanha", recipes.Recipe{Name: "Lasanha", Ingredients: []recipes.Ingredient{{Name: "massa"}}})
+	handler := newMux(service.New(store))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+		wantBody   bool
+	}{
+		{name: "Single-word ID", method: http.MethodGet, path: "/receitas/lasanha", wantStatus: http.StatusOK, wantBody: true},
+		{name: "Trailing slash", method: http.MethodGet, path: "/receitas/", wantStatus: http.StatusOK, wantBody: true},
+		{name: "HEAD uses GET without body", method: http.MethodHead, path: "/receitas/lasanha", wantStatus: http.StatusOK},
+		{name: "HEAD on missing ID", method: http.MethodHead, path: "/receitas/ratatouille", wantStatus: http.StatusNotFound},
+		{name: "OPTIONS on collection", method: http.MethodOptions, path: "/receitas", wantStatus: http.StatusNoContent, wantAllow: "GET, POST, HEAD, OPTIONS"},
+		{name: "OPTIONS on ID", method: http.MethodOptions, path: "/receitas/lasanha", wantStatus: http.StatusNoContent, wantAllow: "GET, PUT, PATCH, DELETE, HEAD, OPTIONS"},
+		{name: "Wrong method on collection", method: http.MethodDelete, path: "/receitas", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, POST, HEAD, OPTIONS", wantBody: true},
+		{name: "Wrong method on ID", method: http.MethodPost, path: "/receitas/lasanha", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, PUT, PATCH, DELETE, HEAD, OPTIONS", wantBody: true},
+		// A rota literal ganha de /receitas/{id}; "match" não pode ser um ID
+		{name: "Wrong method on match", method: http.MethodConnect, path: "/receitas/match", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, POST, HEAD, OPTIONS", wantBody: true},
+		{name: "PUT on match", method: http.MethodPut, path: "/receitas/match", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, POST, HEAD, OPTIONS", wantBody: true},
+		{name: "Unknown path", method: http.MethodGet, path: "/receitas/lasanha/ingredientes", wantStatus: http.StatusNotFound, wantBody: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantAllow, w.Header().Get("Allow"))
+			assert.Equal(t, tt.wantBody, w.Body.Len() > 0)
+		})
+	}
+}
+
+func TestPathParam(t *testing.T) {
+	router := NewRouter()
+	var got string
+	router.Handle(http.MethodGet, "/receitas/{id}/passos/{n}", func(w http.ResponseWriter, r *http.Request) {
+		got = PathParam(r, "id") + " " + PathParam(r, "n") + PathParam(r, "inexistente")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/receitas/bolo-3-leites/passos/2", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bolo-3-leites 2", got)
+}
@@ -0,0 +1,297 @@
+package recipes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gosimple/slug"
+)
+
+// Allergen - uma classe de alérgenos ("gluten", "dairy")
+type Allergen struct {
+	// Key - o valor gravado em Recipe.Allergens e usado no filtro
+	// ?exclude_allergen=
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	// Aliases - outros nomes aceitos no filtro ("lactose" para "dairy")
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// TaxonomyFile - o formato do arquivo de taxonomia (LoadTaxonomy)
+type TaxonomyFile struct {
+	// Replace - descarta a taxonomia padrão em vez de estendê-la
+	Replace   bool       `json:"replace,omitempty"`
+	Allergens []Allergen `json:"allergens,omitempty"`
+	// Ingredients - nome do ingrediente -> classes que ele contém. Uma lista
+	// vazia marca um ingrediente sem alérgenos, para corrigir um nome mais
+	// curto ("leite de coco" não é "leite")
+	Ingredients map[string][]string `json:"ingredients,omitempty"`
+}
+
+// Taxonomy - as classes de alérgenos e os ingredientes que as contêm, com
+// os nomes em português e em inglês. Um ingrediente da receita contém um
+// termo da taxonomia quando tem todas as palavras dele, sem acentos e
+// aceitando o plural ("ovo" encontra "2 ovos caipiras"). Quando dois termos
+// aparecem e um contém o outro, vale o mais longo, então "leite de coco"
+// não conta como leite. É imutável depois de criada
+type Taxonomy struct {
+	allergens []Allergen
+	// classes - a chave e os apelidos de cada classe, normalizados -> chave
+	classes map[string]string
+	terms   []allergenTerm
+}
+
+// allergenTerm - um ingrediente da taxonomia, já separado em palavras
+type allergenTerm struct {
+	words     []string
+	allergens []string
+}
+
+// DefaultTaxonomy - os alérgenos de declaração obrigatória mais comuns e os
+// ingredientes em que eles aparecem com mais frequência. Não substitui a
+// leitura do rótulo: ingredientes industrializados podem conter o que o
+// nome não diz
+var DefaultTaxonomy = mustTaxonomy(TaxonomyFile{
+	Allergens: []Allergen{
+		{Key: "gluten", Name: "Glúten", Aliases: []string{"trigo", "wheat"}},
+		{Key: "dairy", Name: "Leite e derivados", Aliases: []string{"lactose", "leite", "laticinios", "milk"}},
+		{Key: "eggs", Name: "Ovos", Aliases: []string{"ovo", "ovos", "egg"}},
+		{Key: "peanuts", Name: "Amendoim", Aliases: []string{"amendoim", "peanut"}},
+		{Key: "tree-nuts", Name: "Castanhas e nozes", Aliases: []string{"castanhas", "nozes", "nuts"}},
+		{Key: "soy", Name: "Soja", Aliases: []string{"soja"}},
+		{Key: "fish", Name: "Peixes", Aliases: []string{"peixe", "peixes"}},
+		{Key: "shellfish", Name: "Crustáceos e frutos do mar", Aliases: []string{"crustaceos", "frutos do mar", "seafood"}},
+		{Key: "sesame", Name: "Gergelim", Aliases: []string{"gergelim"}},
+	},
+	Ingredients: map[string][]string{
+		// Glúten
+		"trigo": {"gluten"}, "wheat": {"gluten"}, "farinha": {"gluten"}, "flour": {"gluten"},
+		"pão": {"gluten"}, "pães": {"gluten"}, "bread": {"gluten"}, "torrada": {"gluten"},
+		"macarrão": {"gluten"}, "espaguete": {"gluten"}, "spaghetti": {"gluten"},
+		"lasanha": {"gluten"}, "cevada": {"gluten"}, "barley": {"gluten"}, "centeio": {"gluten"},
+		"rye": {"gluten"}, "malte": {"gluten"}, "malt": {"gluten"}, "cerveja": {"gluten"},
+		"beer": {"gluten"}, "aveia": {"gluten"}, "oats": {"gluten"}, "biscoito": {"gluten"},
+		"bolacha": {"gluten"}, "semolina": {"gluten"}, "sêmola": {"gluten"},
+		"cuscuz marroquino": {"gluten"}, "couscous": {"gluten"}, "breadcrumbs": {"gluten"},
+		// Farinhas sem glúten
+		"farinha de mandioca": {}, "farinha de milho": {}, "farinha de arroz": {},
+		"farinha de amêndoas": {"tree-nuts"}, "almond flour": {"tree-nuts"},
+		"rice flour": {}, "corn flour": {}, "pão de queijo": {"dairy", "eggs"},
+		// Leite e derivados
+		"leite": {"dairy"}, "milk": {"dairy"}, "queijo": {"dairy"}, "cheese": {"dairy"},
+		"manteiga": {"dairy"}, "butter": {"dairy"}, "creme de leite": {"dairy"}, "cream": {"dairy"},
+		"nata": {"dairy"}, "requeijão": {"dairy"}, "iogurte": {"dairy"}, "yogurt": {"dairy"},
+		"ricota": {"dairy"}, "ricotta": {"dairy"}, "mussarela": {"dairy"}, "muçarela": {"dairy"},
+		"mozzarella": {"dairy"}, "parmesão": {"dairy"}, "parmesan": {"dairy"}, "whey": {"dairy"},
+		"soro de leite": {"dairy"}, "chantilly": {"dairy"}, "ghee": {"dairy"}, "catupiry": {"dairy"},
+		// Leites e manteigas vegetais
+		"leite de coco": {}, "coconut milk": {}, "leite de amêndoas": {"tree-nuts"},
+		"almond milk": {"tree-nuts"}, "leite de soja": {"soy"}, "soy milk": {"soy"},
+		"leite de aveia": {"gluten"}, "oat milk": {"gluten"}, "manteiga de cacau": {},
+		"cocoa butter": {}, "coconut cream": {}, "manteiga de amendoim": {"peanuts"},
+		"pasta de amendoim": {"peanuts"}, "peanut butter": {"peanuts"},
+		// Ovos
+		"ovo": {"eggs"}, "egg": {"eggs"}, "gema": {"eggs"}, "clara": {"eggs"},
+		"maionese": {"eggs"}, "mayonnaise": {"eggs"},
+		// Amendoim
+		"amendoim": {"peanuts"}, "peanut": {"peanuts"}, "paçoca": {"peanuts"},
+		// Castanhas e nozes
+		"castanha": {"tree-nuts"}, "noz": {"tree-nuts"}, "walnut": {"tree-nuts"},
+		"amêndoa": {"tree-nuts"}, "almond": {"tree-nuts"}, "avelã": {"tree-nuts"},
+		"hazelnut": {"tree-nuts"}, "pistache": {"tree-nuts"}, "pistachio": {"tree-nuts"},
+		"macadâmia": {"tree-nuts"}, "pecã": {"tree-nuts"}, "pecan": {"tree-nuts"},
+		"cashew": {"tree-nuts"}, "noz moscada": {}, "nutmeg": {},
+		// Soja
+		"soja": {"soy"}, "soy": {"soy"}, "tofu": {"soy"}, "missô": {"soy"}, "miso": {"soy"},
+		"edamame": {"soy"}, "shoyu": {"soy", "gluten"}, "soy sauce": {"soy", "gluten"},
+		// Peixes
+		"peixe": {"fish"}, "fish": {"fish"}, "bacalhau": {"fish"}, "cod": {"fish"},
+		"salmão": {"fish"}, "salmon": {"fish"}, "atum": {"fish"}, "tuna": {"fish"},
+		"sardinha": {"fish"}, "sardine": {"fish"}, "tilápia": {"fish"}, "anchova": {"fish"},
+		"anchovy": {"fish"}, "anchovies": {"fish"},
+		// Crustáceos e frutos do mar
+		"camarão": {"shellfish"}, "camarões": {"shellfish"}, "shrimp": {"shellfish"},
+		"prawn": {"shellfish"}, "lagosta": {"shellfish"}, "lobster": {"shellfish"},
+		"caranguejo": {"shellfish"}, "crab": {"shellfish"}, "siri": {"shellfish"},
+		"lula": {"shellfish"}, "squid": {"shellfish"}, "polvo": {"shellfish"},
+		"octopus": {"shellfish"}, "mexilhão": {"shellfish"}, "mexilhões": {"shellfish"},
+		"mussel": {"shellfish"}, "marisco": {"shellfish"}, "ostra": {"shellfish"},
+		"oyster": {"shellfish"}, "clam": {"shellfish"}, "frutos do mar": {"shellfish"},
+		"seafood": {"shellfish"},
+		// Gergelim
+		"gergelim": {"sesame"}, "sesame": {"sesame"}, "tahine": {"sesame"}, "tahini": {"sesame"},
+	},
+})
+
+func mustTaxonomy(file TaxonomyFile) *Taxonomy {
+	taxonomy, err := (&Taxonomy{}).Extend(file)
+	if err != nil {
+		panic(err)
+	}
+	return taxonomy
+}
+
+// LoadTaxonomy - lê um arquivo JSON no formato de TaxonomyFile e estende a
+// DefaultTaxonomy com ele: classes novas são acrescentadas, classes e
+// ingredientes com o mesmo nome são substituídos
+func LoadTaxonomy(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file TaxonomyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("taxonomy %s: %w", path, err)
+	}
+	base := DefaultTaxonomy
+	if file.Replace {
+		base = &Taxonomy{}
+	}
+	taxonomy, err := base.Extend(file)
+	if err != nil {
+		return nil, fmt.Errorf("taxonomy %s: %w", path, err)
+	}
+	return taxonomy, nil
+}
+
+// Extend - uma taxonomia nova com as classes e os ingredientes de file
+// por cima dos de t. file.Replace é ignorado
+func (t *Taxonomy) Extend(file TaxonomyFile) (*Taxonomy, error) {
+	allergens := append([]Allergen(nil), t.allergens...)
+	for _, allergen := range file.Allergens {
+		allergen.Key = slug.Make(allergen.Key)
+		if allergen.Key == "" {
+			return nil, fmt.Errorf("allergen %q: key must contain at least one letter or digit", allergen.Name)
+		}
+		if allergen.Name == "" {
+			allergen.Name = allergen.Key
+		}
+		replaced := false
+		for i := range allergens {
+			if allergens[i].Key == allergen.Key {
+				allergens[i], replaced = allergen, true
+			}
+		}
+		if !replaced {
+			allergens = append(allergens, allergen)
+		}
+	}
+
+	extended := &Taxonomy{allergens: allergens, classes: make(map[string]string)}
+	for _, allergen := range allergens {
+		extended.classes[allergen.Key] = allergen.Key
+	}
+	// Os apelidos não escondem a chave de outra classe
+	for _, allergen := range allergens {
+		for _, alias := range allergen.Aliases {
+			if key := slug.Make(alias); key != "" && extended.classes[key] == "" {
+				extended.classes[key] = allergen.Key
+			}
+		}
+	}
+
+	terms := make(map[string][]string)
+	for _, term := range t.terms {
+		terms[strings.Join(term.words, "-")] = term.allergens
+	}
+	for name, classes := range file.Ingredients {
+		key := slug.Make(name)
+		if key == "" {
+			return nil, fmt.Errorf("ingredient %q must contain at least one letter or digit", name)
+		}
+		resolved := make([]string, 0, len(classes))
+		for _, class := range classes {
+			allergen, ok := extended.Lookup(class)
+			if !ok {
+				return nil, fmt.Errorf("ingredient %q: unknown allergen %q", name, class)
+			}
+			resolved = append(resolved, allergen.Key)
+		}
+		terms[key] = resolved
+	}
+	for key, classes := range terms {
+		extended.terms = append(extended.terms, allergenTerm{words: strings.Split(key, "-"), allergens: classes})
+	}
+	sort.Slice(extended.terms, func(i, j int) bool {
+		return strings.Join(extended.terms[i].words, "-") < strings.Join(extended.terms[j].words, "-")
+	})
+	return extended, nil
+}
+
+// Allergens - as classes conhecidas, na ordem em que foram declaradas
+func (t *Taxonomy) Allergens() []Allergen {
+	return append([]Allergen(nil), t.allergens...)
+}
+
+// Lookup - a classe pela chave ou por um dos apelidos ("lactose" encontra
+// "dairy")
+func (t *Taxonomy) Lookup(name string) (Allergen, bool) {
+	key, ok := t.classes[slug.Make(name)]
+	if !ok {
+		return Allergen{}, false
+	}
+	for _, allergen := range t.allergens {
+		if allergen.Key == key {
+			return allergen, true
+		}
+	}
+	return Allergen{}, false
+}
+
+// Detect - as chaves das classes presentes nos ingredientes da receita,
+// inclusive nos opcionais, em ordem alfabética; nil quando não há nenhuma
+func (t *Taxonomy) Detect(recipe Recipe) []string {
+	found := make(map[string]bool)
+	for _, ingredient := range recipe.Ingredients {
+		for _, allergen := range t.IngredientAllergens(ingredient.Name) {
+			found[allergen] = true
+		}
+	}
+	return sortedKeys(found)
+}
+
+// IngredientAllergens - as classes que o ingrediente contém, pelos termos
+// mais longos encontrados no nome, em ordem alfabética
+func (t *Taxonomy) IngredientAllergens(name string) []string {
+	words := wordSet(matchTokens(name))
+	var matched []allergenTerm
+	for _, term := range t.terms {
+		if hasWords(words, term.words) {
+			matched = append(matched, term)
+		}
+	}
+
+	found := make(map[string]bool)
+	for i, term := range matched {
+		shadowed := false
+		for j, other := range matched {
+			if i != j && len(other.words) > len(term.words) && hasWords(wordSet(other.words), term.words) {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			for _, allergen := range term.allergens {
+				found[allergen] = true
+			}
+		}
+	}
+	return sortedKeys(found)
+}
+
+// sortedKeys - as chaves do conjunto em ordem alfabética; nil quando ele
+// está vazio
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
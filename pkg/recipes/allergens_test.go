@@ -0,0 +1,149 @@
+package recipes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaxonomy_IngredientAllergens(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "queijo minas", want: []string{"dairy"}},
+		{name: "Pão francês", want: []string{"gluten"}},
+		{name: "farinha de trigo peneirada", want: []string{"gluten"}},
+		{name: "2 ovos caipiras", want: []string{"eggs"}},
+		{name: "unsalted butter", want: []string{"dairy"}},
+		{name: "nozes picadas", want: []string{"tree-nuts"}},
+		{name: "shoyu", want: []string{"gluten", "soy"}},
+		{name: "pão de queijo", want: []string{"dairy", "eggs"}},
+		{name: "pão com manteiga", want: []string{"dairy", "gluten"}},
+		// O termo mais longo corrige o mais curto
+		{name: "leite de coco", want: nil},
+		{name: "farinha de mandioca", want: nil},
+		{name: "noz-moscada", want: nil},
+		{name: "leite de amêndoas", want: []string{"tree-nuts"}},
+		{name: "cebola", want: nil},
+		{name: "", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DefaultTaxonomy.IngredientAllergens(tt.name))
+		})
+	}
+}
+
+func TestTaxonomy_Detect(t *testing.T) {
+	recipe := Recipe{Ingredients: []Ingredient{
+		{Name: "pão"},
+		{Name: "queijo"},
+		{Name: "presunto"},
+		{Name: "manteiga", Optional: true},
+	}}
+	assert.Equal(t, []string{"dairy", "gluten"}, DefaultTaxonomy.Detect(recipe))
+	assert.Nil(t, DefaultTaxonomy.Detect(Recipe{Ingredients: []Ingredient{{Name: "arroz"}}}))
+}
+
+func TestTaxonomy_Lookup(t *testing.T) {
+	for name, want := range map[string]string{
+		"gluten":        "gluten",
+		"Glúten":        "gluten",
+		"lactose":       "dairy",
+		"Frutos do Mar": "shellfish",
+		"tree-nuts":     "tree-nuts",
+	} {
+		allergen, ok := DefaultTaxonomy.Lookup(name)
+		require.True(t, ok, name)
+		assert.Equal(t, want, allergen.Key, name)
+	}
+	_, ok := DefaultTaxonomy.Lookup("mostarda")
+	assert.False(t, ok)
+}
+
+func TestLoadTaxonomy(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "allergens.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	t.Run("Extends the default", func(t *testing.T) {
+		taxonomy, err := LoadTaxonomy(write(t, `{
+			"allergens": [{"key": "mustard", "name": "Mostarda", "aliases": ["mostarda"]}],
+			"ingredients": {"mostarda Dijon": ["mostarda"], "maionese": ["eggs", "mustard"], "queijo vegano": []}
+		}`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"eggs", "mustard"}, taxonomy.IngredientAllergens("maionese caseira"))
+		assert.Equal(t, []string{"mustard"}, taxonomy.IngredientAllergens("mostarda dijon"))
+		assert.Nil(t, taxonomy.IngredientAllergens("queijo vegano"))
+		assert.Equal(t, []string{"dairy"}, taxonomy.IngredientAllergens("queijo"))
+		_, ok := taxonomy.Lookup("mostarda")
+		assert.True(t, ok)
+		assert.Len(t, taxonomy.Allergens(), len(DefaultTaxonomy.Allergens())+1)
+
+		// A taxonomia padrão não muda
+		assert.Equal(t, []string{"eggs"}, DefaultTaxonomy.IngredientAllergens("maionese caseira"))
+	})
+
+	t.Run("Replaces the default", func(t *testing.T) {
+		taxonomy, err := LoadTaxonomy(write(t, `{
+			"replace": true,
+			"allergens": [{"key": "celery", "name": "Aipo"}],
+			"ingredients": {"aipo": ["celery"], "salsão": ["celery"]}
+		}`))
+		require.NoError(t, err)
+		assert.Equal(t, []Allergen{{Key: "celery", Name: "Aipo"}}, taxonomy.Allergens())
+		assert.Equal(t, []string{"celery"}, taxonomy.IngredientAllergens("salsão"))
+		assert.Nil(t, taxonomy.IngredientAllergens("queijo"))
+	})
+
+	for _, tt := range []struct {
+		name, content, err string
+	}{
+		{name: "Malformed JSON", content: `{"ingredients": [`, err: "taxonomy"},
+		{name: "Unknown allergen", content: `{"ingredients": {"aipo": ["celery"]}}`, err: `ingredient "aipo": unknown allergen "celery"`},
+		{name: "Empty key", content: `{"allergens": [{"key": "!!", "name": "Nada"}]}`, err: `allergen "Nada": key must contain at least one letter or digit`},
+		{name: "Empty ingredient", content: `{"ingredients": {"": ["gluten"]}}`, err: `ingredient "" must contain at least one letter or digit`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTaxonomy(write(t, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	_, err := LoadTaxonomy(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestStore_ExcludeAllergens(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		store := newSeededStore(t, factory, map[string]Recipe{
+			"torrada": {Name: "torrada", Allergens: []string{"dairy", "gluten"}, Version: 1},
+			"omelete": {Name: "omelete", Allergens: []string{"dairy", "eggs"}, Version: 1},
+			"salada":  {Name: "salada", Version: 1},
+			"tapioca": {Name: "tapioca", Allergens: []string{"dairy"}, Version: 1},
+		})
+
+		page, err := store.ListPage(ListOptions{ExcludeAllergens: []string{"gluten"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"omelete", "salada", "tapioca"}, pageIDs(page))
+		page, err = store.ListPage(ListOptions{ExcludeAllergens: []string{"gluten", "eggs"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"salada", "tapioca"}, pageIDs(page))
+
+		facets, err := store.Facets(ListOptions{ExcludeAllergens: []string{"dairy"}})
+		require.NoError(t, err)
+		assert.Equal(t, 1, facets.Total)
+
+		got, err := store.Get("omelete")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dairy", "eggs"}, got.Allergens)
+	})
+}
@@ -0,0 +1,1510 @@
+// Package conformance - suíte de testes caixa-preta que qualquer servidor de
+// receitas precisa passar. Cada servidor (standardlib, gorilla/mux e gin)
+// chama Run com o seu http.Handler, então status e corpos das respostas
+// precisam ser idênticos entre eles
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	queijoEPresuntoFile           = "receita_queijo_e_presunto.json"
+	queijoPresuntoComManteigaFile = "receita_queijo_presunto_com_manteiga.json"
+
+	queijoEPresuntoID = "torrada-de-presunto-e-queijo"
+)
+
+// HandlerFactory - cria o handler do servidor sobre o serviço informado
+type HandlerFactory func(svc *service.Service) http.Handler
+
+// Run - executa toda a suíte contra o handler criado por newHandler. Cada
+// subteste recebe um serviço novo, sobre uma loja vazia
+func Run(t *testing.T, newHandler HandlerFactory) {
+	tests := []struct {
+		name      string
+		fn        func(t *testing.T, c *client)
+		configure func(svc *service.Service)
+	}{
+		{name: "CRUD lifecycle", fn: testLifecycle},
+		{name: "Missing IDs", fn: testMissingIDs},
+		{name: "Malformed JSON", fn: testMalformedJSON},
+		{name: "Invalid recipe", fn: testInvalidRecipe},
+		{name: "Unsupported media type", fn: testUnsupportedMediaType},
+		{name: "Duplicates", fn: testDuplicates},
+		{name: "Auto suffix", fn: testAutoSuffix, configure: func(svc *service.Service) { svc.AutoSuffix = true }},
+		{name: "Structured ingredients", fn: testStructuredIngredients},
+		{name: "Servings and units", fn: testServingsAndUnits},
+		{name: "Steps and timings", fn: testStepsAndTimings},
+		{name: "Slugs", fn: testSlugs},
+		{name: "Reserved names", fn: testReservedNames},
+		{name: "Reserved names with auto suffix", fn: testReservedNames, configure: func(svc *service.Service) { svc.AutoSuffix = true }},
+		{name: "Unknown methods", fn: testUnknownMethods},
+		{name: "Unknown paths", fn: testUnknownPaths},
+		{name: "Match", fn: testMatch},
+		{name: "Search", fn: testSearch},
+		{name: "Conditional requests", fn: testConditionalRequests},
+		{name: "Re-created recipe", fn: testRecreatedRecipe, configure: func(svc *service.Service) { svc.Clock = tickingClock() }},
+		{name: "Patch", fn: testPatch},
+		{name: "Revisions", fn: testRevisions},
+		{name: "Trash", fn: testTrash},
+		{name: "Rename", fn: testRename},
+		{name: "Listing", fn: testListing, configure: func(svc *service.Service) { svc.Clock = tickingClock() }},
+		{name: "Facets", fn: testFacets},
+		{name: "Allergens", fn: testAllergens},
+		{name: "Substitutions", fn: testSubstitutions},
+		{name: "ShoppingLists", fn: testShoppingLists},
+		{name: "Plans", fn: testPlans},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := recipes.NewMemStore()
+			svc := service.New(store)
+			if tt.configure != nil {
+				tt.configure(svc)
+			}
+			tt.fn(t, &client{t: t, handler: newHandler(svc), store: store})
+		})
+	}
+}
+
+func testLifecycle(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+	comManteiga := readTestData(t, queijoPresuntoComManteigaFile)
+
+	// CREATE
+	res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	assert.Equal(t, http.StatusCreated, res.status)
+	assert.Equal(t, "/receitas/"+queijoEPresuntoID, res.header.Get("Location"))
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	// LIST
+	res = c.do(http.MethodGet, "/receitas", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, `[`+withID(t, queijoEPresunto, queijoEPresuntoID)+`]`, withoutMetadata(t, res.body))
+
+	// GET
+	res = c.do(http.MethodGet, "/receitas/"+queijoEPresuntoID, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	// UPDATE
+	res = c.do(http.MethodPut, "/receitas/"+queijoEPresuntoID, comManteiga)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, withID(t, comManteiga, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, "/receitas/"+queijoEPresuntoID, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, withID(t, comManteiga, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	// O ID vem da URL; um "id" diferente no corpo é rejeitado
+	res = c.do(http.MethodPut, "/receitas/"+queijoEPresuntoID, []byte(`{"id": "outra-receita", "name": "Torrada", "ingredients": [{"name": "pão"}]}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{{Field: "id", Message: "must match the recipe ID in the URL"}}, problem.Errors)
+
+	// DELETE
+	res = c.do(http.MethodDelete, "/receitas/"+queijoEPresuntoID, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	res = c.do(http.MethodGet, "/receitas/"+queijoEPresuntoID, nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	c.assertStoreLen(0)
+}
+
+func testMissingIDs(t *testing.T, c *client) {
+	res := c.do(http.MethodGet, "/receitas/receita-que-nao-existe", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	res = c.do(http.MethodPut, "/receitas/receita-que-nao-existe", readTestData(t, queijoEPresuntoFile))
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	res = c.do(http.MethodDelete, "/receitas/receita-que-nao-existe", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodDelete, "/receitas/receita-que-nao-existe?permanent=true", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	c.assertStoreLen(0)
+}
+
+func testMalformedJSON(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada"`))
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "malformed recipe JSON")
+	c.assertStoreLen(0)
+
+	res = c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = c.do(http.MethodPut, "/receitas/"+queijoEPresuntoID, []byte(`[]`))
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "malformed recipe JSON")
+
+	res = c.do(http.MethodPost, "/receitas/match", []byte(`{"ingredients": [`))
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "malformed pantry JSON")
+}
+
+func testInvalidRecipe(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", []byte(`{"ingredients": [{"name": "pão"}]}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{{Field: "name", Message: "is required"}}, problem.Errors)
+	c.assertStoreLen(0)
+
+	// JSON válido, mas com um campo do tipo errado
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada", "ingredients": "pão"}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "malformed recipe JSON")
+	assert.Equal(t, []recipes.FieldError{{Field: "ingredients", Message: "must be an array"}}, problem.Errors)
+
+	res = c.do(http.MethodPost, "/receitas/match", []byte(`{"ingredients": "pão"}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "malformed pantry JSON")
+	assert.Equal(t, []recipes.FieldError{{Field: "ingredients", Message: "must be an array"}}, problem.Errors)
+
+	// Campos desconhecidos normalmente são erros de digitação do cliente
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"nome": "Torrada", "ingredients": [{"name": "pão"}]}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "malformed recipe JSON")
+	assert.Equal(t, []recipes.FieldError{{Field: "nome", Message: "unknown field"}}, problem.Errors)
+
+	// Todos os problemas são devolvidos de uma vez
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada", "ingredients": [{"name": "pão"}, {"name": ""}, {"name": "Pao"}]}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "ingredients[1].name", Message: "is required"},
+		{Field: "ingredients[2].name", Message: "duplicates ingredients[0]"},
+	}, problem.Errors)
+
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada", "ingredients": []}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{{Field: "ingredients", Message: "must have at least one ingredient"}}, problem.Errors)
+
+	c.assertStoreLen(0)
+}
+
+func testUnsupportedMediaType(t *testing.T, c *client) {
+	res := c.doWithContentType(http.MethodPost, "/receitas", "text/plain", readTestData(t, queijoEPresuntoFile))
+	assertProblem(t, res, http.StatusUnsupportedMediaType, "/problems/unsupported-media-type", "content type must be application/json")
+	c.assertStoreLen(0)
+
+	res = c.doWithContentType(http.MethodPost, "/receitas", "application/json; charset=utf-8", readTestData(t, queijoEPresuntoFile))
+	assert.Equal(t, http.StatusCreated, res.status)
+	c.assertStoreLen(1)
+}
+
+func testDuplicates(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+
+	res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	assert.Equal(t, http.StatusCreated, res.status)
+
+	// Outra receita com o mesmo nome não sobrescreve a primeira
+	res = c.do(http.MethodPost, "/receitas", readTestData(t, queijoPresuntoComManteigaFile))
+	require.Equal(t, http.StatusCreated, res.status)
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada de Presunto e Queijo!", "ingredients": [{"name": "pão"}]}`))
+	assertProblem(t, res, http.StatusConflict, "/problems/conflict", `recipe "`+queijoEPresuntoID+`" already exists`)
+	assert.Empty(t, res.header.Get("Location"))
+
+	c.assertStoreLen(2)
+	res = c.do(http.MethodGet, "/receitas/"+queijoEPresuntoID, nil)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+}
+
+func testAutoSuffix(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+
+	for _, id := range []string{queijoEPresuntoID, queijoEPresuntoID + "-2", queijoEPresuntoID + "-3"} {
+		res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+		assert.Equal(t, http.StatusCreated, res.status)
+		assert.Equal(t, "/receitas/"+id, res.header.Get("Location"))
+		assert.JSONEq(t, withID(t, queijoEPresunto, id), withoutMetadata(t, res.body))
+
+		res = c.do(http.MethodGet, "/receitas/"+id, nil)
+		assert.Equal(t, http.StatusOK, res.status)
+	}
+
+	c.assertStoreLen(3)
+}
+
+// testStructuredIngredients - ingredientes em objeto com quantidade e
+// unidade ou em texto livre, misturados com o formato antigo ({"name": ...})
+func testStructuredIngredients(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", []byte(`{
+		"name": "Torrada com manteiga",
+		"ingredients": [
+			{"name": "pão", "quantity": 2, "unit": "fatias"},
+			"1 colher de sopa de manteiga, em temperatura ambiente",
+			"sal a gosto (opcional)"
+		]
+	}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+
+	want := `{
+		"id": "torrada-com-manteiga",
+		"name": "Torrada com manteiga",
+		"ingredients": [
+			{"name": "pão", "quantity": 2, "unit": "slice"},
+			{"name": "manteiga", "quantity": 1, "unit": "tbsp", "note": "em temperatura ambiente"},
+			{"name": "sal", "note": "a gosto", "optional": true}
+		]
+	}`
+	assert.JSONEq(t, want, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, "/receitas/torrada-com-manteiga", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, want, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodPut, "/receitas/torrada-com-manteiga", []byte(`{"name": "Torrada com manteiga", "ingredients": [{"name": "pão", "quantity": 2, "unit": "punhado"}]}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{{Field: "ingredients[0].unit", Message: "unknown unit"}}, problem.Errors)
+}
+
+// testServingsAndUnits - ?servings= e ?units= devolvem uma cópia ajustada,
+// sem alterar a receita gravada
+func testServingsAndUnits(t *testing.T, c *client) {
+	stored := `{
+		"id": "bolo-de-caneca",
+		"name": "Bolo de caneca",
+		"servings": 2,
+		"ingredients": [
+			{"name": "farinha de trigo", "quantity": 1, "unit": "cup"},
+			{"name": "leite", "quantity": 0.5, "unit": "cup"},
+			{"name": "ovo", "quantity": 1}
+		]
+	}`
+	res := c.do(http.MethodPost, "/receitas", []byte(stored))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+
+	res = c.do(http.MethodGet, "/receitas/bolo-de-caneca?servings=4&units=metric", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, `{
+		"id": "bolo-de-caneca",
+		"name": "Bolo de caneca",
+		"servings": 4,
+		"ingredients": [
+			{"name": "farinha de trigo", "quantity": 240, "unit": "g"},
+			{"name": "leite", "quantity": 240, "unit": "ml"},
+			{"name": "ovo", "quantity": 2}
+		]
+	}`, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, "/receitas/bolo-de-caneca", nil)
+	assert.JSONEq(t, stored, withoutMetadata(t, res.body))
+
+	for _, servings := range []string{"0", "-2", "dois"} {
+		res = c.do(http.MethodGet, "/receitas/bolo-de-caneca?servings="+servings, nil)
+		assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "servings must be an integer between 1 and 1000")
+	}
+
+	res = c.do(http.MethodGet, "/receitas/bolo-de-caneca?units=furlongs", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "units must be metric or imperial")
+
+	// Sem o número de porções gravado não há como escalar
+	res = c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	require.Equal(t, http.StatusCreated, res.status)
+	res = c.do(http.MethodGet, "/receitas/"+queijoEPresuntoID+"?servings=4", nil)
+	assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", recipes.NoServingsErr.Error())
+}
+
+// testStepsAndTimings - modo de preparo, tempos, rendimento e dificuldade
+// voltam como foram enviados, com as durações em ISO-8601
+func testStepsAndTimings(t *testing.T, c *client) {
+	stored := `{
+		"id": "ovo-cozido",
+		"name": "Ovo cozido",
+		"servings": 1,
+		"ingredients": [{"name": "ovo", "quantity": 2}, {"name": "água", "quantity": 500, "unit": "ml"}],
+		"steps": [
+			{"text": "Ferva a água", "ingredients": ["água"]},
+			{"text": "Cozinhe os ovos", "ingredients": ["ovo"], "timer": "PT9M"},
+			{"text": "Esfrie em água gelada", "timer": "PT1M30S"}
+		],
+		"total_time": "PT15M",
+		"active_time": "PT2M",
+		"yield": "2 ovos",
+		"difficulty": "easy"
+	}`
+	res := c.do(http.MethodPost, "/receitas", []byte(stored))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.JSONEq(t, stored, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, "/receitas/ovo-cozido", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, stored, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodPut, "/receitas/ovo-cozido", []byte(`{
+		"name": "Ovo cozido",
+		"ingredients": [{"name": "ovo"}],
+		"steps": [{"text": "Cozinhe", "ingredients": ["ovos"], "timer": "9 minutos"}],
+		"difficulty": "trivial"
+	}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "malformed recipe JSON")
+	assert.Equal(t, []recipes.FieldError{{Field: "steps[0].timer", Message: `must be an ISO-8601 duration such as "PT1H30M"`}}, problem.Errors)
+
+	res = c.do(http.MethodPut, "/receitas/ovo-cozido", []byte(`{
+		"name": "Ovo cozido",
+		"ingredients": [{"name": "ovo"}],
+		"steps": [{"text": "Cozinhe", "ingredients": ["ovos"], "timer": "PT9M"}],
+		"total_time": "PT5M",
+		"active_time": "PT10M",
+		"difficulty": "trivial"
+	}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "steps[0].ingredients[0]", Message: "does not match any ingredient"},
+		{Field: "active_time", Message: "must not exceed total_time"},
+		{Field: "difficulty", Message: "must be one of easy, medium, hard"},
+	}, problem.Errors)
+
+	res = c.do(http.MethodGet, "/receitas/ovo-cozido", nil)
+	assert.JSONEq(t, stored, withoutMetadata(t, res.body))
+}
+
+// testSlugs - IDs de uma palavra, derivados de nomes acentuados ou só com
+// números precisam ser acessíveis como qualquer outro
+func testSlugs(t *testing.T, c *client) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		{name: "Lasanha", id: "lasanha"},
+		{name: "Pão de Queijo", id: "pao-de-queijo"},
+		{name: "Açaí", id: "acai"},
+		{name: "1900", id: "1900"},
+		{name: "Bolo 3 Leites", id: "bolo-3-leites"},
+	}
+	for _, tt := range tests {
+		body := []byte(`{"name": "` + tt.name + `", "ingredients": [{"name": "farinha"}]}`)
+		res := c.do(http.MethodPost, "/receitas", body)
+		require.Equal(t, http.StatusCreated, res.status, tt.name)
+		assert.Equal(t, "/receitas/"+tt.id, res.header.Get("Location"))
+
+		res = c.do(http.MethodGet, "/receitas/"+tt.id, nil)
+		assert.Equal(t, http.StatusOK, res.status, tt.id)
+		assert.JSONEq(t, withID(t, body, tt.id), withoutMetadata(t, res.body))
+
+		res = c.do(http.MethodPut, "/receitas/"+tt.id, []byte(`{"name": "`+tt.name+`", "ingredients": [{"name": "ovo"}]}`))
+		assert.Equal(t, http.StatusOK, res.status, tt.id)
+
+		res = c.do(http.MethodDelete, "/receitas/"+tt.id, nil)
+		assert.Equal(t, http.StatusOK, res.status, tt.id)
+		res = c.do(http.MethodGet, "/receitas/"+tt.id, nil)
+		assert.Equal(t, http.StatusNotFound, res.status, tt.id)
+	}
+
+	c.assertStoreLen(0)
+}
+
+// testReservedNames - um nome que gera o slug de uma rota fixa de
+// /receitas/ deixaria a receita inacessível, então é rejeitado na criação e
+// no rename, com ou sem AutoSuffix. PUT e PATCH não mudam o ID e aceitam
+// esses nomes
+func testReservedNames(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", []byte(`{"name": "Lasanha", "ingredients": [{"name": "massa"}]}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+
+	for _, tt := range []struct {
+		name string
+		id   string
+	}{
+		{name: "Match", id: "match"},
+		{name: "Search", id: "search"},
+		{name: "Trash", id: "trash"},
+		{name: "Facets", id: "facets"},
+	} {
+		want := []recipes.FieldError{{Field: "name", Message: `must not generate the reserved ID "` + tt.id + `"`}}
+
+		res := c.do(http.MethodPost, "/receitas", []byte(`{"name": "`+tt.name+`", "ingredients": [{"name": "massa"}]}`))
+		problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+		assert.Equal(t, want, problem.Errors, tt.name)
+
+		res = c.do(http.MethodPost, "/receitas/lasanha/rename", []byte(`{"name": "`+tt.name+`"}`))
+		problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+		assert.Equal(t, want, problem.Errors, tt.name)
+	}
+
+	res = c.do(http.MethodPut, "/receitas/lasanha", []byte(`{"name": "Search", "ingredients": [{"name": "massa"}]}`))
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assert.JSONEq(t, `{"id": "lasanha", "name": "Search", "ingredients": [{"name": "massa"}]}`, withoutMetadata(t, res.body))
+
+	res = c.doWithHeader(http.MethodPatch, "/receitas/lasanha", http.Header{"Content-Type": {service.JSONPatchContentType}},
+		[]byte(`[{"op": "replace", "path": "/name", "value": "Trash"}]`))
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assert.JSONEq(t, `{"id": "lasanha", "name": "Trash", "ingredients": [{"name": "massa"}]}`, withoutMetadata(t, res.body))
+
+	c.assertStoreLen(1)
+}
+
+func testUnknownMethods(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	require.Equal(t, http.StatusCreated, res.status)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodPatch, "/receitas"},
+		{http.MethodDelete, "/receitas"},
+		{http.MethodPut, "/receitas"},
+		{http.MethodPost, "/receitas/" + queijoEPresuntoID},
+	} {
+		res := c.do(req.method, req.path, nil)
+		assertProblem(t, res, http.StatusMethodNotAllowed, "/problems/method-not-allowed", "method not allowed")
+	}
+
+	c.assertStoreLen(1)
+}
+
+func testUnknownPaths(t *testing.T, c *client) {
+	for _, path := range []string{"/receitas/torrada/ingredientes", "/ingredientes"} {
+		res := c.do(http.MethodGet, path, nil)
+		assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	}
+}
+
+func testMatch(t *testing.T, c *client) {
+	for _, name := range []string{queijoEPresuntoFile, queijoPresuntoComManteigaFile} {
+		res := c.do(http.MethodPost, "/receitas", readTestData(t, name))
+		require.Equal(t, http.StatusCreated, res.status)
+	}
+
+	res := c.do(http.MethodGet, "/receitas/match?have=pao,queijo,presunto", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	var matches recipes.Matches
+	require.NoError(t, json.Unmarshal([]byte(res.body), &matches))
+	require.Len(t, matches.Exact, 1)
+	assert.Equal(t, queijoEPresuntoID, matches.Exact[0].ID)
+	require.Len(t, matches.NearMisses, 1)
+	assert.Equal(t, []string{"manteiga"}, matches.NearMisses[0].Missing)
+
+	post := c.do(http.MethodPost, "/receitas/match", []byte(`{"ingredients": [{"name": "pão"}, {"name": "queijo"}, {"name": "presunto"}]}`))
+	assert.Equal(t, http.StatusOK, post.status)
+	assert.JSONEq(t, res.body, post.body)
+
+	res = c.do(http.MethodGet, "/receitas/match?max_missing=dois", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "max_missing must be an integer")
+}
+
+// testSearch - a busca encontra as receitas pelo nome, ingredientes e passos
+// e acompanha as alterações feitas pela API
+func testSearch(t *testing.T, c *client) {
+	for _, name := range []string{queijoEPresuntoFile, queijoPresuntoComManteigaFile} {
+		res := c.do(http.MethodPost, "/receitas", readTestData(t, name))
+		require.Equal(t, http.StatusCreated, res.status)
+	}
+	const comManteigaID = "torrada-de-queijo-presunto-e-manteiga"
+
+	search := func(query string) recipes.SearchResults {
+		t.Helper()
+		res := c.do(http.MethodGet, "/receitas/search?"+query, nil)
+		require.Equal(t, http.StatusOK, res.status, res.body)
+		var results recipes.SearchResults
+		require.NoError(t, json.Unmarshal([]byte(res.body), &results))
+		return results
+	}
+
+	results := search("q=manteiga")
+	require.Len(t, results.Results, 1)
+	assert.Equal(t, comManteigaID, results.Results[0].ID)
+	assert.Equal(t, []recipes.Highlight{
+		{Field: "name", Snippet: "Torrada de queijo, presunto e <mark>manteiga</mark>"},
+		{Field: "ingredients[3].name", Snippet: "<mark>manteiga</mark>"},
+	}, results.Results[0].Highlights)
+
+	// Sem acento, no plural e com erro de digitação
+	results = search("q=paes+quiejo&limit=1")
+	assert.Equal(t, "paes quiejo", results.Query)
+	assert.Equal(t, 2, results.Total)
+	assert.Len(t, results.Results, 1)
+
+	// Alterações e remoções chegam ao índice
+	res := c.do(http.MethodPut, "/receitas/"+comManteigaID, []byte(`{
+		"name": "Torrada de queijo, presunto e manteiga",
+		"ingredients": [{"name": "pão"}, {"name": "queijo"}, {"name": "presunto"}],
+		"steps": [{"text": "Passe requeijão no pão"}]
+	}`))
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	results = search("q=requeijao")
+	require.Len(t, results.Results, 1)
+	assert.Equal(t, []recipes.Highlight{{Field: "steps[0].text", Snippet: "Passe <mark>requeijão</mark> no pão"}}, results.Results[0].Highlights)
+
+	res = c.do(http.MethodDelete, "/receitas/"+comManteigaID, nil)
+	require.Equal(t, http.StatusOK, res.status)
+	assert.Empty(t, search("q=requeijao").Results)
+
+	res = c.do(http.MethodGet, "/receitas/search", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "q is required")
+
+	res = c.do(http.MethodGet, "/receitas/search?q=pao&limit=0", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "limit must be an integer between 1 and 100")
+}
+
+// testConditionalRequests - ETag no GET, 304 com If-None-Match e 412
+// quando o If-Match do PUT ou do DELETE não é o da versão gravada
+func testConditionalRequests(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+	comManteiga := readTestData(t, queijoPresuntoComManteigaFile)
+	path := "/receitas/" + queijoEPresuntoID
+
+	res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	require.Equal(t, http.StatusCreated, res.status)
+	v1 := assertETag(t, res, 1)
+
+	res = c.do(http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, v1, res.header.Get("ETag"))
+	var recipe recipes.Recipe
+	require.NoError(t, json.Unmarshal([]byte(res.body), &recipe))
+	assert.Equal(t, int64(1), recipe.Version)
+
+	// O cliente já tem essa versão
+	res = c.doWithHeader(http.MethodGet, path, http.Header{"If-None-Match": {v1}}, nil)
+	assert.Equal(t, http.StatusNotModified, res.status)
+	assert.Equal(t, v1, res.header.Get("ETag"))
+	assert.Empty(t, res.body)
+
+	// A receita ajustada é outra representação, com outra etiqueta
+	res = c.doWithHeader(http.MethodGet, path+"?units=imperial", http.Header{"If-None-Match": {v1}}, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.Equal(t, strings.TrimSuffix(v1, `"`)+`;units=imperial"`, res.header.Get("ETag"))
+
+	// Dois cozinheiros leram a versão 1; só o primeiro consegue gravar
+	res = c.doWithHeader(http.MethodPut, path, http.Header{"If-Match": {v1}}, comManteiga)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	v2 := assertETag(t, res, 2)
+
+	res = c.doWithHeader(http.MethodPut, path, http.Header{"If-Match": {v1}}, queijoEPresunto)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+
+	res = c.do(http.MethodGet, path, nil)
+	assert.JSONEq(t, withID(t, comManteiga, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	res = c.doWithHeader(http.MethodGet, path, http.Header{"If-None-Match": {v1}}, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+
+	// Sem If-Match a última escrita vence, como antes
+	res = c.do(http.MethodPut, path, queijoEPresunto)
+	assert.Equal(t, http.StatusOK, res.status)
+	v3 := assertETag(t, res, 3)
+
+	res = c.doWithHeader(http.MethodDelete, path, http.Header{"If-Match": {v2}}, nil)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+	c.assertStoreLen(1)
+
+	res = c.doWithHeader(http.MethodDelete, path, http.Header{"If-Match": {v3}}, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	c.assertStoreLen(0)
+
+	// Com If-Match, a receita precisa existir
+	res = c.doWithHeader(http.MethodDelete, path, http.Header{"If-Match": {"*"}}, nil)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+}
+
+// testRecreatedRecipe - uma receita apagada de vez e criada de novo com o
+// mesmo ID volta à versão 1, mas o If-Match da receita antiga não passa
+func testRecreatedRecipe(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+	comManteiga := readTestData(t, queijoPresuntoComManteigaFile)
+	path := "/receitas/" + queijoEPresuntoID
+
+	res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	require.Equal(t, http.StatusCreated, res.status)
+	stale := assertETag(t, res, 1)
+
+	res = c.do(http.MethodDelete, path+"?permanent=true", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	res = c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.NotEqual(t, stale, assertETag(t, res, 1))
+
+	res = c.doWithHeader(http.MethodPut, path, http.Header{"If-Match": {stale}}, comManteiga)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+	res = c.doWithHeader(http.MethodDelete, path, http.Header{"If-Match": {stale}}, nil)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+
+	res = c.do(http.MethodGet, path, nil)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+	c.assertStoreLen(1)
+}
+
+// testRevisions - o histórico de revisões, o diff entre elas e a
+// restauração de uma revisão antiga
+func testRevisions(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+	comManteiga := readTestData(t, queijoPresuntoComManteigaFile)
+	path := "/receitas/" + queijoEPresuntoID
+
+	res := c.doWithHeader(http.MethodPost, "/receitas", http.Header{"From": {"ana@example.com"}}, queijoEPresunto)
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	v1 := assertETag(t, res, 1)
+	var recipe recipes.Recipe
+	require.NoError(t, json.Unmarshal([]byte(res.body), &recipe))
+	assert.Equal(t, "ana@example.com", recipe.UpdatedBy)
+
+	res = c.doWithHeader(http.MethodPut, path, http.Header{"From": {"bia@example.com"}}, comManteiga)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	v2 := assertETag(t, res, 2)
+
+	// A listagem não traz o conteúdo das revisões
+	res = c.do(http.MethodGet, path+"/revisions", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	var revisions []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(res.body), &revisions))
+	require.Len(t, revisions, 2)
+	for i, author := range []string{"ana@example.com", "bia@example.com"} {
+		assert.Equal(t, float64(i+1), revisions[i]["number"])
+		assert.Equal(t, author, revisions[i]["author"])
+		assert.NotEmpty(t, revisions[i]["created_at"])
+		assert.NotContains(t, revisions[i], "recipe")
+	}
+
+	res = c.do(http.MethodGet, path+"/revisions/1", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	var revision struct {
+		Number int64           `json:"number"`
+		Recipe json.RawMessage `json:"recipe"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(res.body), &revision))
+	assert.Equal(t, int64(1), revision.Number)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, string(revision.Recipe)))
+
+	// Sem ?from=, o diff é contra a revisão anterior
+	res = c.do(http.MethodGet, path+"/revisions/2/diff", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, `{
+		"from": 1,
+		"to": 2,
+		"fields": [{"field": "name", "from": "Torrada de presunto e queijo", "to": "Torrada de queijo, presunto e manteiga"}],
+		"ingredients": {"added": [{"name": "manteiga"}], "removed": [], "changed": []}
+	}`, res.body)
+
+	res = c.do(http.MethodGet, path+"/revisions/2/diff?from=0", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	var diff recipes.Diff
+	require.NoError(t, json.Unmarshal([]byte(res.body), &diff))
+	assert.Len(t, diff.Ingredients.Added, 4)
+
+	res = c.do(http.MethodGet, path+"/revisions/um", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "revision must be a positive integer")
+	res = c.do(http.MethodGet, path+"/revisions/2/diff?from=x", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "from must be a non-negative integer")
+	res = c.do(http.MethodGet, path+"/revisions/9", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodGet, "/receitas/ratatouille/revisions", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	// Restaurar grava uma revisão nova e respeita o If-Match
+	res = c.doWithHeader(http.MethodPost, path+"/revisions/1/restore", http.Header{"If-Match": {v1}}, nil)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+
+	res = c.doWithHeader(http.MethodPost, path+"/revisions/1/restore", http.Header{"If-Match": {v2}, "From": {"caio"}}, nil)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assertETag(t, res, 3)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, path+"/revisions", nil)
+	require.NoError(t, json.Unmarshal([]byte(res.body), &revisions))
+	require.Len(t, revisions, 3)
+	assert.Equal(t, "caio", revisions[2]["author"])
+
+	res = c.doWithHeader(http.MethodPost, path+"/revisions/1/restore", http.Header{"From": {strings.Repeat("a", service.MaxAuthorLength+1)}}, nil)
+	assert.Equal(t, http.StatusBadRequest, res.status)
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodDelete, path + "/revisions"},
+		{http.MethodPut, path + "/revisions/1"},
+		{http.MethodGet, path + "/revisions/1/restore"},
+	} {
+		res := c.do(req.method, req.path, nil)
+		assertProblem(t, res, http.StatusMethodNotAllowed, "/problems/method-not-allowed", "method not allowed")
+	}
+}
+
+// testTrash - DELETE move a receita para a lixeira, de onde ela pode ser
+// restaurada; ?permanent=true apaga de vez
+func testTrash(t *testing.T, c *client) {
+	queijoEPresunto := readTestData(t, queijoEPresuntoFile)
+	path := "/receitas/" + queijoEPresuntoID
+
+	res := c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	require.Equal(t, http.StatusCreated, res.status)
+	res = c.do(http.MethodPut, path, queijoEPresunto)
+	require.Equal(t, http.StatusOK, res.status)
+
+	res = c.do(http.MethodGet, "/receitas/trash", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, `[]`, res.body)
+
+	res = c.do(http.MethodDelete, path, nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	c.assertStoreLen(0)
+
+	// Fora da lixeira, a receita não existe mais
+	res = c.do(http.MethodGet, path, nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodDelete, path, nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodGet, "/receitas", nil)
+	assert.JSONEq(t, `[]`, res.body)
+
+	// O ID continua reservado enquanto ela estiver na lixeira
+	res = c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	assertProblem(t, res, http.StatusConflict, "/problems/conflict", `recipe "`+queijoEPresuntoID+`" is in the trash`)
+
+	res = c.do(http.MethodGet, "/receitas/trash", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	var trash []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(res.body), &trash))
+	require.Len(t, trash, 1)
+	assert.Equal(t, queijoEPresuntoID, trash[0]["id"])
+	assert.NotEmpty(t, trash[0]["deleted_at"])
+	assert.NotEmpty(t, trash[0]["purge_at"])
+
+	// Restaurada, volta como estava, na mesma versão
+	res = c.do(http.MethodPost, "/receitas/trash/"+queijoEPresuntoID+"/restore", nil)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assertETag(t, res, 2)
+	assert.JSONEq(t, withID(t, queijoEPresunto, queijoEPresuntoID), withoutMetadata(t, res.body))
+	c.assertStoreLen(1)
+
+	res = c.do(http.MethodPost, "/receitas/trash/"+queijoEPresuntoID+"/restore", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	// Apagada de vez, não passa pela lixeira e o ID fica livre
+	res = c.do(http.MethodDelete, path+"?permanent=maybe", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "permanent must be true or false")
+	res = c.do(http.MethodDelete, path+"?permanent=true", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	res = c.do(http.MethodGet, "/receitas/trash", nil)
+	assert.JSONEq(t, `[]`, res.body)
+	res = c.do(http.MethodPost, "/receitas", queijoEPresunto)
+	assert.Equal(t, http.StatusCreated, res.status)
+}
+
+// testRename - o rename gera o ID de novo e o ID antigo responde 301 no GET
+func testRename(t *testing.T, c *client) {
+	path := "/receitas/" + queijoEPresuntoID
+	newPath := "/receitas/torrada-de-presunto-queijo-e-tomate"
+
+	res := c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	require.Equal(t, http.StatusCreated, res.status)
+	v1 := assertETag(t, res, 1)
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Misto quente", "ingredients": [{"name": "pão"}]}`))
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = c.do(http.MethodPost, path+"/rename", []byte(`{"name": "Misto quente"}`))
+	assertProblem(t, res, http.StatusConflict, "/problems/conflict", `recipe "misto-quente" already exists`)
+	res = c.do(http.MethodPost, path+"/rename", []byte(`{"name": "!!!"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+	res = c.do(http.MethodPost, path+"/rename", []byte(`{"nome": "Torrada"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status)
+	res = c.do(http.MethodPost, "/receitas/ratatouille/rename", []byte(`{"name": "Ratatouille"}`))
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodGet, path+"/rename", nil)
+	assertProblem(t, res, http.StatusMethodNotAllowed, "/problems/method-not-allowed", "method not allowed")
+
+	res = c.doWithHeader(http.MethodPost, path+"/rename", http.Header{"If-Match": {v1}}, []byte(`{"name": "Torrada de presunto, queijo e tomate"}`))
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, newPath, res.header.Get("Location"))
+	assertETag(t, res, 2)
+	assert.JSONEq(t, `{
+		"id": "torrada-de-presunto-queijo-e-tomate",
+		"name": "Torrada de presunto, queijo e tomate",
+		"ingredients": [{"name": "pão"}, {"name": "presunto"}, {"name": "queijo"}]
+	}`, withoutMetadata(t, res.body))
+	c.assertStoreLen(2)
+
+	// O ID antigo redireciona, mantendo a query string
+	res = c.do(http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusMovedPermanently, res.status)
+	assert.Equal(t, newPath, res.header.Get("Location"))
+	res = c.do(http.MethodGet, path+"?servings=2", nil)
+	assert.Equal(t, http.StatusMovedPermanently, res.status)
+	assert.Equal(t, newPath+"?servings=2", res.header.Get("Location"))
+
+	// Só o GET é redirecionado; escritas no ID antigo não encontram a receita
+	res = c.do(http.MethodPut, path, readTestData(t, queijoEPresuntoFile))
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	assertProblem(t, res, http.StatusConflict, "/problems/conflict",
+		`"`+queijoEPresuntoID+`" is an old name of recipe "torrada-de-presunto-queijo-e-tomate"`)
+
+	res = c.do(http.MethodGet, newPath+"/revisions", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	var revisions []recipes.Revision
+	require.NoError(t, json.Unmarshal([]byte(res.body), &revisions))
+	assert.Len(t, revisions, 2)
+
+	// A revisão de antes do rename volta com o nome atual, que gera o ID
+	res = c.do(http.MethodPost, newPath+"/revisions/1/restore", nil)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	assert.JSONEq(t, `{
+		"id": "torrada-de-presunto-queijo-e-tomate",
+		"name": "Torrada de presunto, queijo e tomate",
+		"ingredients": [{"name": "pão"}, {"name": "presunto"}, {"name": "queijo"}]
+	}`, withoutMetadata(t, res.body))
+
+	// Apagada de vez, o ID antigo deixa de redirecionar
+	res = c.do(http.MethodDelete, newPath+"?permanent=true", nil)
+	assert.Equal(t, http.StatusOK, res.status)
+	res = c.do(http.MethodGet, path, nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+}
+
+// testPatch - PATCH com merge patch e JSON Patch, validando o resultado e
+// respeitando o If-Match
+func testPatch(t *testing.T, c *client) {
+	path := "/receitas/" + queijoEPresuntoID
+	merge := http.Header{"Content-Type": {service.MergePatchContentType}}
+	jsonPatch := http.Header{"Content-Type": {service.JSONPatchContentType}}
+
+	res := c.do(http.MethodPost, "/receitas", readTestData(t, queijoEPresuntoFile))
+	require.Equal(t, http.StatusCreated, res.status)
+
+	res = c.doWithHeader(http.MethodPatch, path, merge, []byte(`{"servings": 2, "tags": ["lanche"]}`))
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	v2 := assertETag(t, res, 2)
+	assert.JSONEq(t, `{
+		"id": "torrada-de-presunto-e-queijo",
+		"name": "Torrada de presunto e queijo",
+		"servings": 2,
+		"tags": ["lanche"],
+		"ingredients": [{"name": "pão"}, {"name": "presunto"}, {"name": "queijo"}]
+	}`, withoutMetadata(t, res.body))
+
+	// Trocar um ingrediente sem reenviar a receita inteira
+	res = c.doWithHeader(http.MethodPatch, path, jsonPatch, []byte(`[
+		{"op": "test", "path": "/ingredients/2/name", "value": "queijo"},
+		{"op": "replace", "path": "/ingredients/2", "value": "100 g de queijo minas"},
+		{"op": "remove", "path": "/servings"}
+	]`))
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	want := `{
+		"id": "torrada-de-presunto-e-queijo",
+		"name": "Torrada de presunto e queijo",
+		"tags": ["lanche"],
+		"ingredients": [{"name": "pão"}, {"name": "presunto"}, {"name": "queijo minas", "quantity": 100, "unit": "g"}]
+	}`
+	assert.JSONEq(t, want, withoutMetadata(t, res.body))
+
+	res = c.do(http.MethodGet, path, nil)
+	assert.JSONEq(t, want, withoutMetadata(t, res.body))
+	assertETag(t, res, 3)
+
+	// O resultado do patch passa pela validação
+	res = c.doWithHeader(http.MethodPatch, path, merge, []byte(`{"ingredients": null, "difficulty": "trivial"}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "recipe failed validation")
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "ingredients", Message: "must have at least one ingredient"},
+		{Field: "difficulty", Message: "must be one of easy, medium, hard"},
+	}, problem.Errors)
+
+	res = c.doWithHeader(http.MethodPatch, path, jsonPatch, []byte(`[{"op": "test", "path": "/name", "value": "Torrada"}]`))
+	assertProblem(t, res, http.StatusConflict, "/problems/conflict", `cannot apply patch: operation 0 (test): value at "/name" does not match`)
+
+	res = c.doWithHeader(http.MethodPatch, path, jsonPatch, []byte(`[{"op": "rename", "path": "/name"}]`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "malformed JSON patch")
+	assert.Equal(t, []recipes.FieldError{{Field: "[0].op", Message: "must be one of add, remove, replace, move, copy, test"}}, problem.Errors)
+
+	res = c.do(http.MethodPatch, path, []byte(`{"servings": 2}`))
+	assertProblem(t, res, http.StatusUnsupportedMediaType, "/problems/unsupported-media-type",
+		"content type must be application/merge-patch+json or application/json-patch+json")
+
+	res = c.doWithHeader(http.MethodPatch, path, http.Header{"Content-Type": {service.MergePatchContentType}, "If-Match": {v2}}, []byte(`{"servings": 4}`))
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "recipe does not match If-Match")
+
+	res = c.doWithHeader(http.MethodPatch, "/receitas/receita-que-nao-existe", merge, []byte(`{"servings": 4}`))
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	res = c.do(http.MethodGet, path, nil)
+	assert.JSONEq(t, want, withoutMetadata(t, res.body))
+}
+
+// testListing - paginação pelo cabeçalho Link, ordenação e filtros da
+// listagem
+func testListing(t *testing.T, c *client) {
+	for _, body := range []string{
+		`{"name": "Brigadeiro", "ingredients": [{"name": "leite condensado"}, {"name": "chocolate em pó"}], "tags": ["doce", "Festa"]}`,
+		`{"name": "Arroz doce", "ingredients": [{"name": "arroz"}, {"name": "leite"}], "tags": ["doce"]}`,
+		`{"name": "Bolo de cenoura", "ingredients": [{"name": "cenoura"}, {"name": "chocolate em pó"}], "tags": ["doce", "festa"]}`,
+		`{"name": "Torrada", "ingredients": [{"name": "pão"}, {"name": "queijo"}]}`,
+	} {
+		res := c.do(http.MethodPost, "/receitas", []byte(body))
+		require.Equal(t, http.StatusCreated, res.status, res.body)
+	}
+
+	list := func(path string) ([]string, response) {
+		t.Helper()
+		res := c.do(http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, res.status, res.body)
+		var page []recipes.Recipe
+		require.NoError(t, json.Unmarshal([]byte(res.body), &page))
+		ids := []string{}
+		for _, recipe := range page {
+			ids = append(ids, recipe.ID)
+		}
+		return ids, res
+	}
+
+	// Seguindo os links de uma página para a outra, nos dois sentidos
+	ids, res := list("/receitas?sort=-created&limit=3")
+	assert.Equal(t, []string{"torrada", "bolo-de-cenoura", "arroz-doce"}, ids)
+	links := parseLinks(t, res.header.Get("Link"))
+	require.Contains(t, links, "next")
+	assert.NotContains(t, links, "prev")
+
+	ids, res = list(links["next"])
+	assert.Equal(t, []string{"brigadeiro"}, ids)
+	links = parseLinks(t, res.header.Get("Link"))
+	require.Contains(t, links, "prev")
+	assert.NotContains(t, links, "next")
+
+	ids, _ = list(links["prev"])
+	assert.Equal(t, []string{"torrada", "bolo-de-cenoura", "arroz-doce"}, ids)
+
+	// Uma página só não tem links
+	ids, res = list("/receitas")
+	assert.Equal(t, []string{"arroz-doce", "bolo-de-cenoura", "brigadeiro", "torrada"}, ids)
+	assert.Empty(t, res.header.Get("Link"))
+
+	// A receita alterada por último vem primeiro
+	res = c.do(http.MethodPut, "/receitas/brigadeiro", []byte(`{"name": "Brigadeiro", "ingredients": [{"name": "leite condensado"}, {"name": "cacau"}], "tags": ["doce", "festa"]}`))
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	ids, _ = list("/receitas?sort=-updated&limit=1")
+	assert.Equal(t, []string{"brigadeiro"}, ids)
+
+	ids, _ = list("/receitas?ingredient=chocolate")
+	assert.Equal(t, []string{"bolo-de-cenoura"}, ids)
+	ids, _ = list("/receitas?exclude_ingredient=leite,chocolate")
+	assert.Equal(t, []string{"torrada"}, ids)
+	ids, _ = list("/receitas?tag=festa&tag=Doce")
+	assert.Equal(t, []string{"bolo-de-cenoura", "brigadeiro"}, ids)
+
+	for _, tt := range []struct {
+		query, detail string
+	}{
+		{query: "limit=0", detail: "limit must be an integer between 1 and 100"},
+		{query: "sort=calorias", detail: "sort must be name, created or updated, optionally prefixed with -"},
+		{query: "cursor=xyz", detail: "invalid cursor"},
+		{query: "tag=!!!", detail: "tag must contain at least one letter or digit"},
+	} {
+		res = c.do(http.MethodGet, "/receitas?"+tt.query, nil)
+		assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", tt.detail)
+	}
+
+	// O cursor pertence à ordenação que o gerou
+	_, res = list("/receitas?limit=1")
+	next := parseLinks(t, res.header.Get("Link"))["next"]
+	res = c.do(http.MethodGet, next+"&sort=-created", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "cursor does not match sort")
+}
+
+func testFacets(t *testing.T, c *client) {
+	for _, body := range []string{
+		`{"name": "Brigadeiro", "ingredients": [{"name": "leite condensado"}, {"name": "chocolate em pó"}], "tags": ["Sobremesa", "sem gluten", "festa"]}`,
+		`{"name": "Mousse", "ingredients": [{"name": "chocolate em pó"}, {"name": "ovos"}], "tags": ["sobremesa"]}`,
+		`{"name": "Torrada", "ingredients": [{"name": "pão"}, {"name": "queijo"}], "tags": ["Café da manhã", "rápido"]}`,
+	} {
+		res := c.do(http.MethodPost, "/receitas", []byte(body))
+		require.Equal(t, http.StatusCreated, res.status, res.body)
+	}
+
+	facets := func(path string) recipes.Facets {
+		t.Helper()
+		res := c.do(http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, res.status, res.body)
+		var facets recipes.Facets
+		require.NoError(t, json.Unmarshal([]byte(res.body), &facets))
+		return facets
+	}
+
+	got := facets("/receitas/facets")
+	assert.Equal(t, 3, got.Total)
+	assert.Equal(t, []recipes.FacetCount{
+		{Value: "sobremesa", Name: "Sobremesa", Count: 2},
+		{Value: "cafe-da-manha", Name: "Café da manhã", Count: 1},
+	}, got.Categories)
+	assert.Equal(t, []recipes.FacetCount{{Value: "sem-gluten", Name: "Sem glúten", Count: 1}}, got.Diets)
+	assert.Equal(t, []recipes.FacetCount{
+		{Value: "festa", Name: "festa", Count: 1},
+		{Value: "rapido", Name: "rápido", Count: 1},
+	}, got.Tags)
+	assert.Len(t, got.Ingredients, 5)
+	assert.Equal(t, recipes.FacetCount{Value: "chocolate-em-po", Name: "chocolate em pó", Count: 2}, got.Ingredients[0])
+
+	// As contagens seguem os filtros da listagem, e limit corta cada faceta
+	got = facets("/receitas/facets?tag=sobremesa&exclude_ingredient=ovos&limit=1")
+	assert.Equal(t, recipes.Facets{
+		Total:       1,
+		Categories:  []recipes.FacetCount{{Value: "sobremesa", Name: "Sobremesa", Count: 1}},
+		Diets:       []recipes.FacetCount{{Value: "sem-gluten", Name: "Sem glúten", Count: 1}},
+		Tags:        []recipes.FacetCount{{Value: "festa", Name: "festa", Count: 1}},
+		Ingredients: []recipes.FacetCount{{Value: "chocolate-em-po", Name: "chocolate em pó", Count: 1}},
+	}, got)
+
+	// Receitas na lixeira não contam
+	res := c.do(http.MethodDelete, "/receitas/brigadeiro", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	got = facets("/receitas/facets?tag=sem-gluten")
+	assert.Equal(t, 0, got.Total)
+	assert.Empty(t, got.Ingredients)
+
+	res = c.do(http.MethodGet, "/receitas/facets?limit=0", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "limit must be an integer between 1 and 100")
+	res = c.do(http.MethodPost, "/receitas/facets", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.status, res.body)
+}
+
+func testAllergens(t *testing.T, c *client) {
+	allergens := func(body string) []string {
+		t.Helper()
+		var recipe recipes.Recipe
+		require.NoError(t, json.Unmarshal([]byte(body), &recipe), body)
+		return recipe.Allergens
+	}
+
+	// Calculados a partir dos ingredientes; o que vem no corpo é ignorado
+	res := c.do(http.MethodPost, "/receitas", []byte(`{"name": "Torrada", "ingredients": ["2 fatias de pão", "queijo minas"], "allergens": ["fish"]}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, []string{"dairy", "gluten"}, allergens(res.body))
+	res = c.do(http.MethodGet, "/receitas/torrada", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, []string{"dairy", "gluten"}, allergens(res.body))
+
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Tapioca", "ingredients": ["goma de tapioca", "1 ovo", "leite de coco"]}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, []string{"eggs"}, allergens(res.body))
+	res = c.do(http.MethodPost, "/receitas", []byte(`{"name": "Salada", "ingredients": ["alface", "tomate"]}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Empty(t, allergens(res.body))
+
+	// E recalculados a cada escrita
+	res = c.doWithHeader(http.MethodPatch, "/receitas/salada", http.Header{"Content-Type": {service.MergePatchContentType}}, []byte(`{"ingredients": ["alface", "castanha de caju"]}`))
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, []string{"tree-nuts"}, allergens(res.body))
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{query: "exclude_allergen=gluten,lactose", want: []string{"salada", "tapioca"}},
+		{query: "exclude_allergen=ovos&exclude_allergen=Castanhas", want: []string{"torrada"}},
+		{query: "exclude_allergen=peixe", want: []string{"salada", "tapioca", "torrada"}},
+	} {
+		res = c.do(http.MethodGet, "/receitas?"+tt.query, nil)
+		require.Equal(t, http.StatusOK, res.status, res.body)
+		var page []recipes.Recipe
+		require.NoError(t, json.Unmarshal([]byte(res.body), &page))
+		ids := []string{}
+		for _, recipe := range page {
+			ids = append(ids, recipe.ID)
+		}
+		assert.Equal(t, tt.want, ids, tt.query)
+	}
+
+	res = c.do(http.MethodGet, "/receitas/facets?exclude_allergen=gluten", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Contains(t, res.body, `"total":2`)
+
+	const unknown = `unknown allergen "mostarda"; use one of gluten, dairy, eggs, peanuts, tree-nuts, soy, fish, shellfish, sesame`
+	res = c.do(http.MethodGet, "/receitas?exclude_allergen=mostarda", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", unknown)
+	res = c.do(http.MethodGet, "/receitas/facets?exclude_allergen=mostarda", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", unknown)
+}
+
+func testSubstitutions(t *testing.T, c *client) {
+	res := c.do(http.MethodPost, "/receitas", []byte(`{
+		"name": "Bolo simples",
+		"ingredients": ["2 xícaras de farinha de trigo", "100 g de manteiga", "3 ovos"],
+		"steps": [{"text": "Bata a manteiga com os ovos", "ingredients": ["manteiga", "ovos"]}]
+	}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+
+	res = c.do(http.MethodGet, "/receitas/bolo-simples/substitutions?missing=manteiga,margarina", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	var result recipes.SubstitutedRecipe
+	require.NoError(t, json.Unmarshal([]byte(res.body), &result))
+	assert.Equal(t, "bolo-simples", result.Recipe.ID)
+	assert.Equal(t, recipes.Ingredient{Name: "óleo", Quantity: 80, Unit: recipes.UnitGram}, result.Recipe.Ingredients[1])
+	assert.Equal(t, []string{"óleo", "ovos"}, result.Recipe.Steps[0].Ingredients)
+	assert.Equal(t, []string{"eggs", "gluten"}, result.Recipe.Allergens)
+	require.Len(t, result.Substitutions, 1)
+	assert.Equal(t, "manteiga", result.Substitutions[0].Original.Name)
+	assert.Equal(t, "a massa fica mais úmida e menos aerada", result.Substitutions[0].Note)
+
+	// A receita gravada não muda
+	res = c.do(http.MethodGet, "/receitas/bolo-simples", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Contains(t, res.body, `"manteiga"`)
+
+	res = c.do(http.MethodGet, "/receitas/bolo-simples/substitutions", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "missing is required")
+	res = c.do(http.MethodGet, "/receitas/bolo-simples/substitutions?missing=chocolate", nil)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "chocolate: not an ingredient of the recipe")
+	res = c.do(http.MethodGet, "/receitas/pudim/substitutions?missing=leite", nil)
+	assert.Equal(t, http.StatusNotFound, res.status, res.body)
+	res = c.do(http.MethodPost, "/receitas/bolo-simples/substitutions?missing=ovos", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.status, res.body)
+}
+
+func testShoppingLists(t *testing.T, c *client) {
+	for _, body := range []string{
+		`{"name": "Bolo simples", "servings": 8, "ingredients": ["2 xícaras de farinha de trigo", "100 g de manteiga", "3 ovos"]}`,
+		`{"name": "Pão caseiro", "ingredients": ["500 g de farinha de trigo", "1 colher de sopa de fermento", "sal a gosto"]}`,
+	} {
+		res := c.do(http.MethodPost, "/receitas", []byte(body))
+		require.Equal(t, http.StatusCreated, res.status, res.body)
+	}
+	request := []byte(`{"recipes": [{"id": "bolo-simples", "servings": 16}, "pao-caseiro"], "pantry": ["ovos"]}`)
+
+	res := c.do(http.MethodPost, "/shopping-lists", request)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, "application/json", res.header.Get("Content-Type"))
+	var list recipes.ShoppingList
+	require.NoError(t, json.Unmarshal([]byte(res.body), &list))
+	assert.Equal(t, recipes.ShoppingList{
+		Recipes: []recipes.ShoppingRecipe{
+			{ID: "bolo-simples", Name: "Bolo simples", Servings: 16},
+			{ID: "pao-caseiro", Name: "Pão caseiro"},
+		},
+		Aisles: []recipes.ShoppingAisle{
+			{Key: "dairy", Name: "Frios e laticínios", Items: []recipes.ShoppingItem{
+				{Name: "manteiga", Amounts: []recipes.Amount{{Quantity: 200, Unit: recipes.UnitGram}}, Recipes: []string{"bolo-simples"}},
+			}},
+			{Key: "pantry", Name: "Mercearia", Items: []recipes.ShoppingItem{
+				{Name: "farinha de trigo", Amounts: []recipes.Amount{{Quantity: 8.17, Unit: recipes.UnitCup}}, Recipes: []string{"bolo-simples", "pao-caseiro"}},
+				{Name: "fermento", Amounts: []recipes.Amount{{Quantity: 1, Unit: recipes.UnitTablespoon}}, Recipes: []string{"pao-caseiro"}},
+			}},
+			{Key: "spices", Name: "Temperos", Items: []recipes.ShoppingItem{
+				{Name: "sal", Recipes: []string{"pao-caseiro"}},
+			}},
+		},
+		InPantry: []string{"ovos"},
+	}, list)
+
+	res = c.doWithHeader(http.MethodPost, "/shopping-lists", http.Header{"Accept": {"text/html, text/plain;q=0.9"}}, request)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, service.TextContentType, res.header.Get("Content-Type"))
+	assert.Contains(t, res.body, "\nFrios e laticínios\n- manteiga: 200 g\n")
+
+	res = c.do(http.MethodPost, "/shopping-lists?format=markdown", request)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assert.Equal(t, service.MarkdownContentType, res.header.Get("Content-Type"))
+	assert.Contains(t, res.body, "## Mercearia\n\n- [ ] farinha de trigo: 8.17 cup\n- [ ] fermento: 1 tbsp\n")
+
+	res = c.doWithHeader(http.MethodPost, "/shopping-lists", http.Header{"Accept": {"image/png"}}, request)
+	assertProblem(t, res, http.StatusNotAcceptable, "/problems/not-acceptable", "shopping lists are available as application/json, text/plain or text/markdown")
+	res = c.do(http.MethodPost, "/shopping-lists?format=pdf", request)
+	assertProblem(t, res, http.StatusBadRequest, "/problems/bad-request", "format must be json, text or markdown")
+
+	res = c.do(http.MethodPost, "/shopping-lists", []byte(`{"recipes": ["pudim", {"id": "pao-caseiro", "servings": 4}]}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "invalid shopping list")
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "recipes[0].id", Message: "recipe not found"},
+		{Field: "recipes[1].servings", Message: "recipe has no servings count to scale from"},
+	}, problem.Errors)
+
+	res = c.do(http.MethodPost, "/shopping-lists", []byte(`{"recipes": []}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "invalid shopping list")
+	assert.Equal(t, []recipes.FieldError{{Field: "recipes", Message: "must list at least one recipe"}}, problem.Errors)
+
+	res = c.do(http.MethodGet, "/shopping-lists", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.status, res.body)
+}
+
+func testPlans(t *testing.T, c *client) {
+	for _, body := range []string{
+		`{"name": "Salada", "tags": ["vegano", "rápido"], "total_time": "PT15M", "ingredients": ["alface"]}`,
+		`{"name": "Sopa", "tags": ["vegano"], "total_time": "PT1H", "ingredients": ["abóbora"]}`,
+		`{"name": "Omelete", "tags": ["rápido"], "active_time": "PT10M", "ingredients": ["ovos"]}`,
+	} {
+		res := c.do(http.MethodPost, "/receitas", []byte(body))
+		require.Equal(t, http.StatusCreated, res.status, res.body)
+	}
+
+	res := c.do(http.MethodPost, "/planos", []byte(`{"name": "Semana 1", "slots": [
+		{"date": "2024-05-07", "meal": "almoço", "recipe_id": "sopa"},
+		{"date": "2024-05-06", "meal": "jantar", "recipe_id": "salada", "servings": 2},
+		{"date": "2024-05-08", "meal": "lunch", "recipe_id": "omelete"}]}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, "/planos/semana-1", res.header.Get("Location"))
+	v1 := assertETag(t, res, 1)
+	var plan recipes.Plan
+	require.NoError(t, json.Unmarshal([]byte(res.body), &plan))
+	assert.Equal(t, "semana-1", plan.ID)
+	// Os slots voltam em ordem cronológica, com a refeição em inglês
+	assert.Equal(t, []recipes.PlanSlot{
+		{Date: "2024-05-06", Meal: recipes.MealDinner, RecipeID: "salada", Servings: 2},
+		{Date: "2024-05-07", Meal: recipes.MealLunch, RecipeID: "sopa"},
+		{Date: "2024-05-08", Meal: recipes.MealLunch, RecipeID: "omelete"},
+	}, plan.Slots)
+
+	// Um nome repetido ganha um sufixo
+	res = c.do(http.MethodPost, "/planos", []byte(`{"name": "Semana 1", "slots": []}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, "/planos/semana-1-2", res.header.Get("Location"))
+
+	res = c.do(http.MethodPost, "/planos", []byte(`{"name": "Semana 2", "slots": [
+		{"date": "2024-05-06", "meal": "ceia", "recipe_id": "sopa"},
+		{"date": "2024-05-06", "meal": "lunch", "recipe_id": "pudim"}]}`))
+	problem := assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "invalid plan")
+	assert.Equal(t, []recipes.FieldError{{Field: "slots[0].meal", Message: "must be one of breakfast, lunch, snack, dinner"}}, problem.Errors)
+	res = c.do(http.MethodPost, "/planos", []byte(`{"name": "Semana 2", "slots": [{"date": "2024-05-06", "meal": "lunch", "recipe_id": "pudim"}]}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "invalid plan")
+	assert.Equal(t, []recipes.FieldError{{Field: "slots[0].recipe_id", Message: "recipe not found"}}, problem.Errors)
+
+	res = c.do(http.MethodGet, "/planos", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	var plans []recipes.Plan
+	require.NoError(t, json.Unmarshal([]byte(res.body), &plans))
+	require.Len(t, plans, 2)
+	assert.Equal(t, "semana-1", plans[0].ID)
+	assert.Equal(t, "semana-1-2", plans[1].ID)
+
+	res = c.do(http.MethodPost, "/planos/generate", []byte(`{"name": "Rápida", "start": "2024-05-06", "days": 2,
+		"meals": ["jantar"], "tags": ["rapido"], "max_time": "PT20M", "no_repeat_days": 2}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, "/planos/rapida", res.header.Get("Location"))
+	var generated recipes.Plan
+	require.NoError(t, json.Unmarshal([]byte(res.body), &generated))
+	assert.Equal(t, []recipes.PlanSlot{
+		{Date: "2024-05-06", Meal: recipes.MealDinner, RecipeID: "omelete"},
+		{Date: "2024-05-07", Meal: recipes.MealDinner, RecipeID: "salada"},
+	}, generated.Slots)
+	res = c.do(http.MethodPost, "/planos/generate", []byte(`{"start": "2024-05-06", "days": 3, "meals": ["jantar"], "tags": ["rapido"], "no_repeat_days": 3}`))
+	assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "not enough recipes: no recipe left for dinner on 2024-05-08")
+	res = c.do(http.MethodPost, "/planos/generate", []byte(`{"days": 40, "meals": ["ceia"]}`))
+	problem = assertProblem(t, res, http.StatusUnprocessableEntity, "/problems/validation", "invalid plan constraints")
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "days", Message: "must be between 1 and 31"},
+		{Field: "meals[0]", Message: "unknown meal"},
+	}, problem.Errors)
+
+	// /planos/generate encobriria o plano, então o ID ganha um sufixo
+	res = c.do(http.MethodPost, "/planos", []byte(`{"name": "Generate", "slots": []}`))
+	require.Equal(t, http.StatusCreated, res.status, res.body)
+	assert.Equal(t, "/planos/generate-2", res.header.Get("Location"))
+	res = c.do(http.MethodGet, "/planos/generate-2", nil)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+
+	// Receita renomeada segue no plano com o ID novo; receita na lixeira
+	// ou apagada gera um aviso
+	res = c.do(http.MethodPost, "/receitas/sopa/rename", []byte(`{"name": "Sopa de abóbora"}`))
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	res = c.do(http.MethodDelete, "/receitas/salada", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	res = c.do(http.MethodDelete, "/receitas/omelete?permanent=true", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	res = c.do(http.MethodGet, "/planos/semana-1", nil)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	plan = recipes.Plan{}
+	require.NoError(t, json.Unmarshal([]byte(res.body), &plan))
+	assert.Equal(t, "sopa-de-abobora", plan.Slots[1].RecipeID)
+	assert.Equal(t, []recipes.PlanWarning{
+		{Slot: 0, RecipeID: "salada", Message: "recipe is in the trash"},
+		{Slot: 2, RecipeID: "omelete", Message: "recipe was deleted"},
+	}, plan.Warnings)
+
+	// PUT com If-Match; o corpo de um GET pode voltar como veio
+	res = c.doWithHeader(http.MethodPut, "/planos/semana-1", http.Header{"If-Match": {`"2"`}}, []byte(`{"name": "Semana 1", "slots": []}`))
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "plan does not match If-Match")
+	// Só a sopa: uma receita que não existe mais não pode entrar no plano
+	plan.Slots = plan.Slots[1:2]
+	body, err := json.Marshal(plan)
+	require.NoError(t, err)
+	res = c.doWithHeader(http.MethodPut, "/planos/semana-1", http.Header{"If-Match": {v1}}, body)
+	require.Equal(t, http.StatusOK, res.status, res.body)
+	assertETag(t, res, 2)
+	res = c.do(http.MethodPut, "/planos/semana-1", []byte(`{"id": "outro", "name": "Semana 1", "slots": []}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, res.status, res.body)
+	res = c.do(http.MethodPut, "/planos/semana-9", []byte(`{"name": "Semana 9", "slots": []}`))
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+
+	res = c.doWithHeader(http.MethodDelete, "/planos/semana-1", http.Header{"If-Match": {v1}}, nil)
+	assertProblem(t, res, http.StatusPreconditionFailed, "/problems/precondition-failed", "plan does not match If-Match")
+	res = c.do(http.MethodDelete, "/planos/semana-1", nil)
+	assert.Equal(t, http.StatusOK, res.status, res.body)
+	res = c.do(http.MethodGet, "/planos/semana-1", nil)
+	assertProblem(t, res, http.StatusNotFound, "/problems/not-found", "not found")
+	res = c.do(http.MethodPatch, "/planos/semana-1-2", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.status, res.body)
+}
+
+// tickingClock - um relógio que avança um segundo a cada leitura, para que
+// created_at e updated_at não empatem
+func tickingClock() func() time.Time {
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+// parseLinks - os links de um cabeçalho Link, pelo rel
+func parseLinks(t *testing.T, header string) map[string]string {
+	t.Helper()
+	links := make(map[string]string)
+	if header == "" {
+		return links
+	}
+	for _, link := range strings.Split(header, ", ") {
+		target, rel, ok := strings.Cut(link, ">; rel=")
+		require.True(t, ok, header)
+		links[strings.Trim(rel, `"`)] = strings.TrimPrefix(target, "<")
+	}
+	return links
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   string
+	path   string
+}
+
+// assertProblem - confere uma resposta de erro application/problem+json
+// (RFC 7807) e devolve o corpo decodificado
+func assertProblem(t *testing.T, res response, status int, problemType, detail string) service.Problem {
+	t.Helper()
+
+	assert.Equal(t, status, res.status, res.path)
+	assert.Equal(t, service.ProblemContentType, res.header.Get("Content-Type"), res.path)
+
+	var problem service.Problem
+	require.NoError(t, json.Unmarshal([]byte(res.body), &problem), res.body)
+	assert.Equal(t, problemType, problem.Type, res.path)
+	assert.Equal(t, http.StatusText(status), problem.Title, res.path)
+	assert.Equal(t, status, problem.Status, res.path)
+	assert.Equal(t, detail, problem.Detail, res.path)
+	assert.Equal(t, res.path, problem.Instance)
+	return problem
+}
+
+type client struct {
+	t       *testing.T
+	handler http.Handler
+	store   service.Store
+}
+
+func (c *client) do(method, path string, body []byte) response {
+	c.t.Helper()
+	return c.doWithContentType(method, path, "application/json", body)
+}
+
+func (c *client) doWithContentType(method, path, contentType string, body []byte) response {
+	c.t.Helper()
+	return c.doWithHeader(method, path, http.Header{"Content-Type": {contentType}}, body)
+}
+
+// doWithHeader - faz a requisição com os cabeçalhos informados. O
+// Content-Type só é enviado quando há corpo
+func (c *client) doWithHeader(method, path string, header http.Header, body []byte) response {
+	c.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	for name, values := range header {
+		if name == "Content-Type" && body == nil {
+			continue
+		}
+		req.Header[name] = values
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	c.handler.ServeHTTP(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+	data, err := io.ReadAll(result.Body)
+	require.NoError(c.t, err)
+
+	return response{status: result.StatusCode, header: result.Header, body: string(data), path: req.URL.Path}
+}
+
+// assertETag - a resposta traz a etiqueta forte da versão informada
+// ("2-<criação>"); devolve a etiqueta para os If-Match seguintes
+func assertETag(t *testing.T, res response, version int64) string {
+	t.Helper()
+	etag := res.header.Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `"`+strconv.FormatInt(version, 10)+"-"), "ETag %s is not version %d", etag, version)
+	return etag
+}
+
+func (c *client) assertStoreLen(want int) {
+	c.t.Helper()
+	list, err := c.store.List()
+	require.NoError(c.t, err)
+	assert.Len(c.t, list, want)
+}
+
+// withID - o JSON da receita em data com o campo "id" que o servidor devolve
+func withID(t *testing.T, data []byte, id string) string {
+	t.Helper()
+
+	var recipe map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &recipe))
+	recipe["id"] = id
+	out, err := json.Marshal(recipe)
+	require.NoError(t, err)
+	return string(out)
+}
+
+// withoutMetadata - o JSON de uma receita, ou de uma lista delas, sem os
+// campos preenchidos pelo servidor: created_at e updated_at, que dependem do
+// relógio, e version, conferida à parte. Os três precisam estar presentes.
+// updated_by e allergens, que nem toda receita tem, também saem
+func withoutMetadata(t *testing.T, body string) string {
+	t.Helper()
+
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &decoded), body)
+	list, isList := decoded.([]interface{})
+	if !isList {
+		list = []interface{}{decoded}
+	}
+	for _, item := range list {
+		recipe, ok := item.(map[string]interface{})
+		require.True(t, ok, body)
+		for _, field := range []string{"created_at", "updated_at", "version"} {
+			assert.NotEmpty(t, recipe[field], field)
+			delete(recipe, field)
+		}
+		delete(recipe, "updated_by")
+		delete(recipe, "allergens")
+	}
+	out, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	return string(out)
+}
+
+// readTestData - lê um arquivo de testdata/ na raiz do repositório
+func readTestData(t *testing.T, name string) []byte {
+	t.Helper()
+	_, file, _, ok := runtime.Caller(0)
+	require.True(t, ok)
+
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(file), "..", "..", "..", "testdata", name))
+	if err != nil {
+		t.Fatalf("Não conseguiu ler %v: %v", name, err)
+	}
+	return content
+}
@@ -0,0 +1,89 @@
+package recipes
+
+import (
+	"strings"
+
+	"github.com/gosimple/slug"
+)
+
+// density - gramas por mililitro. liquid indica que, no sistema métrico, o
+// ingrediente continua sendo medido em volume
+type density struct {
+	gramsPerML float64
+	liquid     bool
+}
+
+// densities - densidades aproximadas dos ingredientes mais comuns, pelo
+// slug do nome em português e em inglês. Os valores dos sólidos são os das
+// tabelas de culinária (uma xícara de farinha de trigo pesa cerca de 120 g),
+// não os da substância compactada
+var densities = map[string]density{
+	// Farinhas e amidos
+	"farinha":           {0.5, false},
+	"farinha-de-trigo":  {0.5, false},
+	"flour":             {0.5, false},
+	"all-purpose-flour": {0.5, false},
+	"amido-de-milho":    {0.54, false},
+	"maisena":           {0.54, false},
+	"cornstarch":        {0.54, false},
+	"fuba":              {0.62, false},
+	"cornmeal":          {0.62, false},
+	"aveia":             {0.38, false},
+	"oats":              {0.38, false},
+	"cacau-em-po":       {0.36, false},
+	"chocolate-em-po":   {0.36, false},
+	"cocoa-powder":      {0.36, false},
+	// Açúcares e sal
+	"acucar":                {0.85, false},
+	"sugar":                 {0.85, false},
+	"acucar-mascavo":        {0.93, false},
+	"brown-sugar":           {0.93, false},
+	"acucar-de-confeiteiro": {0.5, false},
+	"powdered-sugar":        {0.5, false},
+	"sal":                   {1.2, false},
+	"salt":                  {1.2, false},
+	// Gorduras e laticínios
+	"manteiga":         {0.96, false},
+	"butter":           {0.96, false},
+	"queijo-ralado":    {0.42, false},
+	"grated-cheese":    {0.42, false},
+	"arroz":            {0.78, false},
+	"rice":             {0.78, false},
+	"leite":            {1.03, true},
+	"milk":             {1.03, true},
+	"leite-condensado": {1.3, true},
+	"condensed-milk":   {1.3, true},
+	"creme-de-leite":   {1.0, true},
+	"cream":            {1.0, true},
+	"iogurte":          {1.03, true},
+	"yogurt":           {1.03, true},
+	"agua":             {1.0, true},
+	"water":            {1.0, true},
+	"oleo":             {0.92, true},
+	"oil":              {0.92, true},
+	"azeite":           {0.91, true},
+	"olive-oil":        {0.91, true},
+	"mel":              {1.42, true},
+	"honey":            {1.42, true},
+}
+
+// densityOf - a densidade do ingrediente. Vale a entrada mais longa que
+// seja o nome inteiro, o começo dele ("farinha de trigo peneirada") ou, em
+// inglês, o fim ("unsalted butter")
+func densityOf(name string) (density, bool) {
+	key := slug.Make(name)
+
+	var best string
+	for k := range densities {
+		if len(k) <= len(best) {
+			continue
+		}
+		if key == k || strings.HasPrefix(key, k+"-") || strings.HasSuffix(key, "-"+k) {
+			best = k
+		}
+	}
+	if best == "" {
+		return density{}, false
+	}
+	return densities[best], true
+}
@@ -0,0 +1,87 @@
+package recipes
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration - um time.Duration que no JSON é uma duração ISO-8601
+// ("PT1H30M", "P1DT2H", "PT45S"). Anos e meses não são aceitos, porque
+// não têm duração fixa
+type Duration time.Duration
+
+// isoDurationRe - PnW, PnD e a parte de tempo (TnHnMnS); só os segundos
+// podem ter fração
+var isoDurationRe = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// ParseDuration - converte uma duração ISO-8601 em Duration
+func ParseDuration(s string) (Duration, error) {
+	m := isoDurationRe.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil || s == "P" || strings.HasSuffix(strings.ToUpper(s), "T") {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q", s)
+	}
+
+	var total float64
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.Replace(m[i+1], ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q", s)
+		}
+		total += v * float64(unit)
+	}
+	if total > math.MaxInt64 {
+		return 0, fmt.Errorf("ISO-8601 duration %q is too long", s)
+	}
+	return Duration(total), nil
+}
+
+// String - a duração em ISO-8601, em horas, minutos e segundos ("PT26H5M")
+func (d Duration) String() string {
+	if d <= 0 {
+		return "PT0S"
+	}
+
+	var b strings.Builder
+	b.WriteString("PT")
+	rest := time.Duration(d)
+	if h := rest / time.Hour; h > 0 {
+		fmt.Fprintf(&b, "%dH", h)
+		rest -= h * time.Hour
+	}
+	if m := rest / time.Minute; m > 0 {
+		fmt.Fprintf(&b, "%dM", m)
+		rest -= m * time.Minute
+	}
+	if rest > 0 {
+		b.WriteString(strconv.FormatFloat(rest.Seconds(), 'f', -1, 64) + "S")
+	}
+	return b.String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("ISO-8601 duration must be a string, got %s", data)
+	}
+	parsed, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
@@ -0,0 +1,73 @@
+package recipes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "PT45S", want: 45 * time.Second},
+		{in: "PT1,5S", want: 1500 * time.Millisecond},
+		{in: "P1DT2H", want: 26 * time.Hour},
+		{in: "P1W", want: 7 * 24 * time.Hour},
+		{in: "pt10m", want: 10 * time.Minute},
+		{in: "P0D", want: 0},
+		{in: "P", wantErr: true},
+		{in: "PT", wantErr: true},
+		{in: "P1DT", wantErr: true},
+		{in: "P1Y", wantErr: true},
+		{in: "PT1.5H", wantErr: true},
+		{in: "1h30m", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDuration(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Duration(tt.want), got)
+		})
+	}
+}
+
+func TestDuration_String(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                                   "PT0S",
+		90 * time.Minute:                    "PT1H30M",
+		26*time.Hour + 5*time.Minute:        "PT26H5M",
+		time.Minute + 1500*time.Millisecond: "PT1M1.5S",
+	} {
+		assert.Equal(t, want, Duration(d).String())
+
+		// Volta ao mesmo valor
+		parsed, err := ParseDuration(want)
+		require.NoError(t, err)
+		assert.Equal(t, Duration(d), parsed)
+	}
+}
+
+func TestDuration_JSON(t *testing.T) {
+	var step Step
+	require.NoError(t, json.Unmarshal([]byte(`{"text": "Asse", "timer": "PT40M"}`), &step))
+	assert.Equal(t, Duration(40*time.Minute), step.Timer)
+
+	data, err := json.Marshal(step)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "Asse", "timer": "PT40M"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"timer": "40 minutos"}`), &step))
+	assert.Error(t, json.Unmarshal([]byte(`{"timer": 2400}`), &step))
+}
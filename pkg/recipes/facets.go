@@ -0,0 +1,158 @@
+package recipes
+
+import (
+	"sort"
+
+	"github.com/gosimple/slug"
+)
+
+// Facets - quantas receitas da listagem filtrada têm cada tag e cada
+// ingrediente, para montar a navegação por filtros. As tags são separadas
+// pelo tipo (veja TagKind)
+type Facets struct {
+	// Total - quantas receitas passam pelos filtros
+	Total       int          `json:"total"`
+	Categories  []FacetCount `json:"categories"`
+	Diets       []FacetCount `json:"diets"`
+	Tags        []FacetCount `json:"tags"`
+	Ingredients []FacetCount `json:"ingredients"`
+}
+
+// FacetCount - um valor da faceta e em quantas receitas ele aparece
+type FacetCount struct {
+	// Value - o valor normalizado, que pode ir direto no filtro (?tag= ou
+	// ?ingredient=)
+	Value string `json:"value"`
+	// Name - como mostrar o valor: o nome do vocabulário, para as tags
+	// conhecidas, ou a primeira grafia em ordem alfabética
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// facetCounter - soma as contagens das facetas. As lojas em memória contam
+// receita a receita (add); a SQLStore já recebe as contagens agrupadas do
+// banco (addTag e addIngredient)
+type facetCounter struct {
+	total       int
+	tags        map[string]*FacetCount
+	ingredients map[string]*FacetCount
+}
+
+func newFacetCounter() *facetCounter {
+	return &facetCounter{
+		tags:        make(map[string]*FacetCount),
+		ingredients: make(map[string]*FacetCount),
+	}
+}
+
+// add - conta a receita. Uma tag ou um ingrediente repetido na mesma
+// receita conta uma vez só
+func (c *facetCounter) add(recipe Recipe) {
+	c.total++
+	tags := make(map[string]bool, len(recipe.Tags))
+	for _, tag := range recipe.Tags {
+		if key := TagKey(tag); !tags[key] {
+			tags[key] = true
+			c.addTag(key, tag, 1)
+		}
+	}
+	ingredients := make(map[string]bool, len(recipe.Ingredients))
+	for _, ingredient := range recipe.Ingredients {
+		if key := slug.Make(ingredient.Name); !ingredients[key] {
+			ingredients[key] = true
+			c.addIngredient(key, ingredient.Name, 1)
+		}
+	}
+}
+
+// addTag - soma n receitas à tag key, escrita como name
+func (c *facetCounter) addTag(key, name string, n int) {
+	addFacet(c.tags, key, name, n)
+}
+
+// addIngredient - soma n receitas ao ingrediente key, escrito como name
+func (c *facetCounter) addIngredient(key, name string, n int) {
+	addFacet(c.ingredients, key, name, n)
+}
+
+func addFacet(counts map[string]*FacetCount, key, name string, n int) {
+	if key == "" {
+		return
+	}
+	count, ok := counts[key]
+	if !ok {
+		count = &FacetCount{Value: key, Name: name}
+		counts[key] = count
+	}
+	if name < count.Name {
+		count.Name = name
+	}
+	count.Count += n
+}
+
+// facets - as contagens, das mais frequentes para as menos frequentes;
+// empates pelo valor
+func (c *facetCounter) facets() Facets {
+	facets := Facets{
+		Total:       c.total,
+		Categories:  []FacetCount{},
+		Diets:       []FacetCount{},
+		Tags:        []FacetCount{},
+		Ingredients: sortFacet(c.ingredients),
+	}
+	for _, count := range sortFacet(c.tags) {
+		known := knownTags[count.Value]
+		switch known.Kind {
+		case TagKindCategory:
+			count.Name = known.Name
+			facets.Categories = append(facets.Categories, count)
+		case TagKindDiet:
+			count.Name = known.Name
+			facets.Diets = append(facets.Diets, count)
+		default:
+			facets.Tags = append(facets.Tags, count)
+		}
+	}
+	return facets
+}
+
+func sortFacet(counts map[string]*FacetCount) []FacetCount {
+	facet := make([]FacetCount, 0, len(counts))
+	for _, count := range counts {
+		facet = append(facet, *count)
+	}
+	sort.Slice(facet, func(i, j int) bool {
+		if facet[i].Count != facet[j].Count {
+			return facet[i].Count > facet[j].Count
+		}
+		return facet[i].Value < facet[j].Value
+	})
+	return facet
+}
+
+// Limit - corta cada faceta nos n valores mais frequentes
+func (f Facets) Limit(n int) Facets {
+	cut := func(facet []FacetCount) []FacetCount {
+		if len(facet) > n {
+			return facet[:n]
+		}
+		return facet
+	}
+	f.Categories = cut(f.Categories)
+	f.Diets = cut(f.Diets)
+	f.Tags = cut(f.Tags)
+	f.Ingredients = cut(f.Ingredients)
+	return f
+}
+
+// CountFacets - as facetas das receitas de list que passam pelos filtros
+// de opts. Ordenação, cursor e limite não se aplicam
+func CountFacets(list map[string]Recipe, opts ListOptions) Facets {
+	counter := newFacetCounter()
+	for _, recipe := range list {
+		if opts.matches(recipe) {
+			counter.add(recipe)
+		}
+	}
+	return counter.facets()
+}
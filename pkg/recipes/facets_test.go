@@ -0,0 +1,137 @@
+package recipes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Facets(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreFacets(t, factory)
+	})
+}
+
+func testStoreFacets(t *testing.T, factory storeFactory) {
+	seed := getListingRecipes()
+	brigadeiro := seed["brigadeiro"]
+	brigadeiro.Tags = []string{"Sobremesa", "sem gluten", "festa"}
+	seed["brigadeiro"] = brigadeiro
+	bolo := seed["bolo-de-cenoura"]
+	bolo.Tags = []string{"sobremesa", "Festa"}
+	seed["bolo-de-cenoura"] = bolo
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want Facets
+	}{
+		{
+			name: "Everything",
+			opts: ListOptions{},
+			want: Facets{
+				Total:      4,
+				Categories: []FacetCount{{Value: "sobremesa", Name: "Sobremesa", Count: 2}},
+				Diets:      []FacetCount{{Value: "sem-gluten", Name: "Sem glúten", Count: 1}},
+				Tags: []FacetCount{
+					{Value: "festa", Name: "Festa", Count: 2},
+					{Value: "doce", Name: "doce", Count: 1},
+				},
+				Ingredients: []FacetCount{
+					{Value: "chocolate-em-po", Name: "chocolate em pó", Count: 2},
+					{Value: "arroz", Name: "arroz", Count: 1},
+					{Value: "cenoura", Name: "cenoura", Count: 1},
+					{Value: "leite", Name: "leite", Count: 1},
+					{Value: "leite-condensado", Name: "leite condensado", Count: 1},
+					{Value: "ovos", Name: "ovos", Count: 1},
+					{Value: "pao", Name: "pão", Count: 1},
+					{Value: "queijo-minas", Name: "queijo minas", Count: 1},
+				},
+			},
+		},
+		{
+			name: "Filtered by tag and ingredient",
+			opts: ListOptions{Tags: []string{"sobremesa"}, ExcludeIngredients: []string{"ovos"}},
+			want: Facets{
+				Total:      1,
+				Categories: []FacetCount{{Value: "sobremesa", Name: "Sobremesa", Count: 1}},
+				Diets:      []FacetCount{{Value: "sem-gluten", Name: "Sem glúten", Count: 1}},
+				Tags:       []FacetCount{{Value: "festa", Name: "festa", Count: 1}},
+				Ingredients: []FacetCount{
+					{Value: "chocolate-em-po", Name: "chocolate em pó", Count: 1},
+					{Value: "leite-condensado", Name: "leite condensado", Count: 1},
+				},
+			},
+		},
+		{
+			name: "Nothing matches",
+			opts: ListOptions{Tags: []string{"vegano"}},
+			want: Facets{Categories: []FacetCount{}, Diets: []FacetCount{}, Tags: []FacetCount{}, Ingredients: []FacetCount{}},
+		},
+	}
+	store := newSeededStore(t, factory, seed)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facets, err := store.Facets(tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, facets)
+		})
+	}
+
+	t.Run("Follows writes", func(t *testing.T) {
+		store := newSeededStore(t, factory, seed)
+		require.NoError(t, store.MoveToTrash("brigadeiro", 0, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+		arroz := seed["arroz-doce"]
+		arroz.Tags = []string{"sobremesa", "vegano"}
+		require.NoError(t, store.Update("arroz-doce", arroz))
+		bolo := seed["bolo-de-cenoura"]
+		bolo.Name, bolo.Version = "Bolo", 1
+		require.NoError(t, store.Rename("bolo-de-cenoura", "bolo", 0, bolo))
+
+		facets, err := store.Facets(ListOptions{Tags: []string{"sobremesa"}})
+		require.NoError(t, err)
+		assert.Equal(t, 2, facets.Total)
+		assert.Equal(t, []FacetCount{{Value: "vegano", Name: "Vegano", Count: 1}}, facets.Diets)
+
+		page, err := store.ListPage(ListOptions{Tags: []string{"sobremesa"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"arroz-doce", "bolo"}, pageIDs(page))
+		page, err = store.ListPage(ListOptions{Tags: []string{"doce"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{}, pageIDs(page))
+	})
+}
+
+func TestFacets_Limit(t *testing.T) {
+	facets := Facets{
+		Categories:  []FacetCount{{Value: "sobremesa", Count: 2}, {Value: "lanche", Count: 1}},
+		Diets:       []FacetCount{},
+		Tags:        []FacetCount{{Value: "festa", Count: 1}},
+		Ingredients: []FacetCount{{Value: "ovos", Count: 3}, {Value: "leite", Count: 2}, {Value: "sal", Count: 1}},
+	}
+	limited := facets.Limit(1)
+	assert.Equal(t, []FacetCount{{Value: "sobremesa", Count: 2}}, limited.Categories)
+	assert.Equal(t, []FacetCount{}, limited.Diets)
+	assert.Equal(t, []FacetCount{{Value: "festa", Count: 1}}, limited.Tags)
+	assert.Equal(t, []FacetCount{{Value: "ovos", Count: 3}}, limited.Ingredients)
+}
+
+func TestLookupTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Tag
+	}{
+		{tag: "sobremesa", want: Tag{Key: "sobremesa", Name: "Sobremesa", Kind: TagKindCategory}},
+		{tag: "Prato Principal", want: Tag{Key: "prato-principal", Name: "Prato principal", Kind: TagKindCategory}},
+		{tag: "sem gluten", want: Tag{Key: "sem-gluten", Name: "Sem glúten", Kind: TagKindDiet}},
+		{tag: "VEGANO", want: Tag{Key: "vegano", Name: "Vegano", Kind: TagKindDiet}},
+		{tag: "Rápido", want: Tag{Key: "rapido", Name: "Rápido", Kind: TagKindFree}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			assert.Equal(t, tt.want, LookupTag(tt.tag))
+		})
+	}
+}
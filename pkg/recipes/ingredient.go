@@ -0,0 +1,195 @@
+package recipes
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	// optionalRe - "(opcional)", ", opcional", "optional" no fim da linha
+	optionalRe = regexp.MustCompile(`(?i)[\s,(]*\b(opcional|optional)\b\)?\s*$`)
+	// parenRe - observações entre parênteses: "manteiga (em temperatura ambiente)"
+	parenRe = regexp.MustCompile(`\s*\(([^)]*)\)`)
+	// numberUnitRe - número colado na unidade: "200g", "1,5kg", "½xícara"
+	numberUnitRe = regexp.MustCompile(`^([0-9]+(?:[.,][0-9]+)?|[0-9]*[½⅓⅔¼¾⅛])([^0-9\s/.,½⅓⅔¼¾⅛].*)$`)
+	// decimalRe - "2", "1.5" ou "1,5"
+	decimalRe = regexp.MustCompile(`^[0-9]+(?:[.,][0-9]+)?$`)
+	// fractionRe - "1/2"
+	fractionRe = regexp.MustCompile(`^([0-9]+)/([0-9]+)$`)
+)
+
+// vulgarFractions - frações unicode comuns em receitas copiadas da internet
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4, '⅛': 1.0 / 8,
+}
+
+// numberWords - quantidades escritas por extenso ("uma xícara", "meia
+// cebola", "a pinch of salt")
+var numberWords = map[string]float64{
+	"um": 1, "uma": 1, "a": 1, "an": 1, "one": 1,
+	"dois": 2, "duas": 2, "two": 2,
+	"tres": 3, "três": 3, "three": 3,
+	"quatro": 4, "four": 4,
+	"cinco": 5, "five": 5,
+	"seis": 6, "six": 6,
+	"meio": 0.5, "meia": 0.5, "half": 0.5,
+}
+
+// connectors - palavras entre a unidade e o nome ("2 xícaras de farinha",
+// "1 cup of flour")
+var connectors = map[string]bool{"de": true, "do": true, "da": true, "dos": true, "das": true, "of": true}
+
+// ParseIngredient - converte uma linha de texto livre, em português ou em
+// inglês, em um ingrediente estruturado:
+//
+//	"2 colheres de sopa de manteiga"      -> 2 tbsp manteiga
+//	"1 1/2 xícara de farinha, peneirada" -> 1.5 cup farinha (nota: peneirada)
+//	"200g queijo (opcional)"             -> 200 g queijo, opcional
+//	"3 cloves garlic, minced"            -> 3 clove garlic (nota: minced)
+//	"sal a gosto"                        -> sal (nota: a gosto)
+//
+// O que não for reconhecido como quantidade ou unidade fica no nome, então a
+// conversão nunca perde texto
+func ParseIngredient(line string) Ingredient {
+	var ingredient Ingredient
+	line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "."))
+
+	if loc := optionalRe.FindStringIndex(line); loc != nil {
+		ingredient.Optional = true
+		line = strings.TrimSpace(line[:loc[0]])
+	}
+
+	words := strings.Fields(line)
+	if len(words) > 0 {
+		if m := numberUnitRe.FindStringSubmatch(words[0]); m != nil {
+			words = append([]string{m[1], m[2]}, words[1:]...)
+		}
+	}
+
+	// A quantidade só é aceita se sobrar alguma palavra para o nome
+	if quantity, n := parseQuantity(words); n > 0 && n < len(words) {
+		ingredient.Quantity = quantity
+		if unit, size := parseUnitWords(words[n:]); size > 0 {
+			ingredient.Unit = unit
+			n += size
+			if n < len(words)-1 && connectors[strings.ToLower(words[n])] {
+				n++
+			}
+		}
+		words = words[n:]
+	}
+
+	name, notes := splitNotes(strings.Join(words, " "))
+	ingredient.Name = name
+	ingredient.Note = strings.Join(notes, "; ")
+	return ingredient
+}
+
+// parseQuantity - lê a quantidade no começo de words e devolve quantas
+// palavras ela ocupou. Aceita inteiros, decimais com ponto ou vírgula,
+// frações ("1/2", "½"), números mistos ("1 1/2", "1½") e números por extenso
+func parseQuantity(words []string) (float64, int) {
+	if len(words) == 0 {
+		return 0, 0
+	}
+
+	if quantity, ok := numberWords[strings.ToLower(words[0])]; ok {
+		return quantity, 1
+	}
+
+	quantity, ok := parseNumber(words[0])
+	if !ok {
+		return 0, 0
+	}
+	n := 1
+
+	// Número misto: "1 1/2" ou "1 ½"
+	if len(words) > 1 && !strings.ContainsAny(words[0], "/.,½⅓⅔¼¾⅛") {
+		if fraction, ok := parseNumber(words[1]); ok && fraction < 1 {
+			quantity += fraction
+			n++
+		}
+	}
+	return quantity, n
+}
+
+func parseNumber(s string) (float64, bool) {
+	switch {
+	case decimalRe.MatchString(s):
+		v, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+		return v, err == nil
+	case fractionRe.MatchString(s):
+		m := fractionRe.FindStringSubmatch(s)
+		num, _ := strconv.ParseFloat(m[1], 64)
+		den, _ := strconv.ParseFloat(m[2], 64)
+		if den == 0 {
+			return 0, false
+		}
+		return num / den, true
+	}
+
+	// Inteiro seguido de fração unicode: "1½"
+	runes := []rune(s)
+	last := runes[len(runes)-1]
+	fraction, ok := vulgarFractions[last]
+	if !ok {
+		return 0, false
+	}
+	if len(runes) == 1 {
+		return fraction, true
+	}
+	whole, err := strconv.Atoi(string(runes[:len(runes)-1]))
+	if err != nil {
+		return 0, false
+	}
+	return float64(whole) + fraction, true
+}
+
+// parseUnitWords - a unidade mais longa (em palavras) no começo de words
+func parseUnitWords(words []string) (string, int) {
+	for size := maxUnitWords; size > 0; size-- {
+		// A unidade nunca é a última palavra: sempre sobra o nome
+		if size >= len(words) {
+			continue
+		}
+		if unit, ok := ParseUnit(strings.Join(words[:size], " ")); ok {
+			return unit, size
+		}
+	}
+	return "", 0
+}
+
+// splitNotes - separa o nome das observações: o que estiver entre
+// parênteses, depois da primeira vírgula ou for "a gosto"/"to taste"
+func splitNotes(s string) (string, []string) {
+	var notes []string
+	for _, m := range parenRe.FindAllStringSubmatch(s, -1) {
+		if note := strings.TrimSpace(m[1]); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	s = parenRe.ReplaceAllString(s, "")
+
+	name, note, found := strings.Cut(s, ",")
+	if found {
+		if note = strings.TrimSpace(note); note != "" {
+			notes = append([]string{note}, notes...)
+		}
+	}
+
+	name = strings.TrimSpace(name)
+	lower := strings.ToLower(name)
+	for _, suffix := range []string{" a gosto", " to taste"} {
+		if strings.HasSuffix(lower, suffix) {
+			notes = append([]string{strings.TrimSpace(suffix)}, notes...)
+			name = name[:len(name)-len(suffix)]
+			break
+		}
+	}
+
+	return strings.TrimFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}), notes
+}
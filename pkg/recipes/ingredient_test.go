@@ -0,0 +1,65 @@
+package recipes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIngredient(t *testing.T) {
+	tests := []struct {
+		line string
+		want Ingredient
+	}{
+		// Português
+		{line: "2 colheres de sopa de manteiga", want: Ingredient{Name: "manteiga", Quantity: 2, Unit: UnitTablespoon}},
+		{line: "1 colher (chá) de sal", want: Ingredient{Name: "sal", Quantity: 1, Unit: UnitTeaspoon}},
+		{line: "1 1/2 xícara de farinha, peneirada", want: Ingredient{Name: "farinha", Quantity: 1.5, Unit: UnitCup, Note: "peneirada"}},
+		{line: "½ xícara (chá) de açúcar", want: Ingredient{Name: "açúcar", Quantity: 0.5, Unit: UnitCup}},
+		{line: "meia xícara de leite", want: Ingredient{Name: "leite", Quantity: 0.5, Unit: UnitCup}},
+		{line: "200g queijo (opcional)", want: Ingredient{Name: "queijo", Quantity: 200, Unit: UnitGram, Optional: true}},
+		{line: "1,5 kg de batata", want: Ingredient{Name: "batata", Quantity: 1.5, Unit: UnitKilogram}},
+		{line: "3 dentes de alho, picados", want: Ingredient{Name: "alho", Quantity: 3, Unit: UnitClove, Note: "picados"}},
+		{line: "2 ovos", want: Ingredient{Name: "ovos", Quantity: 2}},
+		{line: "uma cebola (grande), picada", want: Ingredient{Name: "cebola", Quantity: 1, Note: "picada; grande"}},
+		{line: "1 lata de molho de tomate", want: Ingredient{Name: "molho de tomate", Quantity: 1, Unit: UnitCan}},
+		{line: "sal a gosto", want: Ingredient{Name: "sal", Note: "a gosto"}},
+		{line: "Pão", want: Ingredient{Name: "Pão"}},
+		{line: "queijo ralado, opcional", want: Ingredient{Name: "queijo ralado", Optional: true}},
+		// Inglês
+		{line: "2 tbsp butter, melted", want: Ingredient{Name: "butter", Quantity: 2, Unit: UnitTablespoon, Note: "melted"}},
+		{line: "1 cup of flour", want: Ingredient{Name: "flour", Quantity: 1, Unit: UnitCup}},
+		{line: "3 cloves garlic, minced", want: Ingredient{Name: "garlic", Quantity: 3, Unit: UnitClove, Note: "minced"}},
+		{line: "a pinch of salt", want: Ingredient{Name: "salt", Quantity: 1, Unit: UnitPinch}},
+		{line: "4 fl oz milk", want: Ingredient{Name: "milk", Quantity: 4, Unit: UnitFluidOunce}},
+		{line: "1½ lbs ground beef", want: Ingredient{Name: "ground beef", Quantity: 1.5, Unit: UnitPound}},
+		{line: "pepper to taste", want: Ingredient{Name: "pepper", Note: "to taste"}},
+		{line: "parsley (optional)", want: Ingredient{Name: "parsley", Optional: true}},
+		// O número sozinho não vira quantidade, porque não sobraria nome
+		{line: "1900", want: Ingredient{Name: "1900"}},
+		{line: "2 g", want: Ingredient{Name: "g", Quantity: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseIngredient(tt.line))
+		})
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	for alias, want := range map[string]string{
+		"Colheres de Sopa": UnitTablespoon,
+		"xicaras":          UnitCup,
+		"Xícara":           UnitCup,
+		"tsp":              UnitTeaspoon,
+		"Gramas":           UnitGram,
+		"fl oz":            UnitFluidOunce,
+	} {
+		got, ok := ParseUnit(alias)
+		assert.True(t, ok, alias)
+		assert.Equal(t, want, got, alias)
+	}
+
+	_, ok := ParseUnit("punhado")
+	assert.False(t, ok)
+}
@@ -0,0 +1,192 @@
+package recipes
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gosimple/slug"
+)
+
+// DefaultMaxMissing - quantos ingredientes podem faltar para uma receita
+// ainda ser considerada "quase lá"
+const DefaultMaxMissing = 2
+
+// Lister - qualquer loja capaz de listar as receitas
+type Lister interface {
+	List() (map[string]Recipe, error)
+}
+
+// Pantry - Representa o que o usuário tem na geladeira
+type Pantry struct {
+	Ingredients []Ingredient `json:"ingredients"`
+	MaxMissing  *int         `json:"max_missing,omitempty"`
+}
+
+// MatchResult - Representa o quanto uma receita é coberta pela despensa
+type MatchResult struct {
+	ID      string   `json:"id"`
+	Recipe  Recipe   `json:"recipe"`
+	Score   float64  `json:"score"`
+	Have    []string `json:"have,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Matches - Resultado do matcher separado por categoria, cada uma ordenada
+// da maior para a menor pontuação
+type Matches struct {
+	Exact      []MatchResult `json:"exact"`
+	NearMisses []MatchResult `json:"near_misses"`
+	Partial    []MatchResult `json:"partial"`
+}
+
+// Matcher - Ordena receitas pela cobertura dos ingredientes
+type Matcher struct {
+	MaxMissing int
+}
+
+func NewMatcher() Matcher {
+	return Matcher{MaxMissing: DefaultMaxMissing}
+}
+
+// MatchFrom - executa o matcher contra qualquer loja de receitas
+func (m Matcher) MatchFrom(l Lister, pantry []string) (Matches, error) {
+	list, err := l.List()
+	if err != nil {
+		return Matches{}, err
+	}
+	return m.Match(list, pantry), nil
+}
+
+// Match - Calcula a pontuação (ingredientes que o usuário tem / total de
+// ingredientes) de cada receita. Receitas sem ingredientes são ignoradas.
+func (m Matcher) Match(list map[string]Recipe, pantry []string) Matches {
+	have := make([][]string, 0, len(pantry))
+	for _, p := range pantry {
+		if tokens := matchTokens(p); len(tokens) > 0 {
+			have = append(have, tokens)
+		}
+	}
+
+	result := Matches{
+		Exact:      []MatchResult{},
+		NearMisses: []MatchResult{},
+		Partial:    []MatchResult{},
+	}
+	for id, recipe := range list {
+		if len(recipe.Ingredients) == 0 {
+			continue
+		}
+
+		res := MatchResult{ID: id, Recipe: recipe}
+		for _, ingredient := range recipe.Ingredients {
+			if covers(have, matchTokens(ingredient.Name)) {
+				res.Have = append(res.Have, ingredient.Name)
+			} else {
+				res.Missing = append(res.Missing, ingredient.Name)
+			}
+		}
+		res.Score = float64(len(res.Have)) / float64(len(recipe.Ingredients))
+
+		switch {
+		case len(res.Missing) == 0:
+			result.Exact = append(result.Exact, res)
+		case len(res.Missing) <= m.MaxMissing:
+			result.NearMisses = append(result.NearMisses, res)
+		default:
+			result.Partial = append(result.Partial, res)
+		}
+	}
+
+	sortMatches(result.Exact)
+	sortMatches(result.NearMisses)
+	sortMatches(result.Partial)
+	return result
+}
+
+// ParsePantry - Converte uma lista separada por vírgulas ("pão,queijo") nos
+// itens da despensa
+func ParsePantry(s string) []string {
+	var pantry []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			pantry = append(pantry, item)
+		}
+	}
+	return pantry
+}
+
+// Names - Retorna o nome de cada ingrediente da despensa
+func (p Pantry) Names() []string {
+	names := make([]string, 0, len(p.Ingredients))
+	for _, ingredient := range p.Ingredients {
+		names = append(names, ingredient.Name)
+	}
+	return names
+}
+
+func sortMatches(results []MatchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if len(results[i].Missing) != len(results[j].Missing) {
+			return len(results[i].Missing) < len(results[j].Missing)
+		}
+		return results[i].ID < results[j].ID
+	})
+}
+
+// matchTokens - normaliza o nome (sem acentos, minúsculo) e separa em palavras
+func matchTokens(name string) []string {
+	s := slug.Make(name)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "-")
+}
+
+// covers - um ingrediente é coberto quando algum item da despensa tem todas
+// as suas palavras presentes no nome do ingrediente ("queijo" cobre
+// "queijo mussarela")
+func covers(have [][]string, ingredient []string) bool {
+	if len(ingredient) == 0 {
+		return false
+	}
+	words := make(map[string]struct{}, len(ingredient))
+	for _, w := range ingredient {
+		words[w] = struct{}{}
+	}
+	for _, item := range have {
+		all := true
+		for _, w := range item {
+			if _, ok := words[w]; !ok {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// wordSet - as palavras em um conjunto, para consultas
+func wordSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// hasWords - todas as palavras de term estão em words, no singular ou no
+// plural ("ovo" em "ovos", "noz" em "nozes")
+func hasWords(words map[string]bool, term []string) bool {
+	for _, w := range term {
+		if !words[w] && !words[w+"s"] && !words[w+"es"] {
+			return false
+		}
+	}
+	return true
+}
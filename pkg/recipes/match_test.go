@@ -0,0 +1,113 @@
+package recipes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getMatchList() map[string]Recipe {
+	return map[string]Recipe{
+		"torrada-de-presunto-e-queijo": {
+			Name: "Torrada de presunto e queijo",
+			Ingredients: []Ingredient{
+				{Name: "pão"},
+				{Name: "presunto"},
+				{Name: "queijo"},
+			},
+		},
+		"torrada-de-queijo-presunto-e-manteiga": {
+			Name: "Torrada de queijo, presunto e manteiga",
+			Ingredients: []Ingredient{
+				{Name: "pão"},
+				{Name: "presunto"},
+				{Name: "queijo"},
+				{Name: "manteiga"},
+			},
+		},
+		"omelete": {
+			Name: "Omelete",
+			Ingredients: []Ingredient{
+				{Name: "ovos"},
+				{Name: "leite"},
+				{Name: "sal"},
+				{Name: "cebolinha"},
+			},
+		},
+		"agua": {
+			Name: "Água",
+		},
+	}
+}
+
+func TestMatcher_Match(t *testing.T) {
+	tests := []struct {
+		name           string
+		pantry         []string
+		wantExact      []string
+		wantNearMisses []string
+		wantPartial    []string
+	}{
+		{
+			name:           "Exact and near miss",
+			pantry:         []string{"pao", "Queijo", "presunto"},
+			wantExact:      []string{"torrada-de-presunto-e-queijo"},
+			wantNearMisses: []string{"torrada-de-queijo-presunto-e-manteiga"},
+			wantPartial:    []string{"omelete"},
+		},
+		{
+			name:           "Empty pantry",
+			pantry:         nil,
+			wantExact:      []string{},
+			wantNearMisses: []string{},
+			wantPartial:    []string{"torrada-de-presunto-e-queijo", "omelete", "torrada-de-queijo-presunto-e-manteiga"},
+		},
+		{
+			name:           "Specific item does not cover generic ingredient",
+			pantry:         []string{"ovos", "leite", "sal grosso", "cebolinha"},
+			wantExact:      []string{},
+			wantNearMisses: []string{"omelete"},
+			wantPartial:    []string{"torrada-de-presunto-e-queijo", "torrada-de-queijo-presunto-e-manteiga"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewMatcher().Match(getMatchList(), tt.pantry)
+
+			assert.Equal(t, tt.wantExact, matchIDs(got.Exact))
+			assert.Equal(t, tt.wantNearMisses, matchIDs(got.NearMisses))
+			assert.Equal(t, tt.wantPartial, matchIDs(got.Partial))
+		})
+	}
+}
+
+func TestMatcher_MatchNearMissDetails(t *testing.T) {
+	got := NewMatcher().Match(getMatchList(), []string{"pão", "queijo", "presunto"})
+
+	require.Len(t, got.NearMisses, 1)
+	assert.Equal(t, []string{"manteiga"}, got.NearMisses[0].Missing)
+	assert.Equal(t, 0.75, got.NearMisses[0].Score)
+	require.Len(t, got.Exact, 1)
+	assert.Equal(t, 1.0, got.Exact[0].Score)
+}
+
+func TestMatcher_MatchFrom(t *testing.T) {
+	store := NewMemStore()
+	for id, recipe := range getMatchList() {
+		require.NoError(t, store.Add(id, recipe))
+	}
+
+	got, err := NewMatcher().MatchFrom(store, ParsePantry("pão, queijo,presunto,manteiga"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"torrada-de-presunto-e-queijo", "torrada-de-queijo-presunto-e-manteiga"}, matchIDs(got.Exact))
+}
+
+func matchIDs(results []MatchResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
@@ -0,0 +1,21 @@
+-- Receitas e ingredientes normalizados: cada ingrediente aparece uma única
+-- vez em "ingredients" e as receitas apontam para ele através da tabela de
+-- junção, que também guarda a ordem original da lista
+CREATE TABLE recipes (
+    id   TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE ingredients (
+    id   INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE recipe_ingredients (
+    recipe_id     TEXT    NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    ingredient_id INTEGER NOT NULL REFERENCES ingredients (id),
+    position      INTEGER NOT NULL,
+    PRIMARY KEY (recipe_id, position)
+);
+
+CREATE INDEX recipe_ingredients_ingredient_id ON recipe_ingredients (ingredient_id);
@@ -0,0 +1,7 @@
+-- Quantidade, unidade e observação pertencem ao uso do ingrediente na
+-- receita ("2 colheres de sopa de manteiga"), não ao ingrediente em si,
+-- então ficam na tabela de junção
+ALTER TABLE recipe_ingredients ADD COLUMN quantity REAL NOT NULL DEFAULT 0;
+ALTER TABLE recipe_ingredients ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+ALTER TABLE recipe_ingredients ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE recipe_ingredients ADD COLUMN optional INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Porções que a receita rende; 0 quando não informado
+ALTER TABLE recipes ADD COLUMN servings INTEGER NOT NULL DEFAULT 0;
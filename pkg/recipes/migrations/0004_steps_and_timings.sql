@@ -0,0 +1,16 @@
+-- Tempos em nanossegundos (time.Duration), rendimento e dificuldade
+ALTER TABLE recipes ADD COLUMN total_time INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recipes ADD COLUMN active_time INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recipes ADD COLUMN yield TEXT NOT NULL DEFAULT '';
+ALTER TABLE recipes ADD COLUMN difficulty TEXT NOT NULL DEFAULT '';
+
+-- Modo de preparo. ingredients é um array JSON com os nomes dos
+-- ingredientes citados no passo
+CREATE TABLE recipe_steps (
+    recipe_id   TEXT    NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    position    INTEGER NOT NULL,
+    text        TEXT    NOT NULL,
+    timer       INTEGER NOT NULL DEFAULT 0,
+    ingredients TEXT    NOT NULL DEFAULT '',
+    PRIMARY KEY (recipe_id, position)
+);
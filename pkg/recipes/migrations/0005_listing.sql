@@ -0,0 +1,22 @@
+-- Colunas usadas pela listagem paginada. name_key e ingredients.key são
+-- calculadas em Go (NameKey e ingredientKey); as linhas que já existiam são
+-- preenchidas por backfillKeys logo depois das migrações
+ALTER TABLE recipes ADD COLUMN name_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE recipes ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recipes ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX recipes_name_key ON recipes (name_key, id);
+CREATE INDEX recipes_created_at ON recipes (created_at, id);
+CREATE INDEX recipes_updated_at ON recipes (updated_at, id);
+
+ALTER TABLE ingredients ADD COLUMN key TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE recipe_tags (
+    recipe_id TEXT    NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    position  INTEGER NOT NULL,
+    tag       TEXT    NOT NULL,
+    tag_key   TEXT    NOT NULL,
+    PRIMARY KEY (recipe_id, position)
+);
+
+CREATE INDEX recipe_tags_tag_key ON recipe_tags (tag_key, recipe_id);
@@ -0,0 +1,3 @@
+-- Versão da receita, usada no ETag e nas escritas condicionais
+-- (CompareAndSwap). Receitas anteriores ficam na versão 0
+ALTER TABLE recipes ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- Histórico de revisões: cada escrita grava a receita completa, em JSON,
+-- com o número da versão. Receitas que já existiam ganham a primeira
+-- revisão em backfillRevisions, logo depois das migrações
+ALTER TABLE recipes ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE recipe_revisions (
+    recipe_id  TEXT    NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    number     INTEGER NOT NULL,
+    author     TEXT    NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL DEFAULT 0,
+    recipe     TEXT    NOT NULL,
+    PRIMARY KEY (recipe_id, number)
+);
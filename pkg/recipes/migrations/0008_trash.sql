@@ -0,0 +1,5 @@
+-- Lixeira: receitas removidas ficam na tabela com deleted_at (UnixNano)
+-- preenchido, até serem apagadas de vez. 0 é uma receita ativa
+ALTER TABLE recipes ADD COLUMN deleted_at INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX recipes_deleted_at ON recipes (deleted_at);
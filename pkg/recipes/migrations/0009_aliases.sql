@@ -0,0 +1,8 @@
+-- Apelidos: os nomes antigos das receitas renomeadas, apontando para o ID
+-- atual. Apagar a receita de vez apaga os apelidos dela
+CREATE TABLE recipe_aliases (
+    alias     TEXT NOT NULL PRIMARY KEY,
+    recipe_id TEXT NOT NULL REFERENCES recipes (id) ON DELETE CASCADE
+);
+
+CREATE INDEX recipe_aliases_recipe_id ON recipe_aliases (recipe_id);
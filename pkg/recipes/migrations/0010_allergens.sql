@@ -0,0 +1,9 @@
+-- Alérgenos das receitas, calculados pelo serviço a cada escrita. Ficam em
+-- uma tabela própria para o filtro exclude_allergen
+CREATE TABLE recipe_allergens (
+    recipe_id TEXT NOT NULL REFERENCES recipes (id) ON DELETE CASCADE,
+    allergen  TEXT NOT NULL,
+    PRIMARY KEY (recipe_id, allergen)
+);
+
+CREATE INDEX recipe_allergens_allergen ON recipe_allergens (allergen, recipe_id);
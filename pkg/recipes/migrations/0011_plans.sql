@@ -0,0 +1,21 @@
+-- Planos de refeições. Os slots guardam o ID da receita sem chave
+-- estrangeira: uma receita removida continua no plano e o serviço avisa
+CREATE TABLE plans (
+    id         TEXT    NOT NULL PRIMARY KEY,
+    name       TEXT    NOT NULL,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    updated_at INTEGER NOT NULL DEFAULT 0,
+    version    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE plan_slots (
+    plan_id   TEXT    NOT NULL REFERENCES plans (id) ON DELETE CASCADE,
+    position  INTEGER NOT NULL,
+    date      TEXT    NOT NULL,
+    meal      TEXT    NOT NULL,
+    recipe_id TEXT    NOT NULL,
+    servings  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (plan_id, position)
+);
+
+CREATE INDEX plan_slots_recipe_id ON plan_slots (recipe_id);
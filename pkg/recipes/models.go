@@ -1,13 +1,102 @@
 package recipes
 
+import "time"
+
 // Recipe - Modelos para as receitas
 // Representa uma receita
 type Recipe struct {
+	// ID - slug gerado a partir do nome na criação. PUT e PATCH não o mudam;
+	// só o rename gera outro, e o antigo vira um apelido (veja MemStore.Rename)
+	ID          string       `json:"id,omitempty"`
 	Name        string       `json:"name,omitempty"`
 	Ingredients []Ingredient `json:"ingredients,omitempty"`
+	// Servings - quantas porções a receita rende; usado por Scale
+	Servings int `json:"servings,omitempty"`
+	// Steps - modo de preparo, na ordem em que deve ser feito
+	Steps []Step `json:"steps,omitempty"`
+	// TotalTime - do início ao prato pronto, incluindo forno e descanso
+	TotalTime Duration `json:"total_time,omitempty"`
+	// ActiveTime - a parte do TotalTime em que alguém está trabalhando
+	ActiveTime Duration `json:"active_time,omitempty"`
+	// Yield - rendimento em texto livre ("1 bolo de 20 cm", "12 cookies")
+	Yield      string     `json:"yield,omitempty"`
+	Difficulty Difficulty `json:"difficulty,omitempty"`
+	// Tags - marcadores livres ("vegano", "festa junina"), usados como filtro
+	Tags []string `json:"tags,omitempty"`
+	// Allergens - as classes de alérgenos dos ingredientes (Taxonomy.Detect),
+	// calculadas pelo serviço a cada escrita; o que vier no corpo é ignorado
+	Allergens []string `json:"allergens,omitempty"`
+	// CreatedAt e UpdatedAt - preenchidos pelo serviço; o que vier no corpo
+	// da requisição é ignorado
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// UpdatedBy - quem fez a última alteração, quando informado; também é
+	// o autor da revisão
+	UpdatedBy string `json:"updated_by,omitempty"`
+	// Version - aumenta a cada alteração e vira o ETag da receita. Também é
+	// preenchida pelo serviço
+	Version int64 `json:"version"`
+}
+
+// Step - um passo do modo de preparo
+type Step struct {
+	Text string `json:"text,omitempty"`
+	// Ingredients - nomes dos ingredientes da receita usados neste passo
+	Ingredients []string `json:"ingredients,omitempty"`
+	// Timer - quanto tempo o passo leva, para o app disparar um alarme
+	Timer Duration `json:"timer,omitempty"`
 }
 
-// Ingredient - Representa ingredientes individualmente
+// Difficulty - nível de dificuldade da receita
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+)
+
+// Ingredient - Representa ingredientes individualmente. Só o nome é
+// obrigatório; Quantity zero significa "quantidade não informada" e Unit
+// guarda uma das unidades canônicas de units.go
 type Ingredient struct {
-	Name string `json:"name,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	Quantity float64 `json:"quantity,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	// Note - observação sobre o preparo ("picada", "em temperatura ambiente")
+	Note     string `json:"note,omitempty"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+// clone - Cria uma cópia profunda da receita, para que os slices não sejam
+// compartilhados entre quem chama e a loja
+func (r Recipe) clone() Recipe {
+	if r.Ingredients != nil {
+		ingredients := make([]Ingredient, len(r.Ingredients))
+		copy(ingredients, r.Ingredients)
+		r.Ingredients = ingredients
+	}
+	if r.Steps != nil {
+		steps := make([]Step, len(r.Steps))
+		for i, step := range r.Steps {
+			if step.Ingredients != nil {
+				refs := make([]string, len(step.Ingredients))
+				copy(refs, step.Ingredients)
+				step.Ingredients = refs
+			}
+			steps[i] = step
+		}
+		r.Steps = steps
+	}
+	if r.Tags != nil {
+		tags := make([]string, len(r.Tags))
+		copy(tags, r.Tags)
+		r.Tags = tags
+	}
+	if r.Allergens != nil {
+		allergens := make([]string, len(r.Allergens))
+		copy(allergens, r.Allergens)
+		r.Allergens = allergens
+	}
+	return r
 }
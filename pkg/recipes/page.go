@@ -0,0 +1,304 @@
+package recipes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+const (
+	// DefaultPageSize - quantas receitas uma página traz quando o cliente não
+	// informa o limite
+	DefaultPageSize = 20
+	// MaxPageSize - maior limite aceito por página
+	MaxPageSize = 100
+)
+
+// InvalidCursorErr - o cursor não foi gerado por esta API ou foi alterado
+var InvalidCursorErr = errors.New("invalid cursor")
+
+// SortField - campo usado para ordenar a listagem. Empates são desfeitos
+// pelo ID, então a ordem é sempre a mesma
+type SortField string
+
+const (
+	SortByName    SortField = "name"
+	SortByCreated SortField = "created"
+	SortByUpdated SortField = "updated"
+)
+
+// ListOptions - ordenação, filtros e página da listagem
+type ListOptions struct {
+	Sort SortField
+	// Desc - ordem decrescente
+	Desc  bool
+	Limit int
+	// Cursor - onde a página começa; nil é a primeira página
+	Cursor *Cursor
+	// Ingredients - a receita precisa ter todos; "queijo" encontra
+	// "queijo minas", como no matcher
+	Ingredients []string
+	// ExcludeIngredients - a receita não pode ter nenhum
+	ExcludeIngredients []string
+	// Tags - a receita precisa ter todas
+	Tags []string
+	// ExcludeAllergens - chaves de Allergen; a receita não pode ter nenhuma
+	ExcludeAllergens []string
+}
+
+// Page - uma página da listagem. Next e Prev são nil quando não há página
+// seguinte ou anterior
+type Page struct {
+	Recipes []Recipe
+	Next    *Cursor
+	Prev    *Cursor
+}
+
+// Cursor - posição de uma receita na ordenação. Aponta para depois dela ou,
+// com Before, para antes dela. Para o cliente é uma string opaca (Encode)
+type Cursor struct {
+	Sort   SortField `json:"s"`
+	Desc   bool      `json:"d,omitempty"`
+	Key    string    `json:"k"`
+	ID     string    `json:"i"`
+	Before bool      `json:"b,omitempty"`
+}
+
+// Encode - o cursor em base64, para ir na query string
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor - o inverso de Cursor.Encode
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, InvalidCursorErr
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" || !c.Sort.valid() {
+		return Cursor{}, InvalidCursorErr
+	}
+	return c, nil
+}
+
+// ParseSort - "name", "created", "updated", com "-" na frente para a ordem
+// decrescente ("-created" são as mais novas primeiro)
+func ParseSort(s string) (SortField, bool, error) {
+	desc := strings.HasPrefix(s, "-")
+	field := SortField(strings.TrimPrefix(s, "-"))
+	if !field.valid() {
+		return "", false, fmt.Errorf("unknown sort field %q", field)
+	}
+	return field, desc, nil
+}
+
+func (f SortField) valid() bool {
+	switch f {
+	case SortByName, SortByCreated, SortByUpdated:
+		return true
+	}
+	return false
+}
+
+// SortKey - valor da receita usado na ordenação. Nomes são comparados sem
+// acentos e maiúsculas; datas viram nanossegundos com zeros à esquerda, para
+// que a comparação de strings siga a ordem cronológica
+func SortKey(recipe Recipe, field SortField) string {
+	switch field {
+	case SortByCreated:
+		return timeKey(recipe.CreatedAt)
+	case SortByUpdated:
+		return timeKey(recipe.UpdatedAt)
+	default:
+		return NameKey(recipe.Name)
+	}
+}
+
+// NameKey - o nome normalizado para ordenação
+func NameKey(name string) string {
+	return slug.Make(name)
+}
+
+// TagKey - a tag normalizada para comparação ("Festa Junina" e
+// "festa-junina" são a mesma tag)
+func TagKey(tag string) string {
+	return slug.Make(tag)
+}
+
+func timeKey(t time.Time) string {
+	return fmt.Sprintf("%020d", UnixNano(t))
+}
+
+// UnixNano - t em nanossegundos desde 1970; a data zero vira 0
+func UnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// FromUnixNano - o inverso de UnixNano
+func FromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
+
+// Paginate - aplica os filtros, a ordenação e o cursor a uma lista
+// completa. É a implementação das lojas que mantêm tudo em memória
+func Paginate(list map[string]Recipe, opts ListOptions) Page {
+	if opts.Sort == "" {
+		opts.Sort = SortByName
+	}
+	type entry struct {
+		key    string
+		recipe Recipe
+	}
+	entries := make([]entry, 0, len(list))
+	for id, recipe := range list {
+		if !opts.matches(recipe) {
+			continue
+		}
+		recipe.ID = id
+		entries = append(entries, entry{key: SortKey(recipe, opts.Sort), recipe: recipe})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return opts.less(entries[i].key, entries[i].recipe.ID, entries[j].key, entries[j].recipe.ID)
+	})
+
+	// Posição da página em entries: [from, to)
+	from, to := 0, len(entries)
+	if c := opts.Cursor; c != nil {
+		if c.Before {
+			// Primeira receita que não vem antes do cursor
+			to = sort.Search(len(entries), func(i int) bool {
+				return !opts.less(entries[i].key, entries[i].recipe.ID, c.Key, c.ID)
+			})
+			from = max(0, to-opts.limit())
+		} else {
+			// Primeira receita depois do cursor
+			from = sort.Search(len(entries), func(i int) bool {
+				return opts.less(c.Key, c.ID, entries[i].key, entries[i].recipe.ID)
+			})
+		}
+	}
+	to = min(to, from+opts.limit())
+
+	page := Page{Recipes: make([]Recipe, 0, to-from)}
+	for _, e := range entries[from:to] {
+		page.Recipes = append(page.Recipes, e.recipe)
+	}
+	if to < len(entries) && to > from {
+		page.Next = opts.cursorAt(page.Recipes[len(page.Recipes)-1], false)
+	}
+	if from > 0 && to > from {
+		page.Prev = opts.cursorAt(page.Recipes[0], true)
+	}
+	return page
+}
+
+// NewPage - monta a página a partir das receitas encontradas por uma loja
+// que buscou uma a mais que o limite (more indica se ela existia), na
+// direção do cursor. As receitas de uma página anterior vêm em ordem
+// inversa e são desviradas aqui
+func NewPage(recipes []Recipe, more bool, opts ListOptions) Page {
+	page := Page{Recipes: recipes}
+	backwards := opts.Cursor != nil && opts.Cursor.Before
+	if backwards {
+		for i, j := 0, len(recipes)-1; i < j; i, j = i+1, j-1 {
+			recipes[i], recipes[j] = recipes[j], recipes[i]
+		}
+	}
+	if len(recipes) == 0 {
+		return page
+	}
+
+	hasNext, hasPrev := more, opts.Cursor != nil
+	if backwards {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		page.Next = opts.cursorAt(recipes[len(recipes)-1], false)
+	}
+	if hasPrev {
+		page.Prev = opts.cursorAt(recipes[0], true)
+	}
+	return page
+}
+
+func (opts ListOptions) limit() int {
+	if opts.Limit <= 0 {
+		return DefaultPageSize
+	}
+	return opts.Limit
+}
+
+func (opts ListOptions) cursorAt(recipe Recipe, before bool) *Cursor {
+	return &Cursor{Sort: opts.Sort, Desc: opts.Desc, Key: SortKey(recipe, opts.Sort), ID: recipe.ID, Before: before}
+}
+
+// less - a ordem da listagem: pela chave e, nos empates, pelo ID
+func (opts ListOptions) less(keyA, idA, keyB, idB string) bool {
+	if keyA != keyB {
+		return (keyA < keyB) != opts.Desc
+	}
+	if idA == idB {
+		return false
+	}
+	return (idA < idB) != opts.Desc
+}
+
+// matches - a receita passa pelos filtros de ingredientes, tags e alérgenos
+func (opts ListOptions) matches(recipe Recipe) bool {
+	names := make([][]string, len(recipe.Ingredients))
+	for i, ingredient := range recipe.Ingredients {
+		names[i] = matchTokens(ingredient.Name)
+	}
+	hasIngredient := func(filter string) bool {
+		words := matchTokens(filter)
+		for _, name := range names {
+			if covers([][]string{words}, name) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, filter := range opts.Ingredients {
+		if !hasIngredient(filter) {
+			return false
+		}
+	}
+	for _, filter := range opts.ExcludeIngredients {
+		if hasIngredient(filter) {
+			return false
+		}
+	}
+
+	tags := make(map[string]bool, len(recipe.Tags))
+	for _, tag := range recipe.Tags {
+		tags[TagKey(tag)] = true
+	}
+	for _, tag := range opts.Tags {
+		if !tags[TagKey(tag)] {
+			return false
+		}
+	}
+	for _, excluded := range opts.ExcludeAllergens {
+		for _, allergen := range recipe.Allergens {
+			if allergen == excluded {
+				return false
+			}
+		}
+	}
+	return true
+}
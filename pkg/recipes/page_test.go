@@ -0,0 +1,153 @@
+package recipes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getListingRecipes - receitas criadas em dias diferentes, em ordem
+// alfabética diferente da cronológica
+func getListingRecipes() map[string]Recipe {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	return map[string]Recipe{
+		"brigadeiro": {
+			Name:        "Brigadeiro",
+			Ingredients: []Ingredient{{Name: "leite condensado"}, {Name: "chocolate em pó"}},
+			Tags:        []string{"Doce", "festa"},
+			CreatedAt:   day(3), UpdatedAt: day(3),
+		},
+		"arroz-doce": {
+			Name:        "Arroz doce",
+			Ingredients: []Ingredient{{Name: "arroz"}, {Name: "leite"}},
+			Tags:        []string{"doce"},
+			CreatedAt:   day(1), UpdatedAt: day(5),
+		},
+		"bolo-de-cenoura": {
+			Name:        "Bolo de cenoura",
+			Ingredients: []Ingredient{{Name: "cenoura"}, {Name: "ovos"}, {Name: "chocolate em pó"}},
+			Tags:        []string{"doce", "festa"},
+			CreatedAt:   day(2), UpdatedAt: day(2),
+		},
+		"torrada": {
+			Name:        "Torrada",
+			Ingredients: []Ingredient{{Name: "pão"}, {Name: "queijo minas"}},
+			CreatedAt:   day(4), UpdatedAt: day(4),
+		},
+	}
+}
+
+func TestStore_ListPage(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreListPage(t, factory)
+	})
+}
+
+func testStoreListPage(t *testing.T, factory storeFactory) {
+	store := newSeededStore(t, factory, getListingRecipes())
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{name: "Name by default", opts: ListOptions{}, want: []string{"arroz-doce", "bolo-de-cenoura", "brigadeiro", "torrada"}},
+		{name: "Newest first", opts: ListOptions{Sort: SortByCreated, Desc: true}, want: []string{"torrada", "brigadeiro", "bolo-de-cenoura", "arroz-doce"}},
+		{name: "Last updated", opts: ListOptions{Sort: SortByUpdated, Desc: true, Limit: 1}, want: []string{"arroz-doce"}},
+		{name: "Ingredient", opts: ListOptions{Ingredients: []string{"chocolate"}}, want: []string{"bolo-de-cenoura", "brigadeiro"}},
+		{name: "Ingredient without accents", opts: ListOptions{Ingredients: []string{"pao", "queijo"}}, want: []string{"torrada"}},
+		{name: "Ingredient is a whole word", opts: ListOptions{Ingredients: []string{"leit"}}, want: []string{}},
+		{name: "Excluded ingredient", opts: ListOptions{ExcludeIngredients: []string{"leite"}}, want: []string{"bolo-de-cenoura", "torrada"}},
+		{name: "Tags", opts: ListOptions{Tags: []string{"Festa", "doce"}}, want: []string{"bolo-de-cenoura", "brigadeiro"}},
+		{name: "Unknown tag", opts: ListOptions{Tags: []string{"salgado"}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := store.ListPage(tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pageIDs(page))
+		})
+	}
+
+	t.Run("Cursor", func(t *testing.T) {
+		opts := ListOptions{Sort: SortByCreated, Limit: 3}
+		first, err := store.ListPage(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"arroz-doce", "bolo-de-cenoura", "brigadeiro"}, pageIDs(first))
+		assert.Nil(t, first.Prev)
+		require.NotNil(t, first.Next)
+
+		opts.Cursor = first.Next
+		second, err := store.ListPage(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"torrada"}, pageIDs(second))
+		assert.Nil(t, second.Next)
+		require.NotNil(t, second.Prev)
+
+		// Voltando a partir da segunda página
+		opts.Cursor = second.Prev
+		back, err := store.ListPage(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"arroz-doce", "bolo-de-cenoura", "brigadeiro"}, pageIDs(back))
+		assert.Nil(t, back.Prev)
+		assert.NotNil(t, back.Next)
+
+		// Na ordem decrescente a receita do cursor também fica de fora
+		desc := ListOptions{Sort: SortByName, Desc: true, Limit: 2}
+		page, err := store.ListPage(desc)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"torrada", "brigadeiro"}, pageIDs(page))
+		desc.Cursor = page.Next
+		page, err = store.ListPage(desc)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bolo-de-cenoura", "arroz-doce"}, pageIDs(page))
+		desc.Cursor = page.Prev
+		page, err = store.ListPage(desc)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"torrada", "brigadeiro"}, pageIDs(page))
+
+		// O cursor continua válido depois que a receita dele é removida
+		require.NoError(t, store.Remove("brigadeiro"))
+		opts.Cursor = first.Next
+		after, err := store.ListPage(opts)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"torrada"}, pageIDs(after))
+	})
+}
+
+func TestCursor_Encode(t *testing.T) {
+	cursor := Cursor{Sort: SortByCreated, Desc: true, Key: "00000000001700000000", ID: "torrada", Before: true}
+	got, err := DecodeCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, cursor, got)
+
+	for _, s := range []string{"", "não é base64", "e30", Cursor{Sort: "calorias", ID: "torrada"}.Encode()} {
+		_, err := DecodeCursor(s)
+		assert.ErrorIs(t, err, InvalidCursorErr, s)
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	field, desc, err := ParseSort("-created")
+	require.NoError(t, err)
+	assert.Equal(t, SortByCreated, field)
+	assert.True(t, desc)
+
+	field, desc, err = ParseSort("name")
+	require.NoError(t, err)
+	assert.Equal(t, SortByName, field)
+	assert.False(t, desc)
+
+	_, _, err = ParseSort("calorias")
+	assert.Error(t, err)
+}
+
+func pageIDs(page Page) []string {
+	ids := []string{}
+	for _, recipe := range page.Recipes {
+		ids = append(ids, recipe.ID)
+	}
+	return ids
+}
@@ -0,0 +1,289 @@
+package recipes
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+// Limites dos planos de refeições
+const (
+	MaxPlanSlots = 200
+	MaxPlanDays  = 31
+	// DefaultPlanDays - quantos dias GeneratePlan preenche quando
+	// PlanConstraints.Days é zero
+	DefaultPlanDays = 7
+)
+
+// DateLayout - o formato das datas dos planos ("2024-05-06")
+const DateLayout = "2006-01-02"
+
+// NotEnoughRecipesErr - GeneratePlan não encontrou receitas que cumpram as
+// restrições para todas as refeições
+var NotEnoughRecipesErr = errors.New("not enough recipes")
+
+// Meal - uma refeição do dia
+type Meal string
+
+const (
+	MealBreakfast Meal = "breakfast"
+	MealLunch     Meal = "lunch"
+	MealSnack     Meal = "snack"
+	MealDinner    Meal = "dinner"
+)
+
+// Meals - as refeições, na ordem do dia
+var Meals = []Meal{MealBreakfast, MealLunch, MealSnack, MealDinner}
+
+// DefaultPlanMeals - as refeições que GeneratePlan preenche quando
+// PlanConstraints.Meals é vazio
+var DefaultPlanMeals = []Meal{MealLunch, MealDinner}
+
+// mealAliases - os nomes aceitos para cada refeição, pelo slug
+var mealAliases = map[string]Meal{
+	"breakfast": MealBreakfast, "cafe-da-manha": MealBreakfast, "cafe": MealBreakfast,
+	"lunch": MealLunch, "almoco": MealLunch,
+	"snack": MealSnack, "lanche": MealSnack, "lanche-da-tarde": MealSnack,
+	"dinner": MealDinner, "jantar": MealDinner, "janta": MealDinner,
+}
+
+// ParseMeal - a refeição pelo nome em inglês ou em português ("Almoço",
+// "café da manhã")
+func ParseMeal(s string) (Meal, bool) {
+	meal, ok := mealAliases[slug.Make(s)]
+	return meal, ok
+}
+
+// order - a posição da refeição no dia
+func (m Meal) order() int {
+	for i, meal := range Meals {
+		if meal == m {
+			return i
+		}
+	}
+	return len(Meals)
+}
+
+// PlanSlot - uma receita marcada para uma refeição de um dia. Uma refeição
+// pode ter mais de uma receita (prato principal e sobremesa)
+type PlanSlot struct {
+	// Date - o dia, no formato DateLayout
+	Date     string `json:"date"`
+	Meal     Meal   `json:"meal"`
+	RecipeID string `json:"recipe_id"`
+	// Servings - quantas porções preparar; zero usa as da receita
+	Servings int `json:"servings,omitempty"`
+}
+
+// PlanWarning - um problema com a receita de um slot, apontado a cada
+// leitura do plano
+type PlanWarning struct {
+	// Slot - a posição do slot em Plan.Slots
+	Slot     int    `json:"slot"`
+	RecipeID string `json:"recipe_id"`
+	Message  string `json:"message"`
+}
+
+// Plan - um plano de refeições: receitas distribuídas pelos dias e
+// refeições, em ordem cronológica
+type Plan struct {
+	ID    string     `json:"id,omitempty"`
+	Name  string     `json:"name,omitempty"`
+	Slots []PlanSlot `json:"slots"`
+	// Warnings - receitas do plano que foram removidas; calculado pelo
+	// serviço a cada leitura e nunca gravado
+	Warnings []PlanWarning `json:"warnings,omitempty"`
+	// CreatedAt, UpdatedAt e Version - preenchidos pelo serviço, como nas
+	// receitas
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int64     `json:"version"`
+}
+
+// clone - cópia do plano que não compartilha os slices
+func (p Plan) clone() Plan {
+	if p.Slots != nil {
+		slots := make([]PlanSlot, len(p.Slots))
+		copy(slots, p.Slots)
+		p.Slots = slots
+	}
+	if p.Warnings != nil {
+		warnings := make([]PlanWarning, len(p.Warnings))
+		copy(warnings, p.Warnings)
+		p.Warnings = warnings
+	}
+	return p
+}
+
+// SortSlots - os slots em ordem cronológica: pelo dia e pela refeição. Slots
+// da mesma refeição mantêm a ordem em que vieram
+func (p *Plan) SortSlots() {
+	sort.SliceStable(p.Slots, func(i, j int) bool {
+		a, b := p.Slots[i], p.Slots[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		return a.Meal.order() < b.Meal.order()
+	})
+}
+
+// ValidatePlan - confere as regras de um plano antes de ele ser gravado. Se
+// as receitas existem é conferido pelo serviço, que conhece a loja
+func ValidatePlan(plan Plan) error {
+	v := &ValidationError{}
+
+	validateText(v, "name", plan.Name, MaxNameLength)
+	if strings.TrimSpace(plan.Name) != "" && slug.Make(plan.Name) == "" {
+		v.Add("name", "must contain at least one letter or digit")
+	}
+
+	if len(plan.Slots) > MaxPlanSlots {
+		v.Add("slots", fmt.Sprintf("must have at most %d items", MaxPlanSlots))
+	}
+	seen := make(map[PlanSlot]bool, len(plan.Slots))
+	for i, slot := range plan.Slots {
+		prefix := fmt.Sprintf("slots[%d].", i)
+		if _, err := time.Parse(DateLayout, slot.Date); err != nil {
+			v.Add(prefix+"date", "must be a date such as 2024-05-06")
+		}
+		if slot.Meal.order() == len(Meals) {
+			v.Add(prefix+"meal", "must be one of "+joinMeals(Meals))
+		}
+		if strings.TrimSpace(slot.RecipeID) == "" {
+			v.Add(prefix+"recipe_id", "is required")
+		}
+		if slot.Servings < 0 || slot.Servings > MaxServings {
+			v.Add(prefix+"servings", fmt.Sprintf("must be between 1 and %d", MaxServings))
+		}
+
+		key := PlanSlot{Date: slot.Date, Meal: slot.Meal, RecipeID: slot.RecipeID}
+		if seen[key] {
+			v.Add(prefix+"recipe_id", "is already planned for this meal")
+		}
+		seen[key] = true
+	}
+	return v.Err()
+}
+
+func joinMeals(meals []Meal) string {
+	names := make([]string, len(meals))
+	for i, meal := range meals {
+		names[i] = string(meal)
+	}
+	return strings.Join(names, ", ")
+}
+
+// PlanConstraints - o que GeneratePlan precisa respeitar
+type PlanConstraints struct {
+	// Start - o primeiro dia do plano, no formato DateLayout
+	Start string
+	// Days - quantos dias preencher; DefaultPlanDays quando zero
+	Days int
+	// Meals - as refeições de cada dia; DefaultPlanMeals quando vazio
+	Meals []Meal
+	// Tags - as receitas precisam ter todas estas tags
+	Tags []string
+	// MaxTime - o tempo máximo da receita (TotalTime ou, sem ele,
+	// ActiveTime). Com ele, receitas sem tempo informado ficam de fora
+	MaxTime Duration
+	// NoRepeatDays - uma receita usada em um dia só volta ao plano
+	// NoRepeatDays dias depois (1 evita repeti-la no mesmo dia, 7 a usa uma
+	// vez por semana); zero permite repetir, mas sempre depois de usar as
+	// outras
+	NoRepeatDays int
+	// Servings - as porções de cada slot; zero usa as da receita
+	Servings int
+	// Seed - embaralha a escolha entre receitas igualmente elegíveis; zero
+	// escolhe pela ordem dos IDs, sempre o mesmo plano
+	Seed int64
+}
+
+// GeneratePlan - preenche os dias e refeições de c com as receitas de list.
+// Cada refeição recebe a receita elegível usada há mais tempo (ou nunca
+// usada), então as receitas se revezam. Devolve NotEnoughRecipesErr se
+// alguma refeição ficar sem receita. O plano volta sem nome e sem ID
+func GeneratePlan(list map[string]Recipe, c PlanConstraints) (Plan, error) {
+	start, err := time.Parse(DateLayout, c.Start)
+	if err != nil {
+		return Plan{}, fmt.Errorf("invalid start date %q: %w", c.Start, err)
+	}
+	days := c.Days
+	if days == 0 {
+		days = DefaultPlanDays
+	}
+	meals := c.Meals
+	if len(meals) == 0 {
+		meals = DefaultPlanMeals
+	}
+	meals = append([]Meal(nil), meals...)
+	sort.SliceStable(meals, func(i, j int) bool { return meals[i].order() < meals[j].order() })
+
+	var candidates []string
+	for id, recipe := range list {
+		if planEligible(recipe, c) {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Strings(candidates)
+	if c.Seed != 0 {
+		r := rand.New(rand.NewSource(c.Seed))
+		r.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	}
+
+	plan := Plan{Slots: []PlanSlot{}}
+	// lastUsed - o dia (a partir de zero) em que cada receita foi usada
+	lastUsed := make(map[string]int)
+	for day := 0; day < days; day++ {
+		date := start.AddDate(0, 0, day).Format(DateLayout)
+		for _, meal := range meals {
+			best, bestUsed, bestLast := "", false, 0
+			for _, id := range candidates {
+				last, used := lastUsed[id]
+				if used && day-last < c.NoRepeatDays {
+					continue
+				}
+				// Primeiro as nunca usadas, depois as usadas há mais tempo;
+				// no empate, a que vem antes em candidates
+				if best == "" || bestUsed && (!used || last < bestLast) {
+					best, bestUsed, bestLast = id, used, last
+				}
+			}
+			if best == "" {
+				return Plan{}, fmt.Errorf("%w: no recipe left for %s on %s", NotEnoughRecipesErr, meal, date)
+			}
+			lastUsed[best] = day
+			plan.Slots = append(plan.Slots, PlanSlot{Date: date, Meal: meal, RecipeID: best, Servings: c.Servings})
+		}
+	}
+	return plan, nil
+}
+
+// planEligible - a receita cumpre as tags e o tempo máximo de c
+func planEligible(recipe Recipe, c PlanConstraints) bool {
+	if len(c.Tags) > 0 {
+		have := make(map[string]bool, len(recipe.Tags))
+		for _, tag := range recipe.Tags {
+			have[TagKey(tag)] = true
+		}
+		for _, tag := range c.Tags {
+			if !have[TagKey(tag)] {
+				return false
+			}
+		}
+	}
+	if c.MaxTime > 0 {
+		total := recipe.TotalTime
+		if total == 0 {
+			total = recipe.ActiveTime
+		}
+		if total == 0 || total > c.MaxTime {
+			return false
+		}
+	}
+	return true
+}
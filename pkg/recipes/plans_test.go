@@ -0,0 +1,273 @@
+package recipes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMeal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Meal
+		ok   bool
+	}{
+		{in: "lunch", want: MealLunch, ok: true},
+		{in: "Almoço", want: MealLunch, ok: true},
+		{in: "café da manhã", want: MealBreakfast, ok: true},
+		{in: "Lanche", want: MealSnack, ok: true},
+		{in: "JANTAR", want: MealDinner, ok: true},
+		{in: "ceia", ok: false},
+		{in: "", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := ParseMeal(tt.in)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidatePlan(t *testing.T) {
+	tests := []struct {
+		name string
+		plan Plan
+		want []FieldError
+	}{
+		{
+			name: "Valid plan",
+			plan: Plan{Name: "Semana 1", Slots: []PlanSlot{
+				{Date: "2024-05-06", Meal: MealLunch, RecipeID: "bolo"},
+				{Date: "2024-05-06", Meal: MealLunch, RecipeID: "pao", Servings: 4},
+			}},
+			want: nil,
+		},
+		{
+			name: "Empty plan",
+			plan: Plan{},
+			want: []FieldError{{Field: "name", Message: "is required"}},
+		},
+		{
+			name: "Invalid slots",
+			plan: Plan{Name: "Semana 1", Slots: []PlanSlot{
+				{Date: "06/05/2024", Meal: "ceia", Servings: -1},
+				{Date: "2024-05-06", Meal: MealDinner, RecipeID: "bolo"},
+				{Date: "2024-05-06", Meal: MealDinner, RecipeID: "bolo", Servings: 2},
+			}},
+			want: []FieldError{
+				{Field: "slots[0].date", Message: "must be a date such as 2024-05-06"},
+				{Field: "slots[0].meal", Message: "must be one of breakfast, lunch, snack, dinner"},
+				{Field: "slots[0].recipe_id", Message: "is required"},
+				{Field: "slots[0].servings", Message: "must be between 1 and 1000"},
+				{Field: "slots[2].recipe_id", Message: "is already planned for this meal"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePlan(tt.plan)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "got %v", err)
+			assert.Equal(t, tt.want, validationErr.Errors)
+		})
+	}
+}
+
+func TestPlan_SortSlots(t *testing.T) {
+	plan := Plan{Slots: []PlanSlot{
+		{Date: "2024-05-07", Meal: MealLunch, RecipeID: "a"},
+		{Date: "2024-05-06", Meal: MealDinner, RecipeID: "b"},
+		{Date: "2024-05-06", Meal: MealBreakfast, RecipeID: "c"},
+		{Date: "2024-05-06", Meal: MealDinner, RecipeID: "d"},
+	}}
+	plan.SortSlots()
+
+	var ids []string
+	for _, slot := range plan.Slots {
+		ids = append(ids, slot.RecipeID)
+	}
+	assert.Equal(t, []string{"c", "b", "d", "a"}, ids)
+}
+
+func TestGeneratePlan(t *testing.T) {
+	list := map[string]Recipe{
+		"bolo":    {Name: "Bolo", Tags: []string{"Doce"}, TotalTime: Duration(90 * time.Minute)},
+		"omelete": {Name: "Omelete", Tags: []string{"rápido"}, ActiveTime: Duration(10 * time.Minute)},
+		"salada":  {Name: "Salada", Tags: []string{"Rápido", "vegano"}, TotalTime: Duration(15 * time.Minute)},
+		"sopa":    {Name: "Sopa", Tags: []string{"vegano"}},
+	}
+	slotIDs := func(plan Plan) []string {
+		var ids []string
+		for _, slot := range plan.Slots {
+			ids = append(ids, slot.Date+" "+string(slot.Meal)+" "+slot.RecipeID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name        string
+		constraints PlanConstraints
+		want        []string
+		wantErr     error
+	}{
+		{
+			name:        "Rotates through every recipe",
+			constraints: PlanConstraints{Start: "2024-05-06", Days: 3},
+			want: []string{
+				"2024-05-06 lunch bolo", "2024-05-06 dinner omelete",
+				"2024-05-07 lunch salada", "2024-05-07 dinner sopa",
+				"2024-05-08 lunch bolo", "2024-05-08 dinner omelete",
+			},
+		},
+		{
+			name:        "Tags and max time",
+			constraints: PlanConstraints{Start: "2024-05-06", Days: 2, Meals: []Meal{MealDinner}, Tags: []string{"rapido"}, MaxTime: Duration(20 * time.Minute)},
+			want:        []string{"2024-05-06 dinner omelete", "2024-05-07 dinner salada"},
+		},
+		{
+			name:        "No repeats in the same day",
+			constraints: PlanConstraints{Start: "2024-05-06", Days: 2, Meals: []Meal{MealDinner, MealLunch}, Tags: []string{"vegano"}, NoRepeatDays: 1},
+			want: []string{
+				"2024-05-06 lunch salada", "2024-05-06 dinner sopa",
+				"2024-05-07 lunch salada", "2024-05-07 dinner sopa",
+			},
+		},
+		{
+			name:        "Not enough recipes to avoid repeats",
+			constraints: PlanConstraints{Start: "2024-05-06", Days: 3, Meals: []Meal{MealLunch}, Tags: []string{"vegano"}, NoRepeatDays: 3},
+			wantErr:     NotEnoughRecipesErr,
+		},
+		{
+			name:        "No eligible recipe",
+			constraints: PlanConstraints{Start: "2024-05-06", Tags: []string{"churrasco"}},
+			wantErr:     NotEnoughRecipesErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := GeneratePlan(list, tt.constraints)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, slotIDs(plan))
+			require.NoError(t, ValidatePlan(Plan{Name: "Semana", Slots: plan.Slots}))
+		})
+	}
+
+	t.Run("Seed is deterministic", func(t *testing.T) {
+		c := PlanConstraints{Start: "2024-05-06", Days: 7, Seed: 42}
+		a, err := GeneratePlan(list, c)
+		require.NoError(t, err)
+		b, err := GeneratePlan(list, c)
+		require.NoError(t, err)
+		assert.Equal(t, a, b)
+		assert.Len(t, a.Slots, 14)
+	})
+}
+
+func TestStore_Plans(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStorePlans(t, factory)
+	})
+}
+
+func testStorePlans(t *testing.T, factory storeFactory) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	v1 := Plan{
+		Name: "Semana 1",
+		Slots: []PlanSlot{
+			{Date: "2024-05-06", Meal: MealLunch, RecipeID: "bolo", Servings: 4},
+			{Date: "2024-05-06", Meal: MealDinner, RecipeID: "sopa"},
+		},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Version:   1,
+	}
+	v2 := v1
+	v2.Slots = []PlanSlot{{Date: "2024-05-07", Meal: MealSnack, RecipeID: "pao"}}
+	v2.UpdatedAt, v2.Version = createdAt.Add(time.Hour), 2
+
+	t.Run("Add, swap and delete", func(t *testing.T) {
+		store := factory.new(t)
+
+		require.NoError(t, store.AddPlan("semana-1", v1))
+		assert.ErrorIs(t, store.AddPlan("semana-1", v2), ExistsErr)
+		_, err := store.GetPlan("semana-2")
+		assert.ErrorIs(t, err, NotFoundErr)
+
+		got, err := store.GetPlan("semana-1")
+		require.NoError(t, err)
+		want := v1
+		want.ID = "semana-1"
+		assert.Equal(t, want, got)
+
+		assert.ErrorIs(t, store.CompareAndSwapPlan("semana-1", 2, v2), VersionMismatchErr)
+		assert.ErrorIs(t, store.CompareAndSwapPlan("semana-2", 1, v2), NotFoundErr)
+		require.NoError(t, store.CompareAndSwapPlan("semana-1", 1, v2))
+		got, err = store.GetPlan("semana-1")
+		require.NoError(t, err)
+		want = v2
+		want.ID = "semana-1"
+		assert.Equal(t, want, got)
+
+		assert.ErrorIs(t, store.CompareAndDeletePlan("semana-1", 1), VersionMismatchErr)
+		assert.ErrorIs(t, store.CompareAndDeletePlan("semana-2", 1), NotFoundErr)
+		require.NoError(t, store.CompareAndDeletePlan("semana-1", 2))
+		_, err = store.GetPlan("semana-1")
+		assert.ErrorIs(t, err, NotFoundErr)
+	})
+
+	t.Run("Plans are listed by ID and independent of recipes", func(t *testing.T) {
+		store := factory.new(t)
+		require.NoError(t, store.AddPlan("b", v1))
+		require.NoError(t, store.AddPlan("a", v2))
+		// Um plano pode ter o mesmo ID de uma receita
+		require.NoError(t, store.Add("a", Recipe{Name: "a", Version: 1}))
+
+		plans, err := store.Plans()
+		require.NoError(t, err)
+		require.Len(t, plans, 2)
+		assert.Equal(t, "a", plans[0].ID)
+		assert.Equal(t, v2.Slots, plans[0].Slots)
+		assert.Equal(t, "b", plans[1].ID)
+		assert.Equal(t, v1.Slots, plans[1].Slots)
+	})
+}
+
+func TestFileStore_PlansSurviveRestarts(t *testing.T) {
+	plan := Plan{Name: "Semana", Slots: []PlanSlot{{Date: "2024-05-06", Meal: MealLunch, RecipeID: "bolo"}}, Version: 1}
+	for _, compactEvery := range []int{0, 1} {
+		dir := t.TempDir()
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		store.CompactEvery = compactEvery
+
+		require.NoError(t, store.AddPlan("semana", plan))
+		require.NoError(t, store.AddPlan("outra", plan))
+		updated := plan
+		updated.Version = 2
+		require.NoError(t, store.CompareAndSwapPlan("semana", 1, updated))
+		require.NoError(t, store.CompareAndDeletePlan("outra", 1))
+		require.NoError(t, store.Close())
+
+		store, err = NewFileStore(dir)
+		require.NoError(t, err)
+
+		plans, err := store.Plans()
+		require.NoError(t, err)
+		updated.ID = "semana"
+		assert.Equal(t, []Plan{updated}, plans, "compact every %d", compactEvery)
+		require.NoError(t, store.Close())
+	}
+}
@@ -0,0 +1,611 @@
+package recipes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	walFileName      = "recipes.wal"
+	snapshotFileName = "recipes.snapshot.json"
+
+	// DefaultCompactEvery - quantos registros o log acumula antes de virar snapshot
+	DefaultCompactEvery = 1000
+)
+
+var (
+	CorruptLogErr = errors.New("corrupt write-ahead log")
+)
+
+const (
+	walOpPut     = "put"
+	walOpDelete  = "delete"
+	walOpTrash   = "trash"
+	walOpUntrash = "untrash"
+	walOpRename  = "rename"
+	// walOpPutPlan e walOpDeletePlan - os planos de refeições
+	walOpPutPlan    = "put_plan"
+	walOpDeletePlan = "delete_plan"
+)
+
+// snapshotFormat - versão do formato do snapshot. Snapshots anteriores ao
+// histórico de revisões eram só o mapa de receitas
+const snapshotFormat = 2
+
+// snapshot - o conteúdo de recipes.snapshot.json
+type snapshot struct {
+	Format    int                 `json:"format"`
+	Recipes   map[string]Recipe   `json:"recipes"`
+	Revisions map[string][]Recipe `json:"revisions"`
+	// Trash - a lixeira; ausente nos snapshots anteriores a ela
+	Trash map[string]TrashedRecipe `json:"trash,omitempty"`
+	// Aliases - os nomes antigos das receitas renomeadas
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Plans - os planos de refeições
+	Plans map[string]Plan `json:"plans,omitempty"`
+}
+
+// walRecord - Uma linha do log. Cada linha é gravada como
+// "<crc32 em hex> <json>\n", o que permite detectar um registro cortado
+// no meio por uma queda do processo
+type walRecord struct {
+	Op     string  `json:"op"`
+	Name   string  `json:"name"`
+	Recipe *Recipe `json:"recipe,omitempty"`
+	// DeletedAt - só nos registros de trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// To - só nos registros de rename: o nome novo da receita Name
+	To string `json:"to,omitempty"`
+	// Plan - só nos registros de put_plan, em que Name é o ID do plano
+	Plan *Plan `json:"plan,omitempty"`
+}
+
+// FileStore - loja durável em um diretório local. Toda escrita é anexada a
+// um log (write-ahead log) e sincronizada em disco antes de ser aplicada ao
+// estado em memória; de tempos em tempos o estado é compactado em um
+// snapshot e o log recomeça vazio
+type FileStore struct {
+	// CompactEvery - quantidade de registros no log que dispara um snapshot
+	CompactEvery int
+
+	mu      sync.Mutex
+	dir     string
+	mem     *MemStore
+	wal     *os.File
+	records int
+}
+
+// NewFileStore - abre (ou cria) a loja em dir, recuperando o snapshot e
+// reaplicando o log. Um último registro incompleto é descartado
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{
+		CompactEvery: DefaultCompactEvery,
+		dir:          dir,
+		mem:          NewMemStore(),
+	}
+	if err := f.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(f.path(walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f.wal = wal
+	return f, nil
+}
+
+func (f *FileStore) Add(name string, recipe Recipe) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.mem.inUse(name) {
+		return ExistsErr
+	}
+	if err := f.append(walRecord{Op: walOpPut, Name: name, Recipe: &recipe}); err != nil {
+		return err
+	}
+	if err := f.mem.Add(name, recipe); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+func (f *FileStore) Get(name string) (Recipe, error) {
+	return f.mem.Get(name)
+}
+
+func (f *FileStore) List() (map[string]Recipe, error) {
+	return f.mem.List()
+}
+
+func (f *FileStore) ListPage(opts ListOptions) (Page, error) {
+	return f.mem.ListPage(opts)
+}
+
+func (f *FileStore) Facets(opts ListOptions) (Facets, error) {
+	return f.mem.Facets(opts)
+}
+
+// Rename - veja MemStore.Rename. O registro guarda a receita completa com
+// o nome novo
+func (f *FileStore) Rename(from, to string, version int64, recipe Recipe) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.mem.canRename(from, to, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpRename, Name: from, To: to, Recipe: &recipe}); err != nil {
+		return err
+	}
+	if err := f.mem.Rename(from, to, version, recipe); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+func (f *FileStore) Alias(name string) (string, error) {
+	return f.mem.Alias(name)
+}
+
+// Revisions - o histórico fica em memória, como as receitas; o log e o
+// snapshot guardam cada versão gravada
+func (f *FileStore) Revisions(name string) ([]Revision, error) {
+	return f.mem.Revisions(name)
+}
+
+func (f *FileStore) Revision(name string, number int64) (Revision, error) {
+	return f.mem.Revision(name, number)
+}
+
+func (f *FileStore) Update(name string, recipe Recipe) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.mem.Get(name); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpPut, Name: name, Recipe: &recipe}); err != nil {
+		return err
+	}
+	if err := f.mem.Update(name, recipe); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+// CompareAndSwap - veja MemStore.CompareAndSwap. A versão é conferida antes
+// de o registro ir para o log
+func (f *FileStore) CompareAndSwap(name string, version int64, recipe Recipe) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkVersion(name, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpPut, Name: name, Recipe: &recipe}); err != nil {
+		return err
+	}
+	f.mem.put(name, recipe)
+	return f.maybeCompact()
+}
+
+// CompareAndDelete - veja MemStore.CompareAndDelete
+func (f *FileStore) CompareAndDelete(name string, version int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkVersion(name, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpDelete, Name: name}); err != nil {
+		return err
+	}
+	if err := f.mem.Remove(name); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+// MoveToTrash - veja MemStore.MoveToTrash
+func (f *FileStore) MoveToTrash(name string, version int64, deletedAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkVersion(name, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpTrash, Name: name, DeletedAt: &deletedAt}); err != nil {
+		return err
+	}
+	if err := f.mem.MoveToTrash(name, version, deletedAt); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+func (f *FileStore) Trash() ([]TrashedRecipe, error) {
+	return f.mem.Trash()
+}
+
+// Untrash - veja MemStore.Untrash
+func (f *FileStore) Untrash(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, trashed := f.mem.has(name); !trashed {
+		return NotFoundErr
+	}
+	if err := f.append(walRecord{Op: walOpUntrash, Name: name}); err != nil {
+		return err
+	}
+	if err := f.mem.Untrash(name); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+// Purge - veja MemStore.Purge. Cada receita apagada vira um registro de
+// delete no log
+func (f *FileStore) Purge(before time.Time) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	purged := []string{}
+	for name, trashed := range f.mem.trashed() {
+		if !trashed.DeletedAt.Before(before) {
+			continue
+		}
+		if err := f.append(walRecord{Op: walOpDelete, Name: name}); err != nil {
+			return nil, err
+		}
+		if err := f.mem.Remove(name); err != nil {
+			return nil, err
+		}
+		purged = append(purged, name)
+	}
+	sort.Strings(purged)
+	return purged, f.maybeCompact()
+}
+
+// AddPlan - veja MemStore.AddPlan
+func (f *FileStore) AddPlan(id string, plan Plan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.mem.GetPlan(id); err == nil {
+		return ExistsErr
+	}
+	if err := f.append(walRecord{Op: walOpPutPlan, Name: id, Plan: &plan}); err != nil {
+		return err
+	}
+	if err := f.mem.AddPlan(id, plan); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+func (f *FileStore) GetPlan(id string) (Plan, error) {
+	return f.mem.GetPlan(id)
+}
+
+func (f *FileStore) Plans() ([]Plan, error) {
+	return f.mem.Plans()
+}
+
+// CompareAndSwapPlan - veja MemStore.CompareAndSwapPlan
+func (f *FileStore) CompareAndSwapPlan(id string, version int64, plan Plan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkPlanVersion(id, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpPutPlan, Name: id, Plan: &plan}); err != nil {
+		return err
+	}
+	f.mem.putPlan(id, plan)
+	return f.maybeCompact()
+}
+
+// CompareAndDeletePlan - veja MemStore.CompareAndDeletePlan
+func (f *FileStore) CompareAndDeletePlan(id string, version int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkPlanVersion(id, version); err != nil {
+		return err
+	}
+	if err := f.append(walRecord{Op: walOpDeletePlan, Name: id}); err != nil {
+		return err
+	}
+	f.mem.deletePlan(id)
+	return f.maybeCompact()
+}
+
+// checkPlanVersion - como checkVersion, para os planos
+func (f *FileStore) checkPlanVersion(id string, version int64) error {
+	current, err := f.mem.GetPlan(id)
+	if err != nil {
+		return err
+	}
+	if current.Version != version {
+		return VersionMismatchErr
+	}
+	return nil
+}
+
+// checkVersion - precisa ser chamada com f.mu travado, para que nenhuma
+// escrita passe entre a conferência e o log
+func (f *FileStore) checkVersion(name string, version int64) error {
+	current, err := f.mem.Get(name)
+	if err != nil {
+		return err
+	}
+	if current.Version != version {
+		return VersionMismatchErr
+	}
+	return nil
+}
+
+func (f *FileStore) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.append(walRecord{Op: walOpDelete, Name: name}); err != nil {
+		return err
+	}
+	if err := f.mem.Remove(name); err != nil {
+		return err
+	}
+	return f.maybeCompact()
+}
+
+// Compact - grava o estado atual em um snapshot e esvazia o log
+func (f *FileStore) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.compact()
+}
+
+// Close - fecha o arquivo do log. A loja não pode ser usada depois disso
+func (f *FileStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.wal.Close()
+}
+
+func (f *FileStore) path(name string) string {
+	return filepath.Join(f.dir, name)
+}
+
+// append - grava o registro no log e só retorna depois do fsync
+func (f *FileStore) append(rec walRecord) error {
+	line, err := encodeWALRecord(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := f.wal.Write(line); err != nil {
+		return err
+	}
+	if err := f.wal.Sync(); err != nil {
+		return err
+	}
+
+	f.records++
+	return nil
+}
+
+// maybeCompact - chamado depois que o registro já foi aplicado em memória,
+// para que o snapshot inclua a última escrita
+func (f *FileStore) maybeCompact() error {
+	if f.CompactEvery > 0 && f.records >= f.CompactEvery {
+		return f.compact()
+	}
+	return nil
+}
+
+func (f *FileStore) compact() error {
+	list, err := f.mem.List()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(snapshot{Format: snapshotFormat, Recipes: list, Revisions: f.mem.history(), Trash: f.mem.trashed(), Aliases: f.mem.aliased(), Plans: f.mem.planned()})
+	if err != nil {
+		return err
+	}
+
+	// Grava em um arquivo temporário e renomeia, assim um snapshot pela
+	// metade nunca substitui o anterior
+	tmp := f.path(snapshotFileName + ".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path(snapshotFileName)); err != nil {
+		return err
+	}
+	if err := syncDir(f.dir); err != nil {
+		return err
+	}
+
+	// Se o processo cair antes daqui, o log antigo é reaplicado sobre o
+	// snapshot novo, o que não muda nada: os registros guardam o estado
+	// completo de cada receita
+	if err := f.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := f.wal.Sync(); err != nil {
+		return err
+	}
+	f.records = 0
+	return nil
+}
+
+func (f *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(f.path(snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Um snapshot no formato antigo não tem histórico: cada receita começa
+	// com uma revisão, a da versão gravada
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil || snap.Format != snapshotFormat {
+		snap = snapshot{}
+		if err := json.Unmarshal(data, &snap.Recipes); err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+	}
+	for name, revisions := range snap.Revisions {
+		f.mem.putHistory(name, revisions)
+	}
+	for name, recipe := range snap.Recipes {
+		f.mem.put(name, recipe)
+	}
+	for name, trashed := range snap.Trash {
+		f.mem.putTrash(name, trashed)
+	}
+	for alias, target := range snap.Aliases {
+		f.mem.putAlias(alias, target)
+	}
+	for id, plan := range snap.Plans {
+		f.mem.putPlan(id, plan)
+	}
+	return nil
+}
+
+// replay - reaplica o log sobre o snapshot. Um registro inválido só é
+// tolerado quando é o último do arquivo (escrita interrompida); nesse caso
+// o arquivo é truncado no fim do último registro válido
+func (f *FileStore) replay() error {
+	data, err := os.ReadFile(f.path(walFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var valid int64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		end := valid + int64(len(line)) + 1
+
+		rec, err := decodeWALRecord(line)
+		if err != nil || end > int64(len(data)) {
+			if end < int64(len(data)) {
+				return fmt.Errorf("%w: record at offset %d", CorruptLogErr, valid)
+			}
+			return os.Truncate(f.path(walFileName), valid)
+		}
+
+		switch rec.Op {
+		case walOpPut:
+			f.mem.put(rec.Name, *rec.Recipe)
+		case walOpDelete:
+			err = f.mem.Remove(rec.Name)
+		case walOpTrash:
+			f.mem.replayTrash(rec.Name, *rec.DeletedAt)
+		case walOpUntrash:
+			f.mem.replayUntrash(rec.Name)
+		case walOpRename:
+			f.mem.replayRename(rec.Name, rec.To, *rec.Recipe)
+		case walOpPutPlan:
+			f.mem.putPlan(rec.Name, *rec.Plan)
+		case walOpDeletePlan:
+			f.mem.deletePlan(rec.Name)
+		}
+		if err != nil {
+			return err
+		}
+		valid = end
+		f.records++
+	}
+	return scanner.Err()
+}
+
+func encodeWALRecord(rec walRecord) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(payload), payload)), nil
+}
+
+func decodeWALRecord(line []byte) (walRecord, error) {
+	var rec walRecord
+
+	sum, payload, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return rec, CorruptLogErr
+	}
+	var want uint32
+	if _, err := fmt.Sscanf(string(sum), "%08x", &want); err != nil {
+		return rec, CorruptLogErr
+	}
+	if crc32.ChecksumIEEE(payload) != want {
+		return rec, CorruptLogErr
+	}
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, CorruptLogErr
+	}
+	switch {
+	case rec.Op == walOpPut && rec.Recipe != nil:
+	case rec.Op == walOpTrash && rec.DeletedAt != nil:
+	case rec.Op == walOpRename && rec.Recipe != nil && rec.To != "":
+	case rec.Op == walOpPutPlan && rec.Plan != nil:
+	case rec.Op == walOpDelete, rec.Op == walOpUntrash, rec.Op == walOpDeletePlan:
+	default:
+		return rec, CorruptLogErr
+	}
+	return rec, nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
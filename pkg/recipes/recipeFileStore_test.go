@@ -0,0 +1,146 @@
+package recipes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_PersistsAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Add("ham-and-cheese-toastie", getHamCheeseToasties()))
+	require.NoError(t, store.Add("ratatouille", Recipe{Name: "ratatouille"}))
+	require.NoError(t, store.Update("ratatouille", Recipe{Name: "ratatouille", Ingredients: []Ingredient{{Name: "eggplant"}}}))
+	require.NoError(t, store.Remove("ham-and-cheese-toastie"))
+	require.NoError(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Recipe{
+		"ratatouille": {Name: "ratatouille", Ingredients: []Ingredient{{Name: "eggplant"}}},
+	}, list)
+}
+
+func TestFileStore_UpdateNotFound(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	assert.ErrorIs(t, store.Update("ratatouille", Recipe{}), NotFoundErr)
+}
+
+func TestFileStore_Compaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	store.CompactEvery = 3
+
+	require.NoError(t, store.Add("a", Recipe{Name: "a"}))
+	require.NoError(t, store.Add("b", Recipe{Name: "b"}))
+	require.NoError(t, store.Add("c", Recipe{Name: "c"}))
+	require.NoError(t, store.Remove("a"))
+	require.NoError(t, store.Close())
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	require.NoError(t, err)
+
+	wal, err := os.ReadFile(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	assert.Len(t, splitLines(wal), 1, "only the delete after the snapshot should remain in the log")
+
+	store, err = NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.NotContains(t, list, "a")
+}
+
+func TestFileStore_RecoversFromTornRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		tail string
+	}{
+		{name: "Partial line", tail: `1234abcd {"op":"put","name":"b","reci`},
+		{name: "Bad checksum on last line", tail: "00000000 {\"op\":\"delete\",\"name\":\"a\"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			store, err := NewFileStore(dir)
+			require.NoError(t, err)
+			require.NoError(t, store.Add("a", getHamCheeseToasties()))
+			require.NoError(t, store.Close())
+
+			walPath := filepath.Join(dir, walFileName)
+			before, err := os.ReadFile(walPath)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(walPath, append(before, tt.tail...), 0o644))
+
+			store, err = NewFileStore(dir)
+			require.NoError(t, err)
+
+			got, err := store.Get("a")
+			require.NoError(t, err)
+			assert.Equal(t, getHamCheeseToasties(), got)
+
+			// O registro cortado é descartado e novas escritas continuam válidas
+			require.NoError(t, store.Add("b", Recipe{Name: "b"}))
+			require.NoError(t, store.Close())
+
+			store, err = NewFileStore(dir)
+			require.NoError(t, err)
+			defer store.Close()
+
+			list, err := store.List()
+			require.NoError(t, err)
+			assert.Len(t, list, 2)
+		})
+	}
+}
+
+func TestFileStore_CorruptRecordInTheMiddle(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Add("a", Recipe{Name: "a"}))
+	require.NoError(t, store.Close())
+
+	walPath := filepath.Join(dir, walFileName)
+	good, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+
+	corrupt := append([]byte("00000000 {}\n"), good...)
+	require.NoError(t, os.WriteFile(walPath, corrupt, 0o644))
+
+	_, err = NewFileStore(dir)
+	assert.ErrorIs(t, err, CorruptLogErr)
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	start := 0
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, string(data[start:i]))
+			start = i + 1
+		}
+	}
+	return lines
+}
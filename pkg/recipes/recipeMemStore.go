@@ -1,51 +1,682 @@
 package recipes
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
 
 var (
 	NotFoundErr = errors.New("not found")
+	ExistsErr   = errors.New("already exists")
+	// VersionMismatchErr - a receita gravada não está mais na versão esperada
+	VersionMismatchErr = errors.New("version mismatch")
 )
 
+// MemStore - loja em memória segura para uso concorrente. Os métodos de
+// leitura devolvem cópias, então quem chama pode alterar o resultado sem
+// mexer no estado interno da loja
 type MemStore struct {
+	mu   sync.RWMutex
 	list map[string]Recipe
+	// revisions - o histórico de cada receita, da mais antiga para a mais
+	// nova; veja nextRevision
+	revisions map[string][]Recipe
+	// trash - receitas removidas, que ainda podem ser restauradas. O
+	// histórico delas continua em revisions
+	trash map[string]TrashedRecipe
+	// aliases - os nomes antigos das receitas renomeadas, apontando para o
+	// nome atual. Um apelido também fica reservado
+	aliases map[string]string
+	// byTag - as receitas da listagem por tag (TagKey), para os filtros
+	// ?tag= da listagem e das facetas não percorrerem todas as receitas
+	byTag map[string]map[string]struct{}
+	// plans - os planos de refeições, pelo ID. Os IDs dos planos são
+	// independentes dos das receitas
+	plans map[string]Plan
 }
 
 func NewMemStore() *MemStore {
 	list := make(map[string]Recipe)
 	return &MemStore{
-		list,
+		list:      list,
+		revisions: make(map[string][]Recipe),
+		trash:     make(map[string]TrashedRecipe),
+		aliases:   make(map[string]string),
+		byTag:     make(map[string]map[string]struct{}),
+		plans:     make(map[string]Plan),
 	}
 }
 
-func (m MemStore) Add(name string, recipe Recipe) error {
-	m.list[name] = recipe
+// Add - grava uma receita nova. Devolve ExistsErr, sem alterar nada, se já
+// existir uma receita com o mesmo nome, inclusive na lixeira, ou se o nome
+// for o apelido de uma receita renomeada
+func (m *MemStore) Add(name string, recipe Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.exists(name) {
+		return ExistsErr
+	}
+	m.set(name, recipe)
 	return nil
 }
 
-func (m MemStore) Get(name string) (Recipe, error) {
+// put - grava a receita, exista ela ou não. Usado pela FileStore ao
+// reconstruir o estado a partir do snapshot e do log
+func (m *MemStore) put(name string, recipe Recipe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(name, recipe)
+}
+
+// set - grava a receita e acrescenta a revisão ao histórico. Precisa ser
+// chamada com m.mu travado
+func (m *MemStore) set(name string, recipe Recipe) {
+	m.unindexTags(name)
+	m.list[name] = recipe.clone()
+	m.indexTags(name)
+	if revision, ok := nextRevision(m.revisions[name], recipe); ok {
+		m.revisions[name] = append(m.revisions[name], revision)
+	}
+}
+
+func (m *MemStore) Get(name string) (Recipe, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
 	if val, ok := m.list[name]; ok {
-		return val, nil
+		return val.clone(), nil
 	}
 
 	return Recipe{}, NotFoundErr
 }
 
-func (m MemStore) List() (map[string]Recipe, error) {
-	return m.list, nil
+func (m *MemStore) List() (map[string]Recipe, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make(map[string]Recipe, len(m.list))
+	for name, recipe := range m.list {
+		list[name] = recipe.clone()
+	}
+	return list, nil
+}
+
+// ListPage - uma página da listagem; veja Paginate
+func (m *MemStore) ListPage(opts ListOptions) (Page, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	page := Paginate(m.candidates(opts), opts)
+	for i, recipe := range page.Recipes {
+		page.Recipes[i] = recipe.clone()
+	}
+	return page, nil
 }
 
-func (m MemStore) Update(name string, recipe Recipe) error {
+func (m *MemStore) Update(name string, recipe Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	if _, ok := m.list[name]; ok {
-		m.list[name] = recipe
+		m.set(name, recipe)
 		return nil
 	}
 
 	return NotFoundErr
 }
 
-func (m MemStore) Remove(name string) error {
+// CompareAndSwap - grava a receita só se a versão gravada for version.
+// Devolve NotFoundErr se ela não existir e VersionMismatchErr se outra
+// escrita chegou antes. A versão nova é a que vem em recipe
+func (m *MemStore) CompareAndSwap(name string, version int64, recipe Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(name, version); err != nil {
+		return err
+	}
+	m.set(name, recipe)
+	return nil
+}
+
+// CompareAndDelete - remove a receita só se a versão gravada for version
+func (m *MemStore) CompareAndDelete(name string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(name, version); err != nil {
+		return err
+	}
+	m.delete(name)
+	return nil
+}
+
+// Facets - as facetas das receitas que passam pelos filtros; veja
+// CountFacets
+func (m *MemStore) Facets(opts ListOptions) (Facets, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return CountFacets(m.candidates(opts), opts), nil
+}
+
+// candidates - as receitas que podem passar pelos filtros de opts. Com
+// filtro de tag, só as que o índice tem para a tag menos usada; o resto
+// dos filtros fica com Paginate e CountFacets. Precisa ser chamada com m.mu
+// travado e o resultado não pode ser alterado
+func (m *MemStore) candidates(opts ListOptions) map[string]Recipe {
+	if len(opts.Tags) == 0 {
+		return m.list
+	}
+	var names map[string]struct{}
+	for i, tag := range opts.Tags {
+		if tagged := m.byTag[TagKey(tag)]; i == 0 || len(tagged) < len(names) {
+			names = tagged
+		}
+	}
+	list := make(map[string]Recipe, len(names))
+	for name := range names {
+		list[name] = m.list[name]
+	}
+	return list
+}
+
+// indexTags e unindexTags - mantêm byTag em dia com m.list: unindexTags
+// antes de a receita sair da listagem e indexTags depois de ela entrar.
+// Precisam ser chamadas com m.mu travado
+func (m *MemStore) indexTags(name string) {
+	for _, tag := range m.list[name].Tags {
+		key := TagKey(tag)
+		if m.byTag[key] == nil {
+			m.byTag[key] = make(map[string]struct{})
+		}
+		m.byTag[key][name] = struct{}{}
+	}
+}
+
+func (m *MemStore) unindexTags(name string) {
+	for _, tag := range m.list[name].Tags {
+		key := TagKey(tag)
+		delete(m.byTag[key], name)
+		if len(m.byTag[key]) == 0 {
+			delete(m.byTag, key)
+		}
+	}
+}
+
+// checkVersion - precisa ser chamada com m.mu travado
+func (m *MemStore) checkVersion(name string, version int64) error {
+	current, ok := m.list[name]
+	if !ok {
+		return NotFoundErr
+	}
+	if current.Version != version {
+		return VersionMismatchErr
+	}
+	return nil
+}
+
+func (m *MemStore) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.delete(name)
+	return nil
+}
+
+// delete - remove a receita, esteja ela na lixeira ou não, junto com o
+// histórico e os apelidos, para que uma receita criada depois com o mesmo
+// nome comece do zero
+func (m *MemStore) delete(name string) {
+	m.unindexTags(name)
 	delete(m.list, name)
+	delete(m.trash, name)
+	delete(m.revisions, name)
+	for alias, target := range m.aliases {
+		if target == name {
+			delete(m.aliases, alias)
+		}
+	}
+}
+
+// exists - o nome está em uso, na listagem, na lixeira ou como apelido.
+// Precisa ser chamada com m.mu travado
+func (m *MemStore) exists(name string) bool {
+	_, listed := m.list[name]
+	_, trashed := m.trash[name]
+	_, aliased := m.aliases[name]
+	return listed || trashed || aliased
+}
+
+// inUse - exists, para a FileStore conferir antes de gravar no log
+func (m *MemStore) inUse(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.exists(name)
+}
+
+// has - se o nome está na listagem e se está na lixeira, para a FileStore
+// conferir antes de gravar no log
+func (m *MemStore) has(name string) (listed, trashed bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, listed = m.list[name]
+	_, trashed = m.trash[name]
+	return listed, trashed
+}
+
+// MoveToTrash - tira a receita da listagem e a guarda na lixeira, só se a
+// versão gravada for version; os erros são os de CompareAndDelete
+func (m *MemStore) MoveToTrash(name string, version int64, deletedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(name, version); err != nil {
+		return err
+	}
+	m.moveToTrash(name, deletedAt)
+	return nil
+}
+
+// moveToTrash - precisa ser chamada com m.mu travado. Um nome que não está
+// na listagem é ignorado, o que deixa a reconstrução da FileStore
+// idempotente
+func (m *MemStore) moveToTrash(name string, deletedAt time.Time) {
+	recipe, ok := m.list[name]
+	if !ok {
+		return
+	}
+	m.unindexTags(name)
+	delete(m.list, name)
+	m.trash[name] = TrashedRecipe{Recipe: recipe, DeletedAt: deletedAt}
+}
+
+// Trash - as receitas na lixeira, das removidas mais recentemente para as
+// mais antigas
+func (m *MemStore) Trash() ([]TrashedRecipe, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	trash := make([]TrashedRecipe, 0, len(m.trash))
+	for name, trashed := range m.trash {
+		trashed.Recipe = trashed.Recipe.clone()
+		trashed.ID = name
+		trash = append(trash, trashed)
+	}
+	sortTrash(trash)
+	return trash, nil
+}
+
+// Untrash - devolve a receita da lixeira para a listagem, como ela estava.
+// Devolve NotFoundErr se ela não estiver na lixeira
+func (m *MemStore) Untrash(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.trash[name]; !ok {
+		return NotFoundErr
+	}
+	m.untrash(name)
 	return nil
 }
+
+// replayTrash e replayUntrash - usados pela FileStore ao reaplicar o log,
+// sem conferir a versão
+func (m *MemStore) replayTrash(name string, deletedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.moveToTrash(name, deletedAt)
+}
+
+func (m *MemStore) replayUntrash(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.untrash(name)
+}
+
+// untrash - precisa ser chamada com m.mu travado
+func (m *MemStore) untrash(name string) {
+	trashed, ok := m.trash[name]
+	if !ok {
+		return
+	}
+	delete(m.trash, name)
+	m.list[name] = trashed.Recipe
+	m.indexTags(name)
+}
+
+// Purge - apaga de vez as receitas que estão na lixeira desde antes de
+// before e devolve os nomes delas
+func (m *MemStore) Purge(before time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := []string{}
+	for name, trashed := range m.trash {
+		if trashed.DeletedAt.Before(before) {
+			m.delete(name)
+			purged = append(purged, name)
+		}
+	}
+	sort.Strings(purged)
+	return purged, nil
+}
+
+// Rename - CompareAndSwap que também muda o nome da receita: o histórico
+// vai junto e from vira um apelido de to. Devolve ExistsErr se to já
+// estiver em uso, a não ser que seja um apelido da própria receita
+func (m *MemStore) Rename(from, to string, version int64, recipe Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRename(from, to, version); err != nil {
+		return err
+	}
+	m.rename(from, to, recipe)
+	return nil
+}
+
+// canRename - checkRename, para a FileStore conferir antes de
+// gravar no log
+func (m *MemStore) canRename(from, to string, version int64) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.checkRename(from, to, version)
+}
+
+// checkRename - as conferências de Rename. Precisa ser chamada com m.mu
+// travado
+func (m *MemStore) checkRename(from, to string, version int64) error {
+	if err := m.checkVersion(from, version); err != nil {
+		return err
+	}
+	if m.exists(to) && m.aliases[to] != from {
+		return ExistsErr
+	}
+	return nil
+}
+
+// rename - precisa ser chamada com m.mu travado. Os apelidos que apontavam
+// para from passam a apontar para to, então um nome antigo nunca precisa de
+// mais de um redirecionamento
+func (m *MemStore) rename(from, to string, recipe Recipe) {
+	m.revisions[to] = m.revisions[from]
+	delete(m.revisions, from)
+	m.unindexTags(from)
+	delete(m.list, from)
+	m.set(to, recipe)
+
+	delete(m.aliases, to)
+	for alias, target := range m.aliases {
+		if target == from {
+			m.aliases[alias] = to
+		}
+	}
+	m.aliases[from] = to
+}
+
+// Alias - o nome atual de uma receita renomeada. Devolve NotFoundErr se
+// name não for um apelido
+func (m *MemStore) Alias(name string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if to, ok := m.aliases[name]; ok {
+		return to, nil
+	}
+	return "", NotFoundErr
+}
+
+// Revisions - o histórico da receita, da revisão mais antiga para a mais
+// nova. Devolve NotFoundErr se a receita não existir
+func (m *MemStore) Revisions(name string) ([]Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.list[name]; !ok {
+		return nil, NotFoundErr
+	}
+	revisions := make([]Revision, len(m.revisions[name]))
+	for i, recipe := range m.revisions[name] {
+		revisions[i] = NewRevision(recipe)
+	}
+	return revisions, nil
+}
+
+// Revision - uma revisão do histórico, com a receita completa
+func (m *MemStore) Revision(name string, number int64) (Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.list[name]; !ok {
+		return Revision{}, NotFoundErr
+	}
+	for _, recipe := range m.revisions[name] {
+		if recipe.Version == number {
+			return NewRevision(recipe), nil
+		}
+	}
+	return Revision{}, NotFoundErr
+}
+
+// history - cópia dos históricos, para o snapshot da FileStore
+func (m *MemStore) history() map[string][]Recipe {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := make(map[string][]Recipe, len(m.revisions))
+	for name, revisions := range m.revisions {
+		copies := make([]Recipe, len(revisions))
+		for i, recipe := range revisions {
+			copies[i] = recipe.clone()
+		}
+		history[name] = copies
+	}
+	return history
+}
+
+// trashed - cópia da lixeira, para o snapshot da FileStore
+func (m *MemStore) trashed() map[string]TrashedRecipe {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	trash := make(map[string]TrashedRecipe, len(m.trash))
+	for name, trashed := range m.trash {
+		trashed.Recipe = trashed.Recipe.clone()
+		trash[name] = trashed
+	}
+	return trash
+}
+
+// putTrash - restaura uma receita da lixeira de um snapshot
+func (m *MemStore) putTrash(name string, trashed TrashedRecipe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trashed.ID = ""
+	m.set(name, trashed.Recipe)
+	m.moveToTrash(name, trashed.DeletedAt)
+}
+
+// aliased - cópia dos apelidos, para o snapshot da FileStore
+func (m *MemStore) aliased() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	aliases := make(map[string]string, len(m.aliases))
+	for alias, target := range m.aliases {
+		aliases[alias] = target
+	}
+	return aliases
+}
+
+// putAlias - restaura um apelido de um snapshot
+func (m *MemStore) putAlias(alias, target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.aliases[alias] = target
+}
+
+// replayRename - usado pela FileStore ao reaplicar o log. Se to já existe,
+// o snapshot é posterior à renomeação (o processo caiu antes de o log ser
+// esvaziado) e o que os registros anteriores gravaram em from é descartado
+func (m *MemStore) replayRename(from, to string, recipe Recipe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.list[from]; !ok {
+		return
+	}
+	_, listed := m.list[to]
+	_, trashed := m.trash[to]
+	if listed || trashed {
+		m.unindexTags(from)
+		delete(m.list, from)
+		delete(m.revisions, from)
+		m.aliases[from] = to
+		return
+	}
+	m.rename(from, to, recipe)
+}
+
+// putHistory - restaura o histórico de um snapshot, antes das receitas
+func (m *MemStore) putHistory(name string, revisions []Recipe) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, recipe := range revisions {
+		if revision, ok := nextRevision(m.revisions[name], recipe); ok {
+			m.revisions[name] = append(m.revisions[name], revision)
+		}
+	}
+}
+
+// AddPlan - grava um plano novo. Devolve ExistsErr, sem alterar nada, se já
+// existir um plano com o mesmo ID
+func (m *MemStore) AddPlan(id string, plan Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.plans[id]; ok {
+		return ExistsErr
+	}
+	m.setPlan(id, plan)
+	return nil
+}
+
+// GetPlan - o plano, com o ID preenchido
+func (m *MemStore) GetPlan(id string) (Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plan, ok := m.plans[id]
+	if !ok {
+		return Plan{}, NotFoundErr
+	}
+	plan = plan.clone()
+	plan.ID = id
+	return plan, nil
+}
+
+// Plans - todos os planos, pela ordem dos IDs
+func (m *MemStore) Plans() ([]Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plans := make([]Plan, 0, len(m.plans))
+	for id, plan := range m.plans {
+		plan = plan.clone()
+		plan.ID = id
+		plans = append(plans, plan)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].ID < plans[j].ID })
+	return plans, nil
+}
+
+// CompareAndSwapPlan - substitui o plano só se a versão gravada for
+// version. Devolve NotFoundErr se o plano não existir e VersionMismatchErr
+// se ele tiver mudado
+func (m *MemStore) CompareAndSwapPlan(id string, version int64, plan Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPlanVersion(id, version); err != nil {
+		return err
+	}
+	m.setPlan(id, plan)
+	return nil
+}
+
+// CompareAndDeletePlan - remove o plano só se a versão gravada for version;
+// os erros são os de CompareAndSwapPlan
+func (m *MemStore) CompareAndDeletePlan(id string, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPlanVersion(id, version); err != nil {
+		return err
+	}
+	delete(m.plans, id)
+	return nil
+}
+
+// checkPlanVersion - precisa ser chamada com m.mu travado
+func (m *MemStore) checkPlanVersion(id string, version int64) error {
+	current, ok := m.plans[id]
+	if !ok {
+		return NotFoundErr
+	}
+	if current.Version != version {
+		return VersionMismatchErr
+	}
+	return nil
+}
+
+// setPlan - grava o plano sem o ID e os avisos, que não são guardados.
+// Precisa ser chamada com m.mu travado
+func (m *MemStore) setPlan(id string, plan Plan) {
+	plan = plan.clone()
+	plan.ID = ""
+	plan.Warnings = nil
+	m.plans[id] = plan
+}
+
+// putPlan - grava o plano, exista ele ou não. Usado pela FileStore ao
+// reconstruir o estado a partir do snapshot e do log
+func (m *MemStore) putPlan(id string, plan Plan) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setPlan(id, plan)
+}
+
+// deletePlan - remove o plano, se ele existir; usado pela FileStore ao
+// reaplicar o log
+func (m *MemStore) deletePlan(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.plans, id)
+}
+
+// planned - cópia dos planos, para o snapshot da FileStore
+func (m *MemStore) planned() map[string]Plan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plans := make(map[string]Plan, len(m.plans))
+	for id, plan := range m.plans {
+		plans[id] = plan.clone()
+	}
+	return plans
+}
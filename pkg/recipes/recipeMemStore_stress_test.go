@@ -0,0 +1,112 @@
+package recipes
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Estes testes são mais úteis com o detector de corrida:
+//
+//	go test -race ./pkg/recipes/...
+func TestMemStore_ConcurrentCRUD(t *testing.T) {
+	const (
+		workers    = 16
+		iterations = 200
+	)
+
+	store := NewMemStore()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				name := fmt.Sprintf("recipe-%d", (w*iterations+i)%32)
+				recipe := getHamCheeseToasties()
+
+				// Outro worker pode já ter criado a mesma receita
+				if err := store.Add(name, recipe); err != nil {
+					assert.ErrorIs(t, err, ExistsErr)
+				}
+				_, _ = store.Get(name)
+				_ = store.Update(name, recipe)
+
+				list, err := store.List()
+				assert.NoError(t, err)
+				for _, r := range list {
+					_ = len(r.Ingredients)
+				}
+
+				if i%3 == 0 {
+					assert.NoError(t, store.Remove(name))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(list), 32)
+}
+
+func TestMemStore_ConcurrentReadersMutatingCopies(t *testing.T) {
+	store := NewMemStore()
+	require.NoError(t, store.Add("toastie", getHamCheeseToasties()))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				got, err := store.Get("toastie")
+				assert.NoError(t, err)
+				got.Ingredients[0].Name = "brioche"
+				got.Ingredients = append(got.Ingredients, Ingredient{Name: "mustard"})
+
+				list, err := store.List()
+				assert.NoError(t, err)
+				list["toastie"].Ingredients[1].Name = "turkey"
+				delete(list, "toastie")
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := store.Get("toastie")
+	require.NoError(t, err)
+	assert.Equal(t, getHamCheeseToasties(), got)
+}
+
+func TestMemStore_DefensiveCopies(t *testing.T) {
+	store := NewMemStore()
+
+	recipe := getHamCheeseToasties()
+	require.NoError(t, store.Add("toastie", recipe))
+
+	// Alterar o valor passado para Add não afeta a loja
+	recipe.Ingredients[0].Name = "brioche"
+
+	got, err := store.Get("toastie")
+	require.NoError(t, err)
+	assert.Equal(t, "bread", got.Ingredients[0].Name)
+
+	// Alterar o valor devolvido por Get não afeta a loja
+	got.Ingredients[1].Name = "turkey"
+
+	// Alterar o mapa devolvido por List não afeta a loja
+	list, err := store.List()
+	require.NoError(t, err)
+	list["toastie"].Ingredients[2].Name = "cheddar"
+	delete(list, "toastie")
+
+	got, err = store.Get("toastie")
+	require.NoError(t, err)
+	assert.Equal(t, getHamCheeseToasties(), got)
+}
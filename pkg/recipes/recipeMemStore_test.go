@@ -1,10 +1,12 @@
 package recipes
 
 import (
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func getHamCheeseToasties() Recipe {
@@ -18,7 +20,13 @@ func getHamCheeseToasties() Recipe {
 	}
 }
 
-func TestMemStore_Add(t *testing.T) {
+func TestStore_Add(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreAdd(t, factory)
+	})
+}
+
+func testStoreAdd(t *testing.T, factory storeFactory) {
 	type fields struct {
 		list map[string]Recipe
 	}
@@ -45,23 +53,49 @@ func TestMemStore_Add(t *testing.T) {
 			wantLen: 1,
 			wantErr: false,
 		},
+		{
+			name: "Add existing does not overwrite",
+			fields: fields{
+				map[string]Recipe{"ham and cheese toastie": getHamCheeseToasties()},
+			},
+			args: args{
+				name:   "ham and cheese toastie",
+				recipe: Recipe{Name: "Ham and cheese toastie", Ingredients: []Ingredient{{Name: "ham"}}},
+			},
+			wantLen: 1,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := MemStore{
-				list: tt.fields.list,
-			}
+			m := newSeededStore(t, factory, tt.fields.list)
 			err := m.Add(tt.args.name, tt.args.recipe)
-			if !tt.wantErr {
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ExistsErr)
+			} else {
 				assert.NoError(t, err)
 			}
 
-			assert.Len(t, tt.fields.list, tt.wantLen)
+			list, err := m.List()
+			require.NoError(t, err)
+			assert.Len(t, list, tt.wantLen)
+
+			want := tt.args.recipe
+			if seeded, ok := tt.fields.list[tt.args.name]; ok {
+				want = seeded
+			}
+			assert.Equal(t, want, list[tt.args.name])
 		})
 	}
 }
 
-func TestMemStore_Get(t *testing.T) {
+func TestStore_Get(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreGet(t, factory)
+	})
+}
+
+func testStoreGet(t *testing.T, factory storeFactory) {
 	type fields struct {
 		list map[string]Recipe
 	}
@@ -106,9 +140,7 @@ func TestMemStore_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := MemStore{
-				list: tt.fields.list,
-			}
+			m := newSeededStore(t, factory, tt.fields.list)
 			got, err := m.Get(tt.args.name)
 			if tt.wantErr != nil {
 				if !tt.wantErr(t, err, fmt.Sprintf("Get(%v)", tt.args.name)) {
@@ -123,7 +155,13 @@ func TestMemStore_Get(t *testing.T) {
 	}
 }
 
-func TestMemStore_List(t *testing.T) {
+func TestStore_List(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreList(t, factory)
+	})
+}
+
+func testStoreList(t *testing.T, factory storeFactory) {
 	type fields struct {
 		list map[string]Recipe
 	}
@@ -148,9 +186,7 @@ func TestMemStore_List(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := MemStore{
-				list: tt.fields.list,
-			}
+			m := newSeededStore(t, factory, tt.fields.list)
 			got, err := m.List()
 			if tt.wantErr != nil {
 				if !tt.wantErr(t, err, fmt.Sprintf("List()")) {
@@ -165,7 +201,13 @@ func TestMemStore_List(t *testing.T) {
 	}
 }
 
-func TestMemStore_Remove(t *testing.T) {
+func TestStore_Remove(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreRemove(t, factory)
+	})
+}
+
+func testStoreRemove(t *testing.T, factory storeFactory) {
 	type fields struct {
 		list map[string]Recipe
 	}
@@ -194,9 +236,7 @@ func TestMemStore_Remove(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := MemStore{
-				list: tt.fields.list,
-			}
+			m := newSeededStore(t, factory, tt.fields.list)
 
 			err := m.Remove(tt.args.name)
 
@@ -208,12 +248,20 @@ func TestMemStore_Remove(t *testing.T) {
 				assert.NoError(t, err)
 			}
 
-			assert.Len(t, m.list, tt.wantLen)
+			list, err := m.List()
+			require.NoError(t, err)
+			assert.Len(t, list, tt.wantLen)
 		})
 	}
 }
 
-func TestMemStore_Update(t *testing.T) {
+func TestStore_Update(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreUpdate(t, factory)
+	})
+}
+
+func testStoreUpdate(t *testing.T, factory storeFactory) {
 	type fields struct {
 		list map[string]Recipe
 	}
@@ -250,12 +298,26 @@ func TestMemStore_Update(t *testing.T) {
 			wantErr: nil,
 			wantLen: 1,
 		},
+		{
+			name: "Update missing Ratatouille",
+			fields: fields{
+				map[string]Recipe{
+					"Ham and cheese toasties": getHamCheeseToasties(),
+				},
+			},
+			args: args{
+				name:   "Ratatouille",
+				recipe: Recipe{Name: "Ratatouille"},
+			},
+			wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+				return errors.Is(err, NotFoundErr)
+			},
+			wantLen: 1,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			m := MemStore{
-				list: tt.fields.list,
-			}
+			m := newSeededStore(t, factory, tt.fields.list)
 
 			err := m.Update(tt.args.name, tt.args.recipe)
 			if tt.wantErr != nil {
@@ -266,7 +328,127 @@ func TestMemStore_Update(t *testing.T) {
 				assert.NoError(t, err)
 			}
 
-			assert.Len(t, m.list, tt.wantLen)
+			list, err := m.List()
+			require.NoError(t, err)
+			assert.Len(t, list, tt.wantLen)
 		})
 	}
 }
+
+// getStructuredToastie - receita com todos os campos opcionais preenchidos,
+// para conferir que nenhuma loja perde informação
+func getStructuredToastie() Recipe {
+	return Recipe{
+		Name: "ham and cheese toastie",
+		Ingredients: []Ingredient{
+			{Name: "bread", Quantity: 2, Unit: UnitSlice},
+			{Name: "ham", Quantity: 50, Unit: UnitGram},
+			{Name: "cheese", Quantity: 1.5, Unit: UnitOunce, Note: "grated"},
+			{Name: "butter", Quantity: 1, Unit: UnitTeaspoon, Optional: true},
+		},
+		Servings: 2,
+		Steps: []Step{
+			{Text: "Butter the bread", Ingredients: []string{"bread", "butter"}},
+			{Text: "Fill with ham and cheese"},
+			{Text: "Toast until golden", Timer: Duration(4 * time.Minute)},
+		},
+		TotalTime:  Duration(10 * time.Minute),
+		ActiveTime: Duration(6 * time.Minute),
+		Yield:      "2 toasties",
+		Difficulty: DifficultyEasy,
+		Tags:       []string{"lanche", "rápido"},
+		Allergens:  []string{"dairy", "gluten"},
+		CreatedAt:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		UpdatedAt:  time.Date(2024, 5, 2, 8, 30, 0, 123, time.UTC),
+		Version:    3,
+	}
+}
+
+func TestStore_RoundTrip(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		store := factory.new(t)
+		want := getStructuredToastie()
+		require.NoError(t, store.Add("toastie", want))
+
+		got, err := store.Get("toastie")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		list, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, want, list["toastie"])
+
+		want.Ingredients[1].Note = "smoked"
+		want.Ingredients[3].Optional = false
+		want.Servings = 4
+		want.Steps = want.Steps[1:]
+		want.Steps[1].Timer = Duration(5 * time.Minute)
+		want.Difficulty = DifficultyMedium
+		want.Tags = []string{"café da manhã"}
+		want.Allergens = []string{"gluten"}
+		want.UpdatedAt = want.UpdatedAt.Add(time.Hour)
+		want.Version++
+		require.NoError(t, store.Update("toastie", want))
+		got, err = store.Get("toastie")
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestStore_CompareAndSwap(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreCompareAndSwap(t, factory)
+	})
+}
+
+func testStoreCompareAndSwap(t *testing.T, factory storeFactory) {
+	v1 := getHamCheeseToasties()
+	v1.Version = 1
+	v2 := v1
+	v2.Ingredients = []Ingredient{{Name: "bread"}, {Name: "cheese"}}
+	v2.Version = 2
+
+	tests := []struct {
+		name    string
+		id      string
+		version int64
+		wantErr error
+		want    Recipe
+	}{
+		{name: "Current version", id: "toastie", version: 1, want: v2},
+		{name: "Stale version", id: "toastie", version: 0, wantErr: VersionMismatchErr, want: v1},
+		{name: "Missing recipe", id: "ratatouille", version: 1, wantErr: NotFoundErr, want: v1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newSeededStore(t, factory, map[string]Recipe{"toastie": v1})
+			err := store.CompareAndSwap(tt.id, tt.version, v2)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			got, err := store.Get("toastie")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStore_CompareAndDelete(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		toastie := getHamCheeseToasties()
+		toastie.Version = 4
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": toastie})
+
+		assert.ErrorIs(t, store.CompareAndDelete("toastie", 3), VersionMismatchErr)
+		assert.ErrorIs(t, store.CompareAndDelete("ratatouille", 4), NotFoundErr)
+		_, err := store.Get("toastie")
+		require.NoError(t, err)
+
+		require.NoError(t, store.CompareAndDelete("toastie", 4))
+		_, err = store.Get("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+	})
+}
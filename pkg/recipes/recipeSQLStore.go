@@ -0,0 +1,1127 @@
+package recipes
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	_ "modernc.org/sqlite"
+)
+
+// As migrações ficam versionadas em pkg/recipes/migrations. O número no
+// início do arquivo (0001_...) é a versão gravada em schema_migrations
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// SQLStore - loja em um arquivo SQLite, usando um driver em Go puro
+// (modernc.org/sqlite), então não precisa de cgo
+type SQLStore struct {
+	db *sql.DB
+}
+
+// NewSQLStore - abre (ou cria) o banco em path e aplica as migrações
+// pendentes. Use ":memory:" para um banco temporário
+func NewSQLStore(path string) (*SQLStore, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// O SQLite aceita um único escritor por vez; uma conexão só também faz
+	// com que ":memory:" seja o mesmo banco para todas as consultas
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := backfillKeys(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	store := &SQLStore{db: db}
+	if err := store.backfillRevisions(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Close - fecha o banco
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) Add(name string, recipe Recipe) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if aliased, err := isAlias(tx, name); err != nil {
+			return err
+		} else if aliased {
+			return ExistsErr
+		}
+		args := append([]interface{}{name}, recipeArgs(recipe)...)
+		res, err := tx.Exec(`INSERT INTO recipes (id, `+recipeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO NOTHING`, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ExistsErr
+		}
+		if err := replaceChildren(tx, name, recipe); err != nil {
+			return err
+		}
+		return addRevision(tx, name, recipe)
+	})
+}
+
+func (s *SQLStore) Get(name string) (Recipe, error) {
+	list, err := s.query(`WHERE id = ? AND deleted_at = 0`, name)
+	if err != nil {
+		return Recipe{}, err
+	}
+	recipe, ok := list[name]
+	if !ok {
+		return Recipe{}, NotFoundErr
+	}
+	return recipe, nil
+}
+
+func (s *SQLStore) List() (map[string]Recipe, error) {
+	return s.query(`WHERE deleted_at = 0`)
+}
+
+func (s *SQLStore) Update(name string, recipe Recipe) error {
+	return s.update(name, recipe, ``)
+}
+
+// CompareAndSwap - veja MemStore.CompareAndSwap. A versão é conferida no
+// próprio UPDATE, então duas escritas simultâneas não passam as duas
+func (s *SQLStore) CompareAndSwap(name string, version int64, recipe Recipe) error {
+	return s.update(name, recipe, ` AND version = ?`, version)
+}
+
+// update - o UPDATE da receita e dos filhos, com uma condição a mais no
+// WHERE. Quando nenhuma linha muda, descobre se a receita não existe ou
+// se a condição falhou
+func (s *SQLStore) update(name string, recipe Recipe, cond string, condArgs ...interface{}) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		args := append(append(recipeArgs(recipe), name), condArgs...)
+		res, err := tx.Exec(`UPDATE recipes
+			SET name = ?, servings = ?, total_time = ?, active_time = ?, yield = ?, difficulty = ?,
+				name_key = ?, created_at = ?, updated_at = ?, updated_by = ?, version = ?
+			WHERE id = ? AND deleted_at = 0`+cond, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return missingOrMismatch(tx, name)
+		}
+		if err := replaceChildren(tx, name, recipe); err != nil {
+			return err
+		}
+		return addRevision(tx, name, recipe)
+	})
+}
+
+func (s *SQLStore) Remove(name string) error {
+	_, err := s.db.Exec(`DELETE FROM recipes WHERE id = ?`, name)
+	return err
+}
+
+// CompareAndDelete - veja MemStore.CompareAndDelete
+func (s *SQLStore) CompareAndDelete(name string, version int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM recipes WHERE id = ? AND deleted_at = 0 AND version = ?`, name, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return missingOrMismatch(tx, name)
+		}
+		return nil
+	})
+}
+
+// MoveToTrash - veja MemStore.MoveToTrash. A receita continua na tabela,
+// com deleted_at preenchido, então o ID segue reservado
+func (s *SQLStore) MoveToTrash(name string, version int64, deletedAt time.Time) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE recipes SET deleted_at = ? WHERE id = ? AND deleted_at = 0 AND version = ?`,
+			UnixNano(deletedAt), name, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return missingOrMismatch(tx, name)
+		}
+		return nil
+	})
+}
+
+// Trash - as receitas na lixeira, das removidas mais recentemente para as
+// mais antigas
+func (s *SQLStore) Trash() ([]TrashedRecipe, error) {
+	deleted := make(map[string]int64)
+	rows, err := s.db.Query(`SELECT id, deleted_at FROM recipes WHERE deleted_at <> 0`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var deletedAt int64
+		if err := rows.Scan(&id, &deletedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deleted[id] = deletedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	list, err := s.query(`WHERE deleted_at <> 0`)
+	if err != nil {
+		return nil, err
+	}
+	trash := make([]TrashedRecipe, 0, len(list))
+	for id, recipe := range list {
+		recipe.ID = id
+		trash = append(trash, TrashedRecipe{Recipe: recipe, DeletedAt: FromUnixNano(deleted[id])})
+	}
+	sortTrash(trash)
+	return trash, nil
+}
+
+// Untrash - veja MemStore.Untrash
+func (s *SQLStore) Untrash(name string) error {
+	res, err := s.db.Exec(`UPDATE recipes SET deleted_at = 0 WHERE id = ? AND deleted_at <> 0`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return NotFoundErr
+	}
+	return nil
+}
+
+// Purge - veja MemStore.Purge. Ingredientes, passos, tags e revisões vão
+// junto pelo ON DELETE CASCADE
+func (s *SQLStore) Purge(before time.Time) ([]string, error) {
+	purged := []string{}
+	err := s.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id FROM recipes WHERE deleted_at <> 0 AND deleted_at < ? ORDER BY id`, UnixNano(before))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			purged = append(purged, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM recipes WHERE id IN (`+placeholders(len(purged))+`)`, stringArgs(purged)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// Rename - veja MemStore.Rename. A receita é gravada com o ID novo e o
+// histórico e os apelidos passam para ela antes de a linha antiga ser
+// apagada, senão o ON DELETE CASCADE os levaria junto
+func (s *SQLStore) Rename(from, to string, version int64, recipe Recipe) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		var current int64
+		err := tx.QueryRow(`SELECT version FROM recipes WHERE id = ? AND deleted_at = 0`, from).Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return NotFoundErr
+		}
+		if err != nil {
+			return err
+		}
+		if current != version {
+			return VersionMismatchErr
+		}
+
+		var taken bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM recipes WHERE id = ?)
+			OR EXISTS (SELECT 1 FROM recipe_aliases WHERE alias = ? AND recipe_id <> ?)`, to, to, from).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ExistsErr
+		}
+
+		args := append([]interface{}{to}, recipeArgs(recipe)...)
+		if _, err := tx.Exec(`INSERT INTO recipes (id, `+recipeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...); err != nil {
+			return err
+		}
+		for _, stmt := range []string{
+			`UPDATE recipe_revisions SET recipe_id = ? WHERE recipe_id = ?`,
+			`UPDATE recipe_aliases SET recipe_id = ? WHERE recipe_id = ?`,
+		} {
+			if _, err := tx.Exec(stmt, to, from); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM recipe_aliases WHERE alias = ?`, to); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO recipe_aliases (alias, recipe_id) VALUES (?, ?)`, from, to); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM recipes WHERE id = ?`, from); err != nil {
+			return err
+		}
+		if err := replaceChildren(tx, to, recipe); err != nil {
+			return err
+		}
+		return addRevision(tx, to, recipe)
+	})
+}
+
+// Alias - veja MemStore.Alias
+func (s *SQLStore) Alias(name string) (string, error) {
+	var to string
+	err := s.db.QueryRow(`SELECT recipe_id FROM recipe_aliases WHERE alias = ?`, name).Scan(&to)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", NotFoundErr
+	}
+	return to, err
+}
+
+// AddPlan - veja MemStore.AddPlan
+func (s *SQLStore) AddPlan(id string, plan Plan) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`INSERT INTO plans (id, name, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO NOTHING`, id, plan.Name, UnixNano(plan.CreatedAt), UnixNano(plan.UpdatedAt), plan.Version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ExistsErr
+		}
+		return replacePlanSlots(tx, id, plan.Slots)
+	})
+}
+
+func (s *SQLStore) GetPlan(id string) (Plan, error) {
+	plans, err := s.queryPlans(`WHERE id = ?`, id)
+	if err != nil {
+		return Plan{}, err
+	}
+	if len(plans) == 0 {
+		return Plan{}, NotFoundErr
+	}
+	return plans[0], nil
+}
+
+func (s *SQLStore) Plans() ([]Plan, error) {
+	return s.queryPlans(``)
+}
+
+// CompareAndSwapPlan - veja MemStore.CompareAndSwapPlan
+func (s *SQLStore) CompareAndSwapPlan(id string, version int64, plan Plan) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE plans SET name = ?, created_at = ?, updated_at = ?, version = ? WHERE id = ? AND version = ?`,
+			plan.Name, UnixNano(plan.CreatedAt), UnixNano(plan.UpdatedAt), plan.Version, id, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return planMissingOrMismatch(tx, id)
+		}
+		return replacePlanSlots(tx, id, plan.Slots)
+	})
+}
+
+// CompareAndDeletePlan - veja MemStore.CompareAndDeletePlan. Os slots vão
+// junto pelo ON DELETE CASCADE
+func (s *SQLStore) CompareAndDeletePlan(id string, version int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM plans WHERE id = ? AND version = ?`, id, version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return planMissingOrMismatch(tx, id)
+		}
+		return nil
+	})
+}
+
+// queryPlans - os planos que passam no WHERE, com os slots, pela ordem dos
+// IDs
+func (s *SQLStore) queryPlans(where string, args ...interface{}) ([]Plan, error) {
+	rows, err := s.db.Query(`SELECT id, name, created_at, updated_at, version FROM plans `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	plans := []Plan{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var plan Plan
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&plan.ID, &plan.Name, &createdAt, &updatedAt, &plan.Version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		plan.CreatedAt, plan.UpdatedAt = FromUnixNano(createdAt), FromUnixNano(updatedAt)
+		plan.Slots = []PlanSlot{}
+		index[plan.ID] = len(plans)
+		plans = append(plans, plan)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return plans, nil
+	}
+
+	ids := make([]string, len(plans))
+	for i, plan := range plans {
+		ids[i] = plan.ID
+	}
+	rows, err = s.db.Query(`SELECT plan_id, date, meal, recipe_id, servings FROM plan_slots
+		WHERE plan_id IN (`+placeholders(len(ids))+`) ORDER BY plan_id, position`, stringArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var planID string
+		var slot PlanSlot
+		if err := rows.Scan(&planID, &slot.Date, &slot.Meal, &slot.RecipeID, &slot.Servings); err != nil {
+			return nil, err
+		}
+		i := index[planID]
+		plans[i].Slots = append(plans[i].Slots, slot)
+	}
+	return plans, rows.Err()
+}
+
+// replacePlanSlots - troca os slots do plano pelos de slots, na mesma ordem
+func replacePlanSlots(tx *sql.Tx, id string, slots []PlanSlot) error {
+	if _, err := tx.Exec(`DELETE FROM plan_slots WHERE plan_id = ?`, id); err != nil {
+		return err
+	}
+	for i, slot := range slots {
+		if _, err := tx.Exec(`INSERT INTO plan_slots (plan_id, position, date, meal, recipe_id, servings) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, i, slot.Date, string(slot.Meal), slot.RecipeID, slot.Servings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planMissingOrMismatch - como missingOrMismatch, para os planos
+func planMissingOrMismatch(tx *sql.Tx, id string) error {
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM plans WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return NotFoundErr
+	}
+	return VersionMismatchErr
+}
+
+// isAlias - o nome é o apelido de uma receita renomeada
+func isAlias(tx *sql.Tx, name string) (bool, error) {
+	var aliased bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM recipe_aliases WHERE alias = ?)`, name).Scan(&aliased)
+	return aliased, err
+}
+
+// missingOrMismatch - o erro de uma escrita condicional que não afetou
+// nenhuma linha
+func missingOrMismatch(tx *sql.Tx, name string) error {
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM recipes WHERE id = ? AND deleted_at = 0)`, name).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return NotFoundErr
+	}
+	return VersionMismatchErr
+}
+
+func (s *SQLStore) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// recipeColumns - colunas de recipes além do id, na ordem de recipeArgs.
+// Durações são gravadas em nanossegundos, como no time.Duration, e datas em
+// nanossegundos desde 1970 (UnixNano)
+const recipeColumns = `name, servings, total_time, active_time, yield, difficulty, name_key, created_at, updated_at, updated_by, version`
+
+func recipeArgs(recipe Recipe) []interface{} {
+	return []interface{}{
+		recipe.Name, recipe.Servings, int64(recipe.TotalTime), int64(recipe.ActiveTime), recipe.Yield, string(recipe.Difficulty),
+		NameKey(recipe.Name), UnixNano(recipe.CreatedAt), UnixNano(recipe.UpdatedAt), recipe.UpdatedBy, recipe.Version,
+	}
+}
+
+// ListPage - uma página da listagem, com os filtros, a ordenação e o
+// cursor resolvidos pelo banco; só as receitas da página são carregadas
+func (s *SQLStore) ListPage(opts ListOptions) (Page, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortByName
+	}
+	column := map[SortField]string{
+		SortByName:    "name_key",
+		SortByCreated: "created_at",
+		SortByUpdated: "updated_at",
+	}[opts.Sort]
+
+	where, args := listFilters(opts)
+
+	// A página anterior é buscada de trás para frente a partir do cursor
+	desc := opts.Desc
+	if c := opts.Cursor; c != nil {
+		var key interface{} = c.Key
+		if opts.Sort != SortByName {
+			n, err := strconv.ParseInt(c.Key, 10, 64)
+			if err != nil {
+				return Page{}, InvalidCursorErr
+			}
+			key = n
+		}
+		op := ">"
+		if c.Before != desc {
+			op = "<"
+		}
+		where = append(where, `(`+column+`, id) `+op+` (?, ?)`)
+		args = append(args, key, c.ID)
+		if c.Before {
+			desc = !desc
+		}
+	}
+	order := "ASC"
+	if desc {
+		order = "DESC"
+	}
+
+	query := `SELECT id FROM recipes WHERE ` + strings.Join(where, ` AND `)
+	query += ` ORDER BY ` + column + ` ` + order + `, id ` + order + ` LIMIT ?`
+	args = append(args, opts.limit()+1)
+
+	// Os IDs e as receitas são lidos na mesma transação, para que uma
+	// receita removida entre as duas consultas não volte vazia
+	var ids []string
+	var more bool
+	var list map[string]Recipe
+	err := s.inTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		more = len(ids) > opts.limit()
+		if more {
+			ids = ids[:opts.limit()]
+		}
+		list, err = queryRecipes(tx, `WHERE id IN (`+placeholders(len(ids))+`)`, stringArgs(ids)...)
+		return err
+	})
+	if err != nil {
+		return Page{}, err
+	}
+
+	recipes := make([]Recipe, 0, len(ids))
+	for _, id := range ids {
+		recipe := list[id]
+		recipe.ID = id
+		recipes = append(recipes, recipe)
+	}
+	return NewPage(recipes, more, opts), nil
+}
+
+// listFilters - as condições do WHERE para os filtros de ingredientes,
+// tags e alérgenos da listagem, sempre só com as receitas fora da lixeira
+func listFilters(opts ListOptions) ([]string, []interface{}) {
+	where := []string{`recipes.deleted_at = 0`}
+	var args []interface{}
+	for _, filter := range opts.Ingredients {
+		cond, condArgs := ingredientFilter(filter)
+		where = append(where, `EXISTS (`+cond+`)`)
+		args = append(args, condArgs...)
+	}
+	for _, filter := range opts.ExcludeIngredients {
+		cond, condArgs := ingredientFilter(filter)
+		where = append(where, `NOT EXISTS (`+cond+`)`)
+		args = append(args, condArgs...)
+	}
+	for _, tag := range opts.Tags {
+		where = append(where, `EXISTS (SELECT 1 FROM recipe_tags t WHERE t.recipe_id = recipes.id AND t.tag_key = ?)`)
+		args = append(args, TagKey(tag))
+	}
+	if len(opts.ExcludeAllergens) > 0 {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM recipe_allergens a WHERE a.recipe_id = recipes.id AND a.allergen IN (`+placeholders(len(opts.ExcludeAllergens))+`))`)
+		args = append(args, stringArgs(opts.ExcludeAllergens)...)
+	}
+	return where, args
+}
+
+// Facets - veja MemStore.Facets. As contagens são agrupadas pelo banco,
+// sem carregar as receitas
+func (s *SQLStore) Facets(opts ListOptions) (Facets, error) {
+	where, args := listFilters(opts)
+	cond := strings.Join(where, ` AND `)
+	counter := newFacetCounter()
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM recipes WHERE `+cond, args...).Scan(&counter.total); err != nil {
+		return Facets{}, err
+	}
+	for _, facet := range []struct {
+		query string
+		add   func(key, name string, n int)
+	}{
+		{
+			query: `SELECT ft.tag_key, MIN(ft.tag), COUNT(DISTINCT ft.recipe_id)
+				FROM recipe_tags ft JOIN recipes ON recipes.id = ft.recipe_id
+				WHERE ` + cond + ` GROUP BY ft.tag_key`,
+			add: counter.addTag,
+		},
+		{
+			query: `SELECT fi.key, MIN(fi.name), COUNT(DISTINCT fri.recipe_id)
+				FROM recipe_ingredients fri JOIN ingredients fi ON fi.id = fri.ingredient_id
+				JOIN recipes ON recipes.id = fri.recipe_id
+				WHERE ` + cond + ` GROUP BY fi.key`,
+			add: func(key, name string, n int) {
+				counter.addIngredient(strings.Trim(key, "-"), name, n)
+			},
+		},
+	} {
+		if err := s.scanFacet(facet.query, args, facet.add); err != nil {
+			return Facets{}, err
+		}
+	}
+	return counter.facets(), nil
+}
+
+// scanFacet - lê as linhas (valor, nome, contagem) de uma faceta
+func (s *SQLStore) scanFacet(query string, args []interface{}, add func(key, name string, n int)) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, name string
+		var n int
+		if err := rows.Scan(&key, &name, &n); err != nil {
+			return err
+		}
+		add(key, name, n)
+	}
+	return rows.Err()
+}
+
+// ingredientFilter - subconsulta que encontra, na receita, um ingrediente
+// com todas as palavras do filtro, como o matcher. ingredients.key guarda o
+// slug entre hífens ("-queijo-minas-"), então cada palavra vira um LIKE
+func ingredientFilter(filter string) (string, []interface{}) {
+	cond := `SELECT 1 FROM recipe_ingredients ri JOIN ingredients i ON i.id = ri.ingredient_id
+		WHERE ri.recipe_id = recipes.id`
+	var args []interface{}
+	for _, word := range matchTokens(filter) {
+		cond += ` AND i.key LIKE ?`
+		args = append(args, "%-"+word+"-%")
+	}
+	return cond, args
+}
+
+// ingredientKey - o valor de ingredients.key
+func ingredientKey(name string) string {
+	return "-" + slug.Make(name) + "-"
+}
+
+func placeholders(n int) string {
+	if n == 0 {
+		return `NULL`
+	}
+	return strings.Repeat(`?, `, n-1) + `?`
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// query - carrega as receitas que passam pelo filtro where (sobre a tabela
+// recipes), com ingredientes e passos. Cada tabela é lida com uma consulta
+// só, qualquer que seja o número de receitas
+func (s *SQLStore) query(where string, args ...interface{}) (map[string]Recipe, error) {
+	return queryRecipes(s.db, where, args...)
+}
+
+// queryer - a parte de *sql.DB e *sql.Tx usada por queryRecipes
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryRecipes - o query, no banco ou dentro de uma transação
+func queryRecipes(db queryer, where string, args ...interface{}) (map[string]Recipe, error) {
+	list := make(map[string]Recipe)
+
+	rows, err := db.Query(`SELECT id, `+recipeColumns+` FROM recipes `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, difficulty, nameKey string
+		var totalTime, activeTime, createdAt, updatedAt int64
+		var recipe Recipe
+		err := rows.Scan(&id, &recipe.Name, &recipe.Servings, &totalTime, &activeTime, &recipe.Yield, &difficulty,
+			&nameKey, &createdAt, &updatedAt, &recipe.UpdatedBy, &recipe.Version)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recipe.TotalTime, recipe.ActiveTime = Duration(totalTime), Duration(activeTime)
+		recipe.Difficulty = Difficulty(difficulty)
+		recipe.CreatedAt, recipe.UpdatedAt = FromUnixNano(createdAt), FromUnixNano(updatedAt)
+		list[id] = recipe
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	filter := `WHERE recipe_id IN (SELECT id FROM recipes ` + where + `)`
+
+	rows, err = db.Query(`SELECT ri.recipe_id, i.name, ri.quantity, ri.unit, ri.note, ri.optional
+		FROM recipe_ingredients ri
+		JOIN ingredients i ON i.id = ri.ingredient_id
+		`+filter+`
+		ORDER BY ri.recipe_id, ri.position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var ingredient Ingredient
+		if err := rows.Scan(&id, &ingredient.Name, &ingredient.Quantity, &ingredient.Unit, &ingredient.Note, &ingredient.Optional); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recipe := list[id]
+		recipe.Ingredients = append(recipe.Ingredients, ingredient)
+		list[id] = recipe
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT recipe_id, text, timer, ingredients
+		FROM recipe_steps
+		`+filter+`
+		ORDER BY recipe_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, refs string
+		var timer int64
+		var step Step
+		if err := rows.Scan(&id, &step.Text, &timer, &refs); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		step.Timer = Duration(timer)
+		if refs != "" {
+			if err := json.Unmarshal([]byte(refs), &step.Ingredients); err != nil {
+				return nil, err
+			}
+		}
+		recipe := list[id]
+		recipe.Steps = append(recipe.Steps, step)
+		list[id] = recipe
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT recipe_id, tag
+		FROM recipe_tags
+		`+filter+`
+		ORDER BY recipe_id, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recipe := list[id]
+		recipe.Tags = append(recipe.Tags, tag)
+		list[id] = recipe
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT recipe_id, allergen
+		FROM recipe_allergens
+		`+filter+`
+		ORDER BY recipe_id, allergen`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, allergen string
+		if err := rows.Scan(&id, &allergen); err != nil {
+			return nil, err
+		}
+		recipe := list[id]
+		recipe.Allergens = append(recipe.Allergens, allergen)
+		list[id] = recipe
+	}
+	return list, rows.Err()
+}
+
+// Revisions - o histórico da receita, da revisão mais antiga para a mais
+// nova. As receitas de cada revisão ficam em JSON e não são lidas aqui
+func (s *SQLStore) Revisions(name string) ([]Revision, error) {
+	rows, err := s.db.Query(`SELECT number, author, created_at FROM recipe_revisions
+		WHERE recipe_id = (SELECT id FROM recipes WHERE id = ? AND deleted_at = 0)
+		ORDER BY number`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []Revision{}
+	for rows.Next() {
+		var revision Revision
+		var createdAt int64
+		if err := rows.Scan(&revision.Number, &revision.Author, &createdAt); err != nil {
+			return nil, err
+		}
+		revision.CreatedAt = FromUnixNano(createdAt)
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, NotFoundErr
+	}
+	return revisions, nil
+}
+
+// Revision - uma revisão do histórico, com a receita completa
+func (s *SQLStore) Revision(name string, number int64) (Revision, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT recipe FROM recipe_revisions
+		WHERE recipe_id = (SELECT id FROM recipes WHERE id = ? AND deleted_at = 0) AND number = ?`, name, number).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, NotFoundErr
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+	var recipe Recipe
+	if err := json.Unmarshal([]byte(data), &recipe); err != nil {
+		return Revision{}, err
+	}
+	return NewRevision(recipe), nil
+}
+
+// addRevision - acrescenta a receita ao histórico; veja nextRevision
+func addRevision(tx *sql.Tx, recipeID string, recipe Recipe) error {
+	var last int64
+	err := tx.QueryRow(`SELECT COALESCE(MAX(number), 0) FROM recipe_revisions WHERE recipe_id = ?`, recipeID).Scan(&last)
+	if err != nil {
+		return err
+	}
+	revision, ok := nextRevision([]Recipe{{Version: last}}, recipe)
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO recipe_revisions (recipe_id, number, author, created_at, recipe) VALUES (?, ?, ?, ?, ?)`,
+		recipeID, revision.Version, revision.UpdatedBy, UnixNano(revision.UpdatedAt), string(data))
+	return err
+}
+
+// backfillRevisions - dá às receitas sem histórico (gravadas antes da
+// migração 0007) uma primeira revisão, com o estado atual
+func (s *SQLStore) backfillRevisions() error {
+	list, err := s.query(`WHERE NOT EXISTS (SELECT 1 FROM recipe_revisions WHERE recipe_id = recipes.id)`)
+	if err != nil {
+		return err
+	}
+	for name, recipe := range list {
+		if err := s.inTx(func(tx *sql.Tx) error { return addRevision(tx, name, recipe) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceChildren - troca os ingredientes, os passos, as tags e os
+// alérgenos da receita
+func replaceChildren(tx *sql.Tx, recipeID string, recipe Recipe) error {
+	if err := replaceIngredients(tx, recipeID, recipe.Ingredients); err != nil {
+		return err
+	}
+	if err := replaceSteps(tx, recipeID, recipe.Steps); err != nil {
+		return err
+	}
+	if err := replaceTags(tx, recipeID, recipe.Tags); err != nil {
+		return err
+	}
+	return replaceAllergens(tx, recipeID, recipe.Allergens)
+}
+
+// replaceIngredients - troca a lista de ingredientes da receita, criando no
+// catálogo os ingredientes que ainda não existem
+func replaceIngredients(tx *sql.Tx, recipeID string, ingredients []Ingredient) error {
+	if _, err := tx.Exec(`DELETE FROM recipe_ingredients WHERE recipe_id = ?`, recipeID); err != nil {
+		return err
+	}
+	for position, ingredient := range ingredients {
+		_, err := tx.Exec(`INSERT INTO ingredients (name, key) VALUES (?, ?) ON CONFLICT (name) DO NOTHING`,
+			ingredient.Name, ingredientKey(ingredient.Name))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO recipe_ingredients (recipe_id, ingredient_id, position, quantity, unit, note, optional)
+			SELECT ?, id, ?, ?, ?, ?, ? FROM ingredients WHERE name = ?`,
+			recipeID, position, ingredient.Quantity, ingredient.Unit, ingredient.Note, ingredient.Optional, ingredient.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceSteps - troca o modo de preparo. Os ingredientes citados em cada
+// passo ficam em uma coluna JSON, porque só são lidos junto com o passo
+func replaceSteps(tx *sql.Tx, recipeID string, steps []Step) error {
+	if _, err := tx.Exec(`DELETE FROM recipe_steps WHERE recipe_id = ?`, recipeID); err != nil {
+		return err
+	}
+	for position, step := range steps {
+		var refs []byte
+		if step.Ingredients != nil {
+			var err error
+			if refs, err = json.Marshal(step.Ingredients); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO recipe_steps (recipe_id, position, text, timer, ingredients) VALUES (?, ?, ?, ?, ?)`,
+			recipeID, position, step.Text, int64(step.Timer), string(refs))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceTags - troca as tags da receita
+func replaceTags(tx *sql.Tx, recipeID string, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM recipe_tags WHERE recipe_id = ?`, recipeID); err != nil {
+		return err
+	}
+	for position, tag := range tags {
+		_, err := tx.Exec(`INSERT INTO recipe_tags (recipe_id, position, tag, tag_key) VALUES (?, ?, ?, ?)`,
+			recipeID, position, tag, TagKey(tag))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceAllergens - troca os alérgenos da receita
+func replaceAllergens(tx *sql.Tx, recipeID string, allergens []string) error {
+	if _, err := tx.Exec(`DELETE FROM recipe_allergens WHERE recipe_id = ?`, recipeID); err != nil {
+		return err
+	}
+	for _, allergen := range allergens {
+		_, err := tx.Exec(`INSERT INTO recipe_allergens (recipe_id, allergen) VALUES (?, ?) ON CONFLICT DO NOTHING`, recipeID, allergen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillKeys - calcula as chaves de ordenação e de busca que as migrações
+// deixaram vazias nas linhas antigas, porque elas dependem de slug.Make
+func backfillKeys(db *sql.DB) error {
+	for _, table := range []struct {
+		name, key string
+		fn        func(string) string
+	}{
+		{name: "recipes", key: "name_key", fn: NameKey},
+		{name: "ingredients", key: "key", fn: ingredientKey},
+	} {
+		rows, err := db.Query(`SELECT id, name FROM ` + table.name + ` WHERE ` + table.key + ` = ''`)
+		if err != nil {
+			return err
+		}
+		keys := make(map[string]string)
+		for rows.Next() {
+			var id, name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			keys[id] = table.fn(name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, key := range keys {
+			if _, err := db.Exec(`UPDATE `+table.name+` SET `+table.key+` = ? WHERE id = ?`, key, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrate - aplica, em ordem e cada uma em sua própria transação, as
+// migrações cuja versão ainda não está em schema_migrations
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version, err := migrationVersion(name)
+		if err != nil {
+			return err
+		}
+		if applied[version] {
+			continue
+		}
+
+		script, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrationVersion(name string) (int, error) {
+	base := strings.TrimPrefix(name, "migrations/")
+	prefix, _, ok := strings.Cut(base, "_")
+	if !ok {
+		return 0, fmt.Errorf("migration %s: missing version prefix", name)
+	}
+	return strconv.Atoi(prefix)
+}
@@ -0,0 +1,98 @@
+package recipes
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLStore_PersistsAndMigratesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipes.db")
+
+	store, err := NewSQLStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Add("ham-and-cheese-toastie", getHamCheeseToasties()))
+	require.NoError(t, store.Close())
+
+	// Reabrir não pode reaplicar as migrações
+	store, err = NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	var versions int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&versions))
+	names, err := migrationNames()
+	require.NoError(t, err)
+	assert.Equal(t, len(names), versions)
+
+	got, err := store.Get("ham-and-cheese-toastie")
+	require.NoError(t, err)
+	assert.Equal(t, getHamCheeseToasties(), got)
+}
+
+func TestSQLStore_IngredientsAreNormalized(t *testing.T) {
+	store, err := NewSQLStore(":memory:")
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Add("toastie", getHamCheeseToasties()))
+	require.NoError(t, store.Add("cheese-on-bread", Recipe{
+		Name:        "cheese on bread",
+		Ingredients: []Ingredient{{Name: "cheese"}, {Name: "bread"}},
+	}))
+
+	var ingredients int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM ingredients`).Scan(&ingredients))
+	assert.Equal(t, 3, ingredients)
+
+	// Removendo a receita as linhas da junção vão junto
+	require.NoError(t, store.Remove("toastie"))
+	var links int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM recipe_ingredients`).Scan(&links))
+	assert.Equal(t, 2, links)
+
+	got, err := store.Get("cheese-on-bread")
+	require.NoError(t, err)
+	assert.Equal(t, []Ingredient{{Name: "cheese"}, {Name: "bread"}}, got.Ingredients)
+}
+
+func TestSQLStore_BackfillsListingKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipes.db")
+	store, err := NewSQLStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Add("toastie", getHamCheeseToasties()))
+
+	// Como ficam as linhas gravadas antes da migração da listagem
+	_, err = store.db.Exec(`UPDATE recipes SET name_key = ''`)
+	require.NoError(t, err)
+	_, err = store.db.Exec(`UPDATE ingredients SET key = ''`)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	page, err := store.ListPage(ListOptions{Ingredients: []string{"cheese"}})
+	require.NoError(t, err)
+	require.Len(t, page.Recipes, 1)
+	assert.Equal(t, "toastie", page.Recipes[0].ID)
+
+	var nameKey string
+	require.NoError(t, store.db.QueryRow(`SELECT name_key FROM recipes WHERE id = 'toastie'`).Scan(&nameKey))
+	assert.Equal(t, "ham-and-cheese-toastie", nameKey)
+}
+
+func migrationNames() ([]string, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
@@ -0,0 +1,148 @@
+package recipes
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Rename(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreRename(t, factory)
+	})
+}
+
+func testStoreRename(t *testing.T, factory storeFactory) {
+	v1 := Recipe{Name: "toastie", Ingredients: []Ingredient{{Name: "bread"}}, Version: 1}
+	v2 := v1
+	v2.Name, v2.Version = "Ham toastie", 2
+
+	t.Run("Rename moves the recipe and its history", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": v1, "soup": {Name: "soup", Version: 1}})
+
+		assert.ErrorIs(t, store.Rename("toastie", "ham-toastie", 2, v2), VersionMismatchErr)
+		assert.ErrorIs(t, store.Rename("ratatouille", "ham-toastie", 1, v2), NotFoundErr)
+		assert.ErrorIs(t, store.Rename("toastie", "soup", 1, v2), ExistsErr)
+		require.NoError(t, store.Rename("toastie", "ham-toastie", 1, v2))
+
+		_, err := store.Get("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+		got, err := store.Get("ham-toastie")
+		require.NoError(t, err)
+		assert.Equal(t, v2, got)
+		list, err := store.List()
+		require.NoError(t, err)
+		assert.Len(t, list, 2)
+
+		revisions, err := store.Revisions("ham-toastie")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		revision, err := store.Revision("ham-toastie", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "toastie", revision.Recipe.Name)
+
+		to, err := store.Alias("toastie")
+		require.NoError(t, err)
+		assert.Equal(t, "ham-toastie", to)
+		_, err = store.Alias("ham-toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+
+		// O nome antigo continua reservado
+		assert.ErrorIs(t, store.Add("toastie", v1), ExistsErr)
+		assert.ErrorIs(t, store.Rename("soup", "toastie", 1, Recipe{Name: "toastie", Version: 2}), ExistsErr)
+	})
+
+	t.Run("Aliases follow the latest name", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"a": {Name: "a", Version: 1}})
+		require.NoError(t, store.Rename("a", "b", 1, Recipe{Name: "b", Version: 2}))
+		require.NoError(t, store.Rename("b", "c", 2, Recipe{Name: "c", Version: 3}))
+
+		for _, alias := range []string{"a", "b"} {
+			to, err := store.Alias(alias)
+			require.NoError(t, err)
+			assert.Equal(t, "c", to, alias)
+		}
+
+		// Voltar para um nome antigo da própria receita é permitido
+		require.NoError(t, store.Rename("c", "a", 3, Recipe{Name: "a", Version: 4}))
+		_, err := store.Alias("a")
+		assert.ErrorIs(t, err, NotFoundErr)
+		for _, alias := range []string{"b", "c"} {
+			to, err := store.Alias(alias)
+			require.NoError(t, err)
+			assert.Equal(t, "a", to, alias)
+		}
+		revisions, err := store.Revisions("a")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 4)
+	})
+
+	t.Run("Removing drops the aliases", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": v1})
+		require.NoError(t, store.Rename("toastie", "ham-toastie", 1, v2))
+		require.NoError(t, store.Remove("ham-toastie"))
+
+		_, err := store.Alias("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+		require.NoError(t, store.Add("toastie", v1))
+	})
+}
+
+func TestFileStore_RenameSurvivesRestarts(t *testing.T) {
+	for _, compactEvery := range []int{0, 1} {
+		dir := t.TempDir()
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		store.CompactEvery = compactEvery
+
+		require.NoError(t, store.Add("a", Recipe{Name: "a", Version: 1}))
+		require.NoError(t, store.Rename("a", "b", 1, Recipe{Name: "b", Version: 2}))
+		require.NoError(t, store.CompareAndSwap("b", 2, Recipe{Name: "b", Servings: 2, Version: 3}))
+		require.NoError(t, store.Close())
+
+		store, err = NewFileStore(dir)
+		require.NoError(t, err)
+
+		list, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]Recipe{"b": {Name: "b", Servings: 2, Version: 3}}, list, "compact every %d", compactEvery)
+		to, err := store.Alias("a")
+		require.NoError(t, err)
+		assert.Equal(t, "b", to)
+		revisions, err := store.Revisions("b")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 3)
+		require.NoError(t, store.Close())
+	}
+}
+
+func TestFileStore_ReplaysRenameOverNewerSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	store.CompactEvery = 0
+
+	require.NoError(t, store.Add("a", Recipe{Name: "a", Version: 1}))
+	require.NoError(t, store.Rename("a", "b", 1, Recipe{Name: "b", Version: 2}))
+
+	// Como fica o disco se o processo cair entre o snapshot e o truncamento
+	// do log: o log inteiro é reaplicado sobre o estado que já o inclui
+	wal, err := os.ReadFile(store.path(walFileName))
+	require.NoError(t, err)
+	require.NoError(t, store.Compact())
+	require.NoError(t, store.Close())
+	require.NoError(t, os.WriteFile(store.path(walFileName), wal, 0o644))
+
+	store, err = NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Recipe{"b": {Name: "b", Version: 2}}, list)
+	revisions, err := store.Revisions("b")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 2)
+}
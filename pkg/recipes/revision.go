@@ -0,0 +1,145 @@
+package recipes
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/gosimple/slug"
+)
+
+// Revision - uma versão gravada da receita. As revisões nunca mudam: cada
+// escrita acrescenta uma nova ao histórico da receita
+type Revision struct {
+	// Number - a versão da receita nesta revisão
+	Number int64 `json:"number"`
+	// Author - o UpdatedBy da receita nesta revisão
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// Recipe - a receita completa; omitida na listagem do histórico
+	Recipe *Recipe `json:"recipe,omitempty"`
+}
+
+// NewRevision - a revisão correspondente a uma receita do histórico
+func NewRevision(recipe Recipe) Revision {
+	recipe = recipe.clone()
+	return Revision{
+		Number:    recipe.Version,
+		Author:    recipe.UpdatedBy,
+		CreatedAt: recipe.UpdatedAt,
+		Recipe:    &recipe,
+	}
+}
+
+// nextRevision - como a receita entra no histórico. Receitas gravadas pelo
+// serviço já têm versão e ela é o número da revisão; uma versão que o
+// histórico já tem não entra de novo, o que deixa a reconstrução da
+// FileStore idempotente. Receitas sem versão (0) viram a revisão seguinte
+func nextRevision(history []Recipe, recipe Recipe) (Recipe, bool) {
+	var last int64
+	if len(history) > 0 {
+		last = history[len(history)-1].Version
+	}
+	if recipe.Version == 0 {
+		recipe.Version = last + 1
+	} else if recipe.Version <= last {
+		return Recipe{}, false
+	}
+	recipe.ID = ""
+	return recipe.clone(), true
+}
+
+// Diff - o que mudou de uma revisão para outra
+type Diff struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// Fields - os campos da receita, fora os ingredientes, que mudaram
+	Fields      []FieldChange  `json:"fields"`
+	Ingredients IngredientDiff `json:"ingredients"`
+}
+
+// FieldChange - um campo com o valor antes e depois
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// IngredientDiff - ingredientes são comparados pelo nome normalizado, como
+// na validação de duplicados ("Queijo" e "queijo" são o mesmo ingrediente)
+type IngredientDiff struct {
+	Added   []Ingredient       `json:"added"`
+	Removed []Ingredient       `json:"removed"`
+	Changed []IngredientChange `json:"changed"`
+}
+
+// IngredientChange - um ingrediente presente nas duas revisões, com
+// quantidade, unidade, observação ou opcionalidade diferentes
+type IngredientChange struct {
+	Name string     `json:"name"`
+	From Ingredient `json:"from"`
+	To   Ingredient `json:"to"`
+}
+
+// DiffRecipes - a diferença estrutural entre duas receitas. From e To são
+// as versões delas
+func DiffRecipes(from, to Recipe) Diff {
+	diff := Diff{
+		From:   from.Version,
+		To:     to.Version,
+		Fields: []FieldChange{},
+		Ingredients: IngredientDiff{
+			Added:   []Ingredient{},
+			Removed: []Ingredient{},
+			Changed: []IngredientChange{},
+		},
+	}
+
+	for _, field := range []struct {
+		name     string
+		from, to interface{}
+		empty    bool
+	}{
+		{name: "name", from: from.Name, to: to.Name},
+		{name: "servings", from: from.Servings, to: to.Servings},
+		{name: "steps", from: from.Steps, to: to.Steps, empty: len(from.Steps) == 0 && len(to.Steps) == 0},
+		{name: "total_time", from: from.TotalTime, to: to.TotalTime},
+		{name: "active_time", from: from.ActiveTime, to: to.ActiveTime},
+		{name: "yield", from: from.Yield, to: to.Yield},
+		{name: "difficulty", from: from.Difficulty, to: to.Difficulty},
+		{name: "tags", from: from.Tags, to: to.Tags, empty: len(from.Tags) == 0 && len(to.Tags) == 0},
+	} {
+		if field.empty || reflect.DeepEqual(field.from, field.to) {
+			continue
+		}
+		diff.Fields = append(diff.Fields, FieldChange{Field: field.name, From: field.from, To: field.to})
+	}
+
+	// Um nome repetido (receitas anteriores à validação de duplicados) só
+	// é pareado na primeira ocorrência; as outras contam como removidas ou
+	// adicionadas
+	first := make(map[string]int, len(from.Ingredients))
+	for i, ingredient := range from.Ingredients {
+		key := slug.Make(ingredient.Name)
+		if _, ok := first[key]; !ok {
+			first[key] = i
+		}
+	}
+	matched := make(map[int]bool, len(to.Ingredients))
+	for _, ingredient := range to.Ingredients {
+		i, ok := first[slug.Make(ingredient.Name)]
+		if !ok || matched[i] {
+			diff.Ingredients.Added = append(diff.Ingredients.Added, ingredient)
+			continue
+		}
+		matched[i] = true
+		if old := from.Ingredients[i]; old != ingredient {
+			diff.Ingredients.Changed = append(diff.Ingredients.Changed, IngredientChange{Name: ingredient.Name, From: old, To: ingredient})
+		}
+	}
+	for i, ingredient := range from.Ingredients {
+		if !matched[i] {
+			diff.Ingredients.Removed = append(diff.Ingredients.Removed, ingredient)
+		}
+	}
+	return diff
+}
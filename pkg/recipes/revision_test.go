@@ -0,0 +1,239 @@
+package recipes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Revisions(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreRevisions(t, factory)
+	})
+}
+
+func testStoreRevisions(t *testing.T, factory storeFactory) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	v1 := getHamCheeseToasties()
+	v1.Version, v1.UpdatedBy, v1.CreatedAt, v1.UpdatedAt = 1, "ana", created, created
+	v2 := v1
+	v2.Ingredients = []Ingredient{{Name: "bread"}, {Name: "cheese"}}
+	v2.Version, v2.UpdatedBy, v2.UpdatedAt = 2, "bia", created.Add(time.Hour)
+
+	t.Run("Every write is a revision", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": v1})
+		require.NoError(t, store.CompareAndSwap("toastie", 1, v2))
+
+		revisions, err := store.Revisions("toastie")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, Revision{Number: 1, Author: "ana", CreatedAt: created}, withoutRecipe(revisions[0]))
+		assert.Equal(t, Revision{Number: 2, Author: "bia", CreatedAt: created.Add(time.Hour)}, withoutRecipe(revisions[1]))
+
+		revision, err := store.Revision("toastie", 1)
+		require.NoError(t, err)
+		require.NotNil(t, revision.Recipe)
+		assert.Equal(t, v1, *revision.Recipe)
+
+		_, err = store.Revision("toastie", 3)
+		assert.ErrorIs(t, err, NotFoundErr)
+		_, err = store.Revisions("ratatouille")
+		assert.ErrorIs(t, err, NotFoundErr)
+		_, err = store.Revision("ratatouille", 1)
+		assert.ErrorIs(t, err, NotFoundErr)
+	})
+
+	t.Run("Removing drops the history", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": v1})
+		require.NoError(t, store.CompareAndSwap("toastie", 1, v2))
+		require.NoError(t, store.Remove("toastie"))
+
+		_, err := store.Revisions("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+
+		require.NoError(t, store.Add("toastie", v1))
+		revisions, err := store.Revisions("toastie")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+	})
+
+	t.Run("Recipes without version", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": getHamCheeseToasties()})
+		require.NoError(t, store.Update("toastie", Recipe{Name: "toastie"}))
+
+		revisions, err := store.Revisions("toastie")
+		require.NoError(t, err)
+		require.Len(t, revisions, 2)
+		assert.Equal(t, []int64{1, 2}, []int64{revisions[0].Number, revisions[1].Number})
+
+		revision, err := store.Revision("toastie", 2)
+		require.NoError(t, err)
+		assert.Equal(t, "toastie", revision.Recipe.Name)
+	})
+}
+
+func withoutRecipe(revision Revision) Revision {
+	revision.Recipe = nil
+	return revision
+}
+
+func TestFileStore_RevisionsSurviveCompaction(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	store.CompactEvery = 2
+
+	recipe := Recipe{Name: "a", Version: 1}
+	require.NoError(t, store.Add("a", recipe))
+	for version := int64(2); version <= 3; version++ {
+		recipe.Servings, recipe.Version = int(version), version
+		require.NoError(t, store.CompareAndSwap("a", version-1, recipe))
+	}
+	require.NoError(t, store.Close())
+
+	store, err = NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	revisions, err := store.Revisions("a")
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	revision, err := store.Revision("a", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, revision.Recipe.Servings)
+}
+
+func TestFileStore_LoadsSnapshotWithoutRevisions(t *testing.T) {
+	dir := t.TempDir()
+
+	// O formato anterior ao histórico: só o mapa de receitas
+	data := []byte(`{"toastie": {"name": "toastie", "version": 4}}`)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, snapshotFileName), data, 0o644))
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	revisions, err := store.Revisions("toastie")
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, int64(4), revisions[0].Number)
+
+	require.NoError(t, store.Compact())
+	revisions, err = store.Revisions("toastie")
+	require.NoError(t, err)
+	assert.Len(t, revisions, 1)
+}
+
+func TestSQLStore_BackfillsRevisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recipes.db")
+	store, err := NewSQLStore(path)
+	require.NoError(t, err)
+	toastie := getHamCheeseToasties()
+	toastie.Version = 3
+	require.NoError(t, store.Add("toastie", toastie))
+
+	// Como ficam as receitas gravadas antes da migração do histórico
+	_, err = store.db.Exec(`DELETE FROM recipe_revisions`)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = NewSQLStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	revision, err := store.Revision("toastie", 3)
+	require.NoError(t, err)
+	assert.Equal(t, toastie, *revision.Recipe)
+}
+
+func TestDiffRecipes(t *testing.T) {
+	before := Recipe{
+		Name:     "toastie",
+		Servings: 1,
+		Ingredients: []Ingredient{
+			{Name: "bread", Quantity: 2, Unit: "un"},
+			{Name: "ham"},
+			{Name: "Cheese", Quantity: 50, Unit: "g"},
+		},
+		Tags:    []string{"lanche"},
+		Version: 1,
+	}
+
+	tests := []struct {
+		name  string
+		after func(r Recipe) Recipe
+		want  Diff
+	}{
+		{
+			name:  "Nothing changed",
+			after: func(r Recipe) Recipe { return r },
+			want:  Diff{From: 1, To: 1, Fields: []FieldChange{}, Ingredients: IngredientDiff{Added: []Ingredient{}, Removed: []Ingredient{}, Changed: []IngredientChange{}}},
+		},
+		{
+			name: "Ingredients added, removed and changed",
+			after: func(r Recipe) Recipe {
+				r.Ingredients = []Ingredient{
+					{Name: "bread", Quantity: 2, Unit: "un"},
+					{Name: "cheese", Quantity: 80, Unit: "g"},
+					{Name: "tomato"},
+				}
+				r.Version = 2
+				return r
+			},
+			want: Diff{
+				From:   1,
+				To:     2,
+				Fields: []FieldChange{},
+				Ingredients: IngredientDiff{
+					Added:   []Ingredient{{Name: "tomato"}},
+					Removed: []Ingredient{{Name: "ham"}},
+					Changed: []IngredientChange{{
+						Name: "cheese",
+						From: Ingredient{Name: "Cheese", Quantity: 50, Unit: "g"},
+						To:   Ingredient{Name: "cheese", Quantity: 80, Unit: "g"},
+					}},
+				},
+			},
+		},
+		{
+			name: "Fields",
+			after: func(r Recipe) Recipe {
+				r.Name = "Toastie"
+				r.Servings = 2
+				r.Tags = nil
+				r.TotalTime = Duration(10 * time.Minute)
+				r.Version = 2
+				return r
+			},
+			want: Diff{
+				From: 1,
+				To:   2,
+				Fields: []FieldChange{
+					{Field: "name", From: "toastie", To: "Toastie"},
+					{Field: "servings", From: 1, To: 2},
+					{Field: "total_time", From: Duration(0), To: Duration(10 * time.Minute)},
+					{Field: "tags", From: []string{"lanche"}, To: []string(nil)},
+				},
+				Ingredients: IngredientDiff{Added: []Ingredient{}, Removed: []Ingredient{}, Changed: []IngredientChange{}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DiffRecipes(before, tt.after(before)))
+		})
+	}
+
+	t.Run("From an empty recipe", func(t *testing.T) {
+		diff := DiffRecipes(Recipe{}, before)
+		assert.Equal(t, int64(0), diff.From)
+		assert.Equal(t, before.Ingredients, diff.Ingredients.Added)
+		assert.Len(t, diff.Fields, 3)
+	})
+}
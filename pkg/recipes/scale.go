@@ -0,0 +1,31 @@
+package recipes
+
+import (
+	"errors"
+)
+
+// NoServingsErr - a receita não informa para quantas porções ela rende,
+// então não há como calcular a proporção
+var NoServingsErr = errors.New("recipe has no servings count to scale from")
+
+// Scale - cópia da receita ajustada para servings porções. As quantidades
+// são multiplicadas pela proporção entre as porções novas e as originais;
+// a receita original não é alterada
+func (r Recipe) Scale(servings int) (Recipe, error) {
+	if r.Servings <= 0 {
+		return Recipe{}, NoServingsErr
+	}
+	if servings <= 0 {
+		invalid := &ValidationError{}
+		invalid.Add("servings", "must be positive")
+		return Recipe{}, invalid
+	}
+
+	factor := float64(servings) / float64(r.Servings)
+	r = r.clone()
+	for i := range r.Ingredients {
+		r.Ingredients[i].Quantity = roundQuantity(r.Ingredients[i].Quantity * factor)
+	}
+	r.Servings = servings
+	return r, nil
+}
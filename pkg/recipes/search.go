@@ -0,0 +1,495 @@
+package recipes
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gosimple/slug"
+)
+
+const (
+	// DefaultSearchLimit - quantos resultados a busca devolve quando o
+	// cliente não informa o limite
+	DefaultSearchLimit = 20
+	// MaxSearchLimit - maior limite aceito pela busca
+	MaxSearchLimit = 100
+
+	// MaxHighlights - quantos trechos destacados cada resultado traz
+	MaxHighlights = 3
+
+	// HighlightStart e HighlightEnd - marcam os termos encontrados nos trechos
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// Pesos de cada campo no índice: um termo no nome vale mais que o mesmo
+// termo perdido no modo de preparo
+const (
+	nameBoost       = 3
+	ingredientBoost = 2
+	stepBoost       = 1
+)
+
+// bm25K1 - saturação do peso de um termo repetido, como no BM25
+const bm25K1 = 1.2
+
+// snippetWords - textos com mais palavras que isso são cortados em volta do
+// primeiro termo encontrado
+const snippetWords = 20
+
+// SearchResults - resposta da busca. Total conta todas as receitas
+// encontradas, mesmo as que ficaram fora do limite
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+}
+
+// SearchResult - uma receita encontrada, com a pontuação e os trechos em
+// que os termos aparecem
+type SearchResult struct {
+	ID         string      `json:"id"`
+	Name       string      `json:"name"`
+	Score      float64     `json:"score"`
+	Highlights []Highlight `json:"highlights,omitempty"`
+}
+
+// Highlight - trecho de um campo da receita ("name", "ingredients[1].name",
+// "steps[0].text") com os termos encontrados entre <mark> e </mark>
+type Highlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+// Index - índice invertido sobre nomes, ingredientes e passos das receitas.
+// Os termos são normalizados por analyze: sem acentos, em minúsculas, sem
+// palavras vazias e reduzidos ao radical ("Pães" e "pao" viram "pao"). É
+// seguro para uso concorrente e atualizado receita a receita com Put e Remove
+type Index struct {
+	mu sync.RWMutex
+	// postings - termo -> ID da receita -> peso do termo na receita
+	postings map[string]map[string]float64
+	docs     map[string]indexedRecipe
+}
+
+type indexedRecipe struct {
+	recipe Recipe
+	terms  map[string]float64
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string]float64),
+		docs:     make(map[string]indexedRecipe),
+	}
+}
+
+// BuildIndex - índice com todas as receitas da lista
+func BuildIndex(list map[string]Recipe) *Index {
+	ix := NewIndex()
+	for id, recipe := range list {
+		ix.Put(id, recipe)
+	}
+	return ix
+}
+
+// Put - indexa a receita, substituindo a versão anterior se houver
+func (ix *Index) Put(id string, recipe Recipe) {
+	terms := make(map[string]float64)
+	for _, field := range searchFields(recipe) {
+		for _, token := range analyze(field.text) {
+			terms[token.term] += field.boost
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+	for term, weight := range terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[string]float64)
+		}
+		ix.postings[term][id] = weight
+	}
+	ix.docs[id] = indexedRecipe{recipe: recipe.clone(), terms: terms}
+}
+
+// Remove - tira a receita do índice
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+func (ix *Index) remove(id string) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// Search - receitas que têm todos os termos da consulta, da maior para a
+// menor pontuação. Cada termo também casa com os termos do índice a até uma
+// ou duas letras de distância, conforme o tamanho, com peso menor
+func (ix *Index) Search(query string, limit int) SearchResults {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	results := SearchResults{Query: query, Results: []SearchResult{}}
+	terms := uniqueTerms(analyze(query))
+	if len(terms) == 0 {
+		return results
+	}
+
+	var scores map[string]float64
+	matched := make(map[string]map[string]bool)
+	for i, term := range terms {
+		// Melhor contribuição de cada receita para este termo da consulta
+		best := make(map[string]float64)
+		for candidate, weight := range ix.expand(term) {
+			ids := ix.postings[candidate]
+			idf := math.Log(1 + float64(len(ix.docs))/float64(len(ids)))
+			for id, tf := range ids {
+				score := weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+				best[id] = max(best[id], score)
+				if matched[id] == nil {
+					matched[id] = make(map[string]bool)
+				}
+				matched[id][candidate] = true
+			}
+		}
+
+		if i == 0 {
+			scores = best
+			continue
+		}
+		// Só continuam as receitas que também têm este termo
+		for id := range scores {
+			if score, ok := best[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	for id, score := range scores {
+		doc := ix.docs[id]
+		results.Results = append(results.Results, SearchResult{
+			ID:         id,
+			Name:       doc.recipe.Name,
+			Score:      math.Round(score*1000) / 1000,
+			Highlights: highlights(doc.recipe, matched[id]),
+		})
+	}
+	sort.Slice(results.Results, func(i, j int) bool {
+		if results.Results[i].Score != results.Results[j].Score {
+			return results.Results[i].Score > results.Results[j].Score
+		}
+		return results.Results[i].ID < results.Results[j].ID
+	})
+
+	results.Total = len(results.Results)
+	if limit > 0 && len(results.Results) > limit {
+		results.Results = results.Results[:limit]
+	}
+	return results
+}
+
+// expand - termos do índice que casam com o termo da consulta e o peso de
+// cada um: 1 para o próprio termo, menos para os que têm erros de digitação
+func (ix *Index) expand(term string) map[string]float64 {
+	candidates := make(map[string]float64)
+	if _, ok := ix.postings[term]; ok {
+		candidates[term] = 1
+	}
+	maxDist := maxTypos(term)
+	if maxDist == 0 {
+		return candidates
+	}
+	// Uma varredura do vocabulário basta para o tamanho de um livro de receitas
+	for candidate := range ix.postings {
+		if candidate == term || abs(len(candidate)-len(term)) > maxDist {
+			continue
+		}
+		if d := editDistance(term, candidate, maxDist); d <= maxDist {
+			candidates[candidate] = 1 / float64(1+d)
+		}
+	}
+	return candidates
+}
+
+// maxTypos - quantos erros um termo tolera: nenhum em termos curtos, em que
+// qualquer troca vira outra palavra ("sal", "mel")
+func maxTypos(term string) int {
+	switch n := len(term); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance - distância de Damerau-Levenshtein (com transposição de
+// letras vizinhas). Devolve limit+1 assim que a distância passa de limit
+func editDistance(a, b string, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// searchField - um texto indexado da receita
+type searchField struct {
+	name  string
+	text  string
+	boost float64
+}
+
+func searchFields(recipe Recipe) []searchField {
+	fields := []searchField{{name: "name", text: recipe.Name, boost: nameBoost}}
+	for i, ingredient := range recipe.Ingredients {
+		fields = append(fields, searchField{name: fmt.Sprintf("ingredients[%d].name", i), text: ingredient.Name, boost: ingredientBoost})
+	}
+	for i, step := range recipe.Steps {
+		fields = append(fields, searchField{name: fmt.Sprintf("steps[%d].text", i), text: step.Text, boost: stepBoost})
+	}
+	return fields
+}
+
+// highlights - os primeiros campos em que aparece algum dos termos
+// encontrados, na ordem nome, ingredientes, passos
+func highlights(recipe Recipe, terms map[string]bool) []Highlight {
+	var list []Highlight
+	for _, field := range searchFields(recipe) {
+		if snippet, ok := highlight(field.text, terms); ok {
+			list = append(list, Highlight{Field: field.name, Snippet: snippet})
+			if len(list) == MaxHighlights {
+				break
+			}
+		}
+	}
+	return list
+}
+
+// highlight - o texto com os termos marcados. Textos longos são cortados em
+// uma janela de snippetWords palavras que começa pouco antes do primeiro termo
+func highlight(text string, terms map[string]bool) (string, bool) {
+	words := tokenize(text)
+	first := -1
+	for i, w := range words {
+		if terms[w.term] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return "", false
+	}
+
+	from, to := 0, len(words)
+	if len(words) > snippetWords {
+		from = max(0, min(first-snippetWords/4, len(words)-snippetWords))
+		to = from + snippetWords
+	}
+
+	var b strings.Builder
+	start := 0
+	if from > 0 {
+		b.WriteString("…")
+		start = words[from].start
+	}
+	end := len(text)
+	if to < len(words) {
+		end = words[to-1].end
+	}
+	pos := start
+	for _, w := range words[from:to] {
+		if !terms[w.term] {
+			continue
+		}
+		b.WriteString(text[pos:w.start])
+		b.WriteString(HighlightStart + text[w.start:w.end] + HighlightEnd)
+		pos = w.end
+	}
+	b.WriteString(text[pos:end])
+	if to < len(words) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// token - uma palavra do texto, com a posição em bytes e o termo
+// normalizado. term fica vazio nas palavras vazias ("de", "com", "the")
+type token struct {
+	start, end int
+	term       string
+}
+
+// analyze - os termos indexáveis do texto
+func analyze(text string) []token {
+	var tokens []token
+	for _, t := range tokenize(text) {
+		if t.term != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+// tokenize - separa o texto em palavras (sequências de letras e dígitos)
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	word := foldWord(text[start:end])
+	if stopWords[word] {
+		word = ""
+	}
+	return token{start: start, end: end, term: stem(word)}
+}
+
+func uniqueTerms(tokens []token) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, t := range tokens {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	return terms
+}
+
+// foldWord - a palavra em minúsculas e sem acentos, com as mesmas regras
+// dos IDs ("Pão" -> "pao", "Crème" -> "creme")
+func foldWord(word string) string {
+	if isASCIILower(word) {
+		return word
+	}
+	return strings.ReplaceAll(slug.Make(word), "-", "")
+}
+
+func isASCIILower(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= utf8.RuneSelf || ('A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// stopWords - palavras que aparecem em quase toda receita e só atrapalham
+// a pontuação, já sem acentos
+var stopWords = map[string]bool{
+	"a": true, "o": true, "as": true, "os": true, "e": true, "ou": true,
+	"de": true, "da": true, "do": true, "das": true, "dos": true,
+	"em": true, "no": true, "na": true, "nos": true, "nas": true,
+	"ao": true, "aos": true, "com": true, "sem": true, "para": true, "por": true,
+	"um": true, "uma": true, "uns": true, "umas": true,
+	"the": true, "an": true, "of": true, "and": true, "or": true,
+	"with": true, "to": true, "in": true, "for": true,
+}
+
+// stem - radical de uma palavra já sem acentos, para que plural, gênero e
+// diminutivo caiam no mesmo termo ("bolos", "bolinho" e "bolo" viram "bol").
+// É uma versão enxuta do removedor de sufixos RSLP, pensada para o
+// vocabulário de receitas; palavras de até três letras ficam como estão
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+
+	// Diminutivo, mantendo o plural para a regra seguinte ("pãezinhos" -> "paes")
+	for _, suffix := range []string{"zinhos", "zinhas", "inhos", "inhas", "zinho", "zinha", "inho", "inha"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			plural := strings.HasSuffix(suffix, "s")
+			word = word[:len(word)-len(suffix)]
+			if plural {
+				word += "s"
+			}
+			break
+		}
+	}
+
+	// Plural
+	switch {
+	case strings.HasSuffix(word, "oes"), strings.HasSuffix(word, "aes"):
+		word = word[:len(word)-3] + "ao"
+	case strings.HasSuffix(word, "ais"):
+		word = word[:len(word)-3] + "al"
+	case strings.HasSuffix(word, "eis"):
+		word = word[:len(word)-3] + "el"
+	case strings.HasSuffix(word, "ns"):
+		word = word[:len(word)-2] + "m"
+	case strings.HasSuffix(word, "res"), strings.HasSuffix(word, "zes"), strings.HasSuffix(word, "ses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		word = word[:len(word)-1]
+	}
+
+	// Gênero e vogal temática; o "o" de "ão" fica ("limao")
+	if len(word) > 3 && strings.ContainsRune("aeo", rune(word[len(word)-1])) && !strings.HasSuffix(word, "ao") {
+		word = word[:len(word)-1]
+	}
+	return word
+}
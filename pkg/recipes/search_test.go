@@ -0,0 +1,121 @@
+package recipes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getSearchRecipes() map[string]Recipe {
+	return map[string]Recipe{
+		"pao-de-queijo": {
+			Name:        "Pão de queijo",
+			Ingredients: []Ingredient{{Name: "polvilho azedo"}, {Name: "queijo minas"}, {Name: "ovos"}, {Name: "leite"}},
+			Steps:       []Step{{Text: "Escalde o polvilho com o leite fervente"}, {Text: "Junte os ovos e o queijo e asse"}},
+		},
+		"bolo-de-cenoura": {
+			Name:        "Bolo de cenoura",
+			Ingredients: []Ingredient{{Name: "cenouras"}, {Name: "ovos"}, {Name: "farinha de trigo"}, {Name: "chocolate em pó"}},
+			Steps:       []Step{{Text: "Bata as cenouras com os ovos no liquidificador"}, {Text: "Cubra com calda de chocolate"}},
+		},
+		"brigadeiro": {
+			Name:        "Brigadeiro",
+			Ingredients: []Ingredient{{Name: "leite condensado"}, {Name: "chocolate em pó"}, {Name: "manteiga"}},
+		},
+		"torrada": {
+			Name:        "Torrada",
+			Ingredients: []Ingredient{{Name: "pães franceses"}, {Name: "manteiga"}},
+		},
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	ix := BuildIndex(getSearchRecipes())
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "Accent folding", query: "pao", want: []string{"pao-de-queijo", "torrada"}},
+		{name: "Plural and diminutive", query: "paezinhos", want: []string{"pao-de-queijo", "torrada"}},
+		{name: "All terms must match", query: "chocolate cenoura", want: []string{"bolo-de-cenoura"}},
+		{name: "Terms from different fields", query: "brigadeiro chocolate", want: []string{"brigadeiro"}},
+		{name: "Typo", query: "chocolatte", want: []string{"bolo-de-cenoura", "brigadeiro"}},
+		{name: "Transposed letters", query: "qeuijo", want: []string{"pao-de-queijo"}},
+		{name: "Short terms need exact matches", query: "ovo", want: []string{"bolo-de-cenoura", "pao-de-queijo"}},
+		{name: "Stop words only", query: "de com", want: []string{}},
+		{name: "No match", query: "lasanha", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := ix.Search(tt.query, 0)
+			ids := []string{}
+			for _, r := range results.Results {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.Equal(t, len(tt.want), results.Total)
+		})
+	}
+}
+
+func TestIndex_SearchHighlights(t *testing.T) {
+	ix := BuildIndex(getSearchRecipes())
+
+	results := ix.Search("queijo", 1)
+	require.Len(t, results.Results, 1)
+	assert.Equal(t, []Highlight{
+		{Field: "name", Snippet: "Pão de <mark>queijo</mark>"},
+		{Field: "ingredients[1].name", Snippet: "<mark>queijo</mark> minas"},
+		{Field: "steps[1].text", Snippet: "Junte os ovos e o <mark>queijo</mark> e asse"},
+	}, results.Results[0].Highlights)
+
+	long := Recipe{Name: "Sopa", Steps: []Step{{Text: "Corte a cebola, o alho, o salsão, o alho-poró e a cenoura em cubos pequenos, " +
+		"refogue tudo no azeite por cinco minutos e junte o caldo de legumes quente aos poucos"}}}
+	ix.Put("sopa", long)
+	results = ix.Search("caldo de legumes", 0)
+	require.Len(t, results.Results, 1)
+	assert.Equal(t, "…cenoura em cubos pequenos, refogue tudo no azeite por cinco minutos e junte o <mark>caldo</mark> de <mark>legumes</mark> quente aos poucos",
+		results.Results[0].Highlights[0].Snippet)
+}
+
+func TestIndex_Incremental(t *testing.T) {
+	ix := NewIndex()
+	ix.Put("torrada", Recipe{Name: "Torrada", Ingredients: []Ingredient{{Name: "pão"}}})
+	assert.Equal(t, 1, ix.Search("pao", 0).Total)
+
+	// A versão anterior sai do índice
+	ix.Put("torrada", Recipe{Name: "Torrada", Ingredients: []Ingredient{{Name: "brioche"}}})
+	assert.Equal(t, 0, ix.Search("pao", 0).Total)
+	assert.Equal(t, 1, ix.Search("brioche", 0).Total)
+
+	ix.Remove("torrada")
+	assert.Equal(t, 0, ix.Search("brioche", 0).Total)
+	assert.Empty(t, ix.postings)
+}
+
+func TestStem(t *testing.T) {
+	for word, want := range map[string]string{
+		"pao":        "pao",
+		"paes":       "pao",
+		"paozinho":   "pao",
+		"paezinhos":  "pao",
+		"bolo":       "bol",
+		"bolos":      "bol",
+		"bolinhos":   "bol",
+		"colheres":   "colher",
+		"limoes":     "limao",
+		"integrais":  "integral",
+		"picada":     "picad",
+		"picados":    "picad",
+		"atuns":      "atum",
+		"nozes":      "noz",
+		"sal":        "sal",
+		"cenouras":   "cenour",
+		"chocolates": "chocolat",
+	} {
+		assert.Equal(t, want, stem(word), word)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+func (s *Service) taxonomy() *recipes.Taxonomy {
+	if s.Taxonomy == nil {
+		return recipes.DefaultTaxonomy
+	}
+	return s.Taxonomy
+}
+
+// resolveAllergens - troca os nomes pedidos em exclude_allergen pelas
+// chaves da taxonomia ("lactose" vira "dairy"). Um nome desconhecido é
+// KindBadRequest: ignorá-lo devolveria receitas que o usuário quis excluir
+func (s *Service) resolveAllergens(opts recipes.ListOptions) (recipes.ListOptions, error) {
+	if len(opts.ExcludeAllergens) == 0 {
+		return opts, nil
+	}
+	taxonomy := s.taxonomy()
+	keys := make([]string, len(opts.ExcludeAllergens))
+	for i, name := range opts.ExcludeAllergens {
+		allergen, ok := taxonomy.Lookup(name)
+		if !ok {
+			known := make([]string, 0)
+			for _, allergen := range taxonomy.Allergens() {
+				known = append(known, allergen.Key)
+			}
+			return recipes.ListOptions{}, &Error{Kind: KindBadRequest, Message: fmt.Sprintf("unknown allergen %q; use one of %s", name, strings.Join(known, ", "))}
+		}
+		keys[i] = allergen.Key
+	}
+	opts.ExcludeAllergens = keys
+	return opts, nil
+}
+
+// DetectAllergens - recalcula os alérgenos das receitas gravadas com a
+// taxonomia atual e devolve quantas mudaram. Os alérgenos são gravados na
+// escrita, então sem isso uma taxonomia carregada com -allergens não valeria
+// para as receitas que já estão na loja, e o exclude_allergen deixaria
+// passar receitas com o alérgeno. Os servidores chamam na partida. A
+// versão, a ETag e o histórico das receitas não mudam
+func (s *Service) DetectAllergens() (int, error) {
+	list, err := s.store.List()
+	if err != nil {
+		return 0, err
+	}
+	changed := 0
+	for id := range list {
+		ok, err := s.detectAllergens(id)
+		if err != nil {
+			return changed, err
+		}
+		if ok {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// detectAllergens - grava os alérgenos da taxonomia atual na receita, se
+// forem outros. Regrava na mesma versão, que as lojas não contam como
+// revisão nova
+func (s *Service) detectAllergens(id string) (bool, error) {
+	for {
+		current, err := s.store.Get(id)
+		if errors.Is(err, recipes.NotFoundErr) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		allergens := s.taxonomy().Detect(current)
+		if strings.Join(allergens, ",") == strings.Join(current.Allergens, ",") {
+			return false, nil
+		}
+		current.Allergens = allergens
+		err = s.store.CompareAndSwap(id, current.Version, current)
+		switch {
+		case errors.Is(err, recipes.VersionMismatchErr):
+			continue
+		case errors.Is(err, recipes.NotFoundErr):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		return true, nil
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// MatchRequest - despensa e tolerância usadas pelo matcher
+type MatchRequest struct {
+	Pantry     []string
+	MaxMissing *int
+}
+
+// recipePayload - o corpo aceito por DecodeRecipe. O campo Ingredients
+// esconde o de recipes.Recipe para que cada item possa ser um objeto
+// ({"name": "manteiga", "quantity": 2, "unit": "tbsp"}) ou uma linha de
+// texto livre ("2 colheres de sopa de manteiga"). Passos e durações também
+// são lidos à parte, para que uma duração inválida aponte o campo certo
+type recipePayload struct {
+	recipes.Recipe
+	Ingredients []json.RawMessage `json:"ingredients,omitempty"`
+	Steps       []json.RawMessage `json:"steps,omitempty"`
+	TotalTime   json.RawMessage   `json:"total_time,omitempty"`
+	ActiveTime  json.RawMessage   `json:"active_time,omitempty"`
+}
+
+// stepPayload - um passo do modo de preparo, com o timer ainda sem decodificar
+type stepPayload struct {
+	recipes.Step
+	Timer json.RawMessage `json:"timer,omitempty"`
+}
+
+// DecodeRecipe - Lê o JSON do corpo da requisição e converte em uma
+// instância de recipes.Recipe. contentType é o cabeçalho Content-Type da
+// requisição; vazio é aceito como JSON. Campos desconhecidos são rejeitados
+func DecodeRecipe(contentType string, body io.Reader) (recipes.Recipe, error) {
+	const malformed = "malformed recipe JSON"
+
+	var payload recipePayload
+	if err := decodeJSON(contentType, body, &payload, true, malformed); err != nil {
+		return recipes.Recipe{}, err
+	}
+
+	recipe := payload.Recipe
+	if payload.Ingredients != nil {
+		recipe.Ingredients = make([]recipes.Ingredient, len(payload.Ingredients))
+	}
+	invalid := &recipes.ValidationError{}
+	for i, raw := range payload.Ingredients {
+		recipe.Ingredients[i] = decodeIngredient(raw, fmt.Sprintf("ingredients[%d]", i), invalid)
+	}
+	if payload.Steps != nil {
+		recipe.Steps = make([]recipes.Step, len(payload.Steps))
+	}
+	for i, raw := range payload.Steps {
+		recipe.Steps[i] = decodeStep(raw, fmt.Sprintf("steps[%d]", i), invalid)
+	}
+	recipe.TotalTime = decodeDuration(payload.TotalTime, "total_time", invalid)
+	recipe.ActiveTime = decodeDuration(payload.ActiveTime, "active_time", invalid)
+	if err := invalid.Err(); err != nil {
+		return recipes.Recipe{}, &Error{Kind: KindInvalid, Message: malformed, Err: err}
+	}
+	return recipe, nil
+}
+
+// decodeIngredient - converte um item da lista de ingredientes. Texto livre
+// passa por recipes.ParseIngredient; em objetos, a unidade pode vir em
+// qualquer forma reconhecida ("colheres de sopa") e é gravada na canônica
+func decodeIngredient(raw json.RawMessage, field string, invalid *recipes.ValidationError) recipes.Ingredient {
+	var line string
+	if err := json.Unmarshal(raw, &line); err == nil {
+		return recipes.ParseIngredient(line)
+	}
+
+	var ingredient recipes.Ingredient
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&ingredient); err != nil {
+		if !addFieldError(invalid, field, err) {
+			invalid.Add(field, "must be an object or a string")
+		}
+		return recipes.Ingredient{}
+	}
+
+	if unit, ok := recipes.ParseUnit(ingredient.Unit); ok {
+		ingredient.Unit = unit
+	}
+	return ingredient
+}
+
+// decodeStep - converte um item do modo de preparo, que precisa ser um objeto
+func decodeStep(raw json.RawMessage, field string, invalid *recipes.ValidationError) recipes.Step {
+	var payload stepPayload
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		if !addFieldError(invalid, field, err) {
+			invalid.Add(field, "must be an object")
+		}
+		return recipes.Step{}
+	}
+
+	step := payload.Step
+	step.Timer = decodeDuration(payload.Timer, field+".timer", invalid)
+	return step
+}
+
+// decodeDuration - converte uma duração ISO-8601 ("PT1H30M"); ausente ou
+// null é zero
+func decodeDuration(raw json.RawMessage, field string, invalid *recipes.ValidationError) recipes.Duration {
+	if raw == nil || string(raw) == "null" {
+		return 0
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if d, err := recipes.ParseDuration(s); err == nil {
+			return d
+		}
+	}
+	invalid.Add(field, `must be an ISO-8601 duration such as "PT1H30M"`)
+	return 0
+}
+
+// ViewOptions - como a receita deve ser apresentada no GET; os valores
+// zero devolvem a receita como foi gravada
+type ViewOptions struct {
+	Servings int
+	Units    recipes.UnitSystem
+}
+
+// ViewOptionsFromQuery - GET /receitas/{id}?servings=4&units=metric
+func ViewOptionsFromQuery(query url.Values) (ViewOptions, error) {
+	var opts ViewOptions
+	if v := query.Get("servings"); v != "" {
+		servings, err := strconv.Atoi(v)
+		if err != nil || servings <= 0 || servings > recipes.MaxServings {
+			return ViewOptions{}, &Error{Kind: KindBadRequest, Message: fmt.Sprintf("servings must be an integer between 1 and %d", recipes.MaxServings)}
+		}
+		opts.Servings = servings
+	}
+	if v := query.Get("units"); v != "" {
+		units, ok := recipes.ParseUnitSystem(v)
+		if !ok {
+			return ViewOptions{}, &Error{Kind: KindBadRequest, Message: "units must be metric or imperial"}
+		}
+		opts.Units = units
+	}
+	return opts, nil
+}
+
+// MaxAuthorLength - maior autor aceito no cabeçalho From
+const MaxAuthorLength = 100
+
+// WriteOptions - o que vem nos cabeçalhos de uma escrita, além do corpo
+type WriteOptions struct {
+	// IfMatch - o If-Match da requisição; não se aplica à criação
+	IfMatch Condition
+	// Author - quem fez a alteração (cabeçalho From); vai para UpdatedBy e
+	// para a revisão
+	Author string
+}
+
+// WriteOptionsFromHeader - lê If-Match e From
+func WriteOptionsFromHeader(header http.Header) (WriteOptions, error) {
+	opts := WriteOptions{
+		IfMatch: ParseCondition(header.Values("If-Match")),
+		Author:  strings.TrimSpace(header.Get("From")),
+	}
+	if utf8.RuneCountInString(opts.Author) > MaxAuthorLength || strings.IndexFunc(opts.Author, unicode.IsControl) >= 0 {
+		return WriteOptions{}, &Error{Kind: KindBadRequest, Message: fmt.Sprintf("From must be at most %d characters, without control characters", MaxAuthorLength)}
+	}
+	return opts, nil
+}
+
+// DeleteOptions - WriteOptions, mais ?permanent=true para apagar de vez
+// em vez de mover para a lixeira
+type DeleteOptions struct {
+	WriteOptions
+	Permanent bool
+}
+
+// DeleteOptionsFromRequest - lê If-Match, From e ?permanent=
+func DeleteOptionsFromRequest(query url.Values, header http.Header) (DeleteOptions, error) {
+	write, err := WriteOptionsFromHeader(header)
+	if err != nil {
+		return DeleteOptions{}, err
+	}
+	opts := DeleteOptions{WriteOptions: write}
+	if query.Has("permanent") {
+		if opts.Permanent, err = strconv.ParseBool(query.Get("permanent")); err != nil {
+			return DeleteOptions{}, &Error{Kind: KindBadRequest, Message: "permanent must be true or false"}
+		}
+	}
+	return opts, nil
+}
+
+// SearchRequest - consulta e limite de resultados da busca
+type SearchRequest struct {
+	Query string
+	Limit int
+}
+
+// SearchRequestFromQuery - GET /receitas/search?q=bolo de cenoura&limit=10
+func SearchRequestFromQuery(query url.Values) (SearchRequest, error) {
+	req := SearchRequest{Query: strings.TrimSpace(query.Get("q")), Limit: recipes.DefaultSearchLimit}
+	if req.Query == "" {
+		return SearchRequest{}, &Error{Kind: KindBadRequest, Message: "q is required"}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > recipes.MaxSearchLimit {
+			return SearchRequest{}, &Error{Kind: KindBadRequest, Message: fmt.Sprintf("limit must be an integer between 1 and %d", recipes.MaxSearchLimit)}
+		}
+		req.Limit = limit
+	}
+	return req, nil
+}
+
+// MatchRequestFromQuery - GET /receitas/match?have=pão,queijo&max_missing=1
+func MatchRequestFromQuery(query url.Values) (MatchRequest, error) {
+	req := MatchRequest{Pantry: recipes.ParsePantry(query.Get("have"))}
+	return req, parseMaxMissing(query, &req)
+}
+
+// DecodeMatchRequest - POST /receitas/match com um recipes.Pantry em JSON.
+// O parâmetro max_missing da query string tem prioridade sobre o do corpo
+func DecodeMatchRequest(contentType string, body io.Reader, query url.Values) (MatchRequest, error) {
+	var pantry recipes.Pantry
+	if err := decodeJSON(contentType, body, &pantry, false, "malformed pantry JSON"); err != nil {
+		return MatchRequest{}, err
+	}
+
+	req := MatchRequest{Pantry: pantry.Names(), MaxMissing: pantry.MaxMissing}
+	return req, parseMaxMissing(query, &req)
+}
+
+func parseMaxMissing(query url.Values, req *MatchRequest) error {
+	v := query.Get("max_missing")
+	if v == "" {
+		return nil
+	}
+	maxMissing, err := strconv.Atoi(v)
+	if err != nil {
+		return &Error{Kind: KindBadRequest, Message: "max_missing must be an integer", Err: err}
+	}
+	req.MaxMissing = &maxMissing
+	return nil
+}
+
+// decodeJSON - JSON sintaticamente inválido é um 400; JSON válido com um
+// campo do tipo errado (ou desconhecido, quando strict) é um 422 apontando o
+// campo; qualquer Content-Type que não seja JSON é um 415
+func decodeJSON(contentType string, body io.Reader, v interface{}, strict bool, malformed string) error {
+	if !isJSONContentType(contentType) {
+		return &Error{Kind: KindUnsupportedMediaType, Message: "content type must be application/json"}
+	}
+
+	decoder := json.NewDecoder(body)
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	invalid := &recipes.ValidationError{}
+	if !addFieldError(invalid, "", err) {
+		return &Error{Kind: KindBadRequest, Message: malformed, Err: err}
+	}
+	return &Error{Kind: KindInvalid, Message: malformed, Err: invalid}
+}
+
+// addFieldError - registra em invalid os erros do encoding/json que apontam
+// um campo (tipo errado ou campo desconhecido), com prefix antes do nome.
+// Devolve false para os demais erros
+func addFieldError(invalid *recipes.ValidationError, prefix string, err error) bool {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		invalid.Add(joinField(prefix, typeErr.Field), "must be "+jsonTypeName(typeErr.Type))
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		// O encoding/json não tem um tipo de erro próprio para campos
+		// desconhecidos, só a mensagem: json: unknown field "nome"
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+		invalid.Add(joinField(prefix, field), "unknown field")
+	default:
+		return false
+	}
+	return true
+}
+
+func joinField(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
+
+const unknownFieldPrefix = "json: unknown field "
+
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonTypeName - nome do tipo como o cliente o vê no JSON
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Ptr:
+		return jsonTypeName(t.Elem())
+	default:
+		return "a valid value"
+	}
+}
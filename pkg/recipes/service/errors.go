@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// Kind - Classificação de um erro, independente do framework HTTP
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindBadRequest
+	KindInvalid
+	KindNotFound
+	KindMethodNotAllowed
+	KindConflict
+	KindUnsupportedMediaType
+	KindPreconditionFailed
+	KindNotAcceptable
+)
+
+var (
+	// MethodNotAllowedErr - o caminho existe, mas não aceita o método usado
+	MethodNotAllowedErr = &Error{Kind: KindMethodNotAllowed, Message: "method not allowed"}
+)
+
+// Error - erro da camada de serviço, com a classificação usada pelos
+// adaptadores para escolher o status HTTP
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify - descobre a classificação de qualquer erro vindo do serviço ou
+// da loja. Erros desconhecidos são internos
+func Classify(err error) Kind {
+	var serviceErr *Error
+	var validationErr *recipes.ValidationError
+	switch {
+	case errors.As(err, &serviceErr):
+		return serviceErr.Kind
+	case errors.As(err, &validationErr), errors.Is(err, recipes.NoServingsErr):
+		return KindInvalid
+	case errors.Is(err, recipes.NotFoundErr):
+		return KindNotFound
+	case errors.Is(err, recipes.ExistsErr):
+		return KindConflict
+	case errors.Is(err, recipes.VersionMismatchErr):
+		return KindPreconditionFailed
+	default:
+		return KindInternal
+	}
+}
+
+// StatusCode - status HTTP correspondente ao erro
+func StatusCode(err error) int {
+	switch Classify(err) {
+	case KindBadRequest:
+		return http.StatusBadRequest
+	case KindInvalid:
+		return http.StatusUnprocessableEntity
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case KindConflict:
+		return http.StatusConflict
+	case KindUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case KindNotAcceptable:
+		return http.StatusNotAcceptable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// PreconditionFailedErr - o If-Match não corresponde à versão gravada
+var PreconditionFailedErr = &Error{Kind: KindPreconditionFailed, Message: "recipe does not match If-Match"}
+
+// ETag - etiqueta forte da versão gravada da receita ("3-1714564800000000000").
+// É a que o If-Match do PUT e do DELETE precisa repetir
+func ETag(recipe recipes.Recipe) string {
+	return `"` + versionTag(recipe.Version, recipe.CreatedAt) + `"`
+}
+
+// versionTag - a versão seguida da data de criação em nanossegundos. A versão
+// sozinha se repete quando um ID é removido de vez e criado de novo, e aí o
+// If-Match de quem leu o recurso antigo passaria no novo
+func versionTag(version int64, createdAt time.Time) string {
+	return strconv.FormatInt(version, 10) + "-" + strconv.FormatInt(recipes.UnixNano(createdAt), 10)
+}
+
+// ViewETag - etiqueta da receita ajustada por ViewOptions. Cada combinação
+// de porções e medidas é uma representação diferente, então ganha uma
+// etiqueta própria ("3-1714564800000000000;servings=4;units=metric")
+func ViewETag(recipe recipes.Recipe, opts ViewOptions) string {
+	tag := versionTag(recipe.Version, recipe.CreatedAt)
+	if opts.Servings > 0 {
+		tag += fmt.Sprintf(";servings=%d", opts.Servings)
+	}
+	if opts.Units != "" {
+		tag += ";units=" + string(opts.Units)
+	}
+	return `"` + tag + `"`
+}
+
+// Condition - um cabeçalho If-Match ou If-None-Match (RFC 9110, seção
+// 13.1). O valor zero é o cabeçalho ausente, que não impõe condição
+type Condition struct {
+	set  bool
+	any  bool
+	tags []string
+}
+
+// ParseCondition - lê as ocorrências do cabeçalho (Header.Values), cada uma
+// com uma lista de etiquetas separadas por vírgula ou "*"
+func ParseCondition(values []string) Condition {
+	var c Condition
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			switch tag {
+			case "":
+				continue
+			case "*":
+				c.any = true
+			default:
+				c.tags = append(c.tags, tag)
+			}
+			c.set = true
+		}
+	}
+	return c
+}
+
+// IsSet - o cabeçalho veio na requisição
+func (c Condition) IsSet() bool {
+	return c.set
+}
+
+// Match - avalia um If-Match contra a etiqueta atual, com comparação forte:
+// etiquetas fracas (W/"3") nunca passam. Sem o cabeçalho, sempre passa
+func (c Condition) Match(etag string) bool {
+	if !c.set || c.any {
+		return true
+	}
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range c.tags {
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NoneMatch - avalia um If-None-Match contra a etiqueta atual, com
+// comparação fraca. false quer dizer que o cliente já tem a representação
+// atual (304 Not Modified). Sem o cabeçalho, sempre passa
+func (c Condition) NoneMatch(etag string) bool {
+	if !c.set {
+		return true
+	}
+	if c.any {
+		return false
+	}
+	for _, tag := range c.tags {
+		if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+	return true
+}
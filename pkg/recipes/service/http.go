@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// Funções auxiliares para os adaptadores baseados em net/http (standardlib e
+// gorilla/mux). O adaptador do gin usa NewProblem com c.JSON
+
+// WriteJSON - Converte v em JSON e escreve a resposta com o status informado
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		writeProblem(w, NewProblem(err, ""))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// WriteError - escreve o erro como application/problem+json, com o status
+// da sua classificação
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, NewProblem(err, r.URL.Path))
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	jsonBytes, _ := json.Marshal(problem)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(jsonBytes)
+}
+
+// NotFoundHandler - resposta para caminhos que não existem
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, recipes.NotFoundErr)
+}
+
+// MethodNotAllowedHandler - resposta para métodos que o caminho não aceita
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, MethodNotAllowedErr)
+}
+
+// WriteContent - escreve o corpo já pronto, com o Content-Type informado
+func WriteContent(w http.ResponseWriter, status int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/gosimple/slug"
+)
+
+// ListOptionsFromQuery - GET /receitas?limit=20&sort=-created&cursor=...
+// &ingredient=queijo&exclude_ingredient=leite&tag=vegano
+// &exclude_allergen=gluten. Os filtros podem ser repetidos ou separados
+// por vírgulas. Sem sort, vale o do cursor ou, na primeira página, a ordem
+// pelo nome. Os alérgenos são conferidos pelo Service, que conhece a
+// taxonomia
+func ListOptionsFromQuery(query url.Values) (recipes.ListOptions, error) {
+	opts := recipes.ListOptions{Sort: recipes.SortByName, Limit: recipes.DefaultPageSize}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > recipes.MaxPageSize {
+			return recipes.ListOptions{}, &Error{Kind: KindBadRequest, Message: fmt.Sprintf("limit must be an integer between 1 and %d", recipes.MaxPageSize)}
+		}
+		opts.Limit = limit
+	}
+
+	sortParam := query.Get("sort")
+	if sortParam != "" {
+		field, desc, err := recipes.ParseSort(sortParam)
+		if err != nil {
+			return recipes.ListOptions{}, &Error{Kind: KindBadRequest, Message: "sort must be name, created or updated, optionally prefixed with -", Err: err}
+		}
+		opts.Sort, opts.Desc = field, desc
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := recipes.DecodeCursor(v)
+		if err != nil {
+			return recipes.ListOptions{}, &Error{Kind: KindBadRequest, Message: "invalid cursor", Err: err}
+		}
+		if sortParam == "" {
+			opts.Sort, opts.Desc = cursor.Sort, cursor.Desc
+		} else if cursor.Sort != opts.Sort || cursor.Desc != opts.Desc {
+			return recipes.ListOptions{}, &Error{Kind: KindBadRequest, Message: "cursor does not match sort"}
+		}
+		opts.Cursor = &cursor
+	}
+
+	var err error
+	if opts.Ingredients, err = listFilter(query, "ingredient"); err != nil {
+		return recipes.ListOptions{}, err
+	}
+	if opts.ExcludeIngredients, err = listFilter(query, "exclude_ingredient"); err != nil {
+		return recipes.ListOptions{}, err
+	}
+	if opts.Tags, err = listFilter(query, "tag"); err != nil {
+		return recipes.ListOptions{}, err
+	}
+	if opts.ExcludeAllergens, err = listFilter(query, "exclude_allergen"); err != nil {
+		return recipes.ListOptions{}, err
+	}
+	return opts, nil
+}
+
+// listFilter - os valores de um filtro da listagem, de todas as ocorrências
+// do parâmetro
+func listFilter(query url.Values, param string) ([]string, error) {
+	var values []string
+	for _, v := range query[param] {
+		for _, item := range recipes.ParsePantry(v) {
+			if slug.Make(item) == "" {
+				return nil, &Error{Kind: KindBadRequest, Message: param + " must contain at least one letter or digit"}
+			}
+			values = append(values, item)
+		}
+	}
+	return values, nil
+}
+
+// LinkHeader - cabeçalho Link (RFC 8288) com as páginas seguinte e
+// anterior. Os links repetem a query da requisição, trocando só o cursor.
+// Vazio quando a página é a única
+func LinkHeader(u *url.URL, page recipes.Page) string {
+	var links []string
+	for _, l := range []struct {
+		rel    string
+		cursor *recipes.Cursor
+	}{
+		{rel: "next", cursor: page.Next},
+		{rel: "prev", cursor: page.Prev},
+	} {
+		if l.cursor == nil {
+			continue
+		}
+		query := u.Query()
+		query.Set("cursor", l.cursor.Encode())
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, query.Encode(), l.rel))
+	}
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+const (
+	// MergePatchContentType - JSON Merge Patch (RFC 7386)
+	MergePatchContentType = "application/merge-patch+json"
+	// JSONPatchContentType - JSON Patch (RFC 6902)
+	JSONPatchContentType = "application/json-patch+json"
+)
+
+// Patch - o corpo de um PATCH, em um dos dois formatos. É aplicado sobre o
+// JSON da receita gravada, que depois passa pela mesma decodificação e
+// validação de um PUT
+type Patch struct {
+	// merge - o documento do merge patch; nil quando o formato é JSON Patch
+	merge      map[string]interface{}
+	operations []patchOperation
+}
+
+// patchOperation - uma operação do JSON Patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path, from []string
+	value      interface{}
+}
+
+// DecodePatch - lê o corpo de um PATCH. O Content-Type escolhe o formato;
+// qualquer outro, inclusive application/json, responde 415
+func DecodePatch(contentType string, body io.Reader) (Patch, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case MergePatchContentType:
+		var merge map[string]interface{}
+		if err := json.NewDecoder(body).Decode(&merge); err != nil || merge == nil {
+			return Patch{}, &Error{Kind: KindBadRequest, Message: "merge patch must be a JSON object", Err: err}
+		}
+		return Patch{merge: merge}, nil
+	case JSONPatchContentType:
+		return decodeJSONPatch(body)
+	default:
+		return Patch{}, &Error{
+			Kind:    KindUnsupportedMediaType,
+			Message: "content type must be " + MergePatchContentType + " or " + JSONPatchContentType,
+		}
+	}
+}
+
+func decodeJSONPatch(body io.Reader) (Patch, error) {
+	const malformed = "malformed JSON patch"
+
+	// Campos que a operação não usa são ignorados, como pede a RFC 6902
+	var operations []patchOperation
+	if err := json.NewDecoder(body).Decode(&operations); err != nil {
+		invalid := &recipes.ValidationError{}
+		if !addFieldError(invalid, "", err) {
+			return Patch{}, &Error{Kind: KindBadRequest, Message: malformed, Err: err}
+		}
+		return Patch{}, &Error{Kind: KindInvalid, Message: malformed, Err: invalid}
+	}
+	if operations == nil {
+		return Patch{}, &Error{Kind: KindBadRequest, Message: malformed}
+	}
+
+	invalid := &recipes.ValidationError{}
+	for i := range operations {
+		op := &operations[i]
+		field := fmt.Sprintf("[%d]", i)
+
+		switch op.Op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			invalid.Add(field+".op", "must be one of add, remove, replace, move, copy, test")
+			continue
+		}
+
+		var err error
+		if op.Path == nil {
+			invalid.Add(field+".path", "is required")
+		} else if op.path, err = parsePointer(*op.Path); err != nil {
+			invalid.Add(field+".path", err.Error())
+		}
+
+		switch op.Op {
+		case "move", "copy":
+			if op.From == nil {
+				invalid.Add(field+".from", "is required")
+			} else if op.from, err = parsePointer(*op.From); err != nil {
+				invalid.Add(field+".from", err.Error())
+			}
+		case "add", "replace", "test":
+			// "value": null é um valor; só a ausência do campo é erro
+			if op.Value == nil {
+				invalid.Add(field+".value", "is required")
+			} else if err := json.Unmarshal(op.Value, &op.value); err != nil {
+				invalid.Add(field+".value", "must be a JSON value")
+			}
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		return Patch{}, &Error{Kind: KindInvalid, Message: malformed, Err: err}
+	}
+	return Patch{operations: operations}, nil
+}
+
+// apply - aplica o patch ao documento. Uma operação que não pode ser
+// aplicada ao estado atual da receita (caminho inexistente, test que não
+// confere) é um conflito; nenhuma operação vale se uma delas falhar
+func (p Patch) apply(doc interface{}) (interface{}, error) {
+	if p.merge != nil {
+		return mergePatch(doc, p.merge), nil
+	}
+
+	var err error
+	for i, op := range p.operations {
+		if doc, err = op.apply(doc); err != nil {
+			return nil, &Error{Kind: KindConflict, Message: fmt.Sprintf("cannot apply patch: operation %d (%s): %v", i, op.Op, err)}
+		}
+	}
+	return doc, nil
+}
+
+// mergePatch - RFC 7386: objetos são mesclados campo a campo, null remove
+// o campo e qualquer outro valor substitui o anterior
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+func (op patchOperation) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.path, op.value)
+	case "remove":
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case "replace":
+		doc, _, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, op.value)
+	case "move":
+		if isPrefix(op.from, op.path) && len(op.from) < len(op.path) {
+			return nil, fmt.Errorf("cannot move %q into itself", *op.From)
+		}
+		doc, value, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, deepCopy(value))
+	default: // test
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, op.value) {
+			return nil, fmt.Errorf("value at %q does not match", *op.Path)
+		}
+		return doc, nil
+	}
+}
+
+// parsePointer - separa um JSON Pointer (RFC 6901) nos seus tokens. "" é o
+// documento inteiro
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("must be a JSON pointer starting with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// get - o valor apontado por path
+func get(doc interface{}, path []string) (interface{}, error) {
+	for i, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, missingPath(path[:i+1])
+			}
+			doc = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, missingPath(path[:i+1])
+			}
+			doc = node[index]
+		default:
+			return nil, missingPath(path[:i+1])
+		}
+	}
+	return doc, nil
+}
+
+// add - coloca value em path. Em objetos cria ou substitui o campo; em
+// arrays insere na posição, com "-" sendo o fim
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		index := len(node)
+		if last != "-" {
+			if index, err = arrayIndex(last, len(node)); err != nil {
+				return nil, missingPath(path)
+			}
+		}
+		grown := make([]interface{}, 0, len(node)+1)
+		grown = append(append(append(grown, node[:index]...), value), node[index:]...)
+		return replaceAt(doc, path[:len(path)-1], grown)
+	default:
+		return nil, missingPath(path)
+	}
+}
+
+// remove - tira o valor de path e o devolve
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	value, err := get(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(path) == 0 {
+		return nil, value, nil
+	}
+	parent, _ := get(doc, path[:len(path)-1])
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		delete(node, last)
+		return doc, value, nil
+	default:
+		list := node.([]interface{})
+		index, _ := arrayIndex(last, len(list)-1)
+		shrunk := append(append(make([]interface{}, 0, len(list)-1), list[:index]...), list[index+1:]...)
+		doc, err = replaceAt(doc, path[:len(path)-1], shrunk)
+		return doc, value, err
+	}
+}
+
+// replaceAt - troca o valor em path, que já existe. Necessário porque
+// inserir ou remover de um array cria um slice novo
+func replaceAt(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, _ := arrayIndex(last, len(node)-1)
+		node[index] = value
+	}
+	return doc, nil
+}
+
+// arrayIndex - o índice de um token de array, entre 0 e limit. Zeros à
+// esquerda não são aceitos, como pede a RFC 6901
+func arrayIndex(token string, limit int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > limit {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func missingPath(path []string) error {
+	tokens := make([]string, len(path))
+	for i, token := range path {
+		tokens[i] = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return fmt.Errorf("path %q does not exist", "/"+strings.Join(tokens, "/"))
+}
+
+// deepCopy - cópia de um valor JSON decodificado, para que copy não deixe
+// dois caminhos apontando para o mesmo objeto
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			out[name] = deepCopy(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = deepCopy(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// PlanPreconditionFailedErr - o If-Match não corresponde à versão gravada
+// do plano
+var PlanPreconditionFailedErr = &Error{Kind: KindPreconditionFailed, Message: "plan does not match If-Match"}
+
+// PlanLocation - caminho do plano, usado no cabeçalho Location
+func PlanLocation(id string) string {
+	return "/planos/" + id
+}
+
+// PlanETag - etiqueta forte da versão gravada do plano, como ETag. Os
+// avisos não entram: eles dependem das receitas, não do plano
+func PlanETag(plan recipes.Plan) string {
+	return `"` + versionTag(plan.Version, plan.CreatedAt) + `"`
+}
+
+// planPayload - o corpo aceito por DecodePlan. Os campos preenchidos pelo
+// serviço são aceitos e ignorados, para que o corpo de um GET possa voltar
+// em um PUT
+type planPayload struct {
+	ID        string            `json:"id,omitempty"`
+	Name      string            `json:"name"`
+	Slots     []json.RawMessage `json:"slots"`
+	Warnings  json.RawMessage   `json:"warnings,omitempty"`
+	CreatedAt json.RawMessage   `json:"created_at,omitempty"`
+	UpdatedAt json.RawMessage   `json:"updated_at,omitempty"`
+	Version   json.RawMessage   `json:"version,omitempty"`
+}
+
+// DecodePlan - lê o corpo de POST /planos e PUT /planos/{id}:
+//
+//	{"name": "Semana 1", "slots": [
+//	  {"date": "2024-05-06", "meal": "almoço", "recipe_id": "bolo", "servings": 4}]}
+//
+// A refeição pode vir em português ou em inglês e é gravada em inglês
+func DecodePlan(contentType string, body io.Reader) (recipes.Plan, error) {
+	const malformed = "malformed plan JSON"
+
+	var payload planPayload
+	if err := decodeJSON(contentType, body, &payload, true, malformed); err != nil {
+		return recipes.Plan{}, err
+	}
+
+	plan := recipes.Plan{ID: payload.ID, Name: payload.Name, Slots: make([]recipes.PlanSlot, len(payload.Slots))}
+	invalid := &recipes.ValidationError{}
+	for i, raw := range payload.Slots {
+		plan.Slots[i] = decodePlanSlot(raw, fmt.Sprintf("slots[%d]", i), invalid)
+	}
+	if err := invalid.Err(); err != nil {
+		return recipes.Plan{}, &Error{Kind: KindInvalid, Message: malformed, Err: err}
+	}
+	return plan, nil
+}
+
+func decodePlanSlot(raw json.RawMessage, field string, invalid *recipes.ValidationError) recipes.PlanSlot {
+	var slot recipes.PlanSlot
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&slot); err != nil {
+		if !addFieldError(invalid, field, err) {
+			invalid.Add(field, "must be an object")
+		}
+		return recipes.PlanSlot{}
+	}
+
+	// Uma refeição desconhecida fica como veio, para que ValidatePlan a aponte
+	if meal, ok := recipes.ParseMeal(string(slot.Meal)); ok {
+		slot.Meal = meal
+	}
+	return slot
+}
+
+// GeneratePlanRequest - o corpo de POST /planos/generate
+type GeneratePlanRequest struct {
+	// Name - o nome do plano gerado; "Plano de <início>" quando vazio
+	Name        string
+	Constraints recipes.PlanConstraints
+}
+
+// generatePlanPayload - as restrições como chegam no JSON
+type generatePlanPayload struct {
+	Name         string          `json:"name,omitempty"`
+	Start        string          `json:"start,omitempty"`
+	Days         int             `json:"days,omitempty"`
+	Meals        []string        `json:"meals,omitempty"`
+	Tags         []string        `json:"tags,omitempty"`
+	MaxTime      json.RawMessage `json:"max_time,omitempty"`
+	NoRepeatDays int             `json:"no_repeat_days,omitempty"`
+	Servings     int             `json:"servings,omitempty"`
+	Seed         int64           `json:"seed,omitempty"`
+}
+
+// DecodeGeneratePlanRequest - lê o corpo de POST /planos/generate:
+//
+//	{"start": "2024-05-06", "days": 7, "meals": ["almoço", "jantar"],
+//	 "tags": ["vegano"], "max_time": "PT45M", "no_repeat_days": 3}
+//
+// Sem start, o plano começa no dia atual (veja Service.GeneratePlan)
+func DecodeGeneratePlanRequest(contentType string, body io.Reader) (GeneratePlanRequest, error) {
+	const malformed = "malformed plan constraints JSON"
+
+	var payload generatePlanPayload
+	if err := decodeJSON(contentType, body, &payload, true, malformed); err != nil {
+		return GeneratePlanRequest{}, err
+	}
+
+	req := GeneratePlanRequest{
+		Name: payload.Name,
+		Constraints: recipes.PlanConstraints{
+			Start:        payload.Start,
+			Days:         payload.Days,
+			Tags:         payload.Tags,
+			NoRepeatDays: payload.NoRepeatDays,
+			Servings:     payload.Servings,
+			Seed:         payload.Seed,
+		},
+	}
+	invalid := &recipes.ValidationError{}
+	if payload.Start != "" {
+		if _, err := time.Parse(recipes.DateLayout, payload.Start); err != nil {
+			invalid.Add("start", "must be a date such as 2024-05-06")
+		}
+	}
+	if payload.Days < 0 || payload.Days > recipes.MaxPlanDays {
+		invalid.Add("days", fmt.Sprintf("must be between 1 and %d", recipes.MaxPlanDays))
+	}
+	seen := make(map[recipes.Meal]bool, len(payload.Meals))
+	for i, name := range payload.Meals {
+		field := fmt.Sprintf("meals[%d]", i)
+		meal, ok := recipes.ParseMeal(name)
+		switch {
+		case !ok:
+			invalid.Add(field, "unknown meal")
+		case seen[meal]:
+			invalid.Add(field, "duplicates "+string(meal))
+		default:
+			seen[meal] = true
+			req.Constraints.Meals = append(req.Constraints.Meals, meal)
+		}
+	}
+	for i, tag := range payload.Tags {
+		if strings.TrimSpace(tag) == "" {
+			invalid.Add(fmt.Sprintf("tags[%d]", i), "is required")
+		}
+	}
+	req.Constraints.MaxTime = decodeDuration(payload.MaxTime, "max_time", invalid)
+	if payload.NoRepeatDays < 0 || payload.NoRepeatDays > recipes.MaxPlanDays {
+		invalid.Add("no_repeat_days", fmt.Sprintf("must be between 0 and %d", recipes.MaxPlanDays))
+	}
+	if payload.Servings < 0 || payload.Servings > recipes.MaxServings {
+		invalid.Add("servings", fmt.Sprintf("must be between 1 and %d", recipes.MaxServings))
+	}
+	if err := invalid.Err(); err != nil {
+		return GeneratePlanRequest{}, &Error{Kind: KindInvalid, Message: "invalid plan constraints", Err: err}
+	}
+	return req, nil
+}
+
+// CreatePlan - grava o plano com o ID gerado a partir do nome. Como os
+// planos não aparecem em URLs compartilhadas como as receitas, um ID em uso
+// sempre ganha um sufixo ("semana-1-2") em vez de responder 409, e um ID
+// reservado (veja recipes.IsReservedPlanID) também, em vez de responder 422
+func (s *Service) CreatePlan(plan recipes.Plan) (recipes.Plan, error) {
+	if err := s.validatePlan(&plan); err != nil {
+		return recipes.Plan{}, err
+	}
+
+	plan.CreatedAt = s.now()
+	plan.UpdatedAt = plan.CreatedAt
+	plan.Version = 1
+	plan.Warnings = nil
+	plan.SortSlots()
+
+	base := NewID(plan.Name)
+	id, n := base, 2
+	if recipes.IsReservedPlanID(base) {
+		id, n = fmt.Sprintf("%s-%d", base, n), n+1
+	}
+	for ; ; n++ {
+		err := s.store.AddPlan(id, plan)
+		if err == nil {
+			return s.GetPlan(id)
+		}
+		if !errors.Is(err, recipes.ExistsErr) {
+			return recipes.Plan{}, err
+		}
+		if n > MaxSuffix {
+			return recipes.Plan{}, &Error{Kind: KindConflict, Message: fmt.Sprintf("plan %q already exists", base), Err: err}
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// GetPlan - o plano, com os avisos das receitas que saíram da loja
+func (s *Service) GetPlan(id string) (recipes.Plan, error) {
+	plan, err := s.store.GetPlan(id)
+	if err != nil {
+		return recipes.Plan{}, err
+	}
+	return s.withWarnings(plan, newTrashLookup(s))
+}
+
+// ListPlans - todos os planos, pela ordem dos IDs, com os avisos
+func (s *Service) ListPlans() ([]recipes.Plan, error) {
+	plans, err := s.store.Plans()
+	if err != nil {
+		return nil, err
+	}
+	trash := newTrashLookup(s)
+	for i := range plans {
+		if plans[i], err = s.withWarnings(plans[i], trash); err != nil {
+			return nil, err
+		}
+	}
+	return plans, nil
+}
+
+// UpdatePlan - substitui o plano. Como em Update, o ID vem da URL e um
+// plano que não tem uma das etiquetas de opts.IfMatch não é alterado
+func (s *Service) UpdatePlan(id string, plan recipes.Plan, opts WriteOptions) (recipes.Plan, error) {
+	if plan.ID != "" && plan.ID != id {
+		invalid := &recipes.ValidationError{}
+		invalid.Add("id", "must match the plan ID in the URL")
+		return recipes.Plan{}, &Error{Kind: KindInvalid, Message: "invalid plan", Err: invalid}
+	}
+	if err := s.validatePlan(&plan); err != nil {
+		return recipes.Plan{}, err
+	}
+	plan.Warnings = nil
+	plan.SortSlots()
+
+	for {
+		current, err := s.store.GetPlan(id)
+		if err != nil {
+			return recipes.Plan{}, err
+		}
+		if !opts.IfMatch.Match(PlanETag(current)) {
+			return recipes.Plan{}, PlanPreconditionFailedErr
+		}
+
+		plan.CreatedAt = current.CreatedAt
+		plan.UpdatedAt = s.now()
+		plan.Version = current.Version + 1
+		err = s.store.CompareAndSwapPlan(id, current.Version, plan)
+		if errors.Is(err, recipes.VersionMismatchErr) {
+			continue
+		}
+		if err != nil {
+			return recipes.Plan{}, err
+		}
+		return s.GetPlan(id)
+	}
+}
+
+// DeletePlan - apaga o plano. Planos não passam pela lixeira
+func (s *Service) DeletePlan(id string, opts WriteOptions) error {
+	for {
+		current, err := s.store.GetPlan(id)
+		if errors.Is(err, recipes.NotFoundErr) && opts.IfMatch.IsSet() {
+			return PlanPreconditionFailedErr
+		}
+		if err != nil {
+			return err
+		}
+		if !opts.IfMatch.Match(PlanETag(current)) {
+			return PlanPreconditionFailedErr
+		}
+
+		err = s.store.CompareAndDeletePlan(id, current.Version)
+		if errors.Is(err, recipes.VersionMismatchErr) || errors.Is(err, recipes.NotFoundErr) {
+			continue
+		}
+		return err
+	}
+}
+
+// GeneratePlan - monta um plano com as receitas da loja que cumprem as
+// restrições (veja recipes.GeneratePlan) e o grava como em CreatePlan. Sem
+// início, o plano começa no dia atual. Restrições que nenhuma combinação de
+// receitas cumpre são KindInvalid
+func (s *Service) GeneratePlan(req GeneratePlanRequest) (recipes.Plan, error) {
+	c := req.Constraints
+	if c.Start == "" {
+		c.Start = s.now().Format(recipes.DateLayout)
+	}
+	list, err := s.store.List()
+	if err != nil {
+		return recipes.Plan{}, err
+	}
+	plan, err := recipes.GeneratePlan(list, c)
+	if errors.Is(err, recipes.NotEnoughRecipesErr) {
+		return recipes.Plan{}, &Error{Kind: KindInvalid, Message: err.Error(), Err: err}
+	}
+	if err != nil {
+		return recipes.Plan{}, err
+	}
+
+	plan.Name = req.Name
+	if strings.TrimSpace(plan.Name) == "" {
+		plan.Name = "Plano de " + c.Start
+	}
+	return s.CreatePlan(plan)
+}
+
+// validatePlan - recipes.ValidatePlan, mais as receitas: cada slot precisa
+// apontar para uma receita da loja. O ID antigo de uma receita renomeada é
+// trocado pelo atual
+func (s *Service) validatePlan(plan *recipes.Plan) error {
+	if plan.Slots == nil {
+		plan.Slots = []recipes.PlanSlot{}
+	}
+	if err := recipes.ValidatePlan(*plan); err != nil {
+		return &Error{Kind: KindInvalid, Message: "invalid plan", Err: err}
+	}
+
+	invalid := &recipes.ValidationError{}
+	for i, slot := range plan.Slots {
+		_, err := s.store.Get(slot.RecipeID)
+		if errors.Is(err, recipes.NotFoundErr) {
+			if to, aliasErr := s.store.Alias(slot.RecipeID); aliasErr == nil {
+				plan.Slots[i].RecipeID = to
+				continue
+			}
+			invalid.Add(fmt.Sprintf("slots[%d].recipe_id", i), "recipe not found")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := invalid.Err(); err != nil {
+		return &Error{Kind: KindInvalid, Message: "invalid plan", Err: err}
+	}
+	return nil
+}
+
+// withWarnings - o plano com um aviso para cada slot cuja receita não está
+// mais na loja. Uma receita renomeada depois de entrar no plano aparece com
+// o ID atual, sem aviso
+func (s *Service) withWarnings(plan recipes.Plan, trash *trashLookup) (recipes.Plan, error) {
+	plan.Warnings = nil
+	for i, slot := range plan.Slots {
+		_, err := s.store.Get(slot.RecipeID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, recipes.NotFoundErr) {
+			return recipes.Plan{}, err
+		}
+		if to, err := s.store.Alias(slot.RecipeID); err == nil {
+			plan.Slots[i].RecipeID = to
+			continue
+		}
+
+		message := "recipe was deleted"
+		trashed, err := trash.contains(slot.RecipeID)
+		if err != nil {
+			return recipes.Plan{}, err
+		}
+		if trashed {
+			message = "recipe is in the trash"
+		}
+		plan.Warnings = append(plan.Warnings, recipes.PlanWarning{Slot: i, RecipeID: slot.RecipeID, Message: message})
+	}
+	return plan, nil
+}
+
+// trashLookup - os IDs da lixeira, lidos da loja só quando algum plano
+// aponta para uma receita que sumiu, e uma vez só por listagem
+type trashLookup struct {
+	s   *Service
+	ids map[string]bool
+}
+
+func newTrashLookup(s *Service) *trashLookup {
+	return &trashLookup{s: s}
+}
+
+func (t *trashLookup) contains(id string) (bool, error) {
+	if t.ids == nil {
+		trash, err := t.s.store.Trash()
+		if err != nil {
+			return false, err
+		}
+		t.ids = make(map[string]bool, len(trash))
+		for _, trashed := range trash {
+			t.ids[trashed.ID] = true
+		}
+	}
+	return t.ids[id], nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// ProblemContentType - media type das respostas de erro (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Problem - corpo das respostas de erro no formato "Problem Details for HTTP
+// APIs" (RFC 7807). Errors traz os problemas de cada campo quando a receita
+// não passa na validação
+type Problem struct {
+	Type     string               `json:"type"`
+	Title    string               `json:"title"`
+	Status   int                  `json:"status"`
+	Detail   string               `json:"detail,omitempty"`
+	Instance string               `json:"instance,omitempty"`
+	Errors   []recipes.FieldError `json:"errors,omitempty"`
+}
+
+// problemTypes - URI (relativa) que identifica cada tipo de problema
+var problemTypes = map[Kind]string{
+	KindBadRequest:           "/problems/bad-request",
+	KindInvalid:              "/problems/validation",
+	KindNotFound:             "/problems/not-found",
+	KindMethodNotAllowed:     "/problems/method-not-allowed",
+	KindConflict:             "/problems/conflict",
+	KindUnsupportedMediaType: "/problems/unsupported-media-type",
+	KindPreconditionFailed:   "/problems/precondition-failed",
+	KindNotAcceptable:        "/problems/not-acceptable",
+}
+
+// NewProblem - converte o erro no Problem correspondente. instance é o
+// caminho da requisição que falhou. Erros internos não expõem a mensagem
+// original para o cliente
+func NewProblem(err error, instance string) Problem {
+	kind := Classify(err)
+	status := StatusCode(err)
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: instance,
+	}
+	if t, ok := problemTypes[kind]; ok {
+		problem.Type = t
+	}
+	if kind == KindInternal {
+		return problem
+	}
+
+	var serviceErr *Error
+	var validationErr *recipes.ValidationError
+	if errors.As(err, &validationErr) {
+		problem.Errors = validationErr.Errors
+	}
+	switch {
+	case errors.As(err, &serviceErr):
+		problem.Detail = serviceErr.Message
+	case validationErr != nil:
+		problem.Detail = "recipe failed validation"
+	default:
+		problem.Detail = err.Error()
+	}
+	return problem
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"io"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// RenameRequest - o corpo de POST /receitas/{id}/rename
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+// DecodeRename - lê o nome novo do corpo da requisição
+func DecodeRename(contentType string, body io.Reader) (string, error) {
+	var req RenameRequest
+	if err := decodeJSON(contentType, body, &req, true, "malformed rename JSON"); err != nil {
+		return "", err
+	}
+	return req.Name, nil
+}
+
+// Rename - troca o nome da receita e gera o ID de novo a partir dele. O
+// histórico vai junto e o ID antigo vira um apelido, que continua
+// reservado e é redirecionado para o novo (veja Alias). Um nome que gera o
+// mesmo ID é uma escrita comum. Como no Update, respeita o If-Match e
+// grava uma revisão nova
+func (s *Service) Rename(id, name string, opts WriteOptions) (recipes.Recipe, error) {
+	newID := NewID(name)
+	for {
+		current, err := s.store.Get(id)
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		if !opts.IfMatch.Match(ETag(current)) {
+			return recipes.Recipe{}, PreconditionFailedErr
+		}
+
+		recipe := current
+		recipe.Name = name
+		if err := validateNew(recipe); err != nil {
+			return recipes.Recipe{}, err
+		}
+		recipe.ID = newID
+		recipe.UpdatedAt = s.now()
+		recipe.UpdatedBy = opts.Author
+		recipe.Version = current.Version + 1
+		recipe.Allergens = s.taxonomy().Detect(recipe)
+
+		if newID == id {
+			err = s.store.CompareAndSwap(id, current.Version, recipe)
+		} else {
+			err = s.store.Rename(id, newID, current.Version, recipe)
+		}
+		if errors.Is(err, recipes.VersionMismatchErr) {
+			continue
+		}
+		if errors.Is(err, recipes.ExistsErr) {
+			return recipes.Recipe{}, &Error{Kind: KindConflict, Message: s.existsMessage(newID), Err: err}
+		}
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		s.reindex(id)
+		s.reindex(newID)
+		return recipe, nil
+	}
+}
+
+// Alias - o ID atual de uma receita renomeada, para os adaptadores
+// responderem 301 no GET do ID antigo. recipes.NotFoundErr se id nunca foi
+// o ID de uma receita renomeada
+func (s *Service) Alias(id string) (string, error) {
+	return s.store.Alias(id)
+}
+
+// MovedLocation - o endereço do redirecionamento de um ID antigo para o
+// atual, com a mesma query string (?servings=, ?units=)
+func MovedLocation(id, rawQuery string) string {
+	if rawQuery == "" {
+		return Location(id)
+	}
+	return Location(id) + "?" + rawQuery
+}
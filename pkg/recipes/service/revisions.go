@@ -0,0 +1,95 @@
+package service
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// Revisions - o histórico da receita, sem as receitas completas
+func (s *Service) Revisions(id string) ([]recipes.Revision, error) {
+	revisions, err := s.store.Revisions(id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		revisions[i].Recipe = nil
+	}
+	return revisions, nil
+}
+
+// Revision - uma revisão, com a receita como ela estava
+func (s *Service) Revision(id string, number int64) (recipes.Revision, error) {
+	revision, err := s.store.Revision(id, number)
+	if err != nil {
+		return recipes.Revision{}, err
+	}
+	revision.Recipe.ID = id
+	return revision, nil
+}
+
+// DiffRevisions - o que mudou da revisão from para a revisão to. from 0 é
+// a receita vazia, então o diff da primeira revisão mostra tudo como
+// adicionado
+func (s *Service) DiffRevisions(id string, from, to int64) (recipes.Diff, error) {
+	revision, err := s.store.Revision(id, to)
+	if err != nil {
+		return recipes.Diff{}, err
+	}
+	var before recipes.Recipe
+	if from > 0 {
+		previous, err := s.store.Revision(id, from)
+		if err != nil {
+			return recipes.Diff{}, err
+		}
+		before = *previous.Recipe
+	}
+	return recipes.DiffRecipes(before, *revision.Recipe), nil
+}
+
+// Restore - grava de novo a receita como ela estava na revisão. É uma
+// escrita como outra qualquer: gera uma revisão nova, respeita o If-Match e
+// passa pela validação atual. Uma revisão de antes de um rename tem um nome
+// que não gera mais o ID da receita; nesse caso o nome atual é mantido
+func (s *Service) Restore(id string, number int64, opts WriteOptions) (recipes.Recipe, error) {
+	revision, err := s.store.Revision(id, number)
+	if err != nil {
+		return recipes.Recipe{}, err
+	}
+	recipe := *revision.Recipe
+	recipe.ID = ""
+	if err := validateUpdate(id, recipe); err != nil {
+		return recipes.Recipe{}, err
+	}
+
+	return s.write(id, opts, func(current recipes.Recipe) (recipes.Recipe, error) {
+		restored := recipe
+		if NewID(restored.Name) != id {
+			restored.Name = current.Name
+		}
+		return restored, nil
+	})
+}
+
+// ParseRevisionNumber - o {n} de /receitas/{id}/revisions/{n}
+func ParseRevisionNumber(s string) (int64, error) {
+	number, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || number < 1 {
+		return 0, &Error{Kind: KindBadRequest, Message: "revision must be a positive integer"}
+	}
+	return number, nil
+}
+
+// DiffFromQuery - a revisão de partida do diff (?from=), por padrão a
+// anterior a to
+func DiffFromQuery(query url.Values, to int64) (int64, error) {
+	if !query.Has("from") {
+		return to - 1, nil
+	}
+	from, err := strconv.ParseInt(query.Get("from"), 10, 64)
+	if err != nil || from < 0 {
+		return 0, &Error{Kind: KindBadRequest, Message: "from must be a non-negative integer"}
+	}
+	return from, nil
+}
@@ -0,0 +1,425 @@
+// Package service - regras de negócio das receitas, compartilhadas pelos
+// servidores standardlib, gorilla/mux e gin. Os handlers de cada servidor
+// só decodificam a requisição, chamam o serviço e escrevem a resposta
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/gosimple/slug"
+)
+
+// MaxSuffix - maior sufixo tentado por Create no modo AutoSuffix
+const MaxSuffix = 100
+
+// Store - o contrato que toda loja de receitas cumpre
+type Store interface {
+	Add(name string, recipe recipes.Recipe) error
+	Get(name string) (recipes.Recipe, error)
+	List() (map[string]recipes.Recipe, error)
+	// ListPage - uma página da listagem, sem carregar as outras receitas
+	// quando a loja consegue filtrar e ordenar por conta própria
+	ListPage(opts recipes.ListOptions) (recipes.Page, error)
+	// Facets - as contagens de tags e ingredientes das receitas que passam
+	// pelos filtros de opts, sem o limite de valores
+	Facets(opts recipes.ListOptions) (recipes.Facets, error)
+	Update(name string, recipe recipes.Recipe) error
+	// CompareAndSwap - Update só se a versão gravada for version; senão
+	// devolve recipes.VersionMismatchErr
+	CompareAndSwap(name string, version int64, recipe recipes.Recipe) error
+	Remove(name string) error
+	// CompareAndDelete - Remove só se a versão gravada for version
+	CompareAndDelete(name string, version int64) error
+	// Revisions - o histórico da receita, da revisão mais antiga para a
+	// mais nova; cada escrita acrescenta uma revisão
+	Revisions(name string) ([]recipes.Revision, error)
+	// Revision - uma revisão, com a receita completa
+	Revision(name string, number int64) (recipes.Revision, error)
+	// MoveToTrash - CompareAndDelete que guarda a receita na lixeira, onde
+	// o ID continua reservado
+	MoveToTrash(name string, version int64, deletedAt time.Time) error
+	Trash() ([]recipes.TrashedRecipe, error)
+	// Untrash - devolve a receita da lixeira; NotFoundErr se ela não estiver lá
+	Untrash(name string) error
+	// Purge - apaga de vez as receitas que estão na lixeira desde antes de before
+	Purge(before time.Time) ([]string, error)
+	// Rename - CompareAndSwap que também muda o ID da receita, levando o
+	// histórico junto; from vira um apelido de to. recipes.ExistsErr se to
+	// já estiver em uso
+	Rename(from, to string, version int64, recipe recipes.Recipe) error
+	// Alias - o ID atual de uma receita renomeada; recipes.NotFoundErr se
+	// name não for um nome antigo
+	Alias(name string) (string, error)
+
+	// AddPlan - grava um plano novo; recipes.ExistsErr se o ID já estiver
+	// em uso. Os planos têm IDs próprios, separados dos das receitas
+	AddPlan(id string, plan recipes.Plan) error
+	GetPlan(id string) (recipes.Plan, error)
+	// Plans - todos os planos, pela ordem dos IDs
+	Plans() ([]recipes.Plan, error)
+	// CompareAndSwapPlan e CompareAndDeletePlan - como CompareAndSwap e
+	// CompareAndDelete, para os planos
+	CompareAndSwapPlan(id string, version int64, plan recipes.Plan) error
+	CompareAndDeletePlan(id string, version int64) error
+}
+
+// Service - Valida as receitas, gera os IDs e conversa com a loja
+type Service struct {
+	// AutoSuffix - quando true, uma receita cujo ID já existe é criada com um
+	// sufixo numérico ("torrada-2", "torrada-3", ...) em vez de responder 409
+	AutoSuffix bool
+
+	// Clock - fonte da hora gravada em created_at e updated_at; time.Now
+	// quando nil
+	Clock func() time.Time
+
+	// TrashTTL - por quanto tempo uma receita removida fica na lixeira antes
+	// de ser apagada de vez; DefaultTrashTTL quando zero
+	TrashTTL time.Duration
+
+	// Taxonomy - de onde vêm os alérgenos das receitas e as classes aceitas
+	// em exclude_allergen; recipes.DefaultTaxonomy quando nil
+	Taxonomy *recipes.Taxonomy
+
+	// Substitutions - a base usada por Substitute;
+	// recipes.DefaultSubstitutions quando nil
+	Substitutions *recipes.Substitutions
+
+	store Store
+
+	// index - índice da busca, montado na primeira busca a partir da loja e
+	// atualizado a cada Create, Update e Delete. indexMu também garante que
+	// nenhuma atualização se perca enquanto o índice é montado
+	indexMu sync.Mutex
+	index   *recipes.Index
+}
+
+func New(store Store) *Service {
+	return &Service{
+		store: store,
+	}
+}
+
+// NewID - Converte o nome da receita em uma string URL mais amigável, usada
+// como ID ("Torrada de presunto e queijo" -> "torrada-de-presunto-e-queijo")
+func NewID(name string) string {
+	return slug.Make(name)
+}
+
+// Location - caminho da receita, usado no cabeçalho Location das respostas
+func Location(id string) string {
+	return "/receitas/" + id
+}
+
+// Create - adiciona a receita e a devolve com o ID gerado a partir do nome.
+// Se o ID já existir, devolve um erro de conflito ou, no modo AutoSuffix,
+// tenta o próximo sufixo livre. Como o Add da loja falha sem sobrescrever,
+// duas criações simultâneas nunca ficam com o mesmo ID
+func (s *Service) Create(recipe recipes.Recipe, opts WriteOptions) (recipes.Recipe, error) {
+	if err := validateNew(recipe); err != nil {
+		return recipes.Recipe{}, err
+	}
+
+	recipe.CreatedAt = s.now()
+	recipe.UpdatedAt = recipe.CreatedAt
+	recipe.UpdatedBy = opts.Author
+	recipe.Version = 1
+	recipe.Allergens = s.taxonomy().Detect(recipe)
+
+	base := NewID(recipe.Name)
+	id := base
+	for n := 2; ; n++ {
+		recipe.ID = id
+		err := s.store.Add(id, recipe)
+		if err == nil {
+			s.reindex(id)
+			return recipe, nil
+		}
+		if !errors.Is(err, recipes.ExistsErr) {
+			return recipes.Recipe{}, err
+		}
+		if !s.AutoSuffix || n > MaxSuffix {
+			return recipes.Recipe{}, &Error{Kind: KindConflict, Message: s.existsMessage(id), Err: err}
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+func (s *Service) Get(id string) (recipes.Recipe, error) {
+	recipe, err := s.store.Get(id)
+	if err != nil {
+		return recipes.Recipe{}, err
+	}
+	recipe.ID = id
+	return recipe, nil
+}
+
+// View - a receita ajustada para o número de porções e o sistema de
+// medidas pedidos. A receita gravada não é alterada. Porções negativas são
+// um erro de validação
+func (s *Service) View(id string, opts ViewOptions) (recipes.Recipe, error) {
+	recipe, err := s.Get(id)
+	if err != nil {
+		return recipes.Recipe{}, err
+	}
+	if opts.Servings != 0 {
+		if recipe, err = recipe.Scale(opts.Servings); err != nil {
+			return recipes.Recipe{}, err
+		}
+	}
+	if opts.Units != "" {
+		recipe = recipe.ConvertUnits(opts.Units)
+	}
+	return recipe, nil
+}
+
+// ListPage - uma página da listagem, filtrada e ordenada pela loja
+func (s *Service) ListPage(opts recipes.ListOptions) (recipes.Page, error) {
+	opts, err := s.resolveAllergens(opts)
+	if err != nil {
+		return recipes.Page{}, err
+	}
+	return s.store.ListPage(opts)
+}
+
+// Facets - as contagens de categorias, restrições alimentares, tags e
+// ingredientes das receitas que passam pelos filtros da listagem. Cada
+// faceta traz até opts.Limit valores, dos mais frequentes para os menos
+func (s *Service) Facets(opts recipes.ListOptions) (recipes.Facets, error) {
+	opts, err := s.resolveAllergens(opts)
+	if err != nil {
+		return recipes.Facets{}, err
+	}
+	facets, err := s.store.Facets(opts)
+	if err != nil {
+		return recipes.Facets{}, err
+	}
+	return facets.Limit(opts.Limit), nil
+}
+
+func (s *Service) List() (map[string]recipes.Recipe, error) {
+	list, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for id, recipe := range list {
+		recipe.ID = id
+		list[id] = recipe
+	}
+	return list, nil
+}
+
+// Update - substitui a receita. O ID vem da URL; um "id" diferente no corpo
+// é rejeitado, porque renomear o recurso por aqui deixaria a URL antiga
+// órfã (veja Rename). Um nome novo no corpo não muda o ID.
+// Se a receita gravada não tiver uma das etiquetas do opts.IfMatch, nada é
+// alterado e o erro é PreconditionFailedErr
+func (s *Service) Update(id string, recipe recipes.Recipe, opts WriteOptions) (recipes.Recipe, error) {
+	if err := validateUpdate(id, recipe); err != nil {
+		return recipes.Recipe{}, err
+	}
+
+	return s.write(id, opts, func(recipes.Recipe) (recipes.Recipe, error) {
+		return recipe, nil
+	})
+}
+
+// Patch - aplica um merge patch ou JSON Patch à receita gravada. O
+// resultado passa pela mesma decodificação e validação de um PUT; se outra
+// escrita chegar antes, o patch é reaplicado sobre a versão nova
+func (s *Service) Patch(id string, patch Patch, opts WriteOptions) (recipes.Recipe, error) {
+	return s.write(id, opts, func(current recipes.Recipe) (recipes.Recipe, error) {
+		data, err := json.Marshal(current)
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return recipes.Recipe{}, err
+		}
+		if doc, err = patch.apply(doc); err != nil {
+			return recipes.Recipe{}, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return recipes.Recipe{}, err
+		}
+
+		recipe, err := DecodeRecipe("", bytes.NewReader(data))
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		if err := validateUpdate(id, recipe); err != nil {
+			return recipes.Recipe{}, err
+		}
+		return recipe, nil
+	})
+}
+
+// write - a escrita condicional comum a Update e Patch. change recebe a
+// receita gravada e devolve a nova; a escrita só vale se a receita ainda
+// estiver na versão lida, senão tudo é refeito sobre a versão nova, com o
+// If-Match conferido de novo
+func (s *Service) write(id string, opts WriteOptions, change func(current recipes.Recipe) (recipes.Recipe, error)) (recipes.Recipe, error) {
+	for {
+		current, err := s.store.Get(id)
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		if !opts.IfMatch.Match(ETag(current)) {
+			return recipes.Recipe{}, PreconditionFailedErr
+		}
+		current.ID = id
+		recipe, err := change(current)
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+
+		// A data de criação é a da receita gravada, não a que veio no corpo
+		recipe.ID = id
+		recipe.CreatedAt = current.CreatedAt
+		recipe.UpdatedAt = s.now()
+		recipe.UpdatedBy = opts.Author
+		recipe.Version = current.Version + 1
+		recipe.Allergens = s.taxonomy().Detect(recipe)
+		err = s.store.CompareAndSwap(id, current.Version, recipe)
+		if errors.Is(err, recipes.VersionMismatchErr) {
+			continue
+		}
+		if err != nil {
+			return recipes.Recipe{}, err
+		}
+		s.reindex(id)
+		return recipe, nil
+	}
+}
+
+// Delete - move a receita para a lixeira ou, com opts.Permanent, apaga de
+// vez, junto com o histórico. Uma receita que não existe (inclusive uma que
+// já está na lixeira) é NotFoundErr ou, com If-Match, PreconditionFailedErr
+func (s *Service) Delete(id string, opts DeleteOptions) error {
+	for {
+		current, err := s.store.Get(id)
+		if errors.Is(err, recipes.NotFoundErr) && opts.IfMatch.IsSet() {
+			return PreconditionFailedErr
+		}
+		if err != nil {
+			return err
+		}
+		if !opts.IfMatch.Match(ETag(current)) {
+			return PreconditionFailedErr
+		}
+
+		if opts.Permanent {
+			err = s.store.CompareAndDelete(id, current.Version)
+		} else {
+			err = s.store.MoveToTrash(id, current.Version, s.now())
+		}
+		if errors.Is(err, recipes.VersionMismatchErr) || errors.Is(err, recipes.NotFoundErr) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.reindex(id)
+		return nil
+	}
+}
+
+// Search - busca textual nos nomes, ingredientes e passos das receitas
+func (s *Service) Search(req SearchRequest) (recipes.SearchResults, error) {
+	index, err := s.searchIndex()
+	if err != nil {
+		return recipes.SearchResults{}, err
+	}
+	return index.Search(req.Query, req.Limit), nil
+}
+
+// searchIndex - o índice da busca, montado com as receitas da loja na
+// primeira chamada
+func (s *Service) searchIndex() (*recipes.Index, error) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if s.index == nil {
+		list, err := s.store.List()
+		if err != nil {
+			return nil, err
+		}
+		s.index = recipes.BuildIndex(list)
+	}
+	return s.index, nil
+}
+
+// reindex - atualiza a receita no índice, se ele já foi montado. A receita
+// é relida da loja para que duas escritas simultâneas não deixem no índice
+// a versão mais antiga; se a leitura falhar, o índice é descartado e
+// remontado na próxima busca
+func (s *Service) reindex(id string) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	if s.index == nil {
+		return
+	}
+	recipe, err := s.store.Get(id)
+	switch {
+	case errors.Is(err, recipes.NotFoundErr):
+		s.index.Remove(id)
+	case err != nil:
+		s.index = nil
+	default:
+		s.index.Put(id, recipe)
+	}
+}
+
+// Match - Ordena as receitas pelos ingredientes da despensa
+func (s *Service) Match(req MatchRequest) (recipes.Matches, error) {
+	matcher := recipes.NewMatcher()
+	if req.MaxMissing != nil {
+		matcher.MaxMissing = *req.MaxMissing
+	}
+	// O próprio serviço é o Lister, para que as receitas venham com o ID
+	return matcher.MatchFrom(s, req.Pantry)
+}
+
+// now - a hora atual em UTC, sem a leitura do relógio monotônico, para que
+// a receita devolvida seja igual à que a loja devolve depois
+func (s *Service) now() time.Time {
+	clock := s.Clock
+	if clock == nil {
+		clock = time.Now
+	}
+	return clock().UTC().Round(0)
+}
+
+// validate - as regras ficam em recipes.Validate; um nome que vira um slug
+// vazio, por exemplo, geraria uma receita impossível de acessar pela URL
+func validate(recipe recipes.Recipe) error {
+	return recipes.Validate(recipe)
+}
+
+// validateNew - validate, mais o ID gerado a partir do nome, que não pode
+// ser reservado por uma rota (veja recipes.IsReservedID). Só a criação e o
+// rename geram um ID; PUT e PATCH mantêm o da URL
+func validateNew(recipe recipes.Recipe) error {
+	if id := NewID(recipe.Name); recipes.IsReservedID(id) {
+		invalid := &recipes.ValidationError{}
+		invalid.Add("name", fmt.Sprintf("must not generate the reserved ID %q", id))
+		return invalid
+	}
+	return validate(recipe)
+}
+
+// validateUpdate - validate, mais o ID: vazio ou igual ao da URL
+func validateUpdate(id string, recipe recipes.Recipe) error {
+	if recipe.ID != "" && recipe.ID != id {
+		invalid := &recipes.ValidationError{}
+		invalid.Add("id", "must match the recipe ID in the URL")
+		return invalid
+	}
+	return validate(recipe)
+}
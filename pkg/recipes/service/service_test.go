@@ -0,0 +1,1300 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getTorrada() recipes.Recipe {
+	return recipes.Recipe{
+		Name: "Torrada de presunto e queijo",
+		Ingredients: []recipes.Ingredient{
+			{Name: "pão"},
+			{Name: "presunto"},
+			{Name: "queijo"},
+		},
+	}
+}
+
+func TestService_Create(t *testing.T) {
+	tests := []struct {
+		name     string
+		recipe   recipes.Recipe
+		wantID   string
+		wantKind Kind
+		wantErr  bool
+	}{
+		{
+			name:   "Slug from name",
+			recipe: getTorrada(),
+			wantID: "torrada-de-presunto-e-queijo",
+		},
+		{
+			name:     "Empty name",
+			recipe:   recipes.Recipe{Ingredients: getTorrada().Ingredients},
+			wantKind: KindInvalid,
+			wantErr:  true,
+		},
+		{
+			name:     "Name without letters or digits",
+			recipe:   recipes.Recipe{Name: "!!!", Ingredients: getTorrada().Ingredients},
+			wantKind: KindInvalid,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := recipes.NewMemStore()
+			created, err := New(store).Create(tt.recipe, WriteOptions{})
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantKind, Classify(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, created.ID)
+
+			got, err := store.Get(created.ID)
+			require.NoError(t, err)
+			assert.Equal(t, created, got)
+		})
+	}
+}
+
+func TestService_CreateCollision(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoSuffix bool
+		wantIDs    []string
+	}{
+		{
+			name:    "Conflict",
+			wantIDs: []string{"torrada-de-presunto-e-queijo", "", ""},
+		},
+		{
+			name:       "Auto suffix",
+			autoSuffix: true,
+			wantIDs:    []string{"torrada-de-presunto-e-queijo", "torrada-de-presunto-e-queijo-2", "torrada-de-presunto-e-queijo-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := recipes.NewMemStore()
+			svc := New(store)
+			svc.AutoSuffix = tt.autoSuffix
+
+			for _, wantID := range tt.wantIDs {
+				created, err := svc.Create(getTorrada(), WriteOptions{})
+				if wantID == "" {
+					assert.Equal(t, KindConflict, Classify(err))
+					continue
+				}
+				require.NoError(t, err)
+				assert.Equal(t, wantID, created.ID)
+			}
+
+			// A primeira receita nunca é sobrescrita
+			got, err := svc.Get("torrada-de-presunto-e-queijo")
+			require.NoError(t, err)
+			assert.Equal(t, "torrada-de-presunto-e-queijo", got.ID)
+		})
+	}
+}
+
+func TestService_CreateAutoSuffixLimit(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	svc.AutoSuffix = true
+
+	for i := 1; i <= MaxSuffix; i++ {
+		_, err := svc.Create(getTorrada(), WriteOptions{})
+		require.NoError(t, err)
+	}
+	_, err := svc.Create(getTorrada(), WriteOptions{})
+	assert.Equal(t, KindConflict, Classify(err))
+}
+
+func TestService_Timestamps(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := New(recipes.NewMemStore())
+	svc.Clock = func() time.Time { return now }
+
+	// Datas enviadas pelo cliente são ignoradas
+	torrada := getTorrada()
+	torrada.CreatedAt = time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)
+	created, err := svc.Create(torrada, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, now, created.CreatedAt)
+	assert.Equal(t, now, created.UpdatedAt)
+
+	now = now.Add(time.Hour)
+	updated, err := svc.Update(created.ID, torrada, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.Equal(t, now, updated.UpdatedAt)
+
+	got, err := svc.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, updated, got)
+}
+
+func TestService_IfMatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc := New(recipes.NewMemStore())
+	svc.Clock = func() time.Time { return now }
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), created.Version)
+	assert.Equal(t, `"1-1714564800000000000"`, ETag(created))
+
+	stale := ParseCondition([]string{`"0"`})
+	_, err = svc.Update(created.ID, getTorrada(), WriteOptions{IfMatch: stale})
+	assert.ErrorIs(t, err, PreconditionFailedErr)
+	assert.Equal(t, http.StatusPreconditionFailed, StatusCode(err))
+
+	// A versão sozinha não basta
+	_, err = svc.Update(created.ID, getTorrada(), WriteOptions{IfMatch: ParseCondition([]string{`"1"`})})
+	assert.ErrorIs(t, err, PreconditionFailedErr)
+
+	updated, err := svc.Update(created.ID, getTorrada(), WriteOptions{IfMatch: ParseCondition([]string{`"7", ` + ETag(created)})})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// O If-Match da primeira versão não vale mais
+	assert.ErrorIs(t, svc.Delete(created.ID, DeleteOptions{WriteOptions: WriteOptions{IfMatch: ParseCondition([]string{ETag(created)})}}), PreconditionFailedErr)
+	assert.ErrorIs(t, svc.Delete("ratatouille", DeleteOptions{WriteOptions: WriteOptions{IfMatch: ParseCondition([]string{"*"})}}), PreconditionFailedErr)
+	require.NoError(t, svc.Delete(created.ID, DeleteOptions{Permanent: true, WriteOptions: WriteOptions{IfMatch: ParseCondition([]string{ETag(updated)})}}))
+	_, err = svc.Get(created.ID)
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+
+	// Criada de novo, a receita volta à versão 1 com outra etiqueta
+	now = now.Add(time.Minute)
+	recreated, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, recreated.ID)
+	assert.Equal(t, int64(1), recreated.Version)
+	assert.NotEqual(t, ETag(created), ETag(recreated))
+	_, err = svc.Update(created.ID, getTorrada(), WriteOptions{IfMatch: ParseCondition([]string{ETag(created)})})
+	assert.ErrorIs(t, err, PreconditionFailedErr)
+}
+
+// TestService_ConcurrentIfMatch - de várias escritas com o mesmo If-Match,
+// só uma passa
+func TestService_ConcurrentIfMatch(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var ok, failed int
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Update(created.ID, getTorrada(), WriteOptions{IfMatch: ParseCondition([]string{ETag(created)})})
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, PreconditionFailedErr) {
+				failed++
+			} else if assert.NoError(t, err) {
+				ok++
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, ok)
+	assert.Equal(t, writers-1, failed)
+
+	// Sem If-Match nenhuma escrita se perde: a versão conta todas
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Update(created.ID, getTorrada(), WriteOptions{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	got, err := svc.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2+writers), got.Version)
+}
+
+func TestCondition(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        []string
+		etag          string
+		wantMatch     bool
+		wantNoneMatch bool
+	}{
+		{name: "No header", etag: `"1"`, wantMatch: true, wantNoneMatch: true},
+		{name: "Same tag", header: []string{`"1"`}, etag: `"1"`, wantMatch: true, wantNoneMatch: false},
+		{name: "Other tag", header: []string{`"2"`}, etag: `"1"`, wantMatch: false, wantNoneMatch: true},
+		{name: "List", header: []string{`"2", "1"`}, etag: `"1"`, wantMatch: true, wantNoneMatch: false},
+		{name: "Repeated header", header: []string{`"2"`, `"1"`}, etag: `"1"`, wantMatch: true, wantNoneMatch: false},
+		{name: "Weak tag", header: []string{`W/"1"`}, etag: `"1"`, wantMatch: false, wantNoneMatch: false},
+		{name: "Any", header: []string{"*"}, etag: `"1"`, wantMatch: true, wantNoneMatch: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ParseCondition(tt.header)
+			assert.Equal(t, tt.header != nil, c.IsSet())
+			assert.Equal(t, tt.wantMatch, c.Match(tt.etag))
+			assert.Equal(t, tt.wantNoneMatch, c.NoneMatch(tt.etag))
+		})
+	}
+}
+
+func TestViewETag(t *testing.T) {
+	recipe := recipes.Recipe{Version: 3, CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	assert.Equal(t, `"3-1714564800000000000"`, ETag(recipe))
+	assert.Equal(t, ETag(recipe), ViewETag(recipe, ViewOptions{}))
+	assert.Equal(t, `"3-1714564800000000000;servings=4;units=metric"`, ViewETag(recipe, ViewOptions{Servings: 4, Units: recipes.Metric}))
+}
+
+func TestService_UpdateNotFound(t *testing.T) {
+	_, err := New(recipes.NewMemStore()).Update("ratatouille", getTorrada(), WriteOptions{})
+	assert.Equal(t, KindNotFound, Classify(err))
+	assert.Equal(t, http.StatusNotFound, StatusCode(err))
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "Not found from store", err: recipes.NotFoundErr, want: http.StatusNotFound},
+		{name: "Wrapped not found", err: errors.Join(errors.New("context"), recipes.NotFoundErr), want: http.StatusNotFound},
+		{name: "Bad request", err: &Error{Kind: KindBadRequest, Message: "bad"}, want: http.StatusBadRequest},
+		{name: "Invalid", err: &Error{Kind: KindInvalid, Message: "invalid"}, want: http.StatusUnprocessableEntity},
+		{name: "Validation", err: &recipes.ValidationError{}, want: http.StatusUnprocessableEntity},
+		{name: "No servings to scale from", err: recipes.NoServingsErr, want: http.StatusUnprocessableEntity},
+		{name: "Conflict", err: recipes.ExistsErr, want: http.StatusConflict},
+		{name: "Unsupported media type", err: &Error{Kind: KindUnsupportedMediaType}, want: http.StatusUnsupportedMediaType},
+		{name: "Not acceptable", err: &Error{Kind: KindNotAcceptable}, want: http.StatusNotAcceptable},
+		{name: "Unknown", err: errors.New("disk on fire"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, StatusCode(tt.err))
+		})
+	}
+}
+
+func TestService_View_InvalidServings(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	created, err := svc.Create(recipes.Recipe{Name: "Omelete", Servings: 1, Ingredients: []recipes.Ingredient{{Name: "ovos", Quantity: 2}}}, WriteOptions{})
+	require.NoError(t, err)
+
+	// Quem chama View sem passar por ViewOptionsFromQuery recebe um erro do
+	// cliente, não um 500
+	for _, servings := range []int{-1, -10} {
+		_, err := svc.View(created.ID, ViewOptions{Servings: servings})
+		var validationErr *recipes.ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, []recipes.FieldError{{Field: "servings", Message: "must be positive"}}, validationErr.Errors)
+
+		w := httptest.NewRecorder()
+		WriteError(w, httptest.NewRequest(http.MethodGet, "/receitas/omelete", nil), err)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Problem
+	}{
+		{
+			name: "Internal errors are hidden",
+			err:  errors.New("disk on fire"),
+			want: Problem{Type: "about:blank", Title: "Internal Server Error", Status: 500, Instance: "/receitas"},
+		},
+		{
+			name: "Not found",
+			err:  recipes.NotFoundErr,
+			want: Problem{Type: "/problems/not-found", Title: "Not Found", Status: 404, Detail: "not found", Instance: "/receitas"},
+		},
+		{
+			name: "Conflict",
+			err:  recipes.ExistsErr,
+			want: Problem{Type: "/problems/conflict", Title: "Conflict", Status: 409, Detail: "already exists", Instance: "/receitas"},
+		},
+		{
+			name: "Validation",
+			err:  &recipes.ValidationError{Errors: []recipes.FieldError{{Field: "name", Message: "is required"}}},
+			want: Problem{
+				Type:     "/problems/validation",
+				Title:    "Unprocessable Entity",
+				Status:   422,
+				Detail:   "recipe failed validation",
+				Instance: "/receitas",
+				Errors:   []recipes.FieldError{{Field: "name", Message: "is required"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewProblem(tt.err, "/receitas"))
+		})
+	}
+}
+
+func TestDecodeRecipe(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantKind    Kind
+	}{
+		{name: "Malformed", contentType: "application/json", body: `{"name": `, wantKind: KindBadRequest},
+		{name: "Not an object", contentType: "application/json", body: `[]`, wantKind: KindBadRequest},
+		{name: "Wrong field type", contentType: "application/json", body: `{"name": 1}`, wantKind: KindInvalid},
+		{name: "Unsupported content type", contentType: "text/plain", body: `{}`, wantKind: KindUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeRecipe(tt.contentType, strings.NewReader(tt.body))
+			assert.Equal(t, tt.wantKind, Classify(err))
+		})
+	}
+
+	recipe, err := DecodeRecipe("", strings.NewReader(`{"name": "Torrada"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "Torrada", recipe.Name)
+}
+
+func TestDecodeRecipe_Ingredients(t *testing.T) {
+	recipe, err := DecodeRecipe("application/json", strings.NewReader(`{
+		"name": "Torrada",
+		"ingredients": [
+			{"name": "pão"},
+			"2 colheres de sopa de manteiga",
+			{"name": "queijo", "quantity": 100, "unit": "gramas", "note": "ralado", "optional": true}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.Ingredient{
+		{Name: "pão"},
+		{Name: "manteiga", Quantity: 2, Unit: recipes.UnitTablespoon},
+		{Name: "queijo", Quantity: 100, Unit: recipes.UnitGram, Note: "ralado", Optional: true},
+	}, recipe.Ingredients)
+
+	_, err = DecodeRecipe("application/json", strings.NewReader(`{
+		"name": "Torrada",
+		"ingredients": [{"name": "pão", "quantity": "duas"}, 3, {"nome": "queijo"}]
+	}`))
+	var invalid *recipes.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "ingredients[0].quantity", Message: "must be a number"},
+		{Field: "ingredients[1]", Message: "must be an object or a string"},
+		{Field: "ingredients[2].nome", Message: "unknown field"},
+	}, invalid.Errors)
+}
+
+func TestDecodeRecipe_Steps(t *testing.T) {
+	recipe, err := DecodeRecipe("application/json", strings.NewReader(`{
+		"name": "Torrada",
+		"ingredients": ["pão"],
+		"steps": [
+			{"text": "Toste o pão", "ingredients": ["pão"], "timer": "PT3M"},
+			{"text": "Sirva"}
+		],
+		"total_time": "PT5M",
+		"active_time": null,
+		"yield": "1 torrada",
+		"difficulty": "easy"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.Step{
+		{Text: "Toste o pão", Ingredients: []string{"pão"}, Timer: recipes.Duration(3 * time.Minute)},
+		{Text: "Sirva"},
+	}, recipe.Steps)
+	assert.Equal(t, recipes.Duration(5*time.Minute), recipe.TotalTime)
+	assert.Zero(t, recipe.ActiveTime)
+	assert.Equal(t, "1 torrada", recipe.Yield)
+	assert.Equal(t, recipes.DifficultyEasy, recipe.Difficulty)
+
+	_, err = DecodeRecipe("application/json", strings.NewReader(`{
+		"name": "Torrada",
+		"ingredients": ["pão"],
+		"steps": ["Toste o pão", {"text": "Sirva", "timer": 180}, {"texto": "Coma"}],
+		"total_time": "1h"
+	}`))
+	var invalid *recipes.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "steps[0]", Message: "must be an object"},
+		{Field: "steps[1].timer", Message: `must be an ISO-8601 duration such as "PT1H30M"`},
+		{Field: "steps[2].texto", Message: "unknown field"},
+		{Field: "total_time", Message: `must be an ISO-8601 duration such as "PT1H30M"`},
+	}, invalid.Errors)
+}
+
+func TestMatchRequestFromQuery(t *testing.T) {
+	req, err := MatchRequestFromQuery(url.Values{"have": {"pão, queijo"}, "max_missing": {"1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pão", "queijo"}, req.Pantry)
+	require.NotNil(t, req.MaxMissing)
+	assert.Equal(t, 1, *req.MaxMissing)
+
+	_, err = MatchRequestFromQuery(url.Values{"max_missing": {"um"}})
+	assert.Equal(t, KindBadRequest, Classify(err))
+}
+
+func TestSearchRequestFromQuery(t *testing.T) {
+	req, err := SearchRequestFromQuery(url.Values{"q": {" pão de queijo "}})
+	require.NoError(t, err)
+	assert.Equal(t, SearchRequest{Query: "pão de queijo", Limit: recipes.DefaultSearchLimit}, req)
+
+	req, err = SearchRequestFromQuery(url.Values{"q": {"bolo"}, "limit": {"5"}})
+	require.NoError(t, err)
+	assert.Equal(t, 5, req.Limit)
+
+	for _, query := range []url.Values{
+		{},
+		{"q": {"  "}},
+		{"q": {"bolo"}, "limit": {"cinco"}},
+		{"q": {"bolo"}, "limit": {"101"}},
+	} {
+		_, err := SearchRequestFromQuery(query)
+		assert.Equal(t, KindBadRequest, Classify(err), query.Encode())
+	}
+}
+
+func TestListOptionsFromQuery(t *testing.T) {
+	opts, err := ListOptionsFromQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.ListOptions{Sort: recipes.SortByName, Limit: recipes.DefaultPageSize}, opts)
+
+	opts, err = ListOptionsFromQuery(url.Values{
+		"sort":               {"-updated"},
+		"limit":              {"5"},
+		"ingredient":         {"pão, queijo", "presunto"},
+		"exclude_ingredient": {"leite"},
+		"tag":                {"lanche"},
+		"exclude_allergen":   {"gluten,lactose"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.ListOptions{
+		Sort:               recipes.SortByUpdated,
+		Desc:               true,
+		Limit:              5,
+		Ingredients:        []string{"pão", "queijo", "presunto"},
+		ExcludeIngredients: []string{"leite"},
+		Tags:               []string{"lanche"},
+		ExcludeAllergens:   []string{"gluten", "lactose"},
+	}, opts)
+
+	// Sem sort, vale a ordenação do cursor
+	cursor := recipes.Cursor{Sort: recipes.SortByCreated, Desc: true, Key: "1", ID: "torrada"}
+	opts, err = ListOptionsFromQuery(url.Values{"cursor": {cursor.Encode()}})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.SortByCreated, opts.Sort)
+	assert.True(t, opts.Desc)
+	assert.Equal(t, &cursor, opts.Cursor)
+
+	for _, query := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"101"}},
+		{"sort": {"calorias"}},
+		{"cursor": {"???"}},
+		{"cursor": {cursor.Encode()}, "sort": {"name"}},
+		{"ingredient": {"!!"}},
+	} {
+		_, err := ListOptionsFromQuery(query)
+		assert.Equal(t, KindBadRequest, Classify(err), query.Encode())
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	u, err := url.Parse("/receitas?limit=2&tag=doce&cursor=antigo")
+	require.NoError(t, err)
+	next := &recipes.Cursor{Sort: recipes.SortByName, Key: "b", ID: "b"}
+	prev := &recipes.Cursor{Sort: recipes.SortByName, Key: "a", ID: "a", Before: true}
+
+	assert.Equal(t, "", LinkHeader(u, recipes.Page{}))
+	assert.Equal(t,
+		`</receitas?cursor=`+next.Encode()+`&limit=2&tag=doce>; rel="next", </receitas?cursor=`+prev.Encode()+`&limit=2&tag=doce>; rel="prev"`,
+		LinkHeader(u, recipes.Page{Next: next, Prev: prev}))
+}
+
+func TestViewOptionsFromQuery(t *testing.T) {
+	opts, err := ViewOptionsFromQuery(url.Values{"servings": {"4"}, "units": {"métrico"}})
+	require.NoError(t, err)
+	assert.Equal(t, ViewOptions{Servings: 4, Units: recipes.Metric}, opts)
+
+	opts, err = ViewOptionsFromQuery(url.Values{})
+	require.NoError(t, err)
+	assert.Equal(t, ViewOptions{}, opts)
+
+	for _, query := range []url.Values{
+		{"servings": {"quatro"}},
+		{"servings": {"-1"}},
+		{"units": {"furlongs"}},
+	} {
+		_, err := ViewOptionsFromQuery(query)
+		assert.Equal(t, KindBadRequest, Classify(err), query.Encode())
+	}
+}
+
+func TestDecodePatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantKind    Kind
+		wantErrors  []recipes.FieldError
+	}{
+		{name: "Merge patch", contentType: MergePatchContentType, body: `{"servings": 4}`},
+		{name: "Merge patch with charset", contentType: MergePatchContentType + "; charset=utf-8", body: `{"servings": null}`},
+		{name: "JSON patch", contentType: JSONPatchContentType, body: `[{"op": "add", "path": "/tags/-", "value": "lanche", "comment": "ignorado"}]`},
+		{name: "Plain JSON", contentType: "application/json", body: `{"servings": 4}`, wantKind: KindUnsupportedMediaType},
+		{name: "No content type", body: `{"servings": 4}`, wantKind: KindUnsupportedMediaType},
+		{name: "Merge patch that is not an object", contentType: MergePatchContentType, body: `[]`, wantKind: KindBadRequest},
+		{name: "JSON patch that is not an array", contentType: JSONPatchContentType, body: `{"op": "add"}`, wantKind: KindBadRequest},
+		{
+			name:        "Invalid operations",
+			contentType: JSONPatchContentType,
+			body: `[
+				{"op": "delete", "path": "/name"},
+				{"op": "add", "path": "name", "value": 1},
+				{"op": "replace", "path": "/name"},
+				{"op": "move", "path": "/name"},
+				{"op": "test", "path": "/servings", "value": null}
+			]`,
+			wantKind: KindInvalid,
+			wantErrors: []recipes.FieldError{
+				{Field: "[0].op", Message: "must be one of add, remove, replace, move, copy, test"},
+				{Field: "[1].path", Message: "must be a JSON pointer starting with /"},
+				{Field: "[2].value", Message: "is required"},
+				{Field: "[3].from", Message: "is required"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodePatch(tt.contentType, strings.NewReader(tt.body))
+			if tt.wantKind == KindInternal {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantKind, Classify(err))
+			if tt.wantErrors != nil {
+				var invalid *recipes.ValidationError
+				require.ErrorAs(t, err, &invalid)
+				assert.Equal(t, tt.wantErrors, invalid.Errors)
+			}
+		})
+	}
+}
+
+// TestPatch_Apply - os exemplos do apêndice A da RFC 6902 e da seção 3 da
+// RFC 7386
+func TestPatch_Apply(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		doc         string
+		patch       string
+		want        string
+		wantErr     string
+	}{
+		{name: "Add object member", contentType: JSONPatchContentType, doc: `{"foo": "bar"}`, patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`, want: `{"baz": "qux", "foo": "bar"}`},
+		{name: "Add array element", contentType: JSONPatchContentType, doc: `{"foo": ["bar", "baz"]}`, patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`, want: `{"foo": ["bar", "qux", "baz"]}`},
+		{name: "Append to array", contentType: JSONPatchContentType, doc: `{"foo": ["bar"]}`, patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`, want: `{"foo": ["bar", ["abc", "def"]]}`},
+		{name: "Remove array element", contentType: JSONPatchContentType, doc: `{"foo": ["bar", "qux", "baz"]}`, patch: `[{"op": "remove", "path": "/foo/1"}]`, want: `{"foo": ["bar", "baz"]}`},
+		{name: "Replace", contentType: JSONPatchContentType, doc: `{"baz": "qux", "foo": "bar"}`, patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`, want: `{"baz": "boo", "foo": "bar"}`},
+		{name: "Move value", contentType: JSONPatchContentType, doc: `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`, patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`, want: `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`},
+		{name: "Move array element", contentType: JSONPatchContentType, doc: `{"foo": ["all", "grass", "cows", "eat"]}`, patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`, want: `{"foo": ["all", "cows", "eat", "grass"]}`},
+		{name: "Copy", contentType: JSONPatchContentType, doc: `{"a": {"b": 1}}`, patch: `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`, want: `{"a": {"b": 1}, "c": {"b": 2}}`},
+		{name: "Escaped pointer", contentType: JSONPatchContentType, doc: `{"/": 9, "~1": 10}`, patch: `[{"op": "test", "path": "/~01", "value": 10}, {"op": "remove", "path": "/~1"}]`, want: `{"~1": 10}`},
+		{name: "Test fails", contentType: JSONPatchContentType, doc: `{"baz": "qux"}`, patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`, wantErr: `cannot apply patch: operation 0 (test): value at "/baz" does not match`},
+		{name: "Missing target", contentType: JSONPatchContentType, doc: `{"foo": "bar"}`, patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`, wantErr: `cannot apply patch: operation 0 (add): path "/baz" does not exist`},
+		{name: "Array index out of range", contentType: JSONPatchContentType, doc: `{"foo": ["bar"]}`, patch: `[{"op": "remove", "path": "/foo/1"}]`, wantErr: `cannot apply patch: operation 0 (remove): path "/foo/1" does not exist`},
+		{name: "Move into itself", contentType: JSONPatchContentType, doc: `{"a": {"b": 1}}`, patch: `[{"op": "move", "from": "/a", "path": "/a/b"}]`, wantErr: `cannot apply patch: operation 0 (move): cannot move "/a" into itself`},
+		{name: "Merge", contentType: MergePatchContentType, doc: `{"a": "b", "c": {"d": "e", "f": "g"}}`, patch: `{"a": "z", "c": {"f": null}}`, want: `{"a": "z", "c": {"d": "e"}}`},
+		{name: "Merge replaces arrays", contentType: MergePatchContentType, doc: `{"a": ["b"]}`, patch: `{"a": ["c", "d"], "e": {"f": 1}}`, want: `{"a": ["c", "d"], "e": {"f": 1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := DecodePatch(tt.contentType, strings.NewReader(tt.patch))
+			require.NoError(t, err)
+			var doc interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.doc), &doc))
+
+			got, err := patch.apply(doc)
+			if tt.wantErr != "" {
+				assert.Equal(t, KindConflict, Classify(err))
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			data, err := json.Marshal(got)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestService_Patch(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+
+	patch, err := DecodePatch(JSONPatchContentType, strings.NewReader(`[
+		{"op": "test", "path": "/ingredients/0/name", "value": "pão"},
+		{"op": "add", "path": "/ingredients/-", "value": "1 colher de sopa de manteiga"}
+	]`))
+	require.NoError(t, err)
+	patched, err := svc.Patch(created.ID, patch, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.Ingredient{Name: "manteiga", Quantity: 1, Unit: recipes.UnitTablespoon}, patched.Ingredients[len(patched.Ingredients)-1])
+	assert.Equal(t, int64(2), patched.Version)
+	assert.Equal(t, created.CreatedAt, patched.CreatedAt)
+
+	// O resultado passa pela validação e nada é gravado
+	patch, err = DecodePatch(MergePatchContentType, strings.NewReader(`{"name": null, "id": "outra"}`))
+	require.NoError(t, err)
+	_, err = svc.Patch(created.ID, patch, WriteOptions{})
+	var invalid *recipes.ValidationError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, []recipes.FieldError{{Field: "id", Message: "must match the recipe ID in the URL"}}, invalid.Errors)
+
+	got, err := svc.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, patched, got)
+
+	_, err = svc.Patch("ratatouille", patch, WriteOptions{})
+	assert.Equal(t, KindNotFound, Classify(err))
+}
+
+func TestWriteOptionsFromHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set("From", "  ana@example.com ")
+	header.Add("If-Match", `"3"`)
+	opts, err := WriteOptionsFromHeader(header)
+	require.NoError(t, err)
+	assert.Equal(t, "ana@example.com", opts.Author)
+	assert.True(t, opts.IfMatch.Match(`"3"`))
+
+	for _, from := range []string{strings.Repeat("a", MaxAuthorLength+1), "ana\x7f"} {
+		header.Set("From", from)
+		_, err := WriteOptionsFromHeader(header)
+		assert.Equal(t, http.StatusBadRequest, StatusCode(err), from)
+	}
+}
+
+func TestService_Revisions(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := New(recipes.NewMemStore())
+	svc.Clock = func() time.Time { return now }
+
+	created, err := svc.Create(getTorrada(), WriteOptions{Author: "ana"})
+	require.NoError(t, err)
+	assert.Equal(t, "ana", created.UpdatedBy)
+
+	now = now.Add(time.Hour)
+	torrada := getTorrada()
+	torrada.Ingredients = append(torrada.Ingredients, recipes.Ingredient{Name: "tomate"})
+	updated, err := svc.Update(created.ID, torrada, WriteOptions{Author: "bia"})
+	require.NoError(t, err)
+
+	revisions, err := svc.Revisions(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.Revision{
+		{Number: 1, Author: "ana", CreatedAt: created.CreatedAt},
+		{Number: 2, Author: "bia", CreatedAt: now},
+	}, revisions)
+
+	revision, err := svc.Revision(created.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, created, *revision.Recipe)
+
+	diff, err := svc.DiffRevisions(created.ID, 1, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.Ingredient{{Name: "tomate"}}, diff.Ingredients.Added)
+	diff, err = svc.DiffRevisions(created.ID, 0, 1)
+	require.NoError(t, err)
+	assert.Len(t, diff.Ingredients.Added, 3)
+	_, err = svc.DiffRevisions(created.ID, 3, 2)
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+
+	// Restaurar é uma escrita: gera a revisão 3, com o conteúdo da 1
+	_, err = svc.Restore(created.ID, 1, WriteOptions{IfMatch: ParseCondition([]string{ETag(created)})})
+	assert.ErrorIs(t, err, PreconditionFailedErr)
+	restored, err := svc.Restore(created.ID, 1, WriteOptions{Author: "caio", IfMatch: ParseCondition([]string{ETag(updated)})})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), restored.Version)
+	assert.Equal(t, "caio", restored.UpdatedBy)
+	assert.Equal(t, created.Ingredients, restored.Ingredients)
+	assert.Equal(t, created.CreatedAt, restored.CreatedAt)
+
+	_, err = svc.Restore(created.ID, 9, WriteOptions{})
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+	_, err = svc.Revisions("ratatouille")
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+}
+
+func TestParseRevisionNumber(t *testing.T) {
+	n, err := ParseRevisionNumber("12")
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), n)
+	for _, s := range []string{"0", "-1", "abc", ""} {
+		_, err := ParseRevisionNumber(s)
+		assert.Equal(t, http.StatusBadRequest, StatusCode(err), s)
+	}
+
+	from, err := DiffFromQuery(url.Values{}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), from)
+	from, err = DiffFromQuery(url.Values{"from": {"0"}}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), from)
+	_, err = DiffFromQuery(url.Values{"from": {"-1"}}, 3)
+	assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+}
+
+func TestDeleteOptionsFromRequest(t *testing.T) {
+	opts, err := DeleteOptionsFromRequest(url.Values{"permanent": {"true"}}, http.Header{"If-Match": {`"2"`}})
+	require.NoError(t, err)
+	assert.True(t, opts.Permanent)
+	assert.True(t, opts.IfMatch.Match(`"2"`))
+
+	opts, err = DeleteOptionsFromRequest(url.Values{}, http.Header{})
+	require.NoError(t, err)
+	assert.False(t, opts.Permanent)
+
+	_, err = DeleteOptionsFromRequest(url.Values{"permanent": {"sim"}}, http.Header{})
+	assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+}
+
+func TestService_Trash(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := New(recipes.NewMemStore())
+	svc.Clock = func() time.Time { return now }
+	svc.TrashTTL = 24 * time.Hour
+
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	results, err := svc.Search(SearchRequest{Query: "presunto"})
+	require.NoError(t, err)
+	require.Len(t, results.Results, 1)
+
+	assert.ErrorIs(t, svc.Delete("ratatouille", DeleteOptions{}), recipes.NotFoundErr)
+	require.NoError(t, svc.Delete(created.ID, DeleteOptions{}))
+	assert.ErrorIs(t, svc.Delete(created.ID, DeleteOptions{}), recipes.NotFoundErr)
+
+	// Na lixeira, a receita some da busca e o ID continua reservado
+	results, err = svc.Search(SearchRequest{Query: "presunto"})
+	require.NoError(t, err)
+	assert.Empty(t, results.Results)
+	_, err = svc.Create(getTorrada(), WriteOptions{})
+	assert.Equal(t, http.StatusConflict, StatusCode(err))
+	assert.EqualError(t, err, `recipe "torrada-de-presunto-e-queijo" is in the trash: already exists`)
+
+	trash, err := svc.Trash()
+	require.NoError(t, err)
+	require.Len(t, trash, 1)
+	assert.Equal(t, now, trash[0].DeletedAt)
+	assert.Equal(t, now.Add(24*time.Hour), trash[0].PurgeAt)
+
+	restored, err := svc.Untrash(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, restored)
+	results, err = svc.Search(SearchRequest{Query: "presunto"})
+	require.NoError(t, err)
+	assert.Len(t, results.Results, 1)
+
+	// A limpeza só apaga o que passou do prazo
+	require.NoError(t, svc.Delete(created.ID, DeleteOptions{}))
+	now = now.Add(24 * time.Hour)
+	purged, err := svc.PurgeTrash()
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+	now = now.Add(time.Second)
+	purged, err = svc.PurgeTrash()
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = svc.Untrash(created.ID)
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+
+	// Apagar de vez não passa pela lixeira
+	created, err = svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	require.NoError(t, svc.Delete(created.ID, DeleteOptions{Permanent: true}))
+	trash, err = svc.Trash()
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+}
+
+func TestService_RunPurge(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	svc.TrashTTL = 10 * time.Millisecond
+
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	require.NoError(t, svc.Delete(created.ID, DeleteOptions{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.RunPurge(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		trash, err := svc.Trash()
+		return err == nil && len(trash) == 0
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func TestService_Rename(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+
+	created, err := svc.Create(getTorrada(), WriteOptions{})
+	require.NoError(t, err)
+	_, err = svc.Create(recipes.Recipe{Name: "Misto quente", Ingredients: []recipes.Ingredient{{Name: "pão"}}}, WriteOptions{})
+	require.NoError(t, err)
+
+	renamed, err := svc.Rename(created.ID, "Torrada de presunto, queijo e tomate", WriteOptions{Author: "ana", IfMatch: ParseCondition([]string{ETag(created)})})
+	require.NoError(t, err)
+	assert.Equal(t, "torrada-de-presunto-queijo-e-tomate", renamed.ID)
+	assert.Equal(t, "Torrada de presunto, queijo e tomate", renamed.Name)
+	assert.Equal(t, int64(2), renamed.Version)
+	assert.Equal(t, "ana", renamed.UpdatedBy)
+	assert.Equal(t, created.CreatedAt, renamed.CreatedAt)
+
+	got, err := svc.Get(renamed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, renamed, got)
+	_, err = svc.Get(created.ID)
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+	to, err := svc.Alias(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, renamed.ID, to)
+
+	// A busca encontra a receita pelo ID novo
+	results, err := svc.Search(SearchRequest{Query: "tomate"})
+	require.NoError(t, err)
+	require.Len(t, results.Results, 1)
+	assert.Equal(t, renamed.ID, results.Results[0].ID)
+
+	_, err = svc.Rename(created.ID, "Outra torrada", WriteOptions{})
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+	_, err = svc.Rename(renamed.ID, "Outra torrada", WriteOptions{IfMatch: ParseCondition([]string{ETag(created)})})
+	assert.ErrorIs(t, err, PreconditionFailedErr)
+	_, err = svc.Rename(renamed.ID, "Misto quente", WriteOptions{})
+	assert.EqualError(t, err, `recipe "misto-quente" already exists: already exists`)
+	_, err = svc.Rename(renamed.ID, "!!!", WriteOptions{})
+	assert.Equal(t, http.StatusUnprocessableEntity, StatusCode(err))
+
+	// O nome antigo fica reservado, e o 409 diz por quê
+	_, err = svc.Create(getTorrada(), WriteOptions{})
+	assert.EqualError(t, err, `"torrada-de-presunto-e-queijo" is an old name of recipe "torrada-de-presunto-queijo-e-tomate": already exists`)
+
+	// Um nome que gera o mesmo ID só troca o nome
+	same, err := svc.Rename(renamed.ID, "TORRADA de presunto, queijo e tomate", WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, renamed.ID, same.ID)
+	assert.Equal(t, int64(3), same.Version)
+}
+
+func TestService_Facets(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	for _, recipe := range []recipes.Recipe{
+		{Name: "Brigadeiro", Ingredients: []recipes.Ingredient{{Name: "leite condensado"}, {Name: "chocolate em pó"}}, Tags: []string{"sobremesa", "sem gluten"}},
+		{Name: "Mousse", Ingredients: []recipes.Ingredient{{Name: "chocolate em pó"}, {Name: "ovos"}}, Tags: []string{"Sobremesa"}},
+		getTorrada(),
+	} {
+		_, err := svc.Create(recipe, WriteOptions{})
+		require.NoError(t, err)
+	}
+
+	facets, err := svc.Facets(recipes.ListOptions{Tags: []string{"sobremesa"}, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.Facets{
+		Total:       2,
+		Categories:  []recipes.FacetCount{{Value: "sobremesa", Name: "Sobremesa", Count: 2}},
+		Diets:       []recipes.FacetCount{{Value: "sem-gluten", Name: "Sem glúten", Count: 1}},
+		Tags:        []recipes.FacetCount{},
+		Ingredients: []recipes.FacetCount{{Value: "chocolate-em-po", Name: "chocolate em pó", Count: 2}},
+	}, facets)
+}
+
+func TestService_Allergens(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+
+	torrada := getTorrada()
+	torrada.Allergens = []string{"fish"}
+	created, err := svc.Create(torrada, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dairy", "gluten"}, created.Allergens)
+	salada, err := svc.Create(recipes.Recipe{Name: "Salada", Ingredients: []recipes.Ingredient{{Name: "alface"}, {Name: "azeite"}}}, WriteOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, salada.Allergens)
+
+	// Os alérgenos acompanham os ingredientes a cada escrita
+	torrada.Ingredients = []recipes.Ingredient{{Name: "pão de forma"}, {Name: "ovos mexidos"}}
+	updated, err := svc.Update(created.ID, torrada, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eggs", "gluten"}, updated.Allergens)
+	patch, err := DecodePatch(MergePatchContentType, strings.NewReader(`{"ingredients": [{"name": "tapioca"}, {"name": "ovo"}]}`))
+	require.NoError(t, err)
+	patched, err := svc.Patch(created.ID, patch, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eggs"}, patched.Allergens)
+
+	page, err := svc.ListPage(recipes.ListOptions{ExcludeAllergens: []string{"Ovos"}})
+	require.NoError(t, err)
+	require.Len(t, page.Recipes, 1)
+	assert.Equal(t, salada.ID, page.Recipes[0].ID)
+
+	_, err = svc.ListPage(recipes.ListOptions{ExcludeAllergens: []string{"mostarda"}})
+	assert.EqualError(t, err, `unknown allergen "mostarda"; use one of gluten, dairy, eggs, peanuts, tree-nuts, soy, fish, shellfish, sesame`)
+	assert.Equal(t, KindBadRequest, Classify(err))
+	_, err = svc.Facets(recipes.ListOptions{ExcludeAllergens: []string{"mostarda"}})
+	assert.Equal(t, KindBadRequest, Classify(err))
+
+	// Uma taxonomia própria vale para as escritas seguintes
+	svc.Taxonomy, err = recipes.DefaultTaxonomy.Extend(recipes.TaxonomyFile{
+		Allergens:   []recipes.Allergen{{Key: "mustard", Name: "Mostarda", Aliases: []string{"mostarda"}}},
+		Ingredients: map[string][]string{"azeite": {"mustard"}},
+	})
+	require.NoError(t, err)
+	salada, err = svc.Update(salada.ID, salada, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mustard"}, salada.Allergens)
+	page, err = svc.ListPage(recipes.ListOptions{ExcludeAllergens: []string{"mostarda"}})
+	require.NoError(t, err)
+	require.Len(t, page.Recipes, 1)
+	assert.Equal(t, created.ID, page.Recipes[0].ID)
+}
+
+func TestService_DetectAllergens(t *testing.T) {
+	mustard, err := recipes.DefaultTaxonomy.Extend(recipes.TaxonomyFile{
+		Allergens:   []recipes.Allergen{{Key: "mustard", Name: "Mostarda", Aliases: []string{"mostarda"}}},
+		Ingredients: map[string][]string{"azeite": {"mustard"}},
+	})
+	require.NoError(t, err)
+
+	for _, kind := range []string{"mem", "file", "sql"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := OpenStore(kind, dir)
+			require.NoError(t, err)
+			svc := New(store)
+			salada, err := svc.Create(recipes.Recipe{Name: "Salada", Ingredients: []recipes.Ingredient{{Name: "alface"}, {Name: "azeite"}}}, WriteOptions{})
+			require.NoError(t, err)
+			maionese, err := svc.Create(recipes.Recipe{Name: "Maionese", Ingredients: []recipes.Ingredient{{Name: "ovo"}, {Name: "azeite"}}}, WriteOptions{})
+			require.NoError(t, err)
+			require.NoError(t, svc.Delete(maionese.ID, DeleteOptions{}))
+
+			// A mesma loja com outra taxonomia, como em uma nova partida
+			svc = New(store)
+			svc.Taxonomy = mustard
+			changed, err := svc.DetectAllergens()
+			require.NoError(t, err)
+			assert.Equal(t, 1, changed)
+			changed, err = svc.DetectAllergens()
+			require.NoError(t, err)
+			assert.Equal(t, 0, changed)
+
+			page, err := svc.ListPage(recipes.ListOptions{ExcludeAllergens: []string{"mostarda"}})
+			require.NoError(t, err)
+			assert.Empty(t, page.Recipes)
+			got, err := svc.Get(salada.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"mustard"}, got.Allergens)
+			assert.Equal(t, ETag(salada), ETag(got))
+			revisions, err := svc.Revisions(salada.ID)
+			require.NoError(t, err)
+			assert.Len(t, revisions, 1)
+
+			// A receita na lixeira é recalculada quando volta
+			restored, err := svc.Untrash(maionese.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"eggs", "mustard"}, restored.Allergens)
+
+			if closer, ok := store.(io.Closer); ok {
+				require.NoError(t, closer.Close())
+				store, err = OpenStore(kind, dir)
+				require.NoError(t, err)
+				got, err = New(store).Get(salada.ID)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"mustard"}, got.Allergens)
+				require.NoError(t, store.(io.Closer).Close())
+			}
+		})
+	}
+}
+
+func TestMissingFromQuery(t *testing.T) {
+	missing, err := MissingFromQuery(url.Values{"missing": {"manteiga, ovos", "leite"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"manteiga", "ovos", "leite"}, missing)
+
+	for _, query := range []url.Values{{}, {"missing": {""}}, {"missing": {"!!"}}} {
+		_, err := MissingFromQuery(query)
+		assert.Equal(t, KindBadRequest, Classify(err), query.Encode())
+	}
+}
+
+func TestService_Substitute(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	created, err := svc.Create(recipes.Recipe{
+		Name:        "Omelete",
+		Ingredients: []recipes.Ingredient{{Name: "ovos", Quantity: 2}, {Name: "manteiga", Quantity: 1, Unit: recipes.UnitTablespoon}},
+	}, WriteOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dairy", "eggs"}, created.Allergens)
+
+	result, err := svc.Substitute(created.ID, []string{"manteiga", "margarina"})
+	require.NoError(t, err)
+	assert.Equal(t, recipes.Ingredient{Name: "óleo", Quantity: 0.8, Unit: recipes.UnitTablespoon}, result.Recipe.Ingredients[1])
+	assert.Equal(t, []string{"eggs"}, result.Recipe.Allergens)
+	require.Len(t, result.Substitutions, 1)
+	assert.Equal(t, 1, result.Substitutions[0].Index)
+
+	// A receita gravada não muda
+	got, err := svc.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created, got)
+
+	_, err = svc.Substitute(created.ID, []string{"chocolate"})
+	assert.EqualError(t, err, "chocolate: not an ingredient of the recipe")
+	assert.Equal(t, KindBadRequest, Classify(err))
+	_, err = svc.Substitute("panqueca", []string{"ovos"})
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+
+	// Uma base própria
+	svc.Substitutions, err = recipes.DefaultSubstitutions.Extend(recipes.SubstitutionsFile{Substitutions: map[string][]recipes.Substitute{
+		"manteiga": {{Name: "ghee"}},
+	}})
+	require.NoError(t, err)
+	result, err = svc.Substitute(created.ID, []string{"manteiga"})
+	require.NoError(t, err)
+	assert.Equal(t, "ghee", result.Recipe.Ingredients[1].Name)
+}
+
+func TestDecodeShoppingListRequest(t *testing.T) {
+	req, err := DecodeShoppingListRequest("application/json", strings.NewReader(
+		`{"recipes": ["pao", {"id": "bolo", "servings": 16}], "pantry": ["3 ovos", {"name": "farinha", "quantity": 1, "unit": "quilo"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, ShoppingListRequest{
+		Recipes: []ShoppingListRecipe{{ID: "pao"}, {ID: "bolo", Servings: 16}},
+		Pantry:  []recipes.Ingredient{{Name: "ovos", Quantity: 3}, {Name: "farinha", Quantity: 1, Unit: recipes.UnitKilogram}},
+	}, req)
+
+	tests := []struct {
+		name string
+		body string
+		want []recipes.FieldError
+	}{
+		{name: "No recipes", body: `{"pantry": ["ovos"]}`, want: []recipes.FieldError{{Field: "recipes", Message: "must list at least one recipe"}}},
+		{name: "Missing ID", body: `{"recipes": [{"servings": 2}]}`, want: []recipes.FieldError{{Field: "recipes[0].id", Message: "is required"}}},
+		{name: "Negative servings", body: `{"recipes": [{"id": "pao", "servings": -1}]}`, want: []recipes.FieldError{{Field: "recipes[0].servings", Message: "must be between 1 and 1000"}}},
+		{name: "Wrong type", body: `{"recipes": [42]}`, want: []recipes.FieldError{{Field: "recipes[0]", Message: "must be an object or a string"}}},
+		{name: "Unknown field", body: `{"recipes": [{"id": "pao", "porcoes": 2}]}`, want: []recipes.FieldError{{Field: "recipes[0].porcoes", Message: "unknown field"}}},
+		{name: "Empty pantry item", body: `{"recipes": ["pao"], "pantry": [""]}`, want: []recipes.FieldError{{Field: "pantry[0].name", Message: "is required"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeShoppingListRequest("application/json", strings.NewReader(tt.body))
+			var validationErr *recipes.ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.want, validationErr.Errors)
+		})
+	}
+}
+
+func TestShoppingListFormatFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  url.Values
+		accept string
+		want   ShoppingListFormat
+		kind   Kind
+	}{
+		{name: "Default", want: FormatJSON},
+		{name: "Query", query: url.Values{"format": {"Markdown"}}, accept: "text/plain", want: FormatMarkdown},
+		{name: "Accept", accept: "text/markdown", want: FormatMarkdown},
+		{name: "First supported", accept: "text/html, text/plain, application/json", want: FormatText},
+		{name: "Quality", accept: "text/plain;q=0.5, application/json", want: FormatJSON},
+		{name: "Wildcard", accept: "text/html, */*;q=0.1", want: FormatJSON},
+		{name: "Unknown format", query: url.Values{"format": {"pdf"}}, kind: KindBadRequest},
+		{name: "Not acceptable", accept: "text/html, application/json;q=0", kind: KindNotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := ShoppingListFormatFrom(tt.query, tt.accept)
+			if tt.kind != KindInternal {
+				assert.Equal(t, tt.kind, Classify(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, format)
+		})
+	}
+}
+
+func TestService_ShoppingList(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	created, err := svc.Create(recipes.Recipe{
+		Name:        "Omelete",
+		Servings:    1,
+		Ingredients: []recipes.Ingredient{{Name: "ovos", Quantity: 2}, {Name: "manteiga", Quantity: 1, Unit: recipes.UnitTablespoon}},
+	}, WriteOptions{})
+	require.NoError(t, err)
+	_, err = svc.Rename(created.ID, "Omelete simples", WriteOptions{})
+	require.NoError(t, err)
+
+	// O ID antigo continua valendo
+	list, err := svc.ShoppingList(ShoppingListRequest{
+		Recipes: []ShoppingListRecipe{{ID: "omelete", Servings: 3}},
+		Pantry:  []recipes.Ingredient{{Name: "manteiga"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.ShoppingRecipe{{ID: "omelete-simples", Name: "Omelete simples", Servings: 3}}, list.Recipes)
+	require.Len(t, list.Aisles, 1)
+	assert.Equal(t, []recipes.ShoppingItem{{Name: "ovos", Amounts: []recipes.Amount{{Quantity: 6}}, Recipes: []string{"omelete-simples"}}}, list.Aisles[0].Items)
+	assert.Equal(t, []string{"manteiga"}, list.InPantry)
+
+	// A quantidade escrita no nome também entra nas porções
+	_, err = svc.Create(recipes.Recipe{Name: "Pizza", Servings: 2, Ingredients: []recipes.Ingredient{{Name: "200 g queijo"}}}, WriteOptions{})
+	require.NoError(t, err)
+	list, err = svc.ShoppingList(ShoppingListRequest{Recipes: []ShoppingListRecipe{{ID: "pizza", Servings: 4}}})
+	require.NoError(t, err)
+	require.Len(t, list.Aisles, 1)
+	assert.Equal(t, []recipes.ShoppingItem{{Name: "queijo", Amounts: []recipes.Amount{{Quantity: 400, Unit: recipes.UnitGram}}, Recipes: []string{"pizza"}}}, list.Aisles[0].Items)
+
+	_, err = svc.ShoppingList(ShoppingListRequest{Recipes: []ShoppingListRecipe{{ID: "omelete-simples"}, {ID: "panqueca"}}})
+	var validationErr *recipes.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []recipes.FieldError{{Field: "recipes[1].id", Message: "recipe not found"}}, validationErr.Errors)
+	assert.Equal(t, KindInvalid, Classify(err))
+}
+
+func TestDecodePlan(t *testing.T) {
+	plan, err := DecodePlan("application/json", strings.NewReader(`{"name": "Semana", "version": 3, "slots": [
+		{"date": "2024-05-06", "meal": "Almoço", "recipe_id": "bolo", "servings": 4},
+		{"date": "2024-05-06", "meal": "ceia", "recipe_id": "pao"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, recipes.Plan{Name: "Semana", Slots: []recipes.PlanSlot{
+		{Date: "2024-05-06", Meal: recipes.MealLunch, RecipeID: "bolo", Servings: 4},
+		// Fica como veio, para a validação apontar
+		{Date: "2024-05-06", Meal: "ceia", RecipeID: "pao"},
+	}}, plan)
+
+	_, err = DecodePlan("application/json", strings.NewReader(`{"name": "Semana", "slots": [{"dia": "2024-05-06"}, 42]}`))
+	var validationErr *recipes.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "slots[0].dia", Message: "unknown field"},
+		{Field: "slots[1]", Message: "must be an object"},
+	}, validationErr.Errors)
+}
+
+func TestDecodeGeneratePlanRequest(t *testing.T) {
+	req, err := DecodeGeneratePlanRequest("application/json", strings.NewReader(
+		`{"start": "2024-05-06", "days": 5, "meals": ["jantar", "café da manhã"], "tags": ["vegano"], "max_time": "PT45M", "no_repeat_days": 3, "seed": 7}`))
+	require.NoError(t, err)
+	assert.Equal(t, GeneratePlanRequest{Constraints: recipes.PlanConstraints{
+		Start:        "2024-05-06",
+		Days:         5,
+		Meals:        []recipes.Meal{recipes.MealDinner, recipes.MealBreakfast},
+		Tags:         []string{"vegano"},
+		MaxTime:      recipes.Duration(45 * time.Minute),
+		NoRepeatDays: 3,
+		Seed:         7,
+	}}, req)
+
+	_, err = DecodeGeneratePlanRequest("application/json", strings.NewReader(
+		`{"start": "amanhã", "days": -1, "meals": ["almoço", "lunch"], "tags": [" "], "max_time": "45 min", "no_repeat_days": 60, "servings": 2000}`))
+	var validationErr *recipes.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []recipes.FieldError{
+		{Field: "start", Message: "must be a date such as 2024-05-06"},
+		{Field: "days", Message: "must be between 1 and 31"},
+		{Field: "meals[1]", Message: "duplicates lunch"},
+		{Field: "tags[0]", Message: "is required"},
+		{Field: "max_time", Message: `must be an ISO-8601 duration such as "PT1H30M"`},
+		{Field: "no_repeat_days", Message: "must be between 0 and 31"},
+		{Field: "servings", Message: "must be between 1 and 1000"},
+	}, validationErr.Errors)
+}
+
+func TestService_Plans(t *testing.T) {
+	svc := New(recipes.NewMemStore())
+	svc.Clock = func() time.Time { return time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC) }
+	for _, name := range []string{"Bolo", "Pão", "Sopa"} {
+		_, err := svc.Create(recipes.Recipe{Name: name, Ingredients: []recipes.Ingredient{{Name: "farinha"}}}, WriteOptions{})
+		require.NoError(t, err)
+	}
+
+	created, err := svc.CreatePlan(recipes.Plan{Name: "Semana", Slots: []recipes.PlanSlot{
+		{Date: "2024-05-07", Meal: recipes.MealLunch, RecipeID: "bolo"},
+		{Date: "2024-05-06", Meal: recipes.MealDinner, RecipeID: "pao"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "semana", created.ID)
+	assert.Equal(t, int64(1), created.Version)
+	assert.Equal(t, "pao", created.Slots[0].RecipeID)
+
+	_, err = svc.CreatePlan(recipes.Plan{Name: "Outra", Slots: []recipes.PlanSlot{{Date: "2024-05-06", Meal: recipes.MealLunch, RecipeID: "pudim"}}})
+	var validationErr *recipes.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []recipes.FieldError{{Field: "slots[0].recipe_id", Message: "recipe not found"}}, validationErr.Errors)
+
+	// A receita apagada vira um aviso na leitura, sem alterar o plano
+	require.NoError(t, svc.Delete("pao", DeleteOptions{}))
+	got, err := svc.GetPlan("semana")
+	require.NoError(t, err)
+	assert.Equal(t, []recipes.PlanWarning{{Slot: 0, RecipeID: "pao", Message: "recipe is in the trash"}}, got.Warnings)
+	assert.Equal(t, int64(1), got.Version)
+
+	_, err = svc.UpdatePlan("semana", recipes.Plan{Name: "Semana"}, WriteOptions{IfMatch: ParseCondition([]string{`"2"`})})
+	assert.ErrorIs(t, err, PlanPreconditionFailedErr)
+	updated, err := svc.UpdatePlan("semana", recipes.Plan{Name: "Semana", Slots: got.Slots[1:]}, WriteOptions{IfMatch: ParseCondition([]string{PlanETag(got)})})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+	assert.Empty(t, updated.Warnings)
+
+	// Sem início, o plano gerado começa no dia do relógio
+	generated, err := svc.GeneratePlan(GeneratePlanRequest{Constraints: recipes.PlanConstraints{Days: 1, Meals: []recipes.Meal{recipes.MealLunch}}})
+	require.NoError(t, err)
+	assert.Equal(t, "plano-de-2024-05-06", generated.ID)
+	assert.Equal(t, []recipes.PlanSlot{{Date: "2024-05-06", Meal: recipes.MealLunch, RecipeID: "bolo"}}, generated.Slots)
+	_, err = svc.GeneratePlan(GeneratePlanRequest{Constraints: recipes.PlanConstraints{Tags: []string{"vegano"}}})
+	assert.ErrorIs(t, err, recipes.NotEnoughRecipesErr)
+	assert.Equal(t, KindInvalid, Classify(err))
+
+	plans, err := svc.ListPlans()
+	require.NoError(t, err)
+	assert.Len(t, plans, 2)
+	assert.ErrorIs(t, svc.DeletePlan("semana", WriteOptions{IfMatch: ParseCondition([]string{PlanETag(got)})}), PlanPreconditionFailedErr)
+	require.NoError(t, svc.DeletePlan("semana", WriteOptions{}))
+	_, err = svc.GetPlan("semana")
+	assert.ErrorIs(t, err, recipes.NotFoundErr)
+}
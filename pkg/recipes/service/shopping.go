@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// MaxShoppingListRecipes - quantas receitas uma lista de compras aceita
+const MaxShoppingListRecipes = 50
+
+// Media types da lista de compras além do JSON
+const (
+	TextContentType     = "text/plain; charset=utf-8"
+	MarkdownContentType = "text/markdown; charset=utf-8"
+)
+
+// ShoppingListFormat - como a lista de compras é apresentada
+type ShoppingListFormat string
+
+const (
+	FormatJSON     ShoppingListFormat = "json"
+	FormatText     ShoppingListFormat = "text"
+	FormatMarkdown ShoppingListFormat = "markdown"
+)
+
+// shoppingListMediaTypes - media type aceito no Accept -> formato
+var shoppingListMediaTypes = map[string]ShoppingListFormat{
+	"application/json": FormatJSON,
+	"application/*":    FormatJSON,
+	"*/*":              FormatJSON,
+	"text/plain":       FormatText,
+	"text/markdown":    FormatMarkdown,
+	"text/*":           FormatText,
+}
+
+// ShoppingListRequest - o corpo de POST /shopping-lists
+type ShoppingListRequest struct {
+	Recipes []ShoppingListRecipe
+	Pantry  []recipes.Ingredient
+}
+
+// ShoppingListRecipe - uma receita da lista; Servings zero mantém as
+// porções da receita
+type ShoppingListRecipe struct {
+	ID       string `json:"id"`
+	Servings int    `json:"servings,omitempty"`
+}
+
+// shoppingListPayload - as receitas podem ser só o ID ("bolo") ou um objeto
+// com as porções; os itens da despensa, objetos ou texto livre como os
+// ingredientes de uma receita
+type shoppingListPayload struct {
+	Recipes []json.RawMessage `json:"recipes"`
+	Pantry  []json.RawMessage `json:"pantry,omitempty"`
+}
+
+// DecodeShoppingListRequest - lê o corpo de POST /shopping-lists:
+//
+//	{"recipes": ["pao", {"id": "bolo", "servings": 16}],
+//	 "pantry": ["ovos", "500 g farinha de trigo"]}
+func DecodeShoppingListRequest(contentType string, body io.Reader) (ShoppingListRequest, error) {
+	const malformed = "malformed shopping list JSON"
+
+	var payload shoppingListPayload
+	if err := decodeJSON(contentType, body, &payload, true, malformed); err != nil {
+		return ShoppingListRequest{}, err
+	}
+
+	var req ShoppingListRequest
+	invalid := &recipes.ValidationError{}
+	switch {
+	case len(payload.Recipes) == 0:
+		invalid.Add("recipes", "must list at least one recipe")
+	case len(payload.Recipes) > MaxShoppingListRecipes:
+		invalid.Add("recipes", fmt.Sprintf("must list at most %d recipes", MaxShoppingListRecipes))
+	}
+	for i, raw := range payload.Recipes {
+		req.Recipes = append(req.Recipes, decodeShoppingListRecipe(raw, fmt.Sprintf("recipes[%d]", i), invalid))
+	}
+	for i, raw := range payload.Pantry {
+		field := fmt.Sprintf("pantry[%d]", i)
+		ingredient := decodeIngredient(raw, field, invalid)
+		if strings.TrimSpace(ingredient.Name) == "" {
+			invalid.Add(field+".name", "is required")
+		}
+		req.Pantry = append(req.Pantry, ingredient)
+	}
+	if err := invalid.Err(); err != nil {
+		return ShoppingListRequest{}, &Error{Kind: KindInvalid, Message: "invalid shopping list", Err: err}
+	}
+	return req, nil
+}
+
+func decodeShoppingListRecipe(raw json.RawMessage, field string, invalid *recipes.ValidationError) ShoppingListRecipe {
+	var recipe ShoppingListRecipe
+	if err := json.Unmarshal(raw, &recipe.ID); err != nil {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&recipe); err != nil {
+			if !addFieldError(invalid, field, err) {
+				invalid.Add(field, "must be an object or a string")
+			}
+			return ShoppingListRecipe{}
+		}
+	}
+
+	if strings.TrimSpace(recipe.ID) == "" {
+		invalid.Add(field+".id", "is required")
+	}
+	if recipe.Servings < 0 || recipe.Servings > recipes.MaxServings {
+		invalid.Add(field+".servings", fmt.Sprintf("must be between 1 and %d", recipes.MaxServings))
+	}
+	return recipe
+}
+
+// ShoppingListFormatFrom - o formato pedido em ?format= (json, text ou
+// markdown) ou, sem ele, pelo cabeçalho Accept. Sem nenhum dos dois, JSON.
+// Um format desconhecido é KindBadRequest; um Accept que não aceita nenhum
+// dos formatos é KindNotAcceptable
+func ShoppingListFormatFrom(query url.Values, accept string) (ShoppingListFormat, error) {
+	if v := query.Get("format"); v != "" {
+		switch format := ShoppingListFormat(strings.ToLower(v)); format {
+		case FormatJSON, FormatText, FormatMarkdown:
+			return format, nil
+		}
+		return "", &Error{Kind: KindBadRequest, Message: "format must be json, text or markdown"}
+	}
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, nil
+	}
+
+	type candidate struct {
+		format ShoppingListFormat
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		format, ok := shoppingListMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{format: format, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return "", &Error{Kind: KindNotAcceptable, Message: "shopping lists are available as application/json, text/plain or text/markdown"}
+	}
+	// Na mesma qualidade, vale a ordem do cabeçalho
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].format, nil
+}
+
+// RenderShoppingList - o corpo da resposta no formato pedido, com o
+// Content-Type correspondente
+func RenderShoppingList(list recipes.ShoppingList, format ShoppingListFormat) (string, []byte, error) {
+	switch format {
+	case FormatText:
+		return TextContentType, []byte(list.Text()), nil
+	case FormatMarkdown:
+		return MarkdownContentType, []byte(list.Markdown()), nil
+	default:
+		body, err := json.Marshal(list)
+		return "application/json", body, err
+	}
+}
+
+// ShoppingList - a lista de compras das receitas pedidas, nas porções
+// pedidas, sem o que já está na despensa (veja recipes.NewShoppingList). O
+// ID antigo de uma receita renomeada também vale. Uma receita que não
+// existe, ou que não informa as porções quando elas são pedidas, é
+// KindInvalid apontando o item da lista
+func (s *Service) ShoppingList(req ShoppingListRequest) (recipes.ShoppingList, error) {
+	selected := make([]recipes.Recipe, 0, len(req.Recipes))
+	invalid := &recipes.ValidationError{}
+	for i, item := range req.Recipes {
+		field := fmt.Sprintf("recipes[%d]", i)
+		recipe, err := s.shoppingListRecipe(item.ID)
+		if errors.Is(err, recipes.NotFoundErr) {
+			invalid.Add(field+".id", "recipe not found")
+			continue
+		}
+		if err != nil {
+			return recipes.ShoppingList{}, err
+		}
+		if item.Servings > 0 {
+			if recipe, err = recipe.WithAmounts().Scale(item.Servings); err != nil {
+				invalid.Add(field+".servings", err.Error())
+				continue
+			}
+		}
+		selected = append(selected, recipe)
+	}
+	if err := invalid.Err(); err != nil {
+		return recipes.ShoppingList{}, &Error{Kind: KindInvalid, Message: "invalid shopping list", Err: err}
+	}
+	return recipes.NewShoppingList(selected, req.Pantry), nil
+}
+
+func (s *Service) shoppingListRecipe(id string) (recipes.Recipe, error) {
+	recipe, err := s.Get(id)
+	if !errors.Is(err, recipes.NotFoundErr) {
+		return recipe, err
+	}
+	current, aliasErr := s.Alias(id)
+	if aliasErr != nil {
+		return recipes.Recipe{}, err
+	}
+	return s.Get(current)
+}
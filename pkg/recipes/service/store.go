@@ -0,0 +1,26 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// OpenStore - escolhe a loja de acordo com a flag -store dos servidores
+func OpenStore(kind, dataDir string) (Store, error) {
+	switch kind {
+	case "mem":
+		return recipes.NewMemStore(), nil
+	case "file":
+		return recipes.NewFileStore(dataDir)
+	case "sql":
+		if err := os.MkdirAll(dataDir, 0o755); err != nil {
+			return nil, err
+		}
+		return recipes.NewSQLStore(filepath.Join(dataDir, "recipes.db"))
+	default:
+		return nil, fmt.Errorf("loja desconhecida %q (use mem, file ou sql)", kind)
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+// MissingFromQuery - os ingredientes que faltam, de
+// GET /receitas/{id}/substitutions?missing=manteiga,ovos. O parâmetro pode
+// ser repetido e é obrigatório
+func MissingFromQuery(query url.Values) ([]string, error) {
+	missing, err := listFilter(query, "missing")
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) == 0 {
+		return nil, &Error{Kind: KindBadRequest, Message: "missing is required"}
+	}
+	return missing, nil
+}
+
+func (s *Service) substitutions() *recipes.Substitutions {
+	if s.Substitutions == nil {
+		return recipes.DefaultSubstitutions
+	}
+	return s.Substitutions
+}
+
+// Substitute - a receita com os ingredientes de missing trocados pelos
+// substitutos da base, e a lista das trocas. A receita gravada não é
+// alterada; os alérgenos da cópia são recalculados com os ingredientes
+// novos. Um item de missing que não está na receita é KindBadRequest
+func (s *Service) Substitute(id string, missing []string) (recipes.SubstitutedRecipe, error) {
+	recipe, err := s.Get(id)
+	if err != nil {
+		return recipes.SubstitutedRecipe{}, err
+	}
+	result, err := s.substitutions().Apply(recipe, missing)
+	if errors.Is(err, recipes.NotAnIngredientErr) {
+		return recipes.SubstitutedRecipe{}, &Error{Kind: KindBadRequest, Message: err.Error()}
+	}
+	if err != nil {
+		return recipes.SubstitutedRecipe{}, err
+	}
+	result.Recipe.Allergens = s.taxonomy().Detect(result.Recipe)
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IgorCastilhos/go_rest_api_recipes_std_lib/pkg/recipes"
+)
+
+const (
+	// DefaultTrashTTL - prazo da lixeira quando Service.TrashTTL é zero
+	DefaultTrashTTL = 30 * 24 * time.Hour
+	// MaxPurgeInterval - maior intervalo entre duas limpezas da lixeira em
+	// RunPurge; prazos menores limpam com a frequência do próprio prazo
+	MaxPurgeInterval = time.Hour
+)
+
+// Trash - as receitas na lixeira, das removidas mais recentemente para as
+// mais antigas, com a data em que serão apagadas de vez
+func (s *Service) Trash() ([]recipes.TrashedRecipe, error) {
+	trash, err := s.store.Trash()
+	if err != nil {
+		return nil, err
+	}
+	for i := range trash {
+		trash[i].PurgeAt = trash[i].DeletedAt.Add(s.trashTTL())
+	}
+	return trash, nil
+}
+
+// Untrash - devolve a receita da lixeira, como ela estava quando foi
+// removida, inclusive a versão. Só os alérgenos são recalculados
+func (s *Service) Untrash(id string) (recipes.Recipe, error) {
+	if err := s.store.Untrash(id); err != nil {
+		return recipes.Recipe{}, err
+	}
+	// A taxonomia pode ter mudado enquanto a receita estava na lixeira
+	if _, err := s.detectAllergens(id); err != nil {
+		return recipes.Recipe{}, err
+	}
+	s.reindex(id)
+	return s.Get(id)
+}
+
+// PurgeTrash - apaga de vez as receitas que estão na lixeira há mais de
+// TrashTTL e devolve quantas foram
+func (s *Service) PurgeTrash() (int, error) {
+	purged, err := s.store.Purge(s.now().Add(-s.trashTTL()))
+	return len(purged), err
+}
+
+// RunPurge - chama PurgeTrash periodicamente até ctx ser cancelado. Feito
+// para rodar em uma goroutine própria; erros são registrados no log e a
+// limpeza é tentada de novo na próxima vez
+func (s *Service) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(min(s.trashTTL(), MaxPurgeInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeTrash(); err != nil {
+				log.Printf("purging trash: %v", err)
+			}
+		}
+	}
+}
+
+func (s *Service) trashTTL() time.Duration {
+	if s.TrashTTL <= 0 {
+		return DefaultTrashTTL
+	}
+	return s.TrashTTL
+}
+
+// existsMessage - a mensagem do 409 de Create e Rename. Um ID que não
+// aparece na listagem é o nome antigo de uma receita renomeada ou está
+// reservado por uma receita na lixeira
+func (s *Service) existsMessage(id string) string {
+	if to, err := s.store.Alias(id); err == nil {
+		return fmt.Sprintf("%q is an old name of recipe %q", id, to)
+	}
+	if _, err := s.store.Get(id); errors.Is(err, recipes.NotFoundErr) {
+		return fmt.Sprintf("recipe %q is in the trash", id)
+	}
+	return fmt.Sprintf("recipe %q already exists", id)
+}
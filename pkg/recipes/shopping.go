@@ -0,0 +1,460 @@
+package recipes
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gosimple/slug"
+)
+
+// Aisle - um corredor do supermercado
+type Aisle struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// Aisles - os corredores, na ordem em que a lista de compras os percorre.
+// O último recebe o que não foi classificado
+var Aisles = []Aisle{
+	{Key: "produce", Name: "Hortifrúti"},
+	{Key: "meat", Name: "Açougue e peixaria"},
+	{Key: "dairy", Name: "Frios e laticínios"},
+	{Key: "bakery", Name: "Padaria"},
+	{Key: "pantry", Name: "Mercearia"},
+	{Key: "spices", Name: "Temperos"},
+	{Key: "drinks", Name: "Bebidas"},
+	{Key: "frozen", Name: "Congelados"},
+	{Key: "other", Name: "Outros"},
+}
+
+// aisleIngredients - corredor -> ingredientes vendidos nele, em português e
+// em inglês. Como na Taxonomy, vale o termo mais longo contido no nome
+// ("leite de coco" fica na mercearia, "leite" nos laticínios)
+var aisleIngredients = map[string][]string{
+	"produce": {
+		"cebola", "alho", "tomate", "batata", "batata doce", "cenoura", "alface", "rúcula",
+		"limão", "laranja", "banana", "maçã", "abacate", "abacaxi", "manga", "morango", "uva",
+		"maracujá", "pimentão", "abobrinha", "abóbora", "berinjela", "brócolis", "couve",
+		"couve flor", "espinafre", "repolho", "pepino", "chuchu", "mandioca", "inhame",
+		"salsinha", "cebolinha", "coentro", "manjericão", "hortelã", "gengibre", "cogumelo",
+		"onion", "garlic", "tomato", "potato", "sweet potato", "carrot", "lettuce", "lemon",
+		"lime", "orange", "apple", "avocado", "strawberry", "bell pepper", "zucchini",
+		"eggplant", "broccoli", "spinach", "cabbage", "cucumber", "parsley", "cilantro",
+		"basil", "mint", "ginger", "mushroom",
+	},
+	"meat": {
+		"carne", "carne moída", "frango", "peito de frango", "bacon", "linguiça", "costela",
+		"lombo", "porco", "peixe", "salmão", "tilápia", "bacalhau", "camarão",
+		"beef", "ground beef", "chicken", "pork", "sausage", "fish", "salmon", "shrimp",
+	},
+	"dairy": {
+		"leite", "queijo", "manteiga", "margarina", "iogurte", "requeijão", "cream cheese",
+		"presunto", "peito de peru", "mortadela", "salame", "ovo",
+		"milk", "cheese", "butter", "margarine", "yogurt", "ham", "egg",
+	},
+	"bakery": {
+		"pão", "pães", "pão de forma", "pão francês", "bisnaguinha", "croissant", "torrada",
+		"bread", "toast",
+	},
+	"pantry": {
+		"farinha", "farinha de trigo", "fubá", "polvilho", "amido de milho", "aveia", "açúcar",
+		"arroz", "feijão", "lentilha", "grão de bico", "macarrão", "óleo", "azeite", "vinagre",
+		"fermento", "bicarbonato", "chocolate", "cacau", "achocolatado", "mel", "café",
+		"leite condensado", "creme de leite", "leite de coco", "coco ralado", "milho",
+		"ervilha", "molho de tomate", "extrato de tomate", "atum", "sardinha", "azeitona",
+		"maionese", "mostarda", "ketchup", "shoyu", "gelatina", "amendoim", "castanha", "nozes",
+		"manteiga de amendoim",
+		"flour", "cornstarch", "oats", "sugar", "rice", "beans", "lentils", "chickpeas",
+		"pasta", "oil", "olive oil", "vinegar", "baking powder", "baking soda", "cocoa",
+		"honey", "coffee", "condensed milk", "heavy cream", "coconut milk", "corn", "peas",
+		"tomato sauce", "tomato paste", "tuna", "olives", "mayonnaise", "mustard",
+		"soy sauce", "peanut", "peanut butter", "walnuts",
+	},
+	"spices": {
+		"sal", "pimenta", "pimenta do reino", "orégano", "cominho", "canela", "noz moscada",
+		"páprica", "colorau", "louro", "cravo", "curry", "açafrão",
+		"salt", "pepper", "black pepper", "oregano", "cumin", "cinnamon", "nutmeg", "paprika",
+		"bay leaf", "cloves", "turmeric",
+	},
+	"drinks": {
+		"água", "água com gás", "suco", "refrigerante", "vinho", "cerveja", "cachaça",
+		"water", "juice", "wine", "beer",
+	},
+	"frozen": {
+		"congelado", "congelada", "sorvete", "pão de queijo",
+		"frozen", "ice cream",
+	},
+}
+
+// aisleTerm - um ingrediente de aisleIngredients, já separado em palavras
+type aisleTerm struct {
+	words []string
+	aisle Aisle
+}
+
+var aisleTerms = func() []aisleTerm {
+	byKey := make(map[string]Aisle, len(Aisles))
+	for _, aisle := range Aisles {
+		byKey[aisle.Key] = aisle
+	}
+
+	var terms []aisleTerm
+	for key, names := range aisleIngredients {
+		for _, name := range names {
+			terms = append(terms, aisleTerm{words: matchTokens(name), aisle: byKey[key]})
+		}
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		return strings.Join(terms[i].words, "-") < strings.Join(terms[j].words, "-")
+	})
+	return terms
+}()
+
+// AisleOf - o corredor onde o ingrediente é vendido. Vale o termo com mais
+// palavras e, no empate, o mais comprido ("manteiga sem sal" fica nos
+// laticínios, não nos temperos). O que não é reconhecido fica em "other"
+func AisleOf(ingredient string) Aisle {
+	words := wordSet(matchTokens(ingredient))
+	var best *aisleTerm
+	for i, term := range aisleTerms {
+		if !hasWords(words, term.words) {
+			continue
+		}
+		if best == nil || len(term.words) > len(best.words) ||
+			len(term.words) == len(best.words) && len(strings.Join(term.words, "")) > len(strings.Join(best.words, "")) {
+			best = &aisleTerms[i]
+		}
+	}
+	if best == nil {
+		return Aisles[len(Aisles)-1]
+	}
+	return best.aisle
+}
+
+// Amount - uma quantidade a comprar
+type Amount struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit,omitempty"`
+}
+
+func (a Amount) String() string {
+	s := strconv.FormatFloat(a.Quantity, 'f', -1, 64)
+	if a.Unit != "" {
+		s += " " + a.Unit
+	}
+	return s
+}
+
+// ShoppingItem - um ingrediente da lista de compras, somado entre as
+// receitas
+type ShoppingItem struct {
+	Name string `json:"name"`
+	// Amounts - quanto comprar, uma entrada para cada unidade que não
+	// converte nas outras ("500 g" e "2 can"). Vazia quando nenhuma receita
+	// diz a quantidade ("sal a gosto")
+	Amounts []Amount `json:"amounts,omitempty"`
+	// Optional - o ingrediente é opcional em todas as receitas que o usam
+	Optional bool `json:"optional,omitempty"`
+	// Recipes - os IDs das receitas que usam o ingrediente
+	Recipes []string `json:"recipes"`
+}
+
+// ShoppingAisle - os itens de um corredor, em ordem alfabética
+type ShoppingAisle struct {
+	Key   string         `json:"key"`
+	Name  string         `json:"name"`
+	Items []ShoppingItem `json:"items"`
+}
+
+// ShoppingRecipe - uma receita que entrou na lista, com as porções usadas
+type ShoppingRecipe struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Servings int    `json:"servings,omitempty"`
+}
+
+// ShoppingList - os ingredientes de várias receitas, somados, sem o que já
+// está na despensa e agrupados por corredor
+type ShoppingList struct {
+	Recipes []ShoppingRecipe `json:"recipes"`
+	Aisles  []ShoppingAisle  `json:"aisles"`
+	// InPantry - os ingredientes que a despensa cobre por inteiro
+	InPantry []string `json:"in_pantry,omitempty"`
+}
+
+// shoppingEntry - um item enquanto a lista é montada
+type shoppingEntry struct {
+	ShoppingItem
+	key   string
+	words []string
+}
+
+// NewShoppingList - monta a lista de compras das receitas, já nas porções
+// desejadas. Como Recipe.Scale só multiplica Quantity, as receitas escaladas
+// precisam passar antes por Recipe.WithAmounts.
+//
+// Ingredientes com o mesmo nome (sem diferenciar maiúsculas e acentos, no
+// singular ou no plural) viram um item só, com o nome da primeira receita
+// que o usa. Um ingrediente sem quantidade cuja quantidade está no nome
+// ("200 g queijo") passa antes por ParseIngredient. As quantidades são
+// somadas quando as unidades convertem entre si (veja Convert) e as
+// métricas são apresentadas na maior unidade que não fique abaixo de 1
+// (1500 g viram 1,5 kg).
+//
+// Cada item da despensa desconta o ingrediente de mesmo nome, pela mesma
+// regra. Sem quantidade, o item sai da lista; com quantidade, ela é
+// descontada da que converte para a mesma unidade, e o item sai quando não
+// sobra nada a comprar. A quantidade da despensa só é usada uma vez: o que
+// um item descontou não vale para os outros
+func NewShoppingList(selected []Recipe, pantry []Ingredient) ShoppingList {
+	list := ShoppingList{Recipes: make([]ShoppingRecipe, 0, len(selected)), Aisles: []ShoppingAisle{}}
+	var entries []*shoppingEntry
+	for _, recipe := range selected {
+		list.Recipes = append(list.Recipes, ShoppingRecipe{ID: recipe.ID, Name: recipe.Name, Servings: recipe.Servings})
+		for _, ingredient := range recipe.Ingredients {
+			ingredient = withAmount(ingredient)
+			key := slug.Make(ingredient.Name)
+			if key == "" {
+				continue
+			}
+
+			words := matchTokens(ingredient.Name)
+			entry := findEntry(entries, key, words)
+			if entry == nil {
+				entry = &shoppingEntry{
+					ShoppingItem: ShoppingItem{Name: ingredient.Name, Optional: true},
+					key:          key,
+					words:        words,
+				}
+				entries = append(entries, entry)
+			}
+			entry.Optional = entry.Optional && ingredient.Optional
+			entry.addRecipe(recipe.ID)
+			if ingredient.Quantity > 0 {
+				entry.Amounts = addAmount(entry.Amounts, Amount{Quantity: ingredient.Quantity, Unit: ingredient.Unit}, ingredient.Name)
+			}
+		}
+	}
+
+	for _, have := range pantry {
+		have = withAmount(have)
+		words := matchTokens(have.Name)
+		// Sem quantidade, o item cobre tudo; com quantidade, o que sobra de
+		// uma entrada passa para a próxima até acabar
+		limited := have.Quantity > 0
+		kept := entries[:0]
+		for _, entry := range entries {
+			if !sameWords(entry.words, words) || (limited && roundQuantity(have.Quantity) <= 0) {
+				kept = append(kept, entry)
+				continue
+			}
+			covered, left := subtractAmount(entry, have)
+			have.Quantity = left
+			if covered {
+				list.InPantry = append(list.InPantry, entry.Name)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		entries = kept
+	}
+	sort.Strings(list.InPantry)
+
+	byAisle := make(map[string][]*shoppingEntry)
+	for _, entry := range entries {
+		for i, amount := range entry.Amounts {
+			entry.Amounts[i] = presentAmount(amount)
+		}
+		key := AisleOf(entry.Name).Key
+		byAisle[key] = append(byAisle[key], entry)
+	}
+	for _, aisle := range Aisles {
+		group := byAisle[aisle.Key]
+		if len(group) == 0 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].key < group[j].key })
+		items := make([]ShoppingItem, len(group))
+		for i, entry := range group {
+			items[i] = entry.ShoppingItem
+		}
+		list.Aisles = append(list.Aisles, ShoppingAisle{Key: aisle.Key, Name: aisle.Name, Items: items})
+	}
+	return list
+}
+
+// addRecipe - registra a receita uma vez só, mesmo que ela apareça mais de
+// uma vez na lista ou use o ingrediente em mais de uma linha
+func (e *shoppingEntry) addRecipe(id string) {
+	for _, have := range e.Recipes {
+		if have == id {
+			return
+		}
+	}
+	e.Recipes = append(e.Recipes, id)
+}
+
+// WithAmounts - cópia da receita com a quantidade de cada ingrediente que a
+// traz no nome ("200 g queijo") tirada para Quantity e Unit, como a lista de
+// compras lê. Vem antes de Scale, que só multiplica Quantity
+func (r Recipe) WithAmounts() Recipe {
+	r = r.clone()
+	for i, ingredient := range r.Ingredients {
+		r.Ingredients[i] = withAmount(ingredient)
+	}
+	return r
+}
+
+// withAmount - tira a quantidade do nome de um ingrediente que não a
+// informa à parte ("200 g queijo"), e leva a unidade para a forma canônica
+func withAmount(ingredient Ingredient) Ingredient {
+	if ingredient.Quantity == 0 && ingredient.Unit == "" {
+		parsed := ParseIngredient(ingredient.Name)
+		parsed.Optional = parsed.Optional || ingredient.Optional
+		return parsed
+	}
+	if unit, ok := ParseUnit(ingredient.Unit); ok {
+		ingredient.Unit = unit
+	}
+	return ingredient
+}
+
+// addAmount - soma a quantidade à primeira entrada com unidade compatível,
+// ou acrescenta uma entrada nova
+func addAmount(amounts []Amount, amount Amount, ingredient string) []Amount {
+	for i, have := range amounts {
+		if have.Unit == amount.Unit {
+			amounts[i].Quantity += amount.Quantity
+			return amounts
+		}
+		if q, err := Convert(amount.Quantity, amount.Unit, have.Unit, ingredient); err == nil {
+			amounts[i].Quantity += q
+			return amounts
+		}
+	}
+	return append(amounts, amount)
+}
+
+// subtractAmount - desconta o item da despensa do que há para comprar e diz
+// se o item inteiro já está coberto e quanto da despensa sobrou, na unidade
+// dela
+func subtractAmount(entry *shoppingEntry, have Ingredient) (bool, float64) {
+	if have.Quantity == 0 || len(entry.Amounts) == 0 {
+		return true, have.Quantity
+	}
+
+	remaining := have.Quantity
+	amounts := entry.Amounts[:0]
+	for _, amount := range entry.Amounts {
+		q, err := remaining, error(nil)
+		if amount.Unit != have.Unit {
+			q, err = Convert(remaining, have.Unit, amount.Unit, entry.Name)
+		}
+		if err != nil || q <= 0 {
+			amounts = append(amounts, amount)
+			continue
+		}
+		if roundQuantity(amount.Quantity-q) > 0 {
+			amount.Quantity -= q
+			amounts = append(amounts, amount)
+			remaining = 0
+			continue
+		}
+		// Sobrou despensa: o resto pode cobrir a próxima unidade
+		remaining *= (q - amount.Quantity) / q
+	}
+	entry.Amounts = amounts
+	return len(amounts) == 0, remaining
+}
+
+// findEntry - a entrada do ingrediente, pelo slug ou pelas mesmas palavras
+// no singular ou no plural (veja sameWords)
+func findEntry(entries []*shoppingEntry, key string, words []string) *shoppingEntry {
+	for _, entry := range entries {
+		if entry.key == key || sameWords(entry.words, words) {
+			return entry
+		}
+	}
+	return nil
+}
+
+// presentAmount - quantidades métricas na maior unidade que não fique
+// abaixo de 1, todas arredondadas
+func presentAmount(amount Amount) Amount {
+	if f, ok := unitFactors[amount.Unit]; ok && f.system == Metric {
+		base := amount.Quantity * f.factor
+		if f.dimension == dimensionMass {
+			amount.Quantity, amount.Unit = metricMass(base)
+		} else {
+			amount.Quantity, amount.Unit = metricVolume(base)
+		}
+	}
+	amount.Quantity = roundQuantity(amount.Quantity)
+	return amount
+}
+
+// sameWords - os dois nomes têm as mesmas palavras, no singular ou no plural
+// ("ovo" e "ovos")
+func sameWords(a, b []string) bool {
+	if len(a) == 0 || len(a) != len(b) {
+		return false
+	}
+	return hasWords(wordSet(a), b) || hasWords(wordSet(b), a)
+}
+
+// Text - a lista em texto simples, um item por linha
+func (l ShoppingList) Text() string {
+	var b strings.Builder
+	b.WriteString("Lista de compras\n")
+	l.render(&b, "", "- ")
+	return b.String()
+}
+
+// Markdown - a lista em Markdown, com um checklist por corredor
+func (l ShoppingList) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# Lista de compras\n")
+	l.render(&b, "## ", "- [ ] ")
+	return b.String()
+}
+
+func (l ShoppingList) render(b *strings.Builder, heading, bullet string) {
+	names := make([]string, len(l.Recipes))
+	for i, recipe := range l.Recipes {
+		names[i] = recipe.Name
+		if recipe.Servings > 0 {
+			names[i] += fmt.Sprintf(" (%d porções)", recipe.Servings)
+		}
+	}
+	fmt.Fprintf(b, "\nReceitas: %s\n", strings.Join(names, ", "))
+
+	if len(l.Aisles) == 0 {
+		b.WriteString("\nNada para comprar.\n")
+	}
+	for _, aisle := range l.Aisles {
+		fmt.Fprintf(b, "\n%s%s\n", heading, aisle.Name)
+		if heading != "" {
+			b.WriteString("\n")
+		}
+		for _, item := range aisle.Items {
+			b.WriteString(bullet + item.Name)
+			if len(item.Amounts) > 0 {
+				amounts := make([]string, len(item.Amounts))
+				for i, amount := range item.Amounts {
+					amounts[i] = amount.String()
+				}
+				b.WriteString(": " + strings.Join(amounts, " + "))
+			}
+			if item.Optional {
+				b.WriteString(" (opcional)")
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(l.InPantry) > 0 {
+		fmt.Fprintf(b, "\nJá na despensa: %s\n", strings.Join(l.InPantry, ", "))
+	}
+}
@@ -0,0 +1,193 @@
+package recipes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAisleOf(t *testing.T) {
+	tests := []struct {
+		ingredient string
+		want       string
+	}{
+		{ingredient: "cebola roxa", want: "produce"},
+		{ingredient: "peito de frango", want: "meat"},
+		{ingredient: "3 ovos", want: "dairy"},
+		{ingredient: "Farinha de Trigo", want: "pantry"},
+		{ingredient: "noz-moscada", want: "spices"},
+		// O termo mais longo vale
+		{ingredient: "leite de coco", want: "pantry"},
+		{ingredient: "leite integral", want: "dairy"},
+		{ingredient: "manteiga sem sal", want: "dairy"},
+		{ingredient: "pão de queijo", want: "frozen"},
+		{ingredient: "za'atar", want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ingredient, func(t *testing.T) {
+			assert.Equal(t, tt.want, AisleOf(tt.ingredient).Key)
+		})
+	}
+}
+
+func TestNewShoppingList(t *testing.T) {
+	bolo := Recipe{
+		ID:       "bolo",
+		Name:     "Bolo",
+		Servings: 8,
+		Ingredients: []Ingredient{
+			{Name: "farinha de trigo", Quantity: 2, Unit: UnitCup},
+			{Name: "manteiga", Quantity: 100, Unit: UnitGram},
+			{Name: "ovos", Quantity: 3},
+			{Name: "sal", Unit: UnitPinch},
+		},
+	}
+	pao := Recipe{
+		ID:   "pao",
+		Name: "Pão",
+		Ingredients: []Ingredient{
+			{Name: "Farinha de trigo", Quantity: 500, Unit: UnitGram},
+			{Name: "1 kg manteiga"},
+			{Name: "fermento", Quantity: 1, Unit: UnitPackage},
+			{Name: "sal a gosto"},
+			{Name: "gergelim", Optional: true},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		selected []Recipe
+		pantry   []Ingredient
+		want     ShoppingList
+	}{
+		{
+			name:     "Merges and sums compatible units",
+			selected: []Recipe{bolo, pao},
+			want: ShoppingList{
+				Recipes: []ShoppingRecipe{{ID: "bolo", Name: "Bolo", Servings: 8}, {ID: "pao", Name: "Pão"}},
+				Aisles: []ShoppingAisle{
+					{Key: "dairy", Name: "Frios e laticínios", Items: []ShoppingItem{
+						{Name: "manteiga", Amounts: []Amount{{Quantity: 1.1, Unit: UnitKilogram}}, Recipes: []string{"bolo", "pao"}},
+						{Name: "ovos", Amounts: []Amount{{Quantity: 3}}, Recipes: []string{"bolo"}},
+					}},
+					{Key: "pantry", Name: "Mercearia", Items: []ShoppingItem{
+						// 500 g de farinha são 4,17 xícaras
+						{Name: "farinha de trigo", Amounts: []Amount{{Quantity: 6.17, Unit: UnitCup}}, Recipes: []string{"bolo", "pao"}},
+						{Name: "fermento", Amounts: []Amount{{Quantity: 1, Unit: UnitPackage}}, Recipes: []string{"pao"}},
+					}},
+					{Key: "spices", Name: "Temperos", Items: []ShoppingItem{
+						{Name: "sal", Recipes: []string{"bolo", "pao"}},
+					}},
+					{Key: "other", Name: "Outros", Items: []ShoppingItem{
+						{Name: "gergelim", Optional: true, Recipes: []string{"pao"}},
+					}},
+				},
+			},
+		},
+		{
+			name:     "Subtracts the pantry",
+			selected: []Recipe{bolo, pao},
+			pantry: []Ingredient{
+				{Name: "ovo"},
+				{Name: "sal"},
+				{Name: "manteiga", Quantity: 0.5, Unit: UnitKilogram},
+				{Name: "2 packages fermento"},
+				{Name: "gergelim", Quantity: 1, Unit: UnitCup},
+				{Name: "farinha de trigo", Quantity: 1, Unit: UnitCan},
+			},
+			want: ShoppingList{
+				Recipes: []ShoppingRecipe{{ID: "bolo", Name: "Bolo", Servings: 8}, {ID: "pao", Name: "Pão"}},
+				Aisles: []ShoppingAisle{
+					{Key: "dairy", Name: "Frios e laticínios", Items: []ShoppingItem{
+						{Name: "manteiga", Amounts: []Amount{{Quantity: 600, Unit: UnitGram}}, Recipes: []string{"bolo", "pao"}},
+					}},
+					{Key: "pantry", Name: "Mercearia", Items: []ShoppingItem{
+						// Lata não converte em xícaras
+						{Name: "farinha de trigo", Amounts: []Amount{{Quantity: 6.17, Unit: UnitCup}}, Recipes: []string{"bolo", "pao"}},
+					}},
+				},
+				InPantry: []string{"fermento", "gergelim", "ovos", "sal"},
+			},
+		},
+		{
+			name:     "Pantry covers everything",
+			selected: []Recipe{{ID: "salada", Name: "Salada", Ingredients: []Ingredient{{Name: "tomate", Quantity: 2}}}},
+			pantry:   []Ingredient{{Name: "Tomates", Quantity: 6}},
+			want: ShoppingList{
+				Recipes:  []ShoppingRecipe{{ID: "salada", Name: "Salada"}},
+				Aisles:   []ShoppingAisle{},
+				InPantry: []string{"tomate"},
+			},
+		},
+		{
+			name: "Merges singular and plural and uses the pantry once",
+			selected: []Recipe{
+				{ID: "omelete", Name: "Omelete", Ingredients: []Ingredient{{Name: "ovo", Quantity: 3}}},
+				{ID: "bolo", Name: "Bolo", Ingredients: []Ingredient{{Name: "Ovos", Quantity: 2}}},
+			},
+			pantry: []Ingredient{{Name: "1 ovo"}},
+			want: ShoppingList{
+				Recipes: []ShoppingRecipe{{ID: "omelete", Name: "Omelete"}, {ID: "bolo", Name: "Bolo"}},
+				Aisles: []ShoppingAisle{
+					{Key: "dairy", Name: "Frios e laticínios", Items: []ShoppingItem{
+						{Name: "ovo", Amounts: []Amount{{Quantity: 4}}, Recipes: []string{"omelete", "bolo"}},
+					}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NewShoppingList(tt.selected, tt.pantry))
+		})
+	}
+}
+
+func TestShoppingList_Render(t *testing.T) {
+	list := ShoppingList{
+		Recipes: []ShoppingRecipe{{ID: "bolo", Name: "Bolo", Servings: 8}, {ID: "pao", Name: "Pão"}},
+		Aisles: []ShoppingAisle{
+			{Key: "dairy", Name: "Frios e laticínios", Items: []ShoppingItem{
+				{Name: "manteiga", Amounts: []Amount{{Quantity: 1.1, Unit: UnitKilogram}, {Quantity: 2, Unit: UnitCan}}},
+			}},
+			{Key: "spices", Name: "Temperos", Items: []ShoppingItem{
+				{Name: "sal"},
+				{Name: "páprica", Optional: true},
+			}},
+		},
+		InPantry: []string{"ovos"},
+	}
+
+	assert.Equal(t, `Lista de compras
+
+Receitas: Bolo (8 porções), Pão
+
+Frios e laticínios
+- manteiga: 1.1 kg + 2 can
+
+Temperos
+- sal
+- páprica (opcional)
+
+Já na despensa: ovos
+`, list.Text())
+
+	assert.Equal(t, `# Lista de compras
+
+Receitas: Bolo (8 porções), Pão
+
+## Frios e laticínios
+
+- [ ] manteiga: 1.1 kg + 2 can
+
+## Temperos
+
+- [ ] sal
+- [ ] páprica (opcional)
+
+Já na despensa: ovos
+`, list.Markdown())
+
+	empty := ShoppingList{Recipes: []ShoppingRecipe{{ID: "pao", Name: "Pão"}}, Aisles: []ShoppingAisle{}}
+	assert.Equal(t, "Lista de compras\n\nReceitas: Pão\n\nNada para comprar.\n", empty.Text())
+}
@@ -0,0 +1,89 @@
+package recipes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recipeStore - o contrato que toda loja precisa cumprir. As tabelas de
+// recipeMemStore_test.go rodam contra cada implementação abaixo
+type recipeStore interface {
+	Add(name string, recipe Recipe) error
+	Get(name string) (Recipe, error)
+	List() (map[string]Recipe, error)
+	ListPage(opts ListOptions) (Page, error)
+	Facets(opts ListOptions) (Facets, error)
+	Update(name string, recipe Recipe) error
+	CompareAndSwap(name string, version int64, recipe Recipe) error
+	Remove(name string) error
+	CompareAndDelete(name string, version int64) error
+	Revisions(name string) ([]Revision, error)
+	Revision(name string, number int64) (Revision, error)
+	MoveToTrash(name string, version int64, deletedAt time.Time) error
+	Trash() ([]TrashedRecipe, error)
+	Untrash(name string) error
+	Purge(before time.Time) ([]string, error)
+	Rename(from, to string, version int64, recipe Recipe) error
+	Alias(name string) (string, error)
+	AddPlan(id string, plan Plan) error
+	GetPlan(id string) (Plan, error)
+	Plans() ([]Plan, error)
+	CompareAndSwapPlan(id string, version int64, plan Plan) error
+	CompareAndDeletePlan(id string, version int64) error
+}
+
+type storeFactory struct {
+	name string
+	new  func(t *testing.T) recipeStore
+}
+
+func storeFactories() []storeFactory {
+	return []storeFactory{
+		{
+			name: "MemStore",
+			new: func(t *testing.T) recipeStore {
+				return NewMemStore()
+			},
+		},
+		{
+			name: "FileStore",
+			new: func(t *testing.T) recipeStore {
+				store, err := NewFileStore(t.TempDir())
+				require.NoError(t, err)
+				t.Cleanup(func() { store.Close() })
+				return store
+			},
+		},
+		{
+			name: "SQLStore",
+			new: func(t *testing.T) recipeStore {
+				store, err := NewSQLStore(":memory:")
+				require.NoError(t, err)
+				t.Cleanup(func() { store.Close() })
+				return store
+			},
+		},
+	}
+}
+
+// newSeededStore - cria a loja e adiciona as receitas iniciais do caso de teste
+func newSeededStore(t *testing.T, factory storeFactory, seed map[string]Recipe) recipeStore {
+	t.Helper()
+	store := factory.new(t)
+	for name, recipe := range seed {
+		require.NoError(t, store.Add(name, recipe))
+	}
+	return store
+}
+
+// runStoreConformance - executa fn uma vez para cada implementação de loja
+func runStoreConformance(t *testing.T, fn func(t *testing.T, factory storeFactory)) {
+	for _, factory := range storeFactories() {
+		factory := factory
+		t.Run(factory.name, func(t *testing.T) {
+			fn(t, factory)
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package recipes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gosimple/slug"
+	"gopkg.in/yaml.v3"
+)
+
+// NotAnIngredientErr - um ingrediente pedido para substituição não está na
+// receita
+var NotAnIngredientErr = errors.New("not an ingredient of the recipe")
+
+// Substitute - um ingrediente que pode ocupar o lugar de outro
+type Substitute struct {
+	Name string `json:"name" yaml:"name"`
+	// Ratio - quanto do substituto usar para cada unidade do original (0,8
+	// de óleo para 1 de manteiga); 1 quando zero
+	Ratio float64 `json:"ratio,omitempty" yaml:"ratio,omitempty"`
+	// Unit - a unidade do substituto, quando ela não é a do original (uma
+	// colher de sopa de linhaça para cada ovo); vazia mantém a do original
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	// Note - como usar o substituto e o que muda no resultado
+	Note string `json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+// SubstitutionsFile - o formato do arquivo de substituições
+// (LoadSubstitutions)
+type SubstitutionsFile struct {
+	// Replace - descarta a base padrão em vez de estendê-la
+	Replace bool `json:"replace,omitempty" yaml:"replace,omitempty"`
+	// Substitutions - nome do ingrediente -> substitutos, do preferido para
+	// o menos preferido. Uma lista vazia marca um ingrediente sem
+	// substitutos, para que ele não use os de um nome mais curto ("manteiga
+	// de amendoim" não é manteiga)
+	Substitutions map[string][]Substitute `json:"substitutions" yaml:"substitutions"`
+}
+
+// Substitutions - base de substituições de ingredientes. Um ingrediente da
+// receita usa os substitutos do termo mais longo da base contido no nome
+// dele, como na Taxonomy ("manteiga sem sal" usa os de "manteiga"). É
+// imutável depois de criada
+type Substitutions struct {
+	terms []substitutionTerm
+}
+
+// substitutionTerm - um ingrediente da base, já separado em palavras
+type substitutionTerm struct {
+	words       []string
+	substitutes []Substitute
+}
+
+// DefaultSubstitutions - trocas comuns na cozinha do dia a dia, pelos
+// nomes em português e em inglês
+var DefaultSubstitutions = mustSubstitutions(SubstitutionsFile{Substitutions: map[string][]Substitute{
+	"manteiga": {
+		{Name: "margarina", Ratio: 1},
+		{Name: "óleo", Ratio: 0.8, Note: "a massa fica mais úmida e menos aerada"},
+	},
+	"butter": {
+		{Name: "margarine", Ratio: 1},
+		{Name: "vegetable oil", Ratio: 0.8, Note: "the dough turns out moister and less airy"},
+	},
+	"óleo": {
+		{Name: "manteiga derretida", Ratio: 1.25},
+		{Name: "azeite", Ratio: 1, Note: "deixa um sabor mais marcante"},
+	},
+	"vegetable oil": {
+		{Name: "melted butter", Ratio: 1.25},
+		{Name: "olive oil", Ratio: 1, Note: "stronger flavor"},
+	},
+	"leite": {
+		{Name: "bebida vegetal de aveia", Ratio: 1, Note: "ou outra bebida vegetal sem açúcar"},
+		{Name: "água", Ratio: 1, Note: "o resultado fica menos cremoso"},
+	},
+	"milk": {
+		{Name: "oat milk", Ratio: 1, Note: "or any unsweetened plant milk"},
+		{Name: "water", Ratio: 1, Note: "less creamy"},
+	},
+	"leite de coco": {
+		{Name: "creme de leite", Ratio: 0.5, Note: "complete com a mesma quantidade de água"},
+	},
+	"coconut milk": {
+		{Name: "heavy cream", Ratio: 0.5, Note: "top up with the same amount of water"},
+	},
+	"leite condensado": {
+		{Name: "leite em pó", Ratio: 0.5, Note: "bata com a mesma quantidade de açúcar e um pouco de água quente"},
+	},
+	"condensed milk": {
+		{Name: "milk powder", Ratio: 0.5, Note: "blend with the same amount of sugar and a little hot water"},
+	},
+	"manteiga de amendoim": {},
+	"peanut butter":        {},
+	"manteiga de cacau":    {},
+	"cocoa butter":         {},
+	"creme de leite": {
+		{Name: "iogurte natural", Ratio: 1, Note: "acrescente fora do fogo para não talhar"},
+		{Name: "leite de coco", Ratio: 1},
+	},
+	"cream": {
+		{Name: "plain yogurt", Ratio: 1, Note: "stir in off the heat so it does not curdle"},
+		{Name: "coconut milk", Ratio: 1},
+	},
+	"iogurte": {
+		{Name: "coalhada", Ratio: 1},
+		{Name: "creme de leite", Ratio: 1, Note: "com algumas gotas de limão"},
+	},
+	"requeijão": {
+		{Name: "cream cheese", Ratio: 1},
+	},
+	"ovo": {
+		{Name: "linhaça moída", Ratio: 1, Unit: UnitTablespoon, Note: "misture cada colher com 3 colheres (sopa) de água e espere 5 minutos"},
+		{Name: "banana amassada", Ratio: 0.25, Unit: UnitCup, Note: "só em massas doces"},
+	},
+	"egg": {
+		{Name: "ground flaxseed", Ratio: 1, Unit: UnitTablespoon, Note: "mix each tablespoon with 3 tablespoons of water and let it sit for 5 minutes"},
+		{Name: "mashed banana", Ratio: 0.25, Unit: UnitCup, Note: "sweet recipes only"},
+	},
+	"açúcar": {
+		{Name: "açúcar mascavo", Ratio: 1, Note: "o sabor lembra caramelo"},
+		{Name: "mel", Ratio: 0.75, Note: "reduza os líquidos da receita em um quarto"},
+	},
+	"açúcar de confeiteiro": {
+		{Name: "açúcar refinado", Ratio: 1, Note: "bata no liquidificador até virar pó"},
+	},
+	"sugar": {
+		{Name: "brown sugar", Ratio: 1},
+		{Name: "honey", Ratio: 0.75, Note: "reduce the other liquids by a quarter"},
+	},
+	"farinha de trigo": {
+		{Name: "farinha de trigo integral", Ratio: 1, Note: "a massa fica mais densa"},
+		{Name: "farinha de arroz", Ratio: 1, Note: "sem glúten; a massa fica mais quebradiça"},
+	},
+	"flour": {
+		{Name: "whole wheat flour", Ratio: 1, Note: "denser result"},
+		{Name: "rice flour", Ratio: 1, Note: "gluten free; more crumbly"},
+	},
+	"fermento químico": {
+		{Name: "bicarbonato de sódio", Ratio: 0.25, Note: "junte um ingrediente ácido, como iogurte ou suco de limão"},
+	},
+	"baking powder": {
+		{Name: "baking soda", Ratio: 0.25, Note: "add an acid such as yogurt or lemon juice"},
+	},
+	"chocolate em pó": {
+		{Name: "cacau em pó", Ratio: 1, Note: "adoce a gosto"},
+	},
+	"limão": {
+		{Name: "vinagre", Ratio: 1, Note: "só para dar acidez"},
+	},
+	"lemon": {
+		{Name: "vinegar", Ratio: 1, Note: "for acidity only"},
+	},
+	"cebola": {
+		{Name: "alho-poró", Ratio: 1},
+	},
+	"onion": {
+		{Name: "leek", Ratio: 1},
+	},
+	"vinho branco": {
+		{Name: "caldo de legumes", Ratio: 1, Note: "com uma colher (chá) de vinagre"},
+	},
+	"white wine": {
+		{Name: "vegetable stock", Ratio: 1, Note: "with a teaspoon of vinegar"},
+	},
+}})
+
+func mustSubstitutions(file SubstitutionsFile) *Substitutions {
+	substitutions, err := (&Substitutions{}).Extend(file)
+	if err != nil {
+		panic(err)
+	}
+	return substitutions
+}
+
+// LoadSubstitutions - lê um arquivo no formato de SubstitutionsFile, em
+// YAML quando a extensão é .yaml ou .yml e em JSON nos outros casos, e
+// estende a DefaultSubstitutions com ele: os ingredientes do arquivo
+// substituem os de mesmo nome
+func LoadSubstitutions(path string) (*Substitutions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file SubstitutionsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("substitutions %s: %w", path, err)
+	}
+	base := DefaultSubstitutions
+	if file.Replace {
+		base = &Substitutions{}
+	}
+	substitutions, err := base.Extend(file)
+	if err != nil {
+		return nil, fmt.Errorf("substitutions %s: %w", path, err)
+	}
+	return substitutions, nil
+}
+
+// Extend - uma base nova com os ingredientes de file por cima dos de b.
+// file.Replace é ignorado
+func (b *Substitutions) Extend(file SubstitutionsFile) (*Substitutions, error) {
+	terms := make(map[string][]Substitute, len(b.terms)+len(file.Substitutions))
+	for _, term := range b.terms {
+		terms[strings.Join(term.words, "-")] = term.substitutes
+	}
+	for name, substitutes := range file.Substitutions {
+		key := slug.Make(name)
+		if key == "" {
+			return nil, fmt.Errorf("ingredient %q must contain at least one letter or digit", name)
+		}
+		checked := make([]Substitute, len(substitutes))
+		for i, substitute := range substitutes {
+			if slug.Make(substitute.Name) == "" {
+				return nil, fmt.Errorf("ingredient %q: substitute %d must have a name", name, i)
+			}
+			if substitute.Ratio < 0 {
+				return nil, fmt.Errorf("ingredient %q: ratio of %q must not be negative", name, substitute.Name)
+			}
+			if substitute.Ratio == 0 {
+				substitute.Ratio = 1
+			}
+			if substitute.Unit != "" {
+				unit, ok := ParseUnit(substitute.Unit)
+				if !ok {
+					return nil, fmt.Errorf("ingredient %q: unknown unit %q", name, substitute.Unit)
+				}
+				substitute.Unit = unit
+			}
+			checked[i] = substitute
+		}
+		terms[key] = checked
+	}
+
+	extended := &Substitutions{terms: make([]substitutionTerm, 0, len(terms))}
+	for key, substitutes := range terms {
+		extended.terms = append(extended.terms, substitutionTerm{words: strings.Split(key, "-"), substitutes: substitutes})
+	}
+	sort.Slice(extended.terms, func(i, j int) bool {
+		return strings.Join(extended.terms[i].words, "-") < strings.Join(extended.terms[j].words, "-")
+	})
+	return extended, nil
+}
+
+// Lookup - os substitutos do ingrediente, do preferido para o menos
+// preferido; nil quando a base não conhece nenhum
+func (b *Substitutions) Lookup(ingredient string) []Substitute {
+	words := wordSet(matchTokens(ingredient))
+	var best *substitutionTerm
+	for i, term := range b.terms {
+		if hasWords(words, term.words) && (best == nil || len(term.words) > len(best.words)) {
+			best = &b.terms[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return append([]Substitute(nil), best.substitutes...)
+}
+
+// SubstitutedRecipe - a receita com os ingredientes que faltam trocados
+// pelos substitutos, e a lista das trocas
+type SubstitutedRecipe struct {
+	Recipe        Recipe         `json:"recipe"`
+	Substitutions []Substitution `json:"substitutions"`
+}
+
+// Substitution - a troca de um ingrediente da receita
+type Substitution struct {
+	// Index - a posição do ingrediente em Recipe.Ingredients
+	Index    int        `json:"index"`
+	Original Ingredient `json:"original"`
+	// Substitute - o ingrediente que entrou no lugar; nil quando a base
+	// não conhece um substituto, e o original continua na receita
+	Substitute *Ingredient `json:"substitute,omitempty"`
+	Note       string      `json:"note,omitempty"`
+	// Alternatives - os outros substitutos possíveis
+	Alternatives []Substitute `json:"alternatives,omitempty"`
+}
+
+// Apply - cópia da receita sem os ingredientes de missing. Cada item de
+// missing vale para os ingredientes que têm todas as palavras dele
+// ("manteiga" encontra "manteiga sem sal"); cada um é trocado pelo primeiro
+// substituto que também não esteja faltando, com a quantidade multiplicada
+// pela proporção. As referências nos passos acompanham o nome novo. Itens
+// que não são ingredientes da receita só descartam substitutos; se nenhum
+// for, o erro é NotAnIngredientErr
+func (b *Substitutions) Apply(recipe Recipe, missing []string) (SubstitutedRecipe, error) {
+	recipe = recipe.clone()
+	missingWords := make([][]string, len(missing))
+	for i, item := range missing {
+		missingWords[i] = matchTokens(item)
+	}
+	isMissing := func(name string) bool {
+		words := wordSet(matchTokens(name))
+		for _, item := range missingWords {
+			if len(item) > 0 && hasWords(words, item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	found := false
+	for _, ingredient := range recipe.Ingredients {
+		found = found || isMissing(ingredient.Name)
+	}
+	if !found {
+		return SubstitutedRecipe{}, fmt.Errorf("%s: %w", strings.Join(missing, ", "), NotAnIngredientErr)
+	}
+
+	result := SubstitutedRecipe{Substitutions: []Substitution{}}
+	renamed := make(map[string]string)
+	for i, original := range recipe.Ingredients {
+		if !isMissing(original.Name) {
+			continue
+		}
+		substitution := Substitution{Index: i, Original: original}
+		for _, substitute := range b.Lookup(original.Name) {
+			if isMissing(substitute.Name) {
+				continue
+			}
+			if substitution.Substitute != nil {
+				substitution.Alternatives = append(substitution.Alternatives, substitute)
+				continue
+			}
+			replacement := original
+			replacement.Name = substitute.Name
+			replacement.Quantity = roundQuantity(original.Quantity * substitute.Ratio)
+			if substitute.Unit != "" {
+				replacement.Unit = substitute.Unit
+			}
+			substitution.Substitute = &replacement
+			substitution.Note = substitute.Note
+			recipe.Ingredients[i] = replacement
+			renamed[original.Name] = replacement.Name
+		}
+		result.Substitutions = append(result.Substitutions, substitution)
+	}
+
+	for i, step := range recipe.Steps {
+		for j, ref := range step.Ingredients {
+			if name, ok := renamed[ref]; ok {
+				recipe.Steps[i].Ingredients[j] = name
+			}
+		}
+	}
+	result.Recipe = recipe
+	return result, nil
+}
@@ -0,0 +1,172 @@
+package recipes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubstitutions_Lookup(t *testing.T) {
+	tests := []struct {
+		ingredient string
+		want       []string
+	}{
+		{ingredient: "manteiga sem sal", want: []string{"margarina", "óleo"}},
+		{ingredient: "3 ovos", want: []string{"linhaça moída", "banana amassada"}},
+		{ingredient: "unsalted butter", want: []string{"margarine", "vegetable oil"}},
+		// O termo mais longo vale
+		{ingredient: "leite condensado", want: []string{"leite em pó"}},
+		{ingredient: "manteiga de amendoim", want: nil},
+		{ingredient: "sal", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ingredient, func(t *testing.T) {
+			var names []string
+			for _, substitute := range DefaultSubstitutions.Lookup(tt.ingredient) {
+				names = append(names, substitute.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestSubstitutions_Apply(t *testing.T) {
+	bolo := Recipe{
+		Name: "Bolo simples",
+		Ingredients: []Ingredient{
+			{Name: "farinha de trigo", Quantity: 2, Unit: UnitCup},
+			{Name: "manteiga", Quantity: 100, Unit: UnitGram, Note: "em temperatura ambiente"},
+			{Name: "ovos", Quantity: 3},
+			{Name: "sal", Unit: UnitPinch},
+		},
+		Steps: []Step{
+			{Text: "Bata a manteiga com os ovos", Ingredients: []string{"manteiga", "ovos"}},
+			{Text: "Junte a farinha", Ingredients: []string{"farinha de trigo"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		missing []string
+		want    func(recipe *Recipe) []Substitution
+	}{
+		{
+			name:    "One ingredient",
+			missing: []string{"manteiga"},
+			want: func(recipe *Recipe) []Substitution {
+				margarina := Ingredient{Name: "margarina", Quantity: 100, Unit: UnitGram, Note: "em temperatura ambiente"}
+				recipe.Ingredients[1] = margarina
+				recipe.Steps[0].Ingredients[0] = "margarina"
+				return []Substitution{{
+					Index:        1,
+					Original:     bolo.Ingredients[1],
+					Substitute:   &margarina,
+					Alternatives: []Substitute{{Name: "óleo", Ratio: 0.8, Note: "a massa fica mais úmida e menos aerada"}},
+				}}
+			},
+		},
+		{
+			name:    "Skips substitutes that are also missing",
+			missing: []string{"manteiga", "margarina", "ovo"},
+			want: func(recipe *Recipe) []Substitution {
+				oleo := Ingredient{Name: "óleo", Quantity: 80, Unit: UnitGram, Note: "em temperatura ambiente"}
+				linhaca := Ingredient{Name: "linhaça moída", Quantity: 3, Unit: UnitTablespoon}
+				recipe.Ingredients[1] = oleo
+				recipe.Ingredients[2] = linhaca
+				recipe.Steps[0].Ingredients = []string{"óleo", "linhaça moída"}
+				return []Substitution{
+					{Index: 1, Original: bolo.Ingredients[1], Substitute: &oleo, Note: "a massa fica mais úmida e menos aerada"},
+					{
+						Index:        2,
+						Original:     bolo.Ingredients[2],
+						Substitute:   &linhaca,
+						Note:         "misture cada colher com 3 colheres (sopa) de água e espere 5 minutos",
+						Alternatives: []Substitute{{Name: "banana amassada", Ratio: 0.25, Unit: UnitCup, Note: "só em massas doces"}},
+					},
+				}
+			},
+		},
+		{
+			name:    "No known substitute",
+			missing: []string{"sal"},
+			want: func(recipe *Recipe) []Substitution {
+				return []Substitution{{Index: 3, Original: bolo.Ingredients[3]}}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := bolo.clone()
+			substitutions := tt.want(&want)
+
+			got, err := DefaultSubstitutions.Apply(bolo, tt.missing)
+			require.NoError(t, err)
+			assert.Equal(t, want, got.Recipe)
+			assert.Equal(t, substitutions, got.Substitutions)
+		})
+	}
+
+	_, err := DefaultSubstitutions.Apply(bolo, []string{"chocolate", "baunilha"})
+	assert.ErrorIs(t, err, NotAnIngredientErr)
+	assert.EqualError(t, err, "chocolate, baunilha: not an ingredient of the recipe")
+
+	// A receita original não muda
+	assert.Equal(t, "manteiga", bolo.Ingredients[1].Name)
+	assert.Equal(t, []string{"manteiga", "ovos"}, bolo.Steps[0].Ingredients)
+}
+
+func TestLoadSubstitutions(t *testing.T) {
+	write := func(t *testing.T, name, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		substitutions, err := LoadSubstitutions(write(t, "substitutions.json", `{
+			"substitutions": {
+				"manteiga": [{"name": "ghee", "note": "sabor mais intenso"}],
+				"creme de leite": []
+			}
+		}`))
+		require.NoError(t, err)
+		assert.Equal(t, []Substitute{{Name: "ghee", Ratio: 1, Note: "sabor mais intenso"}}, substitutions.Lookup("manteiga"))
+		assert.Nil(t, substitutions.Lookup("creme de leite"))
+		assert.NotNil(t, substitutions.Lookup("ovos"))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		substitutions, err := LoadSubstitutions(write(t, "substitutions.yaml", `
+replace: true
+substitutions:
+  ovo:
+    - name: aquafaba
+      ratio: 3
+      unit: colher de sopa
+      note: o líquido do cozimento do grão-de-bico
+`))
+		require.NoError(t, err)
+		assert.Equal(t, []Substitute{{Name: "aquafaba", Ratio: 3, Unit: UnitTablespoon, Note: "o líquido do cozimento do grão-de-bico"}}, substitutions.Lookup("2 ovos"))
+		assert.Nil(t, substitutions.Lookup("manteiga"))
+	})
+
+	for _, tt := range []struct {
+		name, file, content, err string
+	}{
+		{name: "Malformed JSON", file: "s.json", content: `{"substitutions": [`, err: "substitutions"},
+		{name: "Malformed YAML", file: "s.yml", content: "substitutions: [", err: "substitutions"},
+		{name: "Unknown unit", file: "s.json", content: `{"substitutions": {"ovo": [{"name": "aquafaba", "unit": "concha"}]}}`, err: `ingredient "ovo": unknown unit "concha"`},
+		{name: "Negative ratio", file: "s.json", content: `{"substitutions": {"ovo": [{"name": "aquafaba", "ratio": -1}]}}`, err: `ingredient "ovo": ratio of "aquafaba" must not be negative`},
+		{name: "Nameless substitute", file: "s.json", content: `{"substitutions": {"ovo": [{"ratio": 1}]}}`, err: `ingredient "ovo": substitute 0 must have a name`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSubstitutions(write(t, tt.file, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package recipes
+
+// TagKind - o tipo de uma tag. As receitas guardam só a lista de tags; o
+// tipo vem do vocabulário abaixo, então "sobremesa" é sempre uma categoria
+// e "sem glúten" sempre uma restrição alimentar, como quer que tenham sido
+// escritas
+type TagKind string
+
+const (
+	// TagKindCategory - o tipo de prato ("sobremesa", "prato principal")
+	TagKindCategory TagKind = "category"
+	// TagKindDiet - restrições e estilos de alimentação ("vegano", "sem glúten")
+	TagKindDiet TagKind = "diet"
+	// TagKindFree - qualquer outra tag ("rápido", "festa junina")
+	TagKindFree TagKind = "tag"
+)
+
+// Tag - uma tag do vocabulário conhecido
+type Tag struct {
+	// Key - a tag normalizada (TagKey), usada no filtro ?tag=
+	Key  string  `json:"key"`
+	Name string  `json:"name"`
+	Kind TagKind `json:"kind"`
+}
+
+// Categories e Diets - o vocabulário conhecido, na ordem em que o
+// frontend apresenta
+var (
+	Categories = newTags(TagKindCategory,
+		"Café da manhã", "Entrada", "Prato principal", "Acompanhamento",
+		"Sobremesa", "Lanche", "Bebida", "Molho", "Pão",
+	)
+	Diets = newTags(TagKindDiet,
+		"Vegano", "Vegetariano", "Sem glúten", "Sem lactose", "Sem açúcar",
+		"Low carb",
+	)
+)
+
+// knownTags - Categories e Diets pela chave
+var knownTags = func() map[string]Tag {
+	known := make(map[string]Tag, len(Categories)+len(Diets))
+	for _, tags := range [][]Tag{Categories, Diets} {
+		for _, tag := range tags {
+			known[tag.Key] = tag
+		}
+	}
+	return known
+}()
+
+func newTags(kind TagKind, names ...string) []Tag {
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{Key: TagKey(name), Name: name, Kind: kind}
+	}
+	return tags
+}
+
+// LookupTag - a tag do vocabulário com a mesma chave de tag ("sem gluten"
+// encontra "Sem glúten"). Tags fora do vocabulário são TagKindFree, com o
+// nome como veio
+func LookupTag(tag string) Tag {
+	if known, ok := knownTags[TagKey(tag)]; ok {
+		return known
+	}
+	return Tag{Key: TagKey(tag), Name: tag, Kind: TagKindFree}
+}
@@ -0,0 +1,27 @@
+package recipes
+
+import (
+	"sort"
+	"time"
+)
+
+// TrashedRecipe - uma receita na lixeira. Ela some da listagem, da busca e
+// do match, mas o ID continua reservado até ser apagada de vez, para que a
+// restauração nunca encontre outra receita no lugar
+type TrashedRecipe struct {
+	Recipe
+	DeletedAt time.Time `json:"deleted_at"`
+	// PurgeAt - quando a receita vai ser apagada de vez; preenchido pelo
+	// serviço, que conhece o prazo da lixeira
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+// sortTrash - as removidas mais recentemente primeiro; empates pelo ID
+func sortTrash(trash []TrashedRecipe) {
+	sort.Slice(trash, func(i, j int) bool {
+		if !trash[i].DeletedAt.Equal(trash[j].DeletedAt) {
+			return trash[i].DeletedAt.After(trash[j].DeletedAt)
+		}
+		return trash[i].ID < trash[j].ID
+	})
+}
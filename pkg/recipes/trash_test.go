@@ -0,0 +1,138 @@
+package recipes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Trash(t *testing.T) {
+	runStoreConformance(t, func(t *testing.T, factory storeFactory) {
+		testStoreTrash(t, factory)
+	})
+}
+
+func testStoreTrash(t *testing.T, factory storeFactory) {
+	deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	toastie := getHamCheeseToasties()
+	toastie.Version = 2
+
+	t.Run("Trash and untrash", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": toastie, "ratatouille": {Name: "ratatouille", Version: 1}})
+
+		assert.ErrorIs(t, store.MoveToTrash("toastie", 1, deletedAt), VersionMismatchErr)
+		assert.ErrorIs(t, store.MoveToTrash("soup", 1, deletedAt), NotFoundErr)
+		require.NoError(t, store.MoveToTrash("toastie", 2, deletedAt))
+
+		_, err := store.Get("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+		list, err := store.List()
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+		page, err := store.ListPage(ListOptions{})
+		require.NoError(t, err)
+		assert.Len(t, page.Recipes, 1)
+		_, err = store.Revisions("toastie")
+		assert.ErrorIs(t, err, NotFoundErr)
+		assert.ErrorIs(t, store.Update("toastie", toastie), NotFoundErr)
+		assert.ErrorIs(t, store.MoveToTrash("toastie", 2, deletedAt), NotFoundErr)
+
+		// O ID continua reservado
+		assert.ErrorIs(t, store.Add("toastie", toastie), ExistsErr)
+
+		trash, err := store.Trash()
+		require.NoError(t, err)
+		want := toastie
+		want.ID = "toastie"
+		assert.Equal(t, []TrashedRecipe{{Recipe: want, DeletedAt: deletedAt}}, trash)
+
+		require.NoError(t, store.Untrash("toastie"))
+		assert.ErrorIs(t, store.Untrash("toastie"), NotFoundErr)
+		got, err := store.Get("toastie")
+		require.NoError(t, err)
+		assert.Equal(t, toastie, got)
+		revisions, err := store.Revisions("toastie")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{
+			"a": {Name: "a", Version: 1},
+			"b": {Name: "b", Version: 1},
+			"c": {Name: "c", Version: 1},
+		})
+		require.NoError(t, store.MoveToTrash("a", 1, deletedAt))
+		require.NoError(t, store.MoveToTrash("b", 1, deletedAt.Add(time.Hour)))
+
+		purged, err := store.Purge(deletedAt)
+		require.NoError(t, err)
+		assert.Empty(t, purged)
+
+		purged, err = store.Purge(deletedAt.Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, purged)
+
+		trash, err := store.Trash()
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, "b", trash[0].ID)
+		assert.ErrorIs(t, store.Untrash("a"), NotFoundErr)
+
+		// O ID apagado fica livre, com um histórico novo
+		require.NoError(t, store.Add("a", Recipe{Name: "a", Version: 1}))
+		revisions, err := store.Revisions("a")
+		require.NoError(t, err)
+		assert.Len(t, revisions, 1)
+	})
+
+	t.Run("Remove also empties the trash", func(t *testing.T) {
+		store := newSeededStore(t, factory, map[string]Recipe{"toastie": toastie})
+		require.NoError(t, store.MoveToTrash("toastie", 2, deletedAt))
+		require.NoError(t, store.Remove("toastie"))
+
+		trash, err := store.Trash()
+		require.NoError(t, err)
+		assert.Empty(t, trash)
+		require.NoError(t, store.Add("toastie", toastie))
+	})
+}
+
+func TestFileStore_TrashSurvivesRestarts(t *testing.T) {
+	deletedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, compactEvery := range []int{0, 1} {
+		dir := t.TempDir()
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		store.CompactEvery = compactEvery
+
+		require.NoError(t, store.Add("a", Recipe{Name: "a", Version: 1}))
+		require.NoError(t, store.Add("b", Recipe{Name: "b", Version: 1}))
+		require.NoError(t, store.Add("c", Recipe{Name: "c", Version: 1}))
+		require.NoError(t, store.MoveToTrash("a", 1, deletedAt))
+		require.NoError(t, store.MoveToTrash("b", 1, deletedAt))
+		require.NoError(t, store.MoveToTrash("c", 1, deletedAt.Add(time.Hour)))
+		require.NoError(t, store.Untrash("b"))
+		_, err = store.Purge(deletedAt.Add(time.Minute))
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		store, err = NewFileStore(dir)
+		require.NoError(t, err)
+
+		list, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]Recipe{"b": {Name: "b", Version: 1}}, list, "compact every %d", compactEvery)
+		trash, err := store.Trash()
+		require.NoError(t, err)
+		require.Len(t, trash, 1)
+		assert.Equal(t, "c", trash[0].ID)
+		assert.Equal(t, deletedAt.Add(time.Hour), trash[0].DeletedAt)
+		_, err = store.Revisions("a")
+		assert.ErrorIs(t, err, NotFoundErr)
+		require.NoError(t, store.Close())
+	}
+}
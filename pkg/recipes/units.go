@@ -0,0 +1,252 @@
+package recipes
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gosimple/slug"
+)
+
+// Unidades canônicas gravadas em Ingredient.Unit. Os nomes em português e
+// inglês aceitos na entrada (singular, plural, abreviações) são convertidos
+// para uma delas por ParseUnit
+const (
+	UnitGram       = "g"
+	UnitKilogram   = "kg"
+	UnitMilligram  = "mg"
+	UnitMilliliter = "ml"
+	UnitLiter      = "l"
+	UnitTeaspoon   = "tsp"
+	UnitTablespoon = "tbsp"
+	UnitCup        = "cup"
+	UnitFluidOunce = "fl oz"
+	UnitOunce      = "oz"
+	UnitPound      = "lb"
+	UnitPinch      = "pinch"
+	UnitClove      = "clove"
+	UnitSlice      = "slice"
+	UnitCan        = "can"
+	UnitPackage    = "package"
+	UnitBunch      = "bunch"
+	UnitPiece      = "piece"
+)
+
+// unitAliases - todas as formas reconhecidas de cada unidade. A busca é
+// feita pelo slug, então maiúsculas, acentos e pontuação não importam
+// ("Xícaras", "xicaras" e "xícara(s)" são a mesma chave)
+var unitAliases = map[string][]string{
+	UnitGram:       {"g", "gr", "grama", "gramas", "gram", "grams"},
+	UnitKilogram:   {"kg", "quilo", "quilos", "kilo", "kilos", "quilograma", "quilogramas", "kilogram", "kilograms"},
+	UnitMilligram:  {"mg", "miligrama", "miligramas", "milligram", "milligrams"},
+	UnitMilliliter: {"ml", "mililitro", "mililitros", "milliliter", "milliliters", "millilitre", "millilitres"},
+	UnitLiter:      {"l", "lt", "litro", "litros", "liter", "liters", "litre", "litres"},
+	UnitTeaspoon: {
+		"tsp", "colher de cha", "colheres de cha", "colher (cha)", "colheres (cha)", "colher cha", "colheres cha",
+		"csc", "teaspoon", "teaspoons",
+	},
+	UnitTablespoon: {
+		"tbsp", "colher de sopa", "colheres de sopa", "colher (sopa)", "colheres (sopa)", "colher sopa", "colheres sopa",
+		"css", "tablespoon", "tablespoons",
+	},
+	UnitCup:        {"cup", "cups", "xicara", "xicaras", "xic", "xicara (cha)", "xicaras (cha)", "xicara de cha", "xicaras de cha"},
+	UnitFluidOunce: {"fl oz", "fluid ounce", "fluid ounces"},
+	UnitOunce:      {"oz", "ounce", "ounces", "onca", "oncas"},
+	UnitPound:      {"lb", "lbs", "pound", "pounds", "libra", "libras"},
+	UnitPinch:      {"pinch", "pinches", "pitada", "pitadas"},
+	UnitClove:      {"clove", "cloves", "dente", "dentes"},
+	UnitSlice:      {"slice", "slices", "fatia", "fatias"},
+	UnitCan:        {"can", "cans", "lata", "latas"},
+	UnitPackage:    {"package", "packages", "pack", "packs", "pacote", "pacotes", "embalagem", "embalagens"},
+	UnitBunch:      {"bunch", "bunches", "maco", "macos"},
+	UnitPiece:      {"piece", "pieces", "unidade", "unidades", "un", "pedaco", "pedacos"},
+}
+
+// unitsByAlias - índice reverso de unitAliases, pelo slug do alias
+var unitsByAlias = func() map[string]string {
+	index := make(map[string]string)
+	for unit, aliases := range unitAliases {
+		index[slug.Make(unit)] = unit
+		for _, alias := range aliases {
+			index[slug.Make(alias)] = unit
+		}
+	}
+	return index
+}()
+
+// maxUnitWords - maior número de palavras de um alias ("colheres de sopa")
+const maxUnitWords = 3
+
+// ParseUnit - converte qualquer forma reconhecida de uma unidade ("colheres
+// de sopa", "Tbsp", "xícara") na unidade canônica ("tbsp", "cup")
+func ParseUnit(s string) (string, bool) {
+	unit, ok := unitsByAlias[slug.Make(s)]
+	return unit, ok
+}
+
+// IsUnit - informa se s é uma das unidades canônicas
+func IsUnit(s string) bool {
+	_, ok := unitAliases[s]
+	return ok
+}
+
+// UnitSystem - sistema de medidas usado por ConvertUnits
+type UnitSystem string
+
+const (
+	Metric   UnitSystem = "metric"
+	Imperial UnitSystem = "imperial"
+)
+
+// ParseUnitSystem - "metric"/"métrico" ou "imperial"
+func ParseUnitSystem(s string) (UnitSystem, bool) {
+	switch slug.Make(s) {
+	case "metric", "metrico":
+		return Metric, true
+	case "imperial":
+		return Imperial, true
+	}
+	return "", false
+}
+
+// IncompatibleUnitsErr - não existe conversão entre as duas unidades, ou
+// ela depende de uma densidade que o ingrediente não tem
+var IncompatibleUnitsErr = errors.New("incompatible units")
+
+type dimension int
+
+const (
+	dimensionMass dimension = iota + 1
+	dimensionVolume
+)
+
+// unitFactor - dimensão da unidade e quanto ela vale em gramas (massa) ou
+// mililitros (volume). Unidades de contagem (fatia, dente, lata...) não têm
+// entrada e nunca são convertidas. Colheres e xícara seguem as medidas
+// americanas, que são as mesmas usadas no Brasil (xícara de 240 ml)
+var unitFactors = map[string]struct {
+	dimension dimension
+	factor    float64
+	system    UnitSystem
+}{
+	UnitMilligram:  {dimensionMass, 0.001, Metric},
+	UnitGram:       {dimensionMass, 1, Metric},
+	UnitKilogram:   {dimensionMass, 1000, Metric},
+	UnitOunce:      {dimensionMass, 28.349523125, Imperial},
+	UnitPound:      {dimensionMass, 453.59237, Imperial},
+	UnitMilliliter: {dimensionVolume, 1, Metric},
+	UnitLiter:      {dimensionVolume, 1000, Metric},
+	UnitTeaspoon:   {dimensionVolume, 4.92892159375, ""},
+	UnitTablespoon: {dimensionVolume, 14.78676478125, ""},
+	UnitFluidOunce: {dimensionVolume, 29.5735295625, Imperial},
+	UnitCup:        {dimensionVolume, 240, Imperial},
+}
+
+// Convert - converte quantity de uma unidade para outra. Entre massa e
+// volume usa a densidade do ingrediente (veja densities.go)
+func Convert(quantity float64, from, to, ingredient string) (float64, error) {
+	f, okFrom := unitFactors[from]
+	t, okTo := unitFactors[to]
+	if !okFrom || !okTo {
+		return 0, IncompatibleUnitsErr
+	}
+
+	base := quantity * f.factor
+	if f.dimension != t.dimension {
+		d, ok := densityOf(ingredient)
+		if !ok {
+			return 0, IncompatibleUnitsErr
+		}
+		if f.dimension == dimensionVolume {
+			base *= d.gramsPerML
+		} else {
+			base /= d.gramsPerML
+		}
+	}
+	return base / t.factor, nil
+}
+
+// ConvertTo - o ingrediente medido no sistema informado. No métrico, sólidos
+// com densidade conhecida passam a ser pesados (xícaras de farinha viram
+// gramas) e líquidos ficam em ml; no imperial, o que tem densidade volta a
+// ser medido em xícaras e colheres e o resto em onças e libras. Colheres,
+// unidades de contagem e ingredientes sem quantidade ficam como estão
+func (i Ingredient) ConvertTo(system UnitSystem) Ingredient {
+	f, ok := unitFactors[i.Unit]
+	if !ok || i.Quantity == 0 || f.system == "" || f.system == system {
+		return i
+	}
+
+	base := i.Quantity * f.factor
+	d, hasDensity := densityOf(i.Name)
+	switch {
+	case system == Metric && f.dimension == dimensionVolume && hasDensity && !d.liquid:
+		i.Quantity, i.Unit = metricMass(base * d.gramsPerML)
+	case system == Metric && f.dimension == dimensionVolume:
+		i.Quantity, i.Unit = metricVolume(base)
+	case system == Metric:
+		i.Quantity, i.Unit = metricMass(base)
+	case f.dimension == dimensionMass && hasDensity:
+		i.Quantity, i.Unit = imperialVolume(base / d.gramsPerML)
+	case f.dimension == dimensionMass:
+		i.Quantity, i.Unit = imperialMass(base)
+	default:
+		i.Quantity, i.Unit = imperialVolume(base)
+	}
+	i.Quantity = roundQuantity(i.Quantity)
+	return i
+}
+
+// ConvertUnits - cópia da receita com todos os ingredientes convertidos
+func (r Recipe) ConvertUnits(system UnitSystem) Recipe {
+	r = r.clone()
+	for i, ingredient := range r.Ingredients {
+		r.Ingredients[i] = ingredient.ConvertTo(system)
+	}
+	return r
+}
+
+func metricMass(grams float64) (float64, string) {
+	if grams >= 1000 {
+		return grams / 1000, UnitKilogram
+	}
+	return grams, UnitGram
+}
+
+func metricVolume(ml float64) (float64, string) {
+	if ml >= 1000 {
+		return ml / 1000, UnitLiter
+	}
+	return ml, UnitMilliliter
+}
+
+func imperialMass(grams float64) (float64, string) {
+	oz := grams / unitFactors[UnitOunce].factor
+	if oz >= 16 {
+		return grams / unitFactors[UnitPound].factor, UnitPound
+	}
+	return oz, UnitOunce
+}
+
+// imperialVolume - xícaras a partir de 1/4, depois colheres de sopa e chá
+func imperialVolume(ml float64) (float64, string) {
+	for _, unit := range []string{UnitCup, UnitTablespoon} {
+		factor := unitFactors[unit].factor
+		if unit == UnitCup && ml >= factor/4 || unit == UnitTablespoon && ml >= factor {
+			return ml / factor, unit
+		}
+	}
+	return ml / unitFactors[UnitTeaspoon].factor, UnitTeaspoon
+}
+
+// roundQuantity - arredonda conforme a grandeza: 236.59 -> 237,
+// 14.79 -> 14.8, 1.057 -> 1.06
+func roundQuantity(q float64) float64 {
+	switch {
+	case q >= 100:
+		return math.Round(q)
+	case q >= 10:
+		return math.Round(q*10) / 10
+	default:
+		return math.Round(q*100) / 100
+	}
+}
@@ -0,0 +1,142 @@
+package recipes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name       string
+		quantity   float64
+		from, to   string
+		ingredient string
+		want       float64
+		wantErr    bool
+	}{
+		{name: "Mass", quantity: 1, from: UnitPound, to: UnitGram, want: 453.59237},
+		{name: "Volume", quantity: 1, from: UnitTablespoon, to: UnitTeaspoon, want: 3},
+		{name: "Volume to mass", quantity: 1, from: UnitCup, to: UnitGram, ingredient: "farinha de trigo", want: 120},
+		{name: "Mass to volume", quantity: 240, from: UnitGram, to: UnitMilliliter, ingredient: "water", want: 240},
+		{name: "Unknown density", quantity: 1, from: UnitCup, to: UnitGram, ingredient: "alface", wantErr: true},
+		{name: "Count unit", quantity: 1, from: UnitClove, to: UnitGram, ingredient: "alho", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.quantity, tt.from, tt.to, tt.ingredient)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, IncompatibleUnitsErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 0.0001)
+		})
+	}
+}
+
+func TestIngredient_ConvertTo(t *testing.T) {
+	tests := []struct {
+		name       string
+		ingredient Ingredient
+		system     UnitSystem
+		want       Ingredient
+	}{
+		{
+			name:       "Cups of flour are weighed in metric",
+			ingredient: Ingredient{Name: "farinha de trigo", Quantity: 2, Unit: UnitCup},
+			system:     Metric,
+			want:       Ingredient{Name: "farinha de trigo", Quantity: 240, Unit: UnitGram},
+		},
+		{
+			name:       "Liquids stay in volume",
+			ingredient: Ingredient{Name: "leite", Quantity: 1, Unit: UnitCup},
+			system:     Metric,
+			want:       Ingredient{Name: "leite", Quantity: 240, Unit: UnitMilliliter},
+		},
+		{
+			name:       "Unknown density uses volume",
+			ingredient: Ingredient{Name: "caldo de legumes", Quantity: 5, Unit: UnitCup},
+			system:     Metric,
+			want:       Ingredient{Name: "caldo de legumes", Quantity: 1.2, Unit: UnitLiter},
+		},
+		{
+			name:       "Pounds to kilograms",
+			ingredient: Ingredient{Name: "ground beef", Quantity: 3, Unit: UnitPound},
+			system:     Metric,
+			want:       Ingredient{Name: "ground beef", Quantity: 1.36, Unit: UnitKilogram},
+		},
+		{
+			name:       "Grams of butter to cups",
+			ingredient: Ingredient{Name: "manteiga sem sal", Quantity: 115, Unit: UnitGram},
+			system:     Imperial,
+			want:       Ingredient{Name: "manteiga sem sal", Quantity: 0.5, Unit: UnitCup},
+		},
+		{
+			name:       "Grams without density to ounces",
+			ingredient: Ingredient{Name: "queijo", Quantity: 200, Unit: UnitGram},
+			system:     Imperial,
+			want:       Ingredient{Name: "queijo", Quantity: 7.05, Unit: UnitOunce},
+		},
+		{
+			name:       "Small volumes become spoons",
+			ingredient: Ingredient{Name: "baunilha", Quantity: 5, Unit: UnitMilliliter},
+			system:     Imperial,
+			want:       Ingredient{Name: "baunilha", Quantity: 1.01, Unit: UnitTeaspoon},
+		},
+		{
+			name:       "Spoons are kept",
+			ingredient: Ingredient{Name: "manteiga", Quantity: 2, Unit: UnitTablespoon},
+			system:     Metric,
+			want:       Ingredient{Name: "manteiga", Quantity: 2, Unit: UnitTablespoon},
+		},
+		{
+			name:       "Count units are kept",
+			ingredient: Ingredient{Name: "alho", Quantity: 3, Unit: UnitClove},
+			system:     Imperial,
+			want:       Ingredient{Name: "alho", Quantity: 3, Unit: UnitClove},
+		},
+		{
+			name:       "Already in the target system",
+			ingredient: Ingredient{Name: "farinha", Quantity: 500, Unit: UnitGram},
+			system:     Metric,
+			want:       Ingredient{Name: "farinha", Quantity: 500, Unit: UnitGram},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.ingredient.ConvertTo(tt.system))
+		})
+	}
+}
+
+func TestRecipe_Scale(t *testing.T) {
+	recipe := getStructuredToastie()
+
+	scaled, err := recipe.Scale(3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, scaled.Servings)
+	assert.Equal(t, []float64{3, 75, 2.25, 1.5}, quantities(scaled))
+
+	// A receita original não muda
+	assert.Equal(t, getStructuredToastie(), recipe)
+
+	_, err = Recipe{Name: "toastie", Ingredients: recipe.Ingredients}.Scale(3)
+	assert.ErrorIs(t, err, NoServingsErr)
+
+	for _, servings := range []int{0, -2} {
+		_, err = recipe.Scale(servings)
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr, "servings %d", servings)
+		assert.Equal(t, []FieldError{{Field: "servings", Message: "must be positive"}}, validationErr.Errors)
+	}
+}
+
+func quantities(r Recipe) []float64 {
+	q := make([]float64, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		q[i] = ingredient.Quantity
+	}
+	return q
+}
@@ -0,0 +1,219 @@
+package recipes
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gosimple/slug"
+)
+
+// Limites aplicados por Validate
+const (
+	MaxNameLength           = 200
+	MaxIngredientNameLength = 100
+	MaxIngredients          = 100
+	MaxNoteLength           = 200
+	MaxServings             = 1000
+	MaxSteps                = 100
+	MaxStepLength           = 2000
+	MaxYieldLength          = 100
+	MaxTags                 = 20
+	MaxTagLength            = 50
+)
+
+// reservedIDs - segmentos fixos de /receitas/ usados por outras rotas. Uma
+// receita com um destes IDs seria encoberta pela rota e nunca poderia ser
+// lida, alterada ou excluída pela URL do Location. Só vale onde o ID é
+// gerado a partir do nome, na criação e no rename
+var reservedIDs = map[string]bool{
+	"match":  true,
+	"search": true,
+	"trash":  true,
+	"facets": true,
+}
+
+// IsReservedID - o ID coincide com uma rota fixa de /receitas/
+func IsReservedID(id string) bool {
+	return reservedIDs[id]
+}
+
+// reservedPlanIDs - segmentos fixos de /planos/, pelo mesmo motivo de
+// reservedIDs
+var reservedPlanIDs = map[string]bool{
+	"generate": true,
+}
+
+// IsReservedPlanID - o ID coincide com uma rota fixa de /planos/
+func IsReservedPlanID(id string) bool {
+	return reservedPlanIDs[id]
+}
+
+// FieldError - Representa um problema em um campo específico da receita
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError - Agrupa todos os problemas encontrados em uma receita
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Add - registra um problema no campo informado
+func (e *ValidationError) Add(field, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: message})
+}
+
+// Err - devolve nil quando nenhum problema foi registrado, para que o
+// chamador possa fazer "return v.Err()"
+func (e *ValidationError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validate - confere as regras de uma receita antes de ela ser gravada e
+// devolve um *ValidationError com todos os campos inválidos, ou nil:
+//
+//   - o nome é obrigatório e precisa gerar um slug (o ID da receita)
+//   - nomes respeitam os tamanhos máximos e não têm caracteres de controle
+//   - a lista de ingredientes não pode ser vazia nem ter nomes repetidos
+//     (a comparação ignora maiúsculas e acentos, como o matcher)
+//   - quantidades não podem ser negativas e unidades precisam ser canônicas
+//   - cada passo tem texto e só cita ingredientes que estão na receita
+//   - o tempo ativo não passa do tempo total
+//   - tags não se repetem e precisam ter uma letra ou dígito
+func Validate(r Recipe) error {
+	v := &ValidationError{}
+
+	validateText(v, "name", r.Name, MaxNameLength)
+	if strings.TrimSpace(r.Name) != "" && slug.Make(r.Name) == "" {
+		v.Add("name", "must contain at least one letter or digit")
+	}
+
+	if r.Servings < 0 || r.Servings > MaxServings {
+		v.Add("servings", fmt.Sprintf("must be between 0 and %d", MaxServings))
+	}
+
+	switch {
+	case len(r.Ingredients) == 0:
+		v.Add("ingredients", "must have at least one ingredient")
+	case len(r.Ingredients) > MaxIngredients:
+		v.Add("ingredients", fmt.Sprintf("must have at most %d ingredients", MaxIngredients))
+	}
+
+	seen := make(map[string]int, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		prefix := fmt.Sprintf("ingredients[%d].", i)
+		if ingredient.Quantity < 0 || math.IsInf(ingredient.Quantity, 0) || math.IsNaN(ingredient.Quantity) {
+			v.Add(prefix+"quantity", "must not be negative")
+		}
+		if ingredient.Unit != "" && !IsUnit(ingredient.Unit) {
+			v.Add(prefix+"unit", "unknown unit")
+		}
+		if ingredient.Note != "" {
+			validateText(v, prefix+"note", ingredient.Note, MaxNoteLength)
+		}
+
+		field := prefix + "name"
+		if !validateText(v, field, ingredient.Name, MaxIngredientNameLength) {
+			continue
+		}
+
+		key := slug.Make(ingredient.Name)
+		if first, ok := seen[key]; ok {
+			v.Add(field, fmt.Sprintf("duplicates ingredients[%d]", first))
+			continue
+		}
+		seen[key] = i
+	}
+
+	if len(r.Steps) > MaxSteps {
+		v.Add("steps", fmt.Sprintf("must have at most %d steps", MaxSteps))
+	}
+	for i, step := range r.Steps {
+		prefix := fmt.Sprintf("steps[%d].", i)
+		validateText(v, prefix+"text", step.Text, MaxStepLength)
+		if step.Timer < 0 {
+			v.Add(prefix+"timer", "must not be negative")
+		}
+		for j, ref := range step.Ingredients {
+			if _, ok := seen[slug.Make(ref)]; !ok {
+				v.Add(fmt.Sprintf("%singredients[%d]", prefix, j), "does not match any ingredient")
+			}
+		}
+	}
+
+	if r.TotalTime < 0 {
+		v.Add("total_time", "must not be negative")
+	}
+	if r.ActiveTime < 0 {
+		v.Add("active_time", "must not be negative")
+	}
+	if r.TotalTime > 0 && r.ActiveTime > r.TotalTime {
+		v.Add("active_time", "must not exceed total_time")
+	}
+	if r.Yield != "" {
+		validateText(v, "yield", r.Yield, MaxYieldLength)
+	}
+	switch r.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		v.Add("difficulty", "must be one of easy, medium, hard")
+	}
+
+	if len(r.Tags) > MaxTags {
+		v.Add("tags", fmt.Sprintf("must have at most %d tags", MaxTags))
+	}
+	seenTags := make(map[string]int, len(r.Tags))
+	for i, tag := range r.Tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		if !validateText(v, field, tag, MaxTagLength) {
+			continue
+		}
+		key := TagKey(tag)
+		if key == "" {
+			v.Add(field, "must contain at least one letter or digit")
+			continue
+		}
+		if first, ok := seenTags[key]; ok {
+			v.Add(field, fmt.Sprintf("duplicates tags[%d]", first))
+			continue
+		}
+		seenTags[key] = i
+	}
+
+	return v.Err()
+}
+
+// validateText - regras comuns aos campos de texto. Retorna false quando o
+// campo tem algum problema
+func validateText(v *ValidationError, field, value string, maxLength int) bool {
+	if strings.TrimSpace(value) == "" {
+		v.Add(field, "is required")
+		return false
+	}
+
+	ok := true
+	if utf8.RuneCountInString(value) > maxLength {
+		v.Add(field, fmt.Sprintf("must be at most %d characters", maxLength))
+		ok = false
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		v.Add(field, "must not contain control characters")
+		ok = false
+	}
+	return ok
+}
@@ -0,0 +1,189 @@
+package recipes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		recipe Recipe
+		want   []FieldError
+	}{
+		{
+			name:   "Valid recipe",
+			recipe: getHamCheeseToasties(),
+			want:   nil,
+		},
+		{
+			name:   "Empty recipe",
+			recipe: Recipe{},
+			want: []FieldError{
+				{Field: "name", Message: "is required"},
+				{Field: "ingredients", Message: "must have at least one ingredient"},
+			},
+		},
+		{
+			name:   "Blank name",
+			recipe: Recipe{Name: "   ", Ingredients: []Ingredient{{Name: "pão"}}},
+			want:   []FieldError{{Field: "name", Message: "is required"}},
+		},
+		{
+			name:   "Name without letters or digits",
+			recipe: Recipe{Name: "!!!", Ingredients: []Ingredient{{Name: "pão"}}},
+			want:   []FieldError{{Field: "name", Message: "must contain at least one letter or digit"}},
+		},
+		{
+			name:   "Name too long",
+			recipe: Recipe{Name: strings.Repeat("a", MaxNameLength+1), Ingredients: []Ingredient{{Name: "pão"}}},
+			want:   []FieldError{{Field: "name", Message: "must be at most 200 characters"}},
+		},
+		{
+			name:   "Accented name at the limit",
+			recipe: Recipe{Name: strings.Repeat("ã", MaxNameLength), Ingredients: []Ingredient{{Name: "pão"}}},
+			want:   nil,
+		},
+		{
+			name:   "Control characters",
+			recipe: Recipe{Name: "Torrada\x00", Ingredients: []Ingredient{{Name: "pão\nqueijo"}}},
+			want: []FieldError{
+				{Field: "name", Message: "must not contain control characters"},
+				{Field: "ingredients[0].name", Message: "must not contain control characters"},
+			},
+		},
+		{
+			name: "Empty and too long ingredient names",
+			recipe: Recipe{Name: "Torrada", Ingredients: []Ingredient{
+				{Name: ""},
+				{Name: strings.Repeat("b", MaxIngredientNameLength+1)},
+			}},
+			want: []FieldError{
+				{Field: "ingredients[0].name", Message: "is required"},
+				{Field: "ingredients[1].name", Message: "must be at most 100 characters"},
+			},
+		},
+		{
+			name: "Duplicated ingredients ignore case and accents",
+			recipe: Recipe{Name: "Torrada", Ingredients: []Ingredient{
+				{Name: "pão"},
+				{Name: "queijo"},
+				{Name: "Pao"},
+				{Name: "QUEIJO"},
+			}},
+			want: []FieldError{
+				{Field: "ingredients[2].name", Message: "duplicates ingredients[0]"},
+				{Field: "ingredients[3].name", Message: "duplicates ingredients[1]"},
+			},
+		},
+		{
+			name: "Structured ingredients",
+			recipe: Recipe{Name: "Torrada", Ingredients: []Ingredient{
+				{Name: "pão", Quantity: 2, Unit: UnitSlice},
+				{Name: "manteiga", Quantity: 1, Unit: UnitTablespoon, Note: "em temperatura ambiente", Optional: true},
+			}},
+			want: nil,
+		},
+		{
+			name: "Negative quantity, unknown unit and control characters in note",
+			recipe: Recipe{Name: "Torrada", Ingredients: []Ingredient{
+				{Name: "pão", Quantity: -1, Unit: "punhado", Note: "fatiado\t"},
+			}},
+			want: []FieldError{
+				{Field: "ingredients[0].quantity", Message: "must not be negative"},
+				{Field: "ingredients[0].unit", Message: "unknown unit"},
+				{Field: "ingredients[0].note", Message: "must not contain control characters"},
+			},
+		},
+		{
+			name: "Steps, times and difficulty",
+			recipe: Recipe{
+				Name:        "Torrada",
+				Ingredients: []Ingredient{{Name: "Pão"}, {Name: "manteiga"}},
+				Steps: []Step{
+					{Text: "Passe a manteiga no pão", Ingredients: []string{"pao", "Manteiga"}},
+					{Text: "Toste", Timer: Duration(3 * time.Minute)},
+				},
+				TotalTime:  Duration(5 * time.Minute),
+				ActiveTime: Duration(2 * time.Minute),
+				Yield:      "2 torradas",
+				Difficulty: DifficultyEasy,
+			},
+			want: nil,
+		},
+		{
+			name: "Invalid steps, times and difficulty",
+			recipe: Recipe{
+				Name:        "Torrada",
+				Ingredients: []Ingredient{{Name: "pão"}},
+				Steps: []Step{
+					{Text: " ", Ingredients: []string{"pão", "queijo"}},
+					{Text: "Toste", Timer: -1},
+				},
+				TotalTime:  Duration(time.Minute),
+				ActiveTime: Duration(time.Hour),
+				Yield:      "duas\ttorradas",
+				Difficulty: "fácil",
+			},
+			want: []FieldError{
+				{Field: "steps[0].text", Message: "is required"},
+				{Field: "steps[0].ingredients[1]", Message: "does not match any ingredient"},
+				{Field: "steps[1].timer", Message: "must not be negative"},
+				{Field: "active_time", Message: "must not exceed total_time"},
+				{Field: "yield", Message: "must not contain control characters"},
+				{Field: "difficulty", Message: "must be one of easy, medium, hard"},
+			},
+		},
+		{
+			name:   "Negative total time",
+			recipe: Recipe{Name: "Torrada", Ingredients: []Ingredient{{Name: "pão"}}, TotalTime: -1},
+			want:   []FieldError{{Field: "total_time", Message: "must not be negative"}},
+		},
+		{
+			name: "Invalid tags",
+			recipe: Recipe{
+				Name:        "Torrada",
+				Ingredients: []Ingredient{{Name: "pão"}},
+				Tags:        []string{"Lanche", "", "#!", "lanche", strings.Repeat("a", MaxTagLength+1)},
+			},
+			want: []FieldError{
+				{Field: "tags[1]", Message: "is required"},
+				{Field: "tags[2]", Message: "must contain at least one letter or digit"},
+				{Field: "tags[3]", Message: "duplicates tags[0]"},
+				{Field: "tags[4]", Message: "must be at most 50 characters"},
+			},
+		},
+		{
+			name:   "Too many ingredients",
+			recipe: Recipe{Name: "Sopa de tudo", Ingredients: manyIngredients(MaxIngredients + 1)},
+			want:   []FieldError{{Field: "ingredients", Message: "must have at most 100 ingredients"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.recipe)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr), "got %v", err)
+			assert.Equal(t, tt.want, validationErr.Errors)
+		})
+	}
+}
+
+func manyIngredients(n int) []Ingredient {
+	ingredients := make([]Ingredient, n)
+	for i := range ingredients {
+		ingredients[i] = Ingredient{Name: fmt.Sprintf("ingrediente %d", i)}
+	}
+	return ingredients
+}